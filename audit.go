@@ -0,0 +1,80 @@
+package vercelblob
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync/atomic"
+)
+
+// AuthEvent records the outcome of obtaining a token for a request. It never
+// contains the token itself.
+type AuthEvent struct {
+	Operation Operation
+	Pathname  string
+	// TokenFingerprint is the first 16 hex characters of the SHA-256 of the
+	// token, or "" if no token was obtained.
+	TokenFingerprint string
+	// Provider is the type of the token provider, e.g.
+	// "*vercelblob.HTTPTokenProvider", or "env" for BLOB_READ_WRITE_TOKEN.
+	Provider string
+	// Err is the reason no token was obtained, or nil on success.
+	Err error
+}
+
+// authAudit holds the hook of WithAuthAudit and the number of panics it
+// recovered from.
+type authAudit struct {
+	fn     func(AuthEvent)
+	panics atomic.Uint64
+}
+
+// WithAuthAudit makes the client call fn every time a token is obtained for
+// a request, or fails to be. fn is called synchronously on the request path,
+// so it should be cheap, e.g. hand the event to a logger. A panic in fn is
+// recovered and counted in AuthAuditPanics; the request proceeds as if fn
+// had returned.
+func WithAuthAudit(fn func(AuthEvent)) ClientOption {
+	return func(c *Client) error {
+		if fn == nil {
+			return NewInvalidOptionError("WithAuthAudit", "the hook is nil")
+		}
+		c.authAudit = &authAudit{fn: fn}
+		return nil
+	}
+}
+
+// AuthAuditPanics returns the number of panics recovered from the hook of
+// WithAuthAudit.
+func (c *Client) AuthAuditPanics() uint64 {
+	if c.authAudit == nil {
+		return 0
+	}
+	return c.authAudit.panics.Load()
+}
+
+func (c *Client) auditAuth(operation Operation, pathname, token string, err error) {
+	if c.authAudit == nil || c.authAudit.fn == nil {
+		return
+	}
+	event := AuthEvent{Operation: operation, Pathname: pathname, Provider: "env", Err: err}
+	if c.tokenProvider != nil {
+		event.Provider = fmt.Sprintf("%T", c.tokenProvider)
+	}
+	if token != "" {
+		event.TokenFingerprint = tokenFingerprint(token)
+	}
+
+	defer func() {
+		if recover() != nil {
+			c.authAudit.panics.Add(1)
+		}
+	}()
+	c.authAudit.fn(event)
+}
+
+// tokenFingerprint identifies a token in logs without revealing it.
+func tokenFingerprint(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
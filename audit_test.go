@@ -0,0 +1,71 @@
+package vercelblob
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_WithAuthAudit_Mock(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.txt","pathname":"a.txt"}`))
+	}))
+	defer server.Close()
+
+	var events []AuthEvent
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider(testReadWriteToken)), WithAuthAudit(func(event AuthEvent) {
+		events = append(events, event)
+	}))
+	ctx := context.Background()
+
+	if _, err := client.Put(ctx, "a.txt", strings.NewReader("a"), PutCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	failing, err := client.Clone(WithTokenProvider(&countingTokenProvider{err: errTokenService}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := failing.Head(ctx, "a.txt"); !errors.Is(err, errTokenService) {
+		t.Errorf("Expected the provider error, got %v", err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+	put, head := events[0], events[1]
+	if put.Operation != OperationPut || put.Pathname != "a.txt" || put.Err != nil || put.Provider != "vercelblob.staticTokenProvider" {
+		t.Errorf("Unexpected put event: %+v", put)
+	}
+	if put.TokenFingerprint != tokenFingerprint(testReadWriteToken) || len(put.TokenFingerprint) != 16 {
+		t.Errorf("Expected the token fingerprint, got %q", put.TokenFingerprint)
+	}
+	if head.Operation != OperationHead || head.TokenFingerprint != "" || !errors.Is(head.Err, errTokenService) || head.Provider != "*vercelblob.countingTokenProvider" {
+		t.Errorf("Unexpected head event: %+v", head)
+	}
+	for _, event := range events {
+		if strings.Contains(event.TokenFingerprint+event.Pathname, testReadWriteToken) {
+			t.Errorf("Expected no raw token in %+v", event)
+		}
+	}
+}
+
+func Test_WithAuthAudit_Panic_Mock(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.txt","pathname":"a.txt"}`))
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider(testReadWriteToken)), WithAuthAudit(func(AuthEvent) { panic("audit sink down") }))
+
+	for range 2 {
+		if _, err := client.Put(context.Background(), "a.txt", strings.NewReader("a"), PutCommandOptions{}); err != nil {
+			t.Fatalf("Expected the request to succeed despite the panic, got %v", err)
+		}
+	}
+	if panics := client.AuthAuditPanics(); panics != 2 {
+		t.Errorf("Expected 2 recovered panics, got %d", panics)
+	}
+}
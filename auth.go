@@ -4,27 +4,333 @@ package vercelblob
 import (
 	"crypto/hmac"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"os"
+	"strings"
+	"sync"
 	"time"
 )
 
 // ... (existing code)
 
 // ClientTokenOptions is options for generating a client token.
+//
+// GenerateClientToken encodes every field except Operation and ExpiresAt,
+// which only apply to GenerateLegacyClientToken, into the token payload under
+// the names used by the official SDKs.
 type ClientTokenOptions struct {
-	// The operation to allow: "put", "delete", "list"
-	Operation string `json:"operation"`
+	// The operation to allow: "put", "delete", "list". Legacy format only.
+	Operation string `json:"operation,omitempty"`
 	// The pathname or URL to allow.
 	Pathname string `json:"pathname,omitempty"`
-	// The expiration time for the token.
+	// The expiration time for the token in Unix seconds. Legacy format only;
+	// GenerateClientToken converts it to ValidUntil.
 	ExpiresAt int64 `json:"expiresAt,omitempty"`
+	// The expiration time for the token in Unix milliseconds. Defaults to
+	// one hour from now.
+	ValidUntil int64 `json:"validUntil,omitempty"`
+	// The maximum size of the uploaded blob.
+	MaximumSizeInBytes int64 `json:"maximumSizeInBytes,omitempty"`
+	// The content types the uploaded blob may have, e.g. "image/*".
+	AllowedContentTypes []string `json:"allowedContentTypes,omitempty"`
+	// Add a random suffix to the pathname of the uploaded blob.
+	AddRandomSuffix bool `json:"addRandomSuffix,omitempty"`
+	// Replace an existing blob at the pathname.
+	AllowOverwrite bool `json:"allowOverwrite,omitempty"`
+	// Cache-Control max-age in seconds for the uploaded blob.
+	CacheControlMaxAge int64 `json:"cacheControlMaxAge,omitempty"`
+	// The webhook called by Vercel once the upload has completed.
+	OnUploadCompleted *OnUploadCompleted `json:"onUploadCompleted,omitempty"`
+}
+
+// OnUploadCompleted configures the webhook called once a client upload has completed.
+type OnUploadCompleted struct {
+	CallbackURL string `json:"callbackUrl"`
+	// An opaque value passed back to the webhook.
+	TokenPayload string `json:"tokenPayload,omitempty"`
 }
 
+// clientTokenPrefix is the prefix of client tokens in the Vercel format.
+const clientTokenPrefix = "vercel_blob_client_"
+
 // GenerateClientToken generates a token that can be used by a client (e.g. browser)
 // to perform an operation on the blob store.
+//
+// The token has the same format as the tokens of the official SDKs, so it can
+// be handed to the upload() helper of @vercel/blob:
+//
+//	vercel_blob_client_<storeId>_<base64(signature "." base64(payload))>
+//
+// where the store ID is read from the read-write token, the payload is the
+// JSON encoding of options, and the signature is the hex HMAC-SHA256 of the
+// base64 payload keyed by the read-write token.
 func GenerateClientToken(token string, options ClientTokenOptions) (string, error) {
+	return GenerateClientTokenAt(token, options, time.Now())
+}
+
+// GenerateClientTokenAt is like GenerateClientToken, but a token without a
+// ValidUntil or ExpiresAt expires an hour after now rather than an hour after
+// the current time, for callers with a clock of their own.
+func GenerateClientTokenAt(token string, options ClientTokenOptions, now time.Time) (string, error) {
+	storeID, err := storeIDFromToken(token)
+	if err != nil {
+		return "", err
+	}
+
+	if options.ValidUntil == 0 {
+		if options.ExpiresAt != 0 {
+			options.ValidUntil = options.ExpiresAt * 1000
+		} else {
+			options.ValidUntil = now.Add(time.Hour).UnixMilli()
+		}
+	}
+	options.Operation = ""
+	options.ExpiresAt = 0
+
+	payload, err := json.Marshal(options)
+	if err != nil {
+		return "", err
+	}
+	encodedPayload := base64.StdEncoding.EncodeToString(payload)
+
+	h := hmac.New(sha256.New, []byte(token))
+	h.Write([]byte(encodedPayload))
+	signature := hex.EncodeToString(h.Sum(nil))
+
+	return clientTokenPrefix + storeID + "_" + base64.StdEncoding.EncodeToString([]byte(signature+"."+encodedPayload)), nil
+}
+
+// UploadConstraints restricts the upload allowed by a token from
+// GenerateUploadToken.
+type UploadConstraints struct {
+	// The maximum size of the uploaded blob. Zero leaves the size to the
+	// limits of the store.
+	MaximumSizeInBytes int64
+	// The content types the uploaded blob may have, e.g. "image/*". Empty
+	// allows any content type.
+	AllowedContentTypes []string
+	// The time after which the token is rejected. Defaults to one hour from now.
+	ExpiresAt time.Time
+	// Replace an existing blob at the pathname.
+	AllowOverwrite bool
+}
+
+// GenerateUploadToken generates a client token that allows a single upload to
+// exactly pathname, for handing to a client that uploads directly to the blob
+// store without proxying the bytes through your server.
+//
+// The token is a GenerateClientToken token without a random suffix, so the
+// blob ends up at pathname. Once ExpiresAt has passed it is rejected by the
+// API and by VerifyClientToken. Go clients upload with it using
+// Client.UploadWithClientToken.
+func GenerateUploadToken(rwToken, pathname string, constraints UploadConstraints) (string, error) {
+	if pathname == "" {
+		return "", InvalidInputError("pathname")
+	}
+	options := ClientTokenOptions{
+		Pathname:            pathname,
+		MaximumSizeInBytes:  constraints.MaximumSizeInBytes,
+		AllowedContentTypes: constraints.AllowedContentTypes,
+		AllowOverwrite:      constraints.AllowOverwrite,
+	}
+	if !constraints.ExpiresAt.IsZero() {
+		options.ValidUntil = constraints.ExpiresAt.UnixMilli()
+	}
+	return GenerateClientToken(rwToken, options)
+}
+
+// clientTokenClockSkew is how long past its expiry a client token is still
+// accepted, to allow for clock differences between machines.
+const clientTokenClockSkew = 30 * time.Second
+
+// Versions of the client token format. A payload may carry its version in a
+// "v" field; tokens without one are of the current version, which is the
+// format of the official SDKs. Tokens in the hex(payload).signature format of
+// GenerateLegacyClientToken are of the previous version.
+const (
+	legacyClientTokenVersion  = 0
+	currentClientTokenVersion = 1
+)
+
+// VerifyClientToken checks that clientToken was generated by GenerateClientToken
+// or GenerateLegacyClientToken with the read-write token rwToken and has not
+// expired, and returns its options.
+//
+// It returns ErrMalformedClientToken if the token cannot be parsed,
+// ErrUnsupportedClientTokenVersion if it is of a newer format,
+// ErrInvalidClientTokenSignature if it was not signed with rwToken, and
+// ErrClientTokenExpired if it is past its ValidUntil.
+func VerifyClientToken(rwToken, clientToken string) (*ClientTokenOptions, error) {
+	return VerifyClientTokenWithKeys([]string{rwToken}, clientToken)
+}
+
+// VerifyClientTokenWithKeys is like VerifyClientToken but accepts a token
+// signed with any of rwTokens, so that tokens issued before a key rotation
+// stay valid until they expire. List the current read-write token first.
+// Malformed entries are skipped; ErrInvalidReadWriteToken is returned only if
+// no entry is well-formed and none verifies the token.
+func VerifyClientTokenWithKeys(rwTokens []string, clientToken string) (*ClientTokenOptions, error) {
+	return VerifyClientTokenAt(rwTokens, clientToken, time.Now())
+}
+
+// VerifyClientTokenAt is like VerifyClientTokenWithKeys, but checks the
+// expiry of the token against now rather than the current time, for callers
+// with a clock of their own.
+func VerifyClientTokenAt(rwTokens []string, clientToken string, now time.Time) (*ClientTokenOptions, error) {
+	parsed, err := parseClientToken(clientToken)
+	if err != nil {
+		return nil, err
+	}
+
+	verified, malformed := false, 0
+	for _, rwToken := range rwTokens {
+		ok, err := parsed.verify(rwToken)
+		if err != nil {
+			// A bad entry in a rotation list does not block the others.
+			malformed++
+			continue
+		}
+		if ok {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		if malformed > 0 && malformed == len(rwTokens) {
+			return nil, ErrInvalidReadWriteToken
+		}
+		return nil, ErrInvalidClientTokenSignature
+	}
+
+	if now.Add(-clientTokenClockSkew).UnixMilli() > parsed.options.ValidUntil {
+		return nil, ErrClientTokenExpired
+	}
+	return parsed.options, nil
+}
+
+// DecodeClientToken returns the options encoded in a client token without
+// verifying its signature or expiry. It is meant for diagnostics; use
+// VerifyClientToken before trusting a token.
+func DecodeClientToken(clientToken string) (*ClientTokenOptions, error) {
+	parsed, err := parseClientToken(clientToken)
+	if err != nil {
+		return nil, err
+	}
+	return parsed.options, nil
+}
+
+// TokenInfo returns the expiry, operation and pathname of a client token
+// from GenerateClientToken or GenerateLegacyClientToken, without verifying
+// its signature. The operation is only set for legacy tokens. It returns
+// ErrMalformedClientToken for anything else, including read-write tokens,
+// which do not expire.
+func TokenInfo(token string) (expiresAt time.Time, operation string, pathname string, err error) {
+	parsed, err := parseClientToken(token)
+	if err != nil {
+		return time.Time{}, "", "", err
+	}
+	options := parsed.options
+	return time.UnixMilli(options.ValidUntil), options.Operation, options.Pathname, nil
+}
+
+// parsedClientToken holds the parts of a client token.
+type parsedClientToken struct {
+	version   int
+	storeID   string
+	signature string
+	// signed is the data covered by the signature.
+	signed  []byte
+	options *ClientTokenOptions
+}
+
+// verify reports whether the token was signed with rwToken.
+func (p *parsedClientToken) verify(rwToken string) (bool, error) {
+	h := hmac.New(sha256.New, []byte(rwToken))
+	h.Write(p.signed)
+	expected := hex.EncodeToString(h.Sum(nil))
+	if p.version == legacyClientTokenVersion {
+		return hmac.Equal([]byte(expected), []byte(p.signature)), nil
+	}
+
+	storeID, err := storeIDFromToken(rwToken)
+	if err != nil {
+		return false, err
+	}
+	return hmac.Equal([]byte(expected), []byte(p.signature)) && p.storeID == storeID, nil
+}
+
+func parseClientToken(clientToken string) (*parsedClientToken, error) {
+	rest, ok := strings.CutPrefix(clientToken, clientTokenPrefix)
+	if !ok {
+		return parseLegacyClientToken(clientToken)
+	}
+	storeID, encoded, ok := strings.Cut(rest, "_")
+	if !ok || storeID == "" {
+		return nil, ErrMalformedClientToken
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrMalformedClientToken
+	}
+	signature, encodedPayload, ok := strings.Cut(string(decoded), ".")
+	if !ok {
+		return nil, ErrMalformedClientToken
+	}
+	payload, err := base64.StdEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, ErrMalformedClientToken
+	}
+	var options ClientTokenOptions
+	if err := json.Unmarshal(payload, &options); err != nil {
+		return nil, ErrMalformedClientToken
+	}
+	var version struct {
+		V *int `json:"v"`
+	}
+	_ = json.Unmarshal(payload, &version)
+	if version.V != nil && *version.V != currentClientTokenVersion {
+		return nil, ErrUnsupportedClientTokenVersion
+	}
+	return &parsedClientToken{
+		version:   currentClientTokenVersion,
+		storeID:   storeID,
+		signature: signature,
+		signed:    []byte(encodedPayload),
+		options:   &options,
+	}, nil
+}
+
+// parseLegacyClientToken parses a token from GenerateLegacyClientToken. Its
+// expiry is converted to ValidUntil.
+func parseLegacyClientToken(clientToken string) (*parsedClientToken, error) {
+	encodedPayload, signature, ok := strings.Cut(clientToken, ".")
+	if !ok {
+		return nil, ErrMalformedClientToken
+	}
+	payload, err := hex.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, ErrMalformedClientToken
+	}
+	var options ClientTokenOptions
+	if err := json.Unmarshal(payload, &options); err != nil {
+		return nil, ErrMalformedClientToken
+	}
+	options.ValidUntil = options.ExpiresAt * 1000
+	return &parsedClientToken{
+		version:   legacyClientTokenVersion,
+		signature: signature,
+		signed:    payload,
+		options:   &options,
+	}, nil
+}
+
+// GenerateLegacyClientToken generates a client token in the hex(payload).signature
+// format produced by earlier versions of this package.
+//
+// Deprecated: The Vercel platform does not accept these tokens. Use GenerateClientToken.
+func GenerateLegacyClientToken(token string, options ClientTokenOptions) (string, error) {
 	if options.ExpiresAt == 0 {
 		options.ExpiresAt = time.Now().Add(time.Hour).Unix()
 	}
@@ -41,6 +347,43 @@ func GenerateClientToken(token string, options ClientTokenOptions) (string, erro
 	return hex.EncodeToString(payload) + "." + signature, nil
 }
 
+// readWriteTokenPrefix is the prefix of read-write tokens.
+const readWriteTokenPrefix = "vercel_blob_rw_"
+
+// storeIDFromToken extracts the store ID from a read-write token of the form
+// vercel_blob_rw_<storeId>_<secret>, or from a client token.
+func storeIDFromToken(token string) (string, error) {
+	rest, ok := strings.CutPrefix(token, readWriteTokenPrefix)
+	if !ok {
+		rest, ok = strings.CutPrefix(token, clientTokenPrefix)
+	}
+	storeID, secret, found := strings.Cut(rest, "_")
+	if !ok || !found || storeID == "" || secret == "" {
+		return "", ErrInvalidReadWriteToken
+	}
+	return storeID, nil
+}
+
+// Operation identifies the kind of request a token is requested for. Its value
+// is passed to TokenProvider.GetToken as the operation string.
+type Operation string
+
+// Operations passed to TokenProvider.GetToken.
+const (
+	OperationList     Operation = "list"
+	OperationPut      Operation = "put"
+	OperationHead     Operation = "head"
+	OperationDownload Operation = "download"
+	OperationDelete   Operation = "delete"
+	OperationCopy     Operation = "copy"
+	// The three steps of a multipart upload, used by Put for large bodies,
+	// and the abort of an upload that failed.
+	OperationMultipartCreate   Operation = "multipart-create"
+	OperationMultipartPart     Operation = "multipart-part"
+	OperationMultipartComplete Operation = "multipart-complete"
+	OperationMultipartAbort    Operation = "multipart-abort"
+)
+
 // TokenProvider is a trait for providing a token to authenticate with the Vercel Blob Storage API.
 //
 // If your code is running inside a Vercel function then you will not need this.
@@ -52,7 +395,10 @@ func GenerateClientToken(token string, options ClientTokenOptions) (string, erro
 //
 // The operation (e.g. list, put, download) and pathname (e.g. foo/bar.txt) are
 // provided in case fine-grained authorization is required.  For operations that
-// use the full URL (download / del) the pathname will be the URL.
+// use the full URL (download / del) the pathname will be the URL; for list it
+// is the prefix being listed.  The operation
+// is always one of the Operation constants; copies and the steps of multipart
+// uploads have their own values so they can be told apart from a plain put.
 type TokenProvider interface {
 	GetToken(operation string, pathname string) (string, error)
 }
@@ -69,30 +415,118 @@ func GetToken(provider TokenProvider, operation, pathname string) (string, error
 	return token, nil
 }
 
+// staticTokenProvider is a token provider that always returns the same token.
+type staticTokenProvider string
+
+// StaticTokenProvider returns a token provider that always returns token, for
+// scripts and tests that have a token at hand. Unlike setting
+// BLOB_READ_WRITE_TOKEN, it does not touch process-global state.
+func StaticTokenProvider(token string) TokenProvider {
+	return staticTokenProvider(token)
+}
+
+// GetToken returns the static token.
+func (p staticTokenProvider) GetToken(_, _ string) (string, error) {
+	if p == "" {
+		return "", ErrNotAuthenticated
+	}
+	return string(p), nil
+}
+
+// defaultTokenEnvVar is the environment variable holding the read-write token.
+const defaultTokenEnvVar = "BLOB_READ_WRITE_TOKEN"
+
 // EnvTokenProvider is a token provider that reads the token from an environment variable.
 //
+// The variable is read on every request, so a rotated token is picked up
+// without rebuilding the provider. The zero value reads BLOB_READ_WRITE_TOKEN.
+//
 // This is useful for testing but should not be used for real applications.
 type EnvTokenProvider struct {
-	token string
+	envVar   string
+	fallback bool
+	cacheTTL time.Duration
+	clock    func() time.Time
+
+	mu       sync.Mutex
+	cached   string
+	cachedAt time.Time
 }
 
-// GetToken returns the token from the provider or the BLOB_READ_WRITE_TOKEN environment variable.
-func (p *EnvTokenProvider) GetToken(_, _ string) (string, error) {
-	if p.token != "" {
-		return p.token, nil
+// EnvTokenProviderOption configures an EnvTokenProvider.
+type EnvTokenProviderOption func(*EnvTokenProvider)
+
+// WithDefaultTokenFallback makes the provider fall back to
+// BLOB_READ_WRITE_TOKEN when its own variable is unset or empty.
+func WithDefaultTokenFallback() EnvTokenProviderOption {
+	return func(p *EnvTokenProvider) {
+		p.fallback = true
+	}
+}
+
+// WithEnvCache makes the provider reuse a token it read for ttl instead of
+// reading the variable on every request.
+func WithEnvCache(ttl time.Duration) EnvTokenProviderOption {
+	return func(p *EnvTokenProvider) {
+		p.cacheTTL = ttl
 	}
-	envToken := os.Getenv("BLOB_READ_WRITE_TOKEN")
-	if envToken != "" {
-		return envToken, nil
+}
+
+// WithEnvClock sets the clock the cache of WithEnvCache reads the time from.
+// Defaults to time.Now.
+func WithEnvClock(now func() time.Time) EnvTokenProviderOption {
+	return func(p *EnvTokenProvider) {
+		p.clock = now
 	}
-	return "", ErrNotAuthenticated
 }
 
-// NewEnvTokenProvider creates a new EnvTokenProvider that reads the token from the given environment variable.
-func NewEnvTokenProvider(envVar string) (*EnvTokenProvider, error) {
-	token, exists := os.LookupEnv(envVar)
-	if !exists {
-		return nil, ErrNotAuthenticated
+// NewEnvTokenProvider creates a new EnvTokenProvider that reads the token from
+// the given environment variable. The variable does not need to be set yet.
+// It returns an invalid_input error if envVar is empty.
+func NewEnvTokenProvider(envVar string, opts ...EnvTokenProviderOption) (*EnvTokenProvider, error) {
+	if envVar == "" {
+		return nil, InvalidInputError("envVar")
 	}
-	return &EnvTokenProvider{token}, nil
+	p := &EnvTokenProvider{envVar: envVar}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p, nil
+}
+
+// now returns the time of the clock of the provider.
+func (p *EnvTokenProvider) now() time.Time {
+	if p.clock != nil {
+		return p.clock()
+	}
+	return time.Now()
+}
+
+// GetToken returns the token from the configured environment variable, or from
+// BLOB_READ_WRITE_TOKEN if the fallback is enabled.
+func (p *EnvTokenProvider) GetToken(_, _ string) (string, error) {
+	if p.cacheTTL > 0 {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.cached != "" && p.now().Sub(p.cachedAt) < p.cacheTTL {
+			return p.cached, nil
+		}
+	}
+
+	envVar := p.envVar
+	if envVar == "" {
+		envVar = defaultTokenEnvVar
+	}
+	token := os.Getenv(envVar)
+	if token == "" && p.fallback {
+		token = os.Getenv(defaultTokenEnvVar)
+	}
+	if token == "" {
+		return "", ErrNotAuthenticated
+	}
+
+	if p.cacheTTL > 0 {
+		p.cached, p.cachedAt = token, p.now()
+	}
+	return token, nil
 }
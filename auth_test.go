@@ -0,0 +1,335 @@
+package vercelblob
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testReadWriteToken = "vercel_blob_rw_storeid123_secretvalue"
+
+func Test_GenerateClientToken_Golden(t *testing.T) {
+	// Signed the way @vercel/blob's generateClientTokenFromReadWriteToken
+	// signs: hex HMAC-SHA256 of the base64 payload, keyed by the RW token.
+	const golden = "vercel_blob_client_storeid123_MzI3NmYxOWVjZTUwYWIyNjBmM2MwZTY0NzM5NGUwYjM1ODQ4NzQ2MTU5M2MxM2IxZGQ1OTdiMDQ2ZjY2ODA2NS5leUp3WVhSb2JtRnRaU0k2SW5Wd2JHOWhaSE12WVM1MGVIUWlMQ0oyWVd4cFpGVnVkR2xzSWpveE56QXdNREF3TURBd01EQXdMQ0p0WVhocGJYVnRVMmw2WlVsdVFubDBaWE1pT2pFd05EZzFOellzSW1Gc2JHOTNaV1JEYjI1MFpXNTBWSGx3WlhNaU9sc2lhVzFoWjJVdmNHNW5JbDE5"
+
+	token, err := GenerateClientToken(testReadWriteToken, ClientTokenOptions{
+		Pathname:            "uploads/a.txt",
+		ValidUntil:          1700000000000,
+		MaximumSizeInBytes:  1048576,
+		AllowedContentTypes: []string{"image/png"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != golden {
+		t.Errorf("Expected %s, got %s", golden, token)
+	}
+}
+
+func Test_GenerateClientToken_Defaults(t *testing.T) {
+	before := time.Now().Add(time.Hour).UnixMilli()
+	token, err := GenerateClientToken(testReadWriteToken, ClientTokenOptions{Pathname: "a.txt", Operation: "put"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(token, "vercel_blob_client_storeid123_") {
+		t.Fatalf("Unexpected token prefix: %s", token)
+	}
+
+	decoded, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(token, "vercel_blob_client_storeid123_"))
+	_, encodedPayload, _ := strings.Cut(string(decoded), ".")
+	payload, _ := base64.StdEncoding.DecodeString(encodedPayload)
+	var fields map[string]any
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fields["operation"]; ok {
+		t.Errorf("Expected operation to be omitted, got %v", fields)
+	}
+	if validUntil := int64(fields["validUntil"].(float64)); validUntil < before || validUntil > before+int64(time.Minute/time.Millisecond) {
+		t.Errorf("Expected validUntil one hour from now, got %d", validUntil)
+	}
+}
+
+func Test_GenerateClientToken_InvalidToken(t *testing.T) {
+	for _, token := range []string{"", "secret", "vercel_blob_rw__secret", "vercel_blob_rw_store", "other_blob_rw_store_secret", "prefix_vercel_blob_rw_store_secret"} {
+		if _, err := GenerateClientToken(token, ClientTokenOptions{}); !errors.Is(err, ErrInvalidReadWriteToken) {
+			t.Errorf("Expected ErrInvalidReadWriteToken for %q, got %v", token, err)
+		}
+	}
+}
+
+func Test_VerifyClientToken(t *testing.T) {
+	valid, _ := GenerateClientToken(testReadWriteToken, ClientTokenOptions{Pathname: "a.txt"})
+	withinSkew, _ := GenerateClientToken(testReadWriteToken, ClientTokenOptions{Pathname: "a.txt", ValidUntil: time.Now().Add(-time.Second).UnixMilli()})
+	expired, _ := GenerateClientToken(testReadWriteToken, ClientTokenOptions{Pathname: "a.txt", ValidUntil: time.Now().Add(-time.Hour).UnixMilli()})
+	otherKey, _ := GenerateClientToken("vercel_blob_rw_storeid123_othersecret", ClientTokenOptions{Pathname: "a.txt"})
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{name: "valid", token: valid},
+		{name: "within clock skew", token: withinSkew},
+		{name: "expired", token: expired, wantErr: ErrClientTokenExpired},
+		{name: "wrong key", token: otherKey, wantErr: ErrInvalidClientTokenSignature},
+		{name: "wrong prefix", token: "vercel_blob_rw_storeid123_secretvalue", wantErr: ErrMalformedClientToken},
+		{name: "not base64", token: "vercel_blob_client_storeid123_!!!", wantErr: ErrMalformedClientToken},
+		{name: "no signature", token: "vercel_blob_client_storeid123_" + base64.StdEncoding.EncodeToString([]byte("abc")), wantErr: ErrMalformedClientToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options, err := VerifyClientToken(testReadWriteToken, tt.token)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if options.Pathname != "a.txt" {
+				t.Errorf("Expected pathname a.txt, got %s", options.Pathname)
+			}
+		})
+	}
+}
+
+func Test_GenerateUploadToken(t *testing.T) {
+	expiresAt := time.Now().Add(10 * time.Minute).Truncate(time.Millisecond)
+	token, err := GenerateUploadToken(testReadWriteToken, "uploads/a.png", UploadConstraints{
+		MaximumSizeInBytes:  1024,
+		AllowedContentTypes: []string{"image/png"},
+		ExpiresAt:           expiresAt,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	options, err := VerifyClientToken(testReadWriteToken, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.Pathname != "uploads/a.png" || options.AddRandomSuffix || options.MaximumSizeInBytes != 1024 ||
+		len(options.AllowedContentTypes) != 1 || options.ValidUntil != expiresAt.UnixMilli() {
+		t.Errorf("Unexpected options: %+v", options)
+	}
+
+	expired, _ := GenerateUploadToken(testReadWriteToken, "uploads/a.png", UploadConstraints{ExpiresAt: time.Now().Add(-time.Minute)})
+	if _, err := VerifyClientToken(testReadWriteToken, expired); !errors.Is(err, ErrClientTokenExpired) {
+		t.Errorf("Expected ErrClientTokenExpired, got %v", err)
+	}
+	if _, err := GenerateUploadToken(testReadWriteToken, "", UploadConstraints{}); err == nil {
+		t.Error("Expected an error for an empty pathname")
+	}
+}
+
+// fakeClock is a clock for WithClock and the clock options of the token
+// providers that only moves when advanced.
+type fakeClock struct {
+	mu      sync.Mutex
+	current time.Time
+}
+
+func newFakeClock(start time.Time) *fakeClock {
+	return &fakeClock{current: start}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.current
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.current = c.current.Add(d)
+}
+
+func Test_ClientToken_ExpiryBoundary(t *testing.T) {
+	start := time.UnixMilli(1700000000000)
+	clock := newFakeClock(start)
+
+	token, err := GenerateClientTokenAt(testReadWriteToken, ClientTokenOptions{Pathname: "a.txt"}, clock.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	options, _ := DecodeClientToken(token)
+	if want := start.Add(time.Hour).UnixMilli(); options.ValidUntil != want {
+		t.Errorf("Expected validUntil %d, got %d", want, options.ValidUntil)
+	}
+
+	expiresNow, _ := GenerateClientToken(testReadWriteToken, ClientTokenOptions{Pathname: "a.txt", ValidUntil: start.UnixMilli()})
+	tests := []struct {
+		name    string
+		advance time.Duration
+		wantErr error
+	}{
+		{name: "expires exactly now", advance: 0},
+		{name: "end of clock skew", advance: clientTokenClockSkew},
+		{name: "past clock skew", advance: time.Millisecond, wantErr: ErrClientTokenExpired},
+	}
+	for _, tt := range tests {
+		clock.Advance(tt.advance)
+		if _, err := VerifyClientTokenAt([]string{testReadWriteToken}, expiresNow, clock.Now()); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
+
+// signClientToken builds a client token for an arbitrary payload.
+func signClientToken(rwToken string, payload string) string {
+	encodedPayload := base64.StdEncoding.EncodeToString([]byte(payload))
+	h := hmac.New(sha256.New, []byte(rwToken))
+	h.Write([]byte(encodedPayload))
+	signature := hex.EncodeToString(h.Sum(nil))
+	return "vercel_blob_client_storeid123_" + base64.StdEncoding.EncodeToString([]byte(signature+"."+encodedPayload))
+}
+
+func Test_VerifyClientToken_Versions(t *testing.T) {
+	validUntil := time.Now().Add(time.Hour)
+	current, _ := GenerateClientToken(testReadWriteToken, ClientTokenOptions{Pathname: "a.txt", ValidUntil: validUntil.UnixMilli()})
+	legacy, _ := GenerateLegacyClientToken(testReadWriteToken, ClientTokenOptions{Pathname: "a.txt", ExpiresAt: validUntil.Unix()})
+	explicit := signClientToken(testReadWriteToken, `{"v":1,"pathname":"a.txt","validUntil":`+strconv.FormatInt(validUntil.UnixMilli(), 10)+`}`)
+	newer := signClientToken(testReadWriteToken, `{"v":2,"pathname":"a.txt"}`)
+	legacyExpired, _ := GenerateLegacyClientToken(testReadWriteToken, ClientTokenOptions{Pathname: "a.txt", ExpiresAt: time.Now().Add(-time.Hour).Unix()})
+	legacyOtherKey, _ := GenerateLegacyClientToken("vercel_blob_rw_storeid123_othersecret", ClientTokenOptions{Pathname: "a.txt"})
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{name: "current", token: current},
+		{name: "explicit current version", token: explicit},
+		{name: "legacy", token: legacy},
+		{name: "newer version", token: newer, wantErr: ErrUnsupportedClientTokenVersion},
+		{name: "legacy expired", token: legacyExpired, wantErr: ErrClientTokenExpired},
+		{name: "legacy wrong key", token: legacyOtherKey, wantErr: ErrInvalidClientTokenSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options, err := VerifyClientToken(testReadWriteToken, tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && (options.Pathname != "a.txt" || options.ValidUntil/1000 != validUntil.Unix()) {
+				t.Errorf("Unexpected options: %+v", options)
+			}
+		})
+	}
+}
+
+func Test_VerifyClientTokenWithKeys(t *testing.T) {
+	const oldKey = "vercel_blob_rw_storeid123_oldsecret"
+	const otherStore = "vercel_blob_rw_otherstore_secretvalue"
+	fromOldKey, _ := GenerateClientToken(oldKey, ClientTokenOptions{Pathname: "a.txt"})
+	fromNewKey, _ := GenerateClientToken(testReadWriteToken, ClientTokenOptions{Pathname: "a.txt"})
+	legacyFromOldKey, _ := GenerateLegacyClientToken(oldKey, ClientTokenOptions{Pathname: "a.txt"})
+
+	keys := []string{testReadWriteToken, oldKey}
+	for _, token := range []string{fromOldKey, fromNewKey, legacyFromOldKey} {
+		if _, err := VerifyClientTokenWithKeys(keys, token); err != nil {
+			t.Errorf("Expected the token to verify with a rotated key, got %v", err)
+		}
+	}
+	if _, err := VerifyClientTokenWithKeys([]string{testReadWriteToken}, fromOldKey); !errors.Is(err, ErrInvalidClientTokenSignature) {
+		t.Errorf("Expected ErrInvalidClientTokenSignature once the old key is retired, got %v", err)
+	}
+	if _, err := VerifyClientTokenWithKeys([]string{otherStore}, fromNewKey); !errors.Is(err, ErrInvalidClientTokenSignature) {
+		t.Errorf("Expected ErrInvalidClientTokenSignature for another store, got %v", err)
+	}
+	if _, err := VerifyClientTokenWithKeys(nil, fromNewKey); !errors.Is(err, ErrInvalidClientTokenSignature) {
+		t.Errorf("Expected ErrInvalidClientTokenSignature without keys, got %v", err)
+	}
+
+	// A malformed key does not keep the keys after it from being tried.
+	if _, err := VerifyClientTokenWithKeys([]string{"not a token", testReadWriteToken, oldKey}, fromOldKey); err != nil {
+		t.Errorf("Expected the token to verify past a malformed key, got %v", err)
+	}
+	if _, err := VerifyClientTokenWithKeys([]string{"not a token", otherStore}, fromNewKey); !errors.Is(err, ErrInvalidClientTokenSignature) {
+		t.Errorf("Expected ErrInvalidClientTokenSignature when no key verifies, got %v", err)
+	}
+	if _, err := VerifyClientTokenWithKeys([]string{"not a token", "storeid123_secret"}, fromNewKey); !errors.Is(err, ErrInvalidReadWriteToken) {
+		t.Errorf("Expected ErrInvalidReadWriteToken when every key is malformed, got %v", err)
+	}
+}
+
+func Test_DecodeClientToken(t *testing.T) {
+	expired, _ := GenerateClientToken(testReadWriteToken, ClientTokenOptions{Pathname: "a.txt", ValidUntil: 1})
+	options, err := DecodeClientToken(expired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.Pathname != "a.txt" || options.ValidUntil != 1 {
+		t.Errorf("Unexpected options: %+v", options)
+	}
+	if _, err := DecodeClientToken("garbage"); !errors.Is(err, ErrMalformedClientToken) {
+		t.Errorf("Expected ErrMalformedClientToken, got %v", err)
+	}
+}
+
+func Test_EnvTokenProvider(t *testing.T) {
+	t.Setenv("BLOB_READ_WRITE_TOKEN", "default-token")
+	t.Setenv("BLOB_TOKEN_CUSTOM", "")
+
+	// Unset at construction, set later.
+	provider, err := NewEnvTokenProvider("BLOB_TOKEN_CUSTOM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.GetToken("put", "a.txt"); !errors.Is(err, ErrNotAuthenticated) {
+		t.Errorf("Expected ErrNotAuthenticated without fallback, got %v", err)
+	}
+	t.Setenv("BLOB_TOKEN_CUSTOM", "first")
+	if token, _ := provider.GetToken("put", "a.txt"); token != "first" {
+		t.Errorf("Expected first, got %s", token)
+	}
+
+	// Rotation.
+	t.Setenv("BLOB_TOKEN_CUSTOM", "second")
+	if token, _ := provider.GetToken("put", "a.txt"); token != "second" {
+		t.Errorf("Expected the rotated token, got %s", token)
+	}
+
+	// Fallback toggle.
+	t.Setenv("BLOB_TOKEN_CUSTOM", "")
+	withFallback, _ := NewEnvTokenProvider("BLOB_TOKEN_CUSTOM", WithDefaultTokenFallback())
+	if token, _ := withFallback.GetToken("put", "a.txt"); token != "default-token" {
+		t.Errorf("Expected the fallback token, got %s", token)
+	}
+	if token, _ := (&EnvTokenProvider{}).GetToken("put", "a.txt"); token != "default-token" {
+		t.Errorf("Expected the zero value to read BLOB_READ_WRITE_TOKEN, got %s", token)
+	}
+
+	if _, err := NewEnvTokenProvider(""); err == nil {
+		t.Error("Expected an error for an empty variable name")
+	}
+}
+
+func Test_EnvTokenProvider_Cache(t *testing.T) {
+	clock := newFakeClock(time.Unix(1700000000, 0))
+	t.Setenv("BLOB_TOKEN_CUSTOM", "first")
+	provider, _ := NewEnvTokenProvider("BLOB_TOKEN_CUSTOM", WithEnvCache(time.Minute), WithEnvClock(clock.Now))
+
+	_, _ = provider.GetToken("put", "a.txt")
+	t.Setenv("BLOB_TOKEN_CUSTOM", "second")
+	if token, _ := provider.GetToken("put", "a.txt"); token != "first" {
+		t.Errorf("Expected the cached token, got %s", token)
+	}
+	clock.Advance(time.Minute)
+	if token, _ := provider.GetToken("put", "a.txt"); token != "second" {
+		t.Errorf("Expected the rotated token after the cache TTL, got %s", token)
+	}
+}
@@ -0,0 +1,72 @@
+package vercelblob
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Backoff computes the delay before a retry of WithRetry. A Retry-After
+// header sent with a 429 or 503 response takes precedence over it.
+//
+// Implementations must be safe for concurrent use, as one policy serves every
+// request of a client. A backoff keeping state between retries, such as
+// decorrelated jitter, can derive it from attempt:
+//
+//	type decorrelated struct{ base, max time.Duration }
+//
+//	func (b decorrelated) Next(attempt int, cause error) time.Duration {
+//		d := b.base
+//		for range attempt {
+//			d = min(b.max, b.base+rand.N(3*d-b.base))
+//		}
+//		return d
+//	}
+type Backoff interface {
+	// Next returns the delay after attempt, starting at 1, failed with
+	// cause. Negative delays are treated as zero.
+	Next(attempt int, cause error) time.Duration
+}
+
+// Exponential is a Backoff that waits Base after the first attempt and
+// doubles the delay after each further one, up to Max if it is positive.
+type Exponential struct {
+	Base, Max time.Duration
+}
+
+func (b Exponential) Next(attempt int, cause error) time.Duration {
+	d := b.Base
+	for i := 1; i < attempt && (b.Max <= 0 || d < b.Max); i++ {
+		d *= 2
+	}
+	if b.Max > 0 && d > b.Max {
+		d = b.Max
+	}
+	return d
+}
+
+// ExponentialWithJitter is an Exponential backoff of which the fraction
+// Jitter, between 0 and 1, is randomized so that clients failing together do
+// not retry together. It is the backoff of a RetryPolicy without one.
+type ExponentialWithJitter struct {
+	Base, Max time.Duration
+	Jitter    float64
+}
+
+func (b ExponentialWithJitter) Next(attempt int, cause error) time.Duration {
+	return b.next(attempt, cause, rand.Float64)
+}
+
+// next is Next with the jitter drawn from random.
+func (b ExponentialWithJitter) next(attempt int, cause error, random func() float64) time.Duration {
+	d := Exponential{Base: b.Base, Max: b.Max}.Next(attempt, cause)
+	return d - time.Duration(b.Jitter*random()*float64(d))
+}
+
+// Constant is a Backoff that always waits Delay.
+type Constant struct {
+	Delay time.Duration
+}
+
+func (b Constant) Next(attempt int, cause error) time.Duration {
+	return b.Delay
+}
@@ -0,0 +1,86 @@
+package vercelblob
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_Backoff(t *testing.T) {
+	exponential := Exponential{Base: 100 * time.Millisecond, Max: time.Second}
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for i, w := range want {
+		if d := exponential.Next(i+1, nil); d != w {
+			t.Errorf("Expected a delay of %v after attempt %d, got %v", w, i+1, d)
+		}
+	}
+	if d := (Exponential{Base: time.Millisecond}).Next(20, nil); d != time.Millisecond<<19 {
+		t.Errorf("Expected an uncapped delay, got %v", d)
+	}
+	jittered := ExponentialWithJitter{Base: 100 * time.Millisecond, Max: time.Second, Jitter: 0.5}
+	for range 100 {
+		if d := jittered.Next(2, nil); d < 100*time.Millisecond || d > 200*time.Millisecond {
+			t.Fatalf("Expected a jittered delay between 100ms and 200ms, got %v", d)
+		}
+	}
+	if d := (Constant{Delay: time.Second}).Next(7, ErrServiceUnavailable); d != time.Second {
+		t.Errorf("Expected a constant delay, got %v", d)
+	}
+}
+
+// backoffFunc adapts a function to the Backoff interface.
+type backoffFunc func(attempt int, cause error) time.Duration
+
+func (f backoffFunc) Next(attempt int, cause error) time.Duration { return f(attempt, cause) }
+
+func Test_RetryPolicy_Backoff_Mock(t *testing.T) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch requests.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 3:
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			_, _ = w.Write([]byte(`{"url":"https://blob.com/a.txt","pathname":"a.txt"}`))
+		}
+	}))
+	defer server.Close()
+
+	var calls []string
+	var retries []RetryAttempt
+	client := newTestClient(t,
+		WithBaseURL(server.URL),
+		WithTokenProvider(StaticTokenProvider("token")),
+		WithRetry(RetryPolicy{
+			MaxAttempts:   4,
+			BaseDelay:     time.Hour,
+			MaxRetryAfter: time.Millisecond,
+			Backoff: backoffFunc(func(attempt int, cause error) time.Duration {
+				calls = append(calls, CodeOf(cause))
+				return -time.Duration(attempt)
+			}),
+			OnRetry: func(r RetryAttempt) { retries = append(retries, r) },
+		}),
+	)
+
+	if _, err := client.Put(context.Background(), "a.txt", strings.NewReader("a"), PutCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	// The backoff replaces BaseDelay and is consulted for every retry, but a
+	// Retry-After header overrides it.
+	if strings.Join(calls, ",") != "unknown_error,rate_limited,rate_limited" {
+		t.Errorf("Expected the backoff to see each cause, got %v", calls)
+	}
+	if len(retries) != 3 || retries[0].Delay != 0 || retries[1].Delay != 0 || retries[2].Delay != time.Millisecond {
+		t.Errorf("Unexpected retries: %+v", retries)
+	}
+}
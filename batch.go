@@ -0,0 +1,72 @@
+package vercelblob
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// BatchError reports the items of a batch operation that failed, such as
+// the blobs of a prefix operation or the stores of StoreRegistry.Delete.
+// errors.Is and errors.As match it against the error of any of its items.
+type BatchError struct {
+	// Errors maps each item that failed, such as a pathname, to its error.
+	Errors map[string]error
+	// Total is the number of items in the batch, or 0 if unknown.
+	Total int
+}
+
+// newBatchError returns a *BatchError for errs, or nil if errs is empty.
+func newBatchError(errs map[string]error, total int) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return &BatchError{Errors: errs, Total: total}
+}
+
+// Items returns the items that failed in sorted order.
+func (e *BatchError) Items() []string {
+	items := make([]string, 0, len(e.Errors))
+	for item := range e.Errors {
+		items = append(items, item)
+	}
+	slices.Sort(items)
+	return items
+}
+
+// Err returns the error of item, or nil if it did not fail.
+func (e *BatchError) Err(item string) error {
+	return e.Errors[item]
+}
+
+// Error summarizes the failures with their count and the first of them.
+func (e *BatchError) Error() string {
+	items := e.Items()
+	if len(items) == 0 {
+		return "batch failed"
+	}
+	var b strings.Builder
+	switch {
+	case e.Total > 0:
+		fmt.Fprintf(&b, "%d of %d items failed", len(items), e.Total)
+	case len(items) == 1:
+		b.WriteString("1 item failed")
+	default:
+		fmt.Fprintf(&b, "%d items failed", len(items))
+	}
+	fmt.Fprintf(&b, ", first %s: %v", items[0], e.Errors[items[0]])
+	if len(items) > 1 {
+		fmt.Fprintf(&b, " (and %d more)", len(items)-1)
+	}
+	return b.String()
+}
+
+// Unwrap returns the errors of the items that failed, in the order of Items.
+func (e *BatchError) Unwrap() []error {
+	items := e.Items()
+	errs := make([]error, len(items))
+	for i, item := range items {
+		errs[i] = e.Errors[item]
+	}
+	return errs
+}
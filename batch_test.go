@@ -0,0 +1,45 @@
+package vercelblob
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func Test_BatchError(t *testing.T) {
+	errs := map[string]error{}
+	for i := range 100 {
+		errs[fmt.Sprintf("uploads/%03d.txt", i)] = fmt.Errorf("delete: %w", ErrForbidden)
+	}
+	errs["uploads/050.txt"] = ErrBlobNotFound
+	err := newBatchError(errs, 250)
+
+	want := "100 of 250 items failed, first uploads/000.txt: delete: " + ErrForbidden.Msg + " (and 99 more)"
+	if err.Error() != want {
+		t.Errorf("Expected %q, got %q", want, err.Error())
+	}
+	if !errors.Is(err, ErrBlobNotFound) || !errors.Is(err, ErrForbidden) || errors.Is(err, ErrStoreNotFound) {
+		t.Errorf("Expected the batch to match the errors of its items, got %v", err)
+	}
+	if !IsNotFound(fmt.Errorf("wrapped: %w", err)) {
+		t.Error("Expected the predicates to see through a wrapped batch")
+	}
+
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("Expected a *BatchError, got %v", err)
+	}
+	if batchErr.Err("uploads/050.txt") != ErrBlobNotFound || batchErr.Err("uploads/missing.txt") != nil {
+		t.Error("Unexpected per-item errors")
+	}
+	if items, unwrapped := batchErr.Items(), batchErr.Unwrap(); len(items) != 100 || items[50] != "uploads/050.txt" || unwrapped[50] != ErrBlobNotFound {
+		t.Errorf("Expected Items and Unwrap to share the sorted order, got %v", items[:3])
+	}
+
+	if err := newBatchError(map[string]error{}, 3); err != nil {
+		t.Errorf("Expected no error for an empty batch, got %v", err)
+	}
+	if err := newBatchError(map[string]error{"a": ErrForbidden}, 0); err.Error() != "1 item failed, first a: "+ErrForbidden.Msg {
+		t.Errorf("Unexpected message %q", err.Error())
+	}
+}
@@ -0,0 +1,238 @@
+package vercelblob
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BlobHandlerOptions contains options for NewBlobHandler.
+type BlobHandlerOptions struct {
+	// StripPrefix is removed from the path of each request, e.g. "/files/"
+	// for a handler mounted there. Requests outside it are not found.
+	StripPrefix string
+	// Prefix is put before the rest of the path to make the pathname of the
+	// blob, e.g. "uploads/".
+	Prefix string
+	// Rewrite, if set, maps the pathname made from the request to the
+	// pathname of the blob served, e.g. to keep users to their own folder.
+	// Returning false answers the request with 404 Not Found.
+	Rewrite func(r *http.Request, pathname string) (string, bool)
+	// CacheControl, if set, replaces the Cache-Control of the blobs, e.g.
+	// "private, no-store" for blobs served to authenticated users.
+	CacheControl string
+}
+
+// NewBlobHandler returns an http.Handler serving the blobs of client, to
+// front them with a route of your own, e.g. behind authentication. The path
+// of each request is mapped to a pathname as options say.
+//
+// The metadata of the blob, from Head, sets the Content-Type,
+// Content-Disposition, Cache-Control, ETag and Last-Modified headers and
+// answers If-None-Match and If-Modified-Since with 304 Not Modified. HEAD
+// requests are answered from it alone. GET requests stream the content
+// without buffering it; a single range of a Range header is requested as
+// is and answered with 206 Partial Content, unless If-Range says the blob
+// changed. Missing blobs are answered with 404 Not Found and failures of
+// the store with 502 Bad Gateway.
+func NewBlobHandler(client *Client, options BlobHandlerOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		pathname, ok := blobHandlerPathname(r, options)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		head, err := client.Head(r.Context(), pathname)
+		if err != nil {
+			writeBlobHandlerError(w, r, err)
+			return
+		}
+		header := w.Header()
+		if head.ETag != "" {
+			header.Set("ETag", head.ETag)
+		}
+		if head.UploadedAtKnown {
+			header.Set("Last-Modified", head.UploadedAt.UTC().Format(http.TimeFormat))
+		}
+		if cacheControl := cmp.Or(options.CacheControl, head.CacheControl); cacheControl != "" {
+			header.Set("Cache-Control", cacheControl)
+		}
+		if notModified(r, head) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if head.ContentType != "" {
+			header.Set("Content-Type", head.ContentType)
+		}
+		if head.ContentDisposition != "" {
+			header.Set("Content-Disposition", head.ContentDisposition)
+		}
+		header.Set("Accept-Ranges", "bytes")
+
+		if r.Method == http.MethodHead {
+			header.Set("Content-Length", strconv.FormatUint(head.Size, 10))
+			return
+		}
+		var byteRange *Range
+		if r.Header.Get("Range") != "" && ifRangeMatches(r, head) {
+			if byteRange, err = parseRangeHeader(r.Header.Get("Range"), head.Size); err != nil {
+				header.Set("Content-Range", fmt.Sprintf("bytes */%d", head.Size))
+				http.Error(w, http.StatusText(http.StatusRequestedRangeNotSatisfiable), http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+		}
+
+		resp, err := client.download(r.Context(), head.URL, DownloadCommandOptions{ByteRange: byteRange})
+		if err != nil {
+			writeBlobHandlerError(w, r, err)
+			return
+		}
+		defer func() { _ = resp.Body.Close() }()
+		status := http.StatusOK
+		if byteRange != nil {
+			if resp.StatusCode != http.StatusPartialContent {
+				http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+				return
+			}
+			status = http.StatusPartialContent
+			header.Set("Content-Range", cmp.Or(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-%d/%d", byteRange.Start, byteRange.End, head.Size)))
+		}
+		if resp.ContentLength >= 0 {
+			header.Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+		}
+		w.WriteHeader(status)
+		// The status is sent, so a body breaking off can only end the
+		// response short of its Content-Length.
+		_, _ = io.Copy(w, resp.Body)
+	})
+}
+
+// blobHandlerPathname returns the pathname of the blob a request of a
+// NewBlobHandler is for, or false if it addresses none.
+func blobHandlerPathname(r *http.Request, options BlobHandlerOptions) (string, bool) {
+	rest, ok := strings.CutPrefix(r.URL.Path, options.StripPrefix)
+	if !ok {
+		return "", false
+	}
+	pathname := options.Prefix + strings.TrimPrefix(rest, "/")
+	if options.Rewrite != nil {
+		if pathname, ok = options.Rewrite(r, pathname); !ok {
+			return "", false
+		}
+	}
+	return pathname, ValidatePathname(pathname) == nil
+}
+
+// writeBlobHandlerError answers a request of a NewBlobHandler that failed
+// with err.
+func writeBlobHandlerError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case r.Context().Err() != nil:
+		// The client is gone.
+	case errors.Is(err, ErrBlobNotFound):
+		http.NotFound(w, r)
+	default:
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+	}
+}
+
+// notModified reports whether the conditional headers of r are satisfied by
+// the blob of head, so that it is answered with 304 Not Modified. Like in
+// RFC 9110, If-Modified-Since is ignored when If-None-Match is set.
+func notModified(r *http.Request, head *HeadBlobResult) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		return head.ETag != "" && etagListMatches(match, head.ETag, false)
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && head.UploadedAtKnown && !head.UploadedAt.Truncate(time.Second).After(since)
+}
+
+// ifRangeMatches reports whether the Range header of r applies: without
+// If-Range, or when If-Range names the current version of the blob of head
+// by its ETag or its exact Last-Modified date.
+func ifRangeMatches(r *http.Request, head *HeadBlobResult) bool {
+	ifRange := r.Header.Get("If-Range")
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		return head.ETag != "" && etagListMatches(ifRange, head.ETag, true)
+	}
+	date, err := http.ParseTime(ifRange)
+	return err == nil && head.UploadedAtKnown && head.UploadedAt.Truncate(time.Second).Equal(date)
+}
+
+// etagListMatches reports whether the comma-separated list of ETags of a
+// conditional header matches etag, comparing weak ETags as equal to strong
+// ones unless strong is set.
+func etagListMatches(list, etag string, strong bool) bool {
+	if strong && strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	for candidate := range strings.SplitSeq(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		switch {
+		case candidate == "*" && !strong:
+			return true
+		case strong && strings.HasPrefix(candidate, "W/"):
+			continue
+		case strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/"):
+			return true
+		}
+	}
+	return false
+}
+
+// errRangeNotSatisfiable is returned by parseRangeHeader for a range outside
+// the blob.
+var errRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// parseRangeHeader returns the range of a Range header for a blob of size
+// bytes, or nil if the whole blob is to be served: for headers that are
+// malformed or ask for several ranges, which a server may ignore.
+func parseRangeHeader(header string, size uint64) (*Range, error) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return nil, nil
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return nil, nil
+	}
+	if first == "" {
+		// The last bytes of the blob.
+		n, err := strconv.ParseUint(last, 10, 64)
+		if err != nil {
+			return nil, nil
+		}
+		if n == 0 || size == 0 {
+			return nil, errRangeNotSatisfiable
+		}
+		return &Range{Start: uint(size - min(n, size)), End: uint(size - 1)}, nil
+	}
+	start, err := strconv.ParseUint(first, 10, 64)
+	if err != nil {
+		return nil, nil
+	}
+	end := size - 1
+	if last != "" {
+		if end, err = strconv.ParseUint(last, 10, 64); err != nil || end < start {
+			return nil, nil
+		}
+	}
+	if start >= size {
+		return nil, errRangeNotSatisfiable
+	}
+	return &Range{Start: uint(start), End: uint(min(end, size-1))}, nil
+}
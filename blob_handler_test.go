@@ -0,0 +1,147 @@
+package vercelblob
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/claywarren/vercel_blob/blobtest"
+)
+
+func Test_BlobHandler(t *testing.T) {
+	server := blobtest.NewServer()
+	defer server.Close()
+	blob := server.Seed("docs/a.txt", []byte("hello world"), "text/plain")
+	server.Seed("private/b.txt", []byte("b"), "")
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")), WithNoEnv())
+	handler := NewBlobHandler(client, BlobHandlerOptions{
+		StripPrefix: "/files/",
+		Prefix:      "docs/",
+		Rewrite: func(r *http.Request, pathname string) (string, bool) {
+			return pathname, !strings.HasSuffix(pathname, ".secret")
+		},
+	})
+	lastModified := blob.UploadedAt.Format(http.TimeFormat)
+	serve := func(method, target string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(http.MethodGet, "/files/a.txt", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "hello world" {
+		t.Fatalf("Expected the blob, got %d %q", w.Code, w.Body)
+	}
+	for name, want := range map[string]string{
+		"Content-Type":        "text/plain",
+		"Content-Disposition": `inline; filename="a.txt"`,
+		"Cache-Control":       "public, max-age=2592000",
+		"Content-Length":      "11",
+		"ETag":                blob.ETag(),
+		"Last-Modified":       lastModified,
+		"Accept-Ranges":       "bytes",
+	} {
+		if got := w.Header().Get(name); got != want {
+			t.Errorf("Expected %s %q, got %q", name, want, got)
+		}
+	}
+
+	ranges := []struct {
+		header       http.Header
+		status       int
+		body         string
+		contentRange string
+	}{
+		{http.Header{"Range": {"bytes=6-10"}}, http.StatusPartialContent, "world", "bytes 6-10/11"},
+		{http.Header{"Range": {"bytes=6-"}}, http.StatusPartialContent, "world", "bytes 6-10/11"},
+		{http.Header{"Range": {"bytes=-5"}}, http.StatusPartialContent, "world", "bytes 6-10/11"},
+		{http.Header{"Range": {"bytes=0-100"}}, http.StatusPartialContent, "hello world", "bytes 0-10/11"},
+		{http.Header{"Range": {"bytes=0-1,3-4"}}, http.StatusOK, "hello world", ""},
+		{http.Header{"Range": {"bytes=6-10"}, "If-Range": {blob.ETag()}}, http.StatusPartialContent, "world", "bytes 6-10/11"},
+		{http.Header{"Range": {"bytes=6-10"}, "If-Range": {lastModified}}, http.StatusPartialContent, "world", "bytes 6-10/11"},
+		{http.Header{"Range": {"bytes=6-10"}, "If-Range": {`"stale"`}}, http.StatusOK, "hello world", ""},
+		{http.Header{"Range": {"bytes=100-"}}, http.StatusRequestedRangeNotSatisfiable, "", "bytes */11"},
+	}
+	for _, tt := range ranges {
+		w := serve(http.MethodGet, "/files/a.txt", tt.header)
+		if w.Code != tt.status || w.Header().Get("Content-Range") != tt.contentRange || tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("Expected %d %q %q for %v, got %d %q %q", tt.status, tt.contentRange, tt.body, tt.header, w.Code, w.Header().Get("Content-Range"), w.Body)
+		}
+	}
+
+	conditionals := []struct {
+		header http.Header
+		status int
+	}{
+		{http.Header{"If-None-Match": {blob.ETag()}}, http.StatusNotModified},
+		{http.Header{"If-None-Match": {`"other", W/` + blob.ETag()}}, http.StatusNotModified},
+		{http.Header{"If-None-Match": {"*"}}, http.StatusNotModified},
+		{http.Header{"If-None-Match": {`"other"`}}, http.StatusOK},
+		{http.Header{"If-Modified-Since": {lastModified}}, http.StatusNotModified},
+		{http.Header{"If-Modified-Since": {blob.UploadedAt.Add(-time.Hour).Format(http.TimeFormat)}}, http.StatusOK},
+		// If-None-Match takes precedence.
+		{http.Header{"If-None-Match": {`"other"`}, "If-Modified-Since": {lastModified}}, http.StatusOK},
+	}
+	for _, tt := range conditionals {
+		w := serve(http.MethodGet, "/files/a.txt", tt.header)
+		if w.Code != tt.status {
+			t.Errorf("Expected %d for %v, got %d", tt.status, tt.header, w.Code)
+		}
+		if w.Code == http.StatusNotModified && (w.Body.Len() != 0 || w.Header().Get("ETag") != blob.ETag() || w.Header().Get("Content-Type") != "") {
+			t.Errorf("Unexpected 304 response %v %q", w.Header(), w.Body)
+		}
+	}
+
+	for _, target := range []string{"/files/missing.txt", "/other/a.txt", "/files/a.secret", "/files/x/../../private/b.txt", "/files/"} {
+		if w := serve(http.MethodGet, target, nil); w.Code != http.StatusNotFound {
+			t.Errorf("Expected 404 for %s, got %d", target, w.Code)
+		}
+	}
+	if w := serve(http.MethodPost, "/files/a.txt", nil); w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "GET, HEAD" {
+		t.Errorf("Expected 405, got %d %v", w.Code, w.Header())
+	}
+}
+
+func Test_BlobHandler_Head(t *testing.T) {
+	server := blobtest.NewServer()
+	defer server.Close()
+	server.Seed("a.txt", []byte("hello world"), "text/plain")
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")), WithNoEnv())
+	handler := NewBlobHandler(client, BlobHandlerOptions{CacheControl: "private, no-store"})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/a.txt", nil))
+	if w.Code != http.StatusOK || w.Body.Len() != 0 || w.Header().Get("Content-Length") != "11" || w.Header().Get("Content-Type") != "text/plain" {
+		t.Errorf("Unexpected HEAD response %d %v %q", w.Code, w.Header(), w.Body)
+	}
+	if w.Header().Get("Cache-Control") != "private, no-store" {
+		t.Errorf("Expected the Cache-Control of the options, got %q", w.Header().Get("Cache-Control"))
+	}
+	if log := server.RequestLog(blobtest.Matcher{Operation: blobtest.OperationDownload}); len(log) != 0 {
+		t.Errorf("Expected no download, got %+v", log)
+	}
+}
+
+func Test_BlobHandler_StoreFailure(t *testing.T) {
+	server := blobtest.NewServer()
+	defer server.Close()
+	server.Seed("a.txt", []byte("hello world"), "text/plain")
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")), WithNoEnv())
+	handler := NewBlobHandler(client, BlobHandlerOptions{})
+
+	for _, m := range []blobtest.Matcher{{Operation: blobtest.OperationHead}, {Operation: blobtest.OperationDownload}} {
+		server.ClearScript()
+		server.Fail(m, "service_unavailable", 0)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/a.txt", nil))
+		if w.Code != http.StatusBadGateway {
+			t.Errorf("Expected 502 when the %s fails, got %d", m.Operation, w.Code)
+		}
+	}
+}
@@ -0,0 +1,620 @@
+// Package blobtest provides an in-memory fake of the Vercel Blob API for
+// tests of code using vercelblob.Client, so that they do not have to mimic
+// the API with handlers of their own:
+//
+//	server := blobtest.NewServer()
+//	defer server.Close()
+//	server.Seed("docs/a.txt", []byte("hello"), "text/plain")
+//
+//	client, err := vercelblob.NewClientWithOptions(
+//		vercelblob.WithBaseURL(server.URL),
+//		vercelblob.WithTokenProvider(vercelblob.StaticTokenProvider("token")),
+//	)
+//
+// The server implements puts, including multipart uploads, heads, lists with
+// prefixes, cursors and the folded mode, deletes, copies with fromUrl, and
+// downloads with ranges. Blobs are served by the server itself, at the URLs
+// returned by BlobURL. Failures are reported with the error codes of the
+// API, such as not_found, blob_already_exists, bad_request and forbidden.
+//
+// Tests can script behaviors of the API that are hard to trigger: Fail
+// makes matching requests fail with an error code, such as a 429 with a
+// Retry-After header on the second part of a multipart upload, Delay slows
+// them down and ExpireCursors breaks the listings in progress. RequestLog
+// returns the requests received, with their outcome, for assertions:
+//
+//	server.Fail(blobtest.Matcher{Operation: blobtest.OperationPut}, "store_suspended", 3)
+package blobtest
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheControlMaxAge is the max-age in seconds of blobs put without
+// one, one month like the API.
+const DefaultCacheControlMaxAge = 30 * 24 * 60 * 60
+
+// defaultListLimit is the number of blobs of a list page when the request
+// sets no limit.
+const defaultListLimit = 1000
+
+// Blob is a blob stored by a Server.
+type Blob struct {
+	Pathname           string
+	Content            []byte
+	ContentType        string
+	CacheControlMaxAge uint64
+	UploadedAt         time.Time
+}
+
+// ETag returns the ETag the server reports for the blob.
+func (b Blob) ETag() string {
+	sum := sha256.Sum256(b.Content)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// Server is a fake of the Vercel Blob API backed by memory. It is safe for
+// concurrent use.
+type Server struct {
+	*httptest.Server
+
+	// Token, if set, is the only token accepted by the server. Otherwise
+	// any bearer token is accepted. Requests without a token fail with
+	// forbidden either way.
+	Token string
+	// ListLimit, if set, caps the number of blobs of a list page, e.g. to
+	// test pagination with few blobs.
+	ListLimit int
+
+	mu          sync.Mutex
+	blobs       map[string]Blob
+	uploads     map[string]*upload
+	requests    int
+	log         []Request
+	failures    []*Rule
+	delays      []*Rule
+	cursorEpoch int
+}
+
+// upload is a multipart upload in progress.
+type upload struct {
+	blob      Blob
+	overwrite bool
+	parts     map[int][]byte
+}
+
+// NewServer starts a Server with no blobs. Call Close when done.
+func NewServer() *Server {
+	s := &Server{blobs: map[string]Blob{}, uploads: map[string]*upload{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// BlobURL returns the URL at which the server serves the blob at pathname.
+func (s *Server) BlobURL(pathname string) string {
+	u, _ := url.Parse(s.URL)
+	u.Path = "/" + pathname
+	return u.String()
+}
+
+// Seed stores a blob as if it had been put, replacing any blob at its
+// pathname, and returns it. An empty contentType is derived from the
+// extension of pathname.
+func (s *Server) Seed(pathname string, content []byte, contentType string) Blob {
+	blob := Blob{
+		Pathname:           pathname,
+		Content:            bytes.Clone(content),
+		ContentType:        cmp.Or(contentType, contentTypeOf(pathname)),
+		CacheControlMaxAge: DefaultCacheControlMaxAge,
+		UploadedAt:         time.Now().UTC(),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[pathname] = blob
+	return blob
+}
+
+// Blob returns the blob at pathname.
+func (s *Server) Blob(pathname string) (Blob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	blob, ok := s.blobs[pathname]
+	return blob, ok
+}
+
+// Blobs returns every blob, sorted by pathname.
+func (s *Server) Blobs() []Blob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	blobs := make([]Blob, 0, len(s.blobs))
+	for _, pathname := range slices.Sorted(maps.Keys(s.blobs)) {
+		blobs = append(blobs, s.blobs[pathname])
+	}
+	return blobs
+}
+
+// Pathnames returns the pathnames of every blob, sorted.
+func (s *Server) Pathnames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Sorted(maps.Keys(s.blobs))
+}
+
+// OpenUploads returns the number of multipart uploads created and neither
+// completed nor aborted.
+func (s *Server) OpenUploads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.uploads)
+}
+
+// Requests returns the number of requests the server received.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	req := s.classify(r)
+	s.mu.Lock()
+	s.requests++
+	w.Header().Set("X-Vercel-Id", "blobtest::"+strconv.Itoa(s.requests))
+	delay, failure := scripted(s.delays, req), scripted(s.failures, req)
+	s.mu.Unlock()
+
+	recorder := &responseRecorder{ResponseWriter: w}
+	defer func() {
+		req.Status, req.Code, req.Scripted = recorder.status, recorder.code, failure != nil
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.log = append(s.log, req)
+	}()
+	if delay != nil {
+		timer := time.NewTimer(delay.delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if failure != nil {
+		failure.writeFailure(recorder)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.serve(recorder, r, req.Operation)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request, operation Operation) {
+	pathname := strings.TrimPrefix(r.URL.Path, "/")
+	if operation == OperationDownload {
+		s.download(w, r, pathname)
+		return
+	}
+	if !s.authorized(r) {
+		writeError(w, http.StatusForbidden, "forbidden", "Access denied, please provide a valid token for this resource.")
+		return
+	}
+	switch operation {
+	case OperationHead:
+		s.head(w, r)
+	case OperationList:
+		s.list(w, r)
+	case OperationDelete:
+		s.delete(w, r)
+	case OperationCopy:
+		s.copy(w, r, pathname)
+	case OperationPut:
+		s.put(w, r, pathname)
+	case OperationMultipartCreate, OperationMultipartPart, OperationMultipartComplete, OperationMultipartAbort:
+		s.multipart(w, r)
+	default:
+		if action := r.Header.Get("X-MPU-Action"); pathname == "mpu" && action != "" {
+			writeError(w, http.StatusBadRequest, "bad_request", "Unknown multipart action "+action+".")
+			return
+		}
+		writeError(w, http.StatusBadRequest, "bad_request", fmt.Sprintf("Unsupported request %s %s.", r.Method, r.URL.Path))
+	}
+}
+
+// authorized reports whether r carries an accepted token.
+func (s *Server) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && token != "" && (s.Token == "" || token == s.Token)
+}
+
+// newBlob returns the blob a put or copy to pathname creates, with the
+// metadata of its headers, or writes an error.
+func (s *Server) newBlob(w http.ResponseWriter, r *http.Request, pathname string, content []byte, source *Blob) (Blob, bool) {
+	if pathname == "" {
+		writeError(w, http.StatusBadRequest, "bad_request", "A pathname is required.")
+		return Blob{}, false
+	}
+	if r.Header.Get("X-Add-Random-Suffix") != "0" {
+		pathname = addRandomSuffix(pathname)
+	}
+	blob := Blob{Pathname: pathname, Content: content, CacheControlMaxAge: DefaultCacheControlMaxAge, UploadedAt: time.Now().UTC()}
+	if source != nil {
+		blob.ContentType, blob.CacheControlMaxAge = source.ContentType, source.CacheControlMaxAge
+	}
+	blob.ContentType = cmp.Or(r.Header.Get("X-Content-Type"), blob.ContentType, contentTypeOf(pathname))
+	if maxAge := r.Header.Get("X-Cache-Control-Max-Age"); maxAge != "" {
+		n, err := strconv.ParseUint(maxAge, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "bad_request", "Invalid cache control max age "+maxAge+".")
+			return Blob{}, false
+		}
+		blob.CacheControlMaxAge = n
+	}
+	return blob, true
+}
+
+// store stores blob, or writes an error if it exists and cannot be
+// overwritten.
+func (s *Server) store(w http.ResponseWriter, blob Blob, overwrite bool) bool {
+	if _, ok := s.blobs[blob.Pathname]; ok && !overwrite {
+		writeError(w, http.StatusBadRequest, "blob_already_exists", "This blob already exists, use allowOverwrite: true to overwrite it.")
+		return false
+	}
+	s.blobs[blob.Pathname] = blob
+	return true
+}
+
+func (s *Server) put(w http.ResponseWriter, r *http.Request, pathname string) {
+	var body bytes.Buffer
+	if _, err := body.ReadFrom(r.Body); err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request", "The body could not be read.")
+		return
+	}
+	blob, ok := s.newBlob(w, r, pathname, body.Bytes(), nil)
+	if !ok || !s.store(w, blob, r.Header.Get("X-Allow-Overwrite") == "1") {
+		return
+	}
+	s.writePutResult(w, blob)
+}
+
+func (s *Server) copy(w http.ResponseWriter, r *http.Request, pathname string) {
+	from := r.URL.Query().Get("fromUrl")
+	sourcePathname, ok := s.pathnameOf(from)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "bad_request", "The fromUrl "+from+" is not a blob of this store.")
+		return
+	}
+	source, ok := s.blobs[sourcePathname]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", "The requested blob does not exist")
+		return
+	}
+	blob, ok := s.newBlob(w, r, pathname, source.Content, &source)
+	if !ok || !s.store(w, blob, r.Header.Get("X-Allow-Overwrite") == "1") {
+		return
+	}
+	s.writePutResult(w, blob)
+}
+
+func (s *Server) writePutResult(w http.ResponseWriter, blob Blob) {
+	w.Header().Set("ETag", blob.ETag())
+	writeJSON(w, map[string]any{
+		"url":                s.BlobURL(blob.Pathname),
+		"downloadUrl":        s.BlobURL(blob.Pathname) + "?download=1",
+		"pathname":           blob.Pathname,
+		"contentType":        blob.ContentType,
+		"contentDisposition": contentDisposition(blob.Pathname, false),
+	})
+}
+
+func (s *Server) head(w http.ResponseWriter, r *http.Request) {
+	pathname, _ := s.pathnameOf(r.URL.Query().Get("url"))
+	blob, ok := s.blobs[pathname]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", "The requested blob does not exist")
+		return
+	}
+	w.Header().Set("ETag", blob.ETag())
+	if match := r.Header.Get("If-None-Match"); match != "" && match == blob.ETag() {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSON(w, map[string]any{
+		"url":                s.BlobURL(blob.Pathname),
+		"downloadUrl":        s.BlobURL(blob.Pathname) + "?download=1",
+		"pathname":           blob.Pathname,
+		"size":               len(blob.Content),
+		"uploadedAt":         blob.UploadedAt,
+		"contentType":        blob.ContentType,
+		"contentDisposition": contentDisposition(blob.Pathname, false),
+		"cacheControl":       "public, max-age=" + strconv.FormatUint(blob.CacheControlMaxAge, 10),
+	})
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	prefix, folded := q.Get("prefix"), q.Get("mode") == "folded"
+	limit := defaultListLimit
+	if q.Has("limit") {
+		n, err := strconv.Atoi(q.Get("limit"))
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "bad_request", "Invalid limit "+q.Get("limit")+".")
+			return
+		}
+		limit = min(n, defaultListLimit)
+	}
+	if s.ListLimit > 0 {
+		limit = min(limit, s.ListLimit)
+	}
+	after := ""
+	if cursor := q.Get("cursor"); cursor != "" {
+		// A cursor is the epoch of ExpireCursors it was issued in and the
+		// last entry of its page.
+		decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+		epoch, rest, ok := strings.Cut(string(decoded), ":")
+		if err != nil || !ok {
+			writeError(w, http.StatusBadRequest, "bad_request", "Invalid cursor.")
+			return
+		}
+		if epoch != strconv.Itoa(s.cursorEpoch) {
+			writeError(w, http.StatusBadRequest, "bad_request", "The cursor has expired.")
+			return
+		}
+		after = rest
+	}
+
+	// Entries are the pathnames of blobs and, in folded mode, the folders
+	// directly under the prefix, paginated together.
+	entries := map[string]bool{}
+	for pathname := range s.blobs {
+		rest, ok := strings.CutPrefix(pathname, prefix)
+		if !ok {
+			continue
+		}
+		if i := strings.Index(rest, "/"); folded && i >= 0 {
+			entries[prefix+rest[:i+1]] = true
+		} else {
+			entries[pathname] = false
+		}
+	}
+	keys := slices.Sorted(maps.Keys(entries))
+	start, _ := slices.BinarySearch(keys, after)
+	if start < len(keys) && keys[start] == after {
+		start++
+	}
+	page := keys[start:min(start+limit, len(keys))]
+
+	type listBlob struct {
+		URL         string    `json:"url"`
+		DownloadURL string    `json:"downloadUrl"`
+		Pathname    string    `json:"pathname"`
+		Size        int       `json:"size"`
+		UploadedAt  time.Time `json:"uploadedAt"`
+	}
+	result := struct {
+		Blobs   []listBlob `json:"blobs"`
+		Folders []string   `json:"folders,omitempty"`
+		Cursor  string     `json:"cursor,omitempty"`
+		HasMore bool       `json:"hasMore"`
+	}{Blobs: []listBlob{}}
+	for _, key := range page {
+		if entries[key] {
+			result.Folders = append(result.Folders, key)
+			continue
+		}
+		blob := s.blobs[key]
+		result.Blobs = append(result.Blobs, listBlob{
+			URL:         s.BlobURL(key),
+			DownloadURL: s.BlobURL(key) + "?download=1",
+			Pathname:    key,
+			Size:        len(blob.Content),
+			UploadedAt:  blob.UploadedAt,
+		})
+	}
+	if start+limit < len(keys) {
+		result.HasMore = true
+		result.Cursor = base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(s.cursorEpoch) + ":" + page[len(page)-1]))
+	}
+	writeJSON(w, result)
+}
+
+func (s *Server) delete(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		URLs []string `json:"urls"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request", "Invalid request body.")
+		return
+	}
+	// Like the API, deleting a blob that does not exist succeeds.
+	for _, u := range req.URLs {
+		if pathname, ok := s.pathnameOf(u); ok {
+			delete(s.blobs, pathname)
+		}
+	}
+	writeJSON(w, struct{}{})
+}
+
+func (s *Server) multipart(w http.ResponseWriter, r *http.Request) {
+	switch action := r.Header.Get("X-MPU-Action"); action {
+	case "create":
+		blob, ok := s.newBlob(w, r, r.URL.Query().Get("pathname"), nil, nil)
+		if !ok {
+			return
+		}
+		uploadID := randomString(24)
+		s.uploads[uploadID] = &upload{blob: blob, overwrite: r.Header.Get("X-Allow-Overwrite") == "1", parts: map[int][]byte{}}
+		writeJSON(w, map[string]string{"uploadId": uploadID, "key": blob.Pathname})
+	case "upload":
+		up, ok := s.upload(w, r.Header.Get("X-MPU-Upload-Id"), r.Header.Get("X-MPU-Key"))
+		if !ok {
+			return
+		}
+		partNumber, err := strconv.Atoi(r.Header.Get("X-MPU-Part-Number"))
+		if err != nil || partNumber < 1 || partNumber > 10000 {
+			writeError(w, http.StatusBadRequest, "bad_request", "Invalid part number "+r.Header.Get("X-MPU-Part-Number")+".")
+			return
+		}
+		var body bytes.Buffer
+		if _, err := body.ReadFrom(r.Body); err != nil {
+			writeError(w, http.StatusBadRequest, "bad_request", "The body could not be read.")
+			return
+		}
+		up.parts[partNumber] = body.Bytes()
+		etag := Blob{Content: body.Bytes()}.ETag()
+		w.Header().Set("ETag", etag)
+		writeJSON(w, map[string]any{"etag": etag, "partNumber": partNumber})
+	case "complete":
+		var req struct {
+			UploadID string `json:"uploadId"`
+			Key      string `json:"key"`
+			Parts    []struct {
+				ETag       string `json:"etag"`
+				PartNumber int    `json:"partNumber"`
+			} `json:"parts"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "bad_request", "Invalid request body.")
+			return
+		}
+		up, ok := s.upload(w, req.UploadID, req.Key)
+		if !ok {
+			return
+		}
+		var content bytes.Buffer
+		last := 0
+		for _, part := range req.Parts {
+			data, ok := up.parts[part.PartNumber]
+			if !ok || part.PartNumber <= last || part.ETag != (Blob{Content: data}).ETag() {
+				writeError(w, http.StatusBadRequest, "bad_request", fmt.Sprintf("Invalid part %d.", part.PartNumber))
+				return
+			}
+			last = part.PartNumber
+			content.Write(data)
+		}
+		blob := up.blob
+		blob.Content = content.Bytes()
+		blob.UploadedAt = time.Now().UTC()
+		if !s.store(w, blob, up.overwrite) {
+			return
+		}
+		delete(s.uploads, req.UploadID)
+		s.writePutResult(w, blob)
+	case "abort":
+		if _, ok := s.upload(w, r.Header.Get("X-MPU-Upload-Id"), r.Header.Get("X-MPU-Key")); !ok {
+			return
+		}
+		delete(s.uploads, r.Header.Get("X-MPU-Upload-Id"))
+		writeJSON(w, struct{}{})
+	}
+}
+
+// upload returns the multipart upload with uploadID and key, or writes an
+// error.
+func (s *Server) upload(w http.ResponseWriter, uploadID, key string) (*upload, bool) {
+	up, ok := s.uploads[uploadID]
+	if !ok || up.blob.Pathname != key {
+		writeError(w, http.StatusNotFound, "not_found", "The multipart upload does not exist.")
+		return nil, false
+	}
+	return up, true
+}
+
+func (s *Server) download(w http.ResponseWriter, r *http.Request, pathname string) {
+	blob, ok := s.blobs[pathname]
+	if !ok {
+		http.Error(w, "The page could not be found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("ETag", blob.ETag())
+	w.Header().Set("Content-Type", blob.ContentType)
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.FormatUint(blob.CacheControlMaxAge, 10))
+	w.Header().Set("Content-Disposition", contentDisposition(blob.Pathname, r.URL.Query().Get("download") == "1"))
+	http.ServeContent(w, r, "", blob.UploadedAt, bytes.NewReader(blob.Content))
+}
+
+// pathnameOf returns the pathname addressed by a blob URL of the server or a
+// pathname, and whether it addresses a blob of the server.
+func (s *Server) pathnameOf(urlOrPathname string) (string, bool) {
+	u, err := url.Parse(urlOrPathname)
+	if err != nil {
+		return "", false
+	}
+	if !u.IsAbs() {
+		return strings.TrimPrefix(urlOrPathname, "/"), true
+	}
+	base, _ := url.Parse(s.URL)
+	if u.Host != base.Host {
+		return "", false
+	}
+	return strings.TrimPrefix(u.Path, "/"), true
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	if recorder, ok := w.(*responseRecorder); ok {
+		recorder.code = code
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{"error": map[string]string{"code": code, "message": message}})
+}
+
+// contentTypeOf returns the content type the API derives from the extension
+// of pathname.
+func contentTypeOf(pathname string) string {
+	if contentType := mime.TypeByExtension(path.Ext(pathname)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+func contentDisposition(pathname string, attachment bool) string {
+	kind := "inline"
+	if attachment {
+		kind = "attachment"
+	}
+	return fmt.Sprintf("%s; filename=%q", kind, path.Base(pathname))
+}
+
+// addRandomSuffix inserts a random suffix before the extension of pathname,
+// like the API.
+func addRandomSuffix(pathname string) string {
+	ext := path.Ext(pathname)
+	if strings.Contains(ext, "/") {
+		ext = ""
+	}
+	return strings.TrimSuffix(pathname, ext) + "-" + randomString(30) + ext
+}
+
+const randomAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = randomAlphabet[rand.IntN(len(randomAlphabet))]
+	}
+	return string(b)
+}
@@ -0,0 +1,280 @@
+package blobtest_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	vercelblob "github.com/claywarren/vercel_blob"
+	"github.com/claywarren/vercel_blob/blobtest"
+)
+
+func newClient(t *testing.T, server *blobtest.Server) *vercelblob.Client {
+	t.Helper()
+	client, err := vercelblob.NewClientWithOptions(
+		vercelblob.WithBaseURL(server.URL),
+		vercelblob.WithTokenProvider(vercelblob.StaticTokenProvider("token")),
+		vercelblob.WithNoEnv(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func Test_Server_PutHeadDownload(t *testing.T) {
+	server := blobtest.NewServer()
+	defer server.Close()
+	client := newClient(t, server)
+	ctx := context.Background()
+
+	put, err := client.Put(ctx, "docs/a.txt", strings.NewReader("hello world"), vercelblob.PutCommandOptions{ContentType: "text/plain", CacheControlMaxAge: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if put.URL != server.BlobURL("docs/a.txt") || put.Pathname != "docs/a.txt" || put.ContentType != "text/plain" || put.RequestID == "" {
+		t.Errorf("Unexpected put result %+v", put)
+	}
+	if _, err := client.Put(ctx, "docs/a.txt", strings.NewReader("again"), vercelblob.PutCommandOptions{}); !errors.Is(err, vercelblob.ErrBlobAlreadyExists) {
+		t.Errorf("Expected blob_already_exists, got %v", err)
+	}
+	if _, err := client.Put(ctx, "docs/a.txt", strings.NewReader("hello world"), vercelblob.PutCommandOptions{AllowOverwrite: true, ContentType: "text/plain", CacheControlMaxAge: 60}); err != nil {
+		t.Errorf("Expected the overwrite to succeed, got %v", err)
+	}
+	suffixed, err := client.Put(ctx, "docs/b.txt", strings.NewReader("b"), vercelblob.PutCommandOptions{AddRandomSuffix: true})
+	if err != nil || !strings.HasPrefix(suffixed.Pathname, "docs/b-") || !strings.HasSuffix(suffixed.Pathname, ".txt") {
+		t.Errorf("Expected a random suffix, got %+v, %v", suffixed, err)
+	}
+
+	head, err := client.Head(ctx, "docs/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Size != 11 || head.ContentType != "text/plain" || head.CacheControl != "public, max-age=60" || head.ETag == "" || head.UploadedAt.IsZero() {
+		t.Errorf("Unexpected head result %+v", head)
+	}
+	if again, err := client.HeadWithOptions(ctx, put.URL, vercelblob.HeadCommandOptions{IfNoneMatch: head.ETag}); err != nil || !again.NotModified {
+		t.Errorf("Expected the blob not to be modified, got %+v, %v", again, err)
+	}
+	if _, err := client.Head(ctx, "docs/missing.txt"); !vercelblob.IsNotFound(err) {
+		t.Errorf("Expected not_found, got %v", err)
+	}
+
+	data, err := client.Download(ctx, put.URL, vercelblob.DownloadCommandOptions{})
+	if err != nil || string(data) != "hello world" {
+		t.Errorf("Expected the content, got %q, %v", data, err)
+	}
+	data, err = client.Download(ctx, put.URL, vercelblob.DownloadCommandOptions{ByteRange: &vercelblob.Range{Start: 6, End: 10}})
+	if err != nil || string(data) != "world" {
+		t.Errorf("Expected the range, got %q, %v", data, err)
+	}
+	if _, err := client.Download(ctx, server.BlobURL("docs/missing.txt"), vercelblob.DownloadCommandOptions{}); !vercelblob.IsNotFound(err) {
+		t.Errorf("Expected not_found, got %v", err)
+	}
+
+	resp, err := http.Get(server.BlobURL("docs/a.txt") + "?download=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.Header.Get("Content-Disposition") != `attachment; filename="a.txt"` || resp.Header.Get("Content-Type") != "text/plain" {
+		t.Errorf("Unexpected download headers %v", resp.Header)
+	}
+}
+
+func Test_Server_Multipart(t *testing.T) {
+	server := blobtest.NewServer()
+	defer server.Close()
+	client := newClient(t, server)
+
+	content := bytes.Repeat([]byte("0123456789"), vercelblob.MultipartThreshold/10+1)
+	result, err := client.Put(context.Background(), "big.bin", bytes.NewReader(content), vercelblob.PutCommandOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Stats.UsedMultipart {
+		t.Error("Expected a multipart upload")
+	}
+	blob, ok := server.Blob("big.bin")
+	if !ok || !bytes.Equal(blob.Content, content) || blob.ContentType != "application/octet-stream" {
+		t.Errorf("Expected the parts to be assembled, got %d bytes of %s", len(blob.Content), blob.ContentType)
+	}
+	if server.OpenUploads() != 0 {
+		t.Errorf("Expected the upload to be completed, got %d open", server.OpenUploads())
+	}
+}
+
+func Test_Server_List(t *testing.T) {
+	server := blobtest.NewServer()
+	defer server.Close()
+	server.ListLimit = 2
+	for _, pathname := range []string{"docs/a.txt", "docs/b.txt", "docs/old/c.txt", "docs/old/d.txt", "docs/z.txt", "img/e.png"} {
+		server.Seed(pathname, []byte(pathname), "")
+	}
+	client := newClient(t, server)
+	ctx := context.Background()
+
+	var pathnames []string
+	cursor := ""
+	for {
+		page, err := client.List(ctx, vercelblob.ListCommandOptions{Prefix: "docs/", Cursor: cursor})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Blobs) > 2 {
+			t.Errorf("Expected pages of 2 blobs, got %d", len(page.Blobs))
+		}
+		for _, blob := range page.Blobs {
+			pathnames = append(pathnames, blob.PathName)
+		}
+		if !page.HasMore {
+			break
+		}
+		cursor = page.Cursor
+	}
+	if want := []string{"docs/a.txt", "docs/b.txt", "docs/old/c.txt", "docs/old/d.txt", "docs/z.txt"}; !slices.Equal(pathnames, want) {
+		t.Errorf("Expected %v, got %v", want, pathnames)
+	}
+
+	server.ListLimit = 0
+	folded, err := client.List(ctx, vercelblob.ListCommandOptions{Prefix: "docs/", Mode: "folded"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(folded.Blobs) != 3 || !slices.Equal(folded.Folders, []string{"docs/old/"}) || folded.HasMore {
+		t.Errorf("Expected 3 blobs and one folder, got %+v", folded)
+	}
+	if limited, err := client.List(ctx, vercelblob.ListCommandOptions{Limit: 1}); err != nil || len(limited.Blobs) != 1 || !limited.HasMore {
+		t.Errorf("Expected one blob and more, got %+v, %v", limited, err)
+	}
+}
+
+func Test_Server_CopyDelete(t *testing.T) {
+	server := blobtest.NewServer()
+	defer server.Close()
+	source := server.Seed("a.json", []byte(`{}`), "")
+	client := newClient(t, server)
+	ctx := context.Background()
+
+	copied, err := client.CopyWithOptions(ctx, server.BlobURL("a.json"), "b.json", vercelblob.CopyCommandOptions{Verify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob, ok := server.Blob("b.json")
+	if !ok || copied.Pathname != "b.json" || !bytes.Equal(blob.Content, source.Content) || blob.ContentType != "application/json" {
+		t.Errorf("Unexpected copy %+v of %+v", copied, blob)
+	}
+	if _, err := client.CopyWithOptions(ctx, server.BlobURL("missing.json"), "c.json", vercelblob.CopyCommandOptions{}); !vercelblob.IsNotFound(err) {
+		t.Errorf("Expected not_found, got %v", err)
+	}
+	if _, err := client.CopyWithOptions(ctx, "https://elsewhere.example.com/a.json", "c.json", vercelblob.CopyCommandOptions{}); vercelblob.CodeOf(err) != "bad_request" {
+		t.Errorf("Expected bad_request, got %v", err)
+	}
+
+	if err := client.Delete(ctx, server.BlobURL("a.json"), "b.json", server.BlobURL("missing.json")); err != nil {
+		t.Fatal(err)
+	}
+	if pathnames := server.Pathnames(); len(pathnames) != 0 {
+		t.Errorf("Expected every blob to be deleted, got %v", pathnames)
+	}
+}
+
+func Test_Server_Auth(t *testing.T) {
+	server := blobtest.NewServer()
+	defer server.Close()
+	server.Token = "other"
+	client := newClient(t, server)
+
+	if _, err := client.List(context.Background(), vercelblob.ListCommandOptions{}); !errors.Is(err, vercelblob.ErrForbidden) {
+		t.Errorf("Expected forbidden, got %v", err)
+	}
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden || !strings.Contains(string(body), `"code":"forbidden"`) {
+		t.Errorf("Expected forbidden without a token, got %d %s", resp.StatusCode, body)
+	}
+}
+
+func Test_Server_Script(t *testing.T) {
+	server := blobtest.NewServer()
+	defer server.Close()
+	client := newClient(t, server)
+	ctx := context.Background()
+
+	put := blobtest.Matcher{Operation: blobtest.OperationPut, Pathname: "a.txt"}
+	suspended := server.Fail(put, "store_suspended", 3)
+	for range 3 {
+		if _, err := client.Put(ctx, "a.txt", strings.NewReader("a"), vercelblob.PutCommandOptions{}); !errors.Is(err, vercelblob.ErrStoreSuspended) {
+			t.Errorf("Expected store_suspended, got %v", err)
+		}
+	}
+	if _, err := client.Put(ctx, "a.txt", strings.NewReader("a"), vercelblob.PutCommandOptions{}); err != nil {
+		t.Errorf("Expected the put to succeed once the failures are used up, got %v", err)
+	}
+	if suspended.Used() != 3 {
+		t.Errorf("Expected the failure to be used 3 times, got %d", suspended.Used())
+	}
+	log := server.RequestLog(put)
+	if len(log) != 4 || !log[0].Scripted || log[0].Status != http.StatusForbidden || log[0].Code != "store_suspended" || log[3].Scripted || log[3].Status != http.StatusOK {
+		t.Errorf("Unexpected request log %+v", log)
+	}
+
+	server.Fail(blobtest.Matcher{Operation: blobtest.OperationHead}, "rate_limited", 1).WithRetryAfter(1500 * time.Millisecond)
+	_, err := client.Head(ctx, "a.txt")
+	if after, ok := vercelblob.RetryAfter(err); !errors.Is(err, vercelblob.ErrRateLimited) || !ok || after != 2*time.Second {
+		t.Errorf("Expected rate_limited with a retry after 2s, got %v", err)
+	}
+
+	server.Delay(blobtest.Matcher{Operation: blobtest.OperationHead}, time.Minute).Times(1)
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.Head(timeout, "a.txt"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the deadline to be exceeded, got %v", err)
+	}
+	if _, err := client.Head(ctx, "a.txt"); err != nil {
+		t.Errorf("Expected the delay to be used up, got %v", err)
+	}
+
+	server.Fail(blobtest.Matcher{}, "service_unavailable", 0)
+	server.ClearScript()
+	if _, err := client.Head(ctx, "a.txt"); err != nil {
+		t.Errorf("Expected the script to be cleared, got %v", err)
+	}
+}
+
+func Test_Server_ExpireCursors(t *testing.T) {
+	server := blobtest.NewServer()
+	defer server.Close()
+	server.ListLimit = 1
+	server.Seed("a.txt", []byte("a"), "")
+	server.Seed("b.txt", []byte("b"), "")
+	server.Seed("c.txt", []byte("c"), "")
+	client := newClient(t, server)
+	ctx := context.Background()
+
+	first, err := client.List(ctx, vercelblob.ListCommandOptions{})
+	if err != nil || !first.HasMore {
+		t.Fatalf("Expected a first page, got %+v, %v", first, err)
+	}
+	server.ExpireCursors()
+	if _, err := client.List(ctx, vercelblob.ListCommandOptions{Cursor: first.Cursor}); vercelblob.CodeOf(err) != "bad_request" || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("Expected the cursor to be expired, got %v", err)
+	}
+	again, err := client.List(ctx, vercelblob.ListCommandOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next, err := client.List(ctx, vercelblob.ListCommandOptions{Cursor: again.Cursor}); err != nil || len(next.Blobs) != 1 || next.Blobs[0].PathName != "b.txt" {
+		t.Errorf("Expected the cursors issued since to work, got %+v, %v", next, err)
+	}
+}
@@ -0,0 +1,253 @@
+package blobtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Operation is the kind of a request received by a Server. Its values are
+// those of vercelblob.Operation, plus OperationMultipartAbort.
+type Operation string
+
+const (
+	OperationList              Operation = "list"
+	OperationPut               Operation = "put"
+	OperationHead              Operation = "head"
+	OperationDownload          Operation = "download"
+	OperationDelete            Operation = "delete"
+	OperationCopy              Operation = "copy"
+	OperationMultipartCreate   Operation = "multipart-create"
+	OperationMultipartPart     Operation = "multipart-part"
+	OperationMultipartComplete Operation = "multipart-complete"
+	OperationMultipartAbort    Operation = "multipart-abort"
+)
+
+// Matcher selects the requests a scripted behavior applies to. Its zero
+// fields match any request.
+type Matcher struct {
+	Operation Operation
+	// Pathname matches the pathname of the blob a request is for, or the
+	// prefix of a list.
+	Pathname string
+	// PartNumber matches the part number of a part of a multipart upload.
+	PartNumber int
+}
+
+func (m Matcher) matches(req Request) bool {
+	return (m.Operation == "" || m.Operation == req.Operation) &&
+		(m.Pathname == "" || m.Pathname == req.Pathname) &&
+		(m.PartNumber == 0 || m.PartNumber == req.PartNumber)
+}
+
+// Request is a request received by a Server, as logged for assertions.
+type Request struct {
+	Operation  Operation
+	Method     string
+	Pathname   string
+	PartNumber int
+	// Status is the status of the response, and Code the error code it
+	// reported, if any. Status is zero if the request ended before the
+	// response, e.g. during a delay.
+	Status int
+	Code   string
+	// Scripted reports whether the response is a failure scripted with Fail.
+	Scripted bool
+}
+
+// Rule is a behavior scripted with Fail or Delay.
+type Rule struct {
+	s          *Server
+	match      Matcher
+	times      int
+	used       int
+	code       string
+	retryAfter time.Duration
+	delay      time.Duration
+}
+
+// Times limits the rule to the next n matching requests. Zero applies it to
+// every matching request.
+func (r *Rule) Times(n int) *Rule {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	r.times = n
+	return r
+}
+
+// WithRetryAfter makes the failures of the rule carry a Retry-After header
+// asking for d, rounded up to the second.
+func (r *Rule) WithRetryAfter(d time.Duration) *Rule {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	r.retryAfter = d
+	return r
+}
+
+// Used returns the number of requests the rule was applied to.
+func (r *Rule) Used() int {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	return r.used
+}
+
+// Fail makes the next times requests matching m, or all of them if times is
+// zero, fail with the error code of the API code, such as store_suspended or
+// rate_limited, and its status, without being processed. Rules apply in the
+// order they were added; a request fails with the first one that matches it
+// and is not used up.
+func (s *Server) Fail(m Matcher, code string, times int) *Rule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rule := &Rule{s: s, match: m, times: times, code: code}
+	s.failures = append(s.failures, rule)
+	return rule
+}
+
+// Delay makes every request matching m wait d before it is processed, or
+// before it fails if Fail also applies to it. Use Times to limit it to the
+// next requests.
+func (s *Server) Delay(m Matcher, d time.Duration) *Rule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rule := &Rule{s: s, match: m, delay: d}
+	s.delays = append(s.delays, rule)
+	return rule
+}
+
+// ExpireCursors makes the list cursors returned so far fail with bad_request,
+// like the cursors the API expires, so that a listing in progress breaks.
+func (s *Server) ExpireCursors() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cursorEpoch++
+}
+
+// ClearScript removes the rules added by Fail and Delay.
+func (s *Server) ClearScript() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures, s.delays = nil, nil
+}
+
+// RequestLog returns the requests matching m received so far, in the order
+// they ended.
+func (s *Server) RequestLog(m Matcher) []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var log []Request
+	for _, req := range s.log {
+		if m.matches(req) {
+			log = append(log, req)
+		}
+	}
+	return log
+}
+
+// scripted returns the rule of rules that applies to req, using it up.
+func scripted(rules []*Rule, req Request) *Rule {
+	for _, rule := range rules {
+		if rule.match.matches(req) && (rule.times == 0 || rule.used < rule.times) {
+			rule.used++
+			return rule
+		}
+	}
+	return nil
+}
+
+// writeFailure writes the failure of the rule.
+func (r *Rule) writeFailure(w http.ResponseWriter) {
+	if r.retryAfter > 0 {
+		seconds := (r.retryAfter + time.Second - 1) / time.Second
+		w.Header().Set("Retry-After", strconv.Itoa(int(seconds)))
+	}
+	status := statusOf(r.code)
+	writeError(w, status, r.code, http.StatusText(status))
+}
+
+// statusOf returns the status with which the API reports code.
+func statusOf(code string) int {
+	switch code {
+	case "bad_request", "blob_already_exists":
+		return http.StatusBadRequest
+	case "forbidden", "store_suspended":
+		return http.StatusForbidden
+	case "not_found", "store_not_found":
+		return http.StatusNotFound
+	case "rate_limited":
+		return http.StatusTooManyRequests
+	case "service_unavailable":
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// classify returns the request r is, to be matched and logged. The body of a
+// multipart completion is read for its pathname and put back.
+func (s *Server) classify(r *http.Request) Request {
+	req := Request{Method: r.Method}
+	pathname := strings.TrimPrefix(r.URL.Path, "/")
+	switch {
+	case (r.Method == http.MethodGet || r.Method == http.MethodHead) && pathname != "":
+		req.Operation, req.Pathname = OperationDownload, pathname
+	case r.Method == http.MethodGet && r.URL.Query().Has("url"):
+		req.Operation = OperationHead
+		req.Pathname, _ = s.pathnameOf(r.URL.Query().Get("url"))
+	case r.Method == http.MethodGet:
+		req.Operation, req.Pathname = OperationList, r.URL.Query().Get("prefix")
+	case pathname == "mpu" && r.Header.Get("X-MPU-Action") != "":
+		req.Pathname = r.Header.Get("X-MPU-Key")
+		switch r.Header.Get("X-MPU-Action") {
+		case "create":
+			req.Operation, req.Pathname = OperationMultipartCreate, r.URL.Query().Get("pathname")
+		case "upload":
+			req.Operation = OperationMultipartPart
+			req.PartNumber, _ = strconv.Atoi(r.Header.Get("X-MPU-Part-Number"))
+		case "complete":
+			req.Operation = OperationMultipartComplete
+			body, _ := io.ReadAll(r.Body)
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			var complete struct {
+				Key string `json:"key"`
+			}
+			if json.Unmarshal(body, &complete) == nil {
+				req.Pathname = complete.Key
+			}
+		case "abort":
+			req.Operation = OperationMultipartAbort
+		}
+	case r.Method == http.MethodPost && pathname == "delete":
+		req.Operation = OperationDelete
+	case r.Method == http.MethodPut && r.URL.Query().Has("fromUrl"):
+		req.Operation, req.Pathname = OperationCopy, pathname
+	case r.Method == http.MethodPut && pathname != "":
+		req.Operation, req.Pathname = OperationPut, pathname
+	}
+	return req
+}
+
+// responseRecorder records the status and error code of a response for the
+// request log.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	code   string
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseRecorder) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
@@ -0,0 +1,253 @@
+package vercelblob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of the circuit breaker of a client.
+type CircuitState int
+
+const (
+	// CircuitClosed lets requests through. It is the state of a client
+	// without a circuit breaker.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails requests with ErrCircuitOpen without sending them.
+	CircuitOpen
+	// CircuitHalfOpen lets one probe request through to decide whether to
+	// close the circuit again.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("CircuitState(%d)", int(s))
+	}
+}
+
+// CircuitStateChange describes a transition of the circuit breaker.
+type CircuitStateChange struct {
+	From, To CircuitState
+	// Err is the failure that opened the circuit, or nil.
+	Err error
+}
+
+// WithCircuitBreaker makes the client stop sending requests while the API is
+// failing. After threshold consecutive failures, each within window of the
+// previous one if window is positive, the circuit opens and requests fail
+// with ErrCircuitOpen at once, including the retries of WithRetry. After
+// cooldown, one probe request is let through: the circuit closes if it
+// succeeds and opens again if it fails.
+//
+// Server errors, rate limits, failures in transit and suspended stores count
+// as failures; any other response of the API, such as a 404, counts as a
+// success. Requests that fail otherwise, e.g. because their context was
+// canceled, count as neither.
+//
+// The breaker is shared by the copies returned by ForStore and WithPrefix;
+// Clone gives the copy a breaker of its own. See WithCircuitStateHook and
+// ResetCircuit.
+func WithCircuitBreaker(threshold int, window, cooldown time.Duration) ClientOption {
+	return func(c *Client) error {
+		switch {
+		case threshold < 1:
+			return NewInvalidOptionError("WithCircuitBreaker", fmt.Sprintf("threshold %d is less than 1", threshold))
+		case window < 0:
+			return NewInvalidOptionError("WithCircuitBreaker", fmt.Sprintf("window %v is a negative duration", window))
+		case cooldown <= 0:
+			return NewInvalidOptionError("WithCircuitBreaker", fmt.Sprintf("cooldown %v is not positive", cooldown))
+		}
+		c.breaker = newCircuitBreaker(threshold, window, cooldown)
+		return nil
+	}
+}
+
+// WithCircuitStateHook makes the client call fn on every transition of its
+// circuit breaker, e.g. to export the state as a metric. fn is called
+// synchronously on the request path, so it should be cheap. Transitions are
+// also logged by WithLogger.
+func WithCircuitStateHook(fn func(CircuitStateChange)) ClientOption {
+	return func(c *Client) error {
+		c.circuitHook = fn
+		return nil
+	}
+}
+
+// CircuitState returns the state of the circuit breaker of the client.
+func (c *Client) CircuitState() CircuitState {
+	if c.breaker == nil {
+		return CircuitClosed
+	}
+	c.breaker.mu.Lock()
+	defer c.breaker.mu.Unlock()
+	return c.breaker.state
+}
+
+// ResetCircuit closes the circuit breaker of the client and forgets past
+// failures, e.g. once an operator has fixed a suspended store.
+func (c *Client) ResetCircuit() {
+	if c.breaker == nil {
+		return
+	}
+	c.breaker.mu.Lock()
+	change := c.breaker.transition(c.now(), CircuitClosed, nil)
+	c.breaker.failures = 0
+	c.breaker.probing = false
+	c.breaker.mu.Unlock()
+	c.notifyCircuit(context.Background(), change)
+}
+
+// circuitBreaker holds the state of WithCircuitBreaker.
+type circuitBreaker struct {
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+
+	mu          sync.Mutex
+	state       CircuitState
+	failures    int
+	lastFailure time.Time
+	openedAt    time.Time
+	probing     bool
+}
+
+func newCircuitBreaker(threshold int, window, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, window: window, cooldown: cooldown}
+}
+
+// allow reports whether a request may be sent at now, and whether it is the
+// probe of a half-open circuit.
+func (b *circuitBreaker) allow(now time.Time) (probe bool, change *CircuitStateChange, err error) {
+	if b == nil {
+		return false, nil, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == CircuitOpen && now.Sub(b.openedAt) >= b.cooldown {
+		change = b.transition(now, CircuitHalfOpen, nil)
+	}
+	switch {
+	case b.state == CircuitClosed:
+		return false, change, nil
+	case b.state == CircuitHalfOpen && !b.probing:
+		b.probing = true
+		return true, change, nil
+	default:
+		return false, change, ErrCircuitOpen
+	}
+}
+
+// record records the outcome at now of a request let through by allow. failure is
+// the failure of the request, or nil on success; ignore is set for requests
+// that neither failed nor succeeded.
+func (b *circuitBreaker) record(now time.Time, probe bool, failure error, ignore bool) *CircuitStateChange {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+	}
+	switch {
+	case ignore:
+		return nil
+	case failure == nil:
+		b.failures = 0
+		if probe {
+			return b.transition(now, CircuitClosed, nil)
+		}
+		return nil
+	case probe:
+		return b.transition(now, CircuitOpen, failure)
+	}
+	if b.window > 0 && now.Sub(b.lastFailure) > b.window {
+		b.failures = 0
+	}
+	b.failures++
+	b.lastFailure = now
+	if b.state == CircuitClosed && b.failures >= b.threshold {
+		return b.transition(now, CircuitOpen, failure)
+	}
+	return nil
+}
+
+// transition moves the breaker to state at now and returns the change, or
+// nil if it is already in state. b.mu must be held.
+func (b *circuitBreaker) transition(now time.Time, state CircuitState, err error) *CircuitStateChange {
+	if b.state == state {
+		return nil
+	}
+	change := &CircuitStateChange{From: b.state, To: state, Err: err}
+	b.state = state
+	if state == CircuitOpen {
+		b.openedAt = now
+	}
+	return change
+}
+
+// notifyCircuit reports change, if any, to the hook and the logger.
+func (c *Client) notifyCircuit(ctx context.Context, change *CircuitStateChange) {
+	if change == nil {
+		return
+	}
+	if c.circuitHook != nil {
+		c.circuitHook(*change)
+	}
+	if c.logEnabled(ctx) {
+		attrs := []slog.Attr{slog.String("from", change.From.String()), slog.String("to", change.To.String())}
+		if change.Err != nil {
+			attrs = append(attrs, slog.String("error", change.Err.Error()))
+		}
+		c.logger.LogAttrs(ctx, c.logLevel, "blob circuit breaker", attrs...)
+	}
+}
+
+// sendThroughBreaker sends req with sendFailover unless the circuit breaker of
+// the client is open, and records the outcome.
+func (c *Client) sendThroughBreaker(req *http.Request, operation Operation, pathname string) (*http.Response, error) {
+	ctx := req.Context()
+	probe, change, err := c.breaker.allow(c.now())
+	c.notifyCircuit(ctx, change)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.sendFailover(req, operation, pathname)
+	if c.breaker != nil {
+		failure, ignore := c.circuitFailure(resp, err)
+		c.notifyCircuit(ctx, c.breaker.record(c.now(), probe, failure, ignore))
+	}
+	return resp, err
+}
+
+// circuitFailure classifies the outcome of a request for the circuit
+// breaker: it returns the failure, if the request failed, and whether the
+// outcome must be ignored.
+func (c *Client) circuitFailure(resp *http.Response, err error) (failure error, ignore bool) {
+	if err != nil {
+		if IsRetryable(err) {
+			return err, false
+		}
+		return nil, true
+	}
+	if resp.StatusCode < http.StatusBadRequest {
+		return nil, false
+	}
+	apiErr := c.peekAPIError(resp)
+	if IsRetryable(apiErr) || errors.Is(apiErr, ErrStoreSuspended) {
+		return apiErr, false
+	}
+	return nil, false
+}
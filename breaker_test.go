@@ -0,0 +1,138 @@
+package vercelblob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_WithCircuitBreaker_Mock(t *testing.T) {
+	clock := newFakeClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	var status atomic.Int64
+	status.Store(http.StatusBadGateway)
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(int(status.Load()))
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.txt","pathname":"a.txt"}`))
+	}))
+	defer server.Close()
+	var changes []CircuitStateChange
+	var logs bytes.Buffer
+	client := newTestClient(t,
+		WithBaseURL(server.URL),
+		WithTokenProvider(StaticTokenProvider("token")),
+		WithCircuitBreaker(2, time.Minute, 30*time.Second),
+		WithClock(clock.Now),
+		WithCircuitStateHook(func(c CircuitStateChange) { changes = append(changes, c) }),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))),
+	)
+	ctx := context.Background()
+
+	// Two consecutive server errors open the circuit.
+	for range 2 {
+		if _, err := client.Head(ctx, "a.txt"); errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("Expected the circuit to be closed, got %v", err)
+		}
+	}
+	if state := client.CircuitState(); state != CircuitOpen {
+		t.Fatalf("Expected the circuit to be open, got %v", state)
+	}
+	if _, err := client.Head(ctx, "a.txt"); !errors.Is(err, ErrCircuitOpen) || CodeOf(err) != "circuit_open" {
+		t.Errorf("Expected ErrCircuitOpen, got %v", err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("Expected the open circuit to fail fast, got %d requests", n)
+	}
+
+	// A failed probe after the cooldown opens the circuit again.
+	clock.Advance(30 * time.Second)
+	if _, err := client.Head(ctx, "a.txt"); errors.Is(err, ErrCircuitOpen) || client.CircuitState() != CircuitOpen {
+		t.Errorf("Expected a failed probe, got %v and %v", err, client.CircuitState())
+	}
+
+	// A successful probe closes it.
+	clock.Advance(30 * time.Second)
+	status.Store(http.StatusOK)
+	if _, err := client.Head(ctx, "a.txt"); err != nil || client.CircuitState() != CircuitClosed {
+		t.Errorf("Expected a successful probe, got %v and %v", err, client.CircuitState())
+	}
+
+	want := []CircuitState{CircuitClosed, CircuitOpen, CircuitHalfOpen, CircuitOpen, CircuitHalfOpen, CircuitClosed}
+	if len(changes) != len(want)-1 {
+		t.Fatalf("Expected %d transitions, got %+v", len(want)-1, changes)
+	}
+	for i, change := range changes {
+		if change.From != want[i] || change.To != want[i+1] {
+			t.Errorf("Expected transition %d from %v to %v, got %+v", i, want[i], want[i+1], change)
+		}
+	}
+	if !IsRetryable(changes[0].Err) {
+		t.Errorf("Expected the opening failure, got %v", changes[0].Err)
+	}
+	if !strings.Contains(logs.String(), "blob circuit breaker") || !strings.Contains(logs.String(), "to=half-open") {
+		t.Errorf("Expected the transitions to be logged, got %s", logs.String())
+	}
+}
+
+func Test_CircuitBreaker_Failures(t *testing.T) {
+	clock := newFakeClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	client := newTestClient(t, WithCircuitBreaker(3, time.Minute, time.Minute), WithClock(clock.Now))
+	b := client.breaker
+
+	// Failures further apart than the window are not consecutive.
+	failure := ErrServiceUnavailable
+	b.record(clock.Now(), false, failure, false)
+	b.record(clock.Now(), false, failure, false)
+	clock.Advance(2 * time.Minute)
+	b.record(clock.Now(), false, failure, false)
+	b.record(clock.Now(), false, failure, false)
+	if client.CircuitState() != CircuitClosed {
+		t.Fatal("Expected failures outside the window to be forgotten")
+	}
+	// A success resets the count; ignored outcomes do not.
+	b.record(clock.Now(), false, nil, false)
+	b.record(clock.Now(), false, failure, false)
+	b.record(clock.Now(), false, failure, false)
+	b.record(clock.Now(), false, nil, true)
+	b.record(clock.Now(), false, failure, false)
+	if client.CircuitState() != CircuitOpen {
+		t.Fatal("Expected three consecutive failures to open the circuit")
+	}
+
+	// Only one probe is let through at a time.
+	clock.Advance(time.Minute)
+	if probe, _, err := b.allow(clock.Now()); !probe || err != nil {
+		t.Fatalf("Expected a probe, got %v, %v", probe, err)
+	}
+	if _, _, err := b.allow(clock.Now()); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected a second request to fail fast, got %v", err)
+	}
+
+	client.ResetCircuit()
+	if probe, _, err := b.allow(clock.Now()); client.CircuitState() != CircuitClosed || probe || err != nil {
+		t.Errorf("Expected the reset circuit to be closed, got %v", client.CircuitState())
+	}
+
+	clone, err := client.Clone()
+	if err != nil || clone.breaker == b || clone.breaker.threshold != 3 {
+		t.Errorf("Expected the clone to get a breaker of its own, got %+v, %v", clone.breaker, err)
+	}
+
+	for _, opt := range []ClientOption{
+		WithCircuitBreaker(0, 0, time.Second),
+		WithCircuitBreaker(1, -time.Second, time.Second),
+		WithCircuitBreaker(1, 0, 0),
+	} {
+		if _, err := NewClientWithOptions(opt); CodeOf(err) != "invalid_option" {
+			t.Errorf("Expected an invalid_option error, got %v", err)
+		}
+	}
+}
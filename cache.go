@@ -0,0 +1,155 @@
+package vercelblob
+
+import (
+	"container/list"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HeadCacheStats contains the counters of a head cache.
+type HeadCacheStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// headCache memoizes head results per pathname with a TTL and a size-bounded
+// LRU eviction policy. It is safe for concurrent use.
+type headCache struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	stats   HeadCacheStats
+}
+
+type headCacheEntry struct {
+	key       string
+	result    HeadBlobResult
+	expiresAt time.Time
+}
+
+func newHeadCache(ttl time.Duration, maxEntries int) *headCache {
+	return &headCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    map[string]*list.Element{},
+		lru:        list.New(),
+	}
+}
+
+// headCacheKey returns the cache key for a pathname or URL, so that both
+// forms of the same blob share an entry.
+func headCacheKey(pathnameOrURL string) string {
+	return strings.TrimPrefix(pathnameFromURL(pathnameOrURL), "/")
+}
+
+// get returns the result cached for pathnameOrURL, unless it expired by now.
+func (hc *headCache) get(now time.Time, pathnameOrURL string) (*HeadBlobResult, bool) {
+	key := headCacheKey(pathnameOrURL)
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	elem, ok := hc.entries[key]
+	if ok && now.After(elem.Value.(*headCacheEntry).expiresAt) {
+		hc.remove(elem)
+		ok = false
+	}
+	if !ok {
+		hc.stats.Misses++
+		return nil, false
+	}
+	hc.stats.Hits++
+	hc.lru.MoveToFront(elem)
+	result := elem.Value.(*headCacheEntry).result
+	result.Headers = result.Headers.Clone()
+	return &result, true
+}
+
+// put caches result for pathnameOrURL, expiring the TTL after now.
+func (hc *headCache) put(now time.Time, pathnameOrURL string, result *HeadBlobResult) {
+	key := headCacheKey(pathnameOrURL)
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	entry := &headCacheEntry{key: key, result: *result, expiresAt: now.Add(hc.ttl)}
+	entry.result.Headers = result.Headers.Clone()
+	if elem, ok := hc.entries[key]; ok {
+		elem.Value = entry
+		hc.lru.MoveToFront(elem)
+		return
+	}
+	hc.entries[key] = hc.lru.PushFront(entry)
+	for hc.maxEntries > 0 && hc.lru.Len() > hc.maxEntries {
+		hc.remove(hc.lru.Back())
+	}
+}
+
+func (hc *headCache) invalidate(pathnameOrURL string) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if elem, ok := hc.entries[headCacheKey(pathnameOrURL)]; ok {
+		hc.remove(elem)
+	}
+}
+
+func (hc *headCache) flush() {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.entries = map[string]*list.Element{}
+	hc.lru.Init()
+}
+
+// remove deletes elem. The caller must hold hc.mu.
+func (hc *headCache) remove(elem *list.Element) {
+	hc.lru.Remove(elem)
+	delete(hc.entries, elem.Value.(*headCacheEntry).key)
+}
+
+// WithHeadCache makes the client memoize Head results for ttl, keeping at
+// most maxEntries blobs (unbounded if zero). Entries are invalidated by Put,
+// Copy, Delete and UpdateMetadata through the client; changes made by other
+// clients are only seen once the TTL expires.
+func WithHeadCache(ttl time.Duration, maxEntries int) ClientOption {
+	return func(c *Client) error {
+		switch {
+		case ttl <= 0:
+			return NewInvalidOptionError("WithHeadCache", fmt.Sprintf("ttl %v is not positive", ttl))
+		case maxEntries < 0:
+			return NewInvalidOptionError("WithHeadCache", fmt.Sprintf("maxEntries %d is negative", maxEntries))
+		}
+		c.headCache = newHeadCache(ttl, maxEntries)
+		return nil
+	}
+}
+
+// FlushHeadCache removes every entry from the head cache, if enabled.
+func (c *Client) FlushHeadCache() {
+	if c.headCache != nil {
+		c.headCache.flush()
+	}
+}
+
+// HeadCacheStats returns the hit and miss counters of the head cache. It
+// returns zero counters if the cache is not enabled.
+func (c *Client) HeadCacheStats() HeadCacheStats {
+	if c.headCache == nil {
+		return HeadCacheStats{}
+	}
+	c.headCache.mu.Lock()
+	defer c.headCache.mu.Unlock()
+	return c.headCache.stats
+}
+
+// invalidateHead removes cached head results for the given pathnames or URLs.
+func (c *Client) invalidateHead(pathnamesOrURLs ...string) {
+	if c.headCache == nil {
+		return
+	}
+	for _, pathnameOrURL := range pathnamesOrURLs {
+		c.headCache.invalidate(pathnameOrURL)
+	}
+}
@@ -0,0 +1,80 @@
+package vercelblob
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_HeadCache_Mock(t *testing.T) {
+	heads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			heads++
+			_ = json.NewEncoder(w).Encode(HeadBlobResult{URL: "https://blob.com/" + r.URL.Query().Get("url"), Size: uint64(heads)})
+		case http.MethodPut:
+			_ = json.NewEncoder(w).Encode(PutBlobPutResult{URL: "https://blob.com/a.txt", Pathname: "a.txt"})
+		}
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, WithBaseURL(server.URL), WithHeadCache(time.Minute, 2), WithTokenProvider(StaticTokenProvider("test")))
+	ctx := context.Background()
+
+	head := func(pathnameOrURL string) uint64 {
+		t.Helper()
+		res, err := client.Head(ctx, pathnameOrURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.Size
+	}
+
+	if head("a.txt") != 1 || head("a.txt") != 1 || head("https://blob.com/a.txt") != 1 {
+		t.Errorf("Expected pathname and URL lookups to share a cached entry")
+	}
+	if stats := client.HeadCacheStats(); stats.Hits != 2 || stats.Misses != 1 {
+		t.Errorf("Expected 2 hits and 1 miss, got %+v", stats)
+	}
+
+	if _, err := client.Put(ctx, "a.txt", bytes.NewReader([]byte("hello")), PutCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if head("a.txt") != 2 {
+		t.Errorf("Expected Put to invalidate the cached entry")
+	}
+
+	head("b.txt")
+	head("c.txt")
+	if head("a.txt") != 5 {
+		t.Errorf("Expected the least recently used entry to be evicted")
+	}
+
+	client.FlushHeadCache()
+	if head("c.txt") != 6 {
+		t.Errorf("Expected FlushHeadCache to empty the cache")
+	}
+
+	for _, opt := range []ClientOption{WithHeadCache(0, 2), WithHeadCache(time.Minute, -1)} {
+		if _, err := NewClientWithOptions(opt); CodeOf(err) != "invalid_option" {
+			t.Errorf("Expected an invalid_option error, got %v", err)
+		}
+	}
+}
+
+func Test_HeadCache_Expiry(t *testing.T) {
+	start := time.Now()
+	cache := newHeadCache(time.Millisecond, 0)
+	cache.put(start, "a.txt", &HeadBlobResult{Size: 1})
+	if _, ok := cache.get(start, "a.txt"); !ok {
+		t.Fatal("Expected a cached entry")
+	}
+	if _, ok := cache.get(start.Add(2*time.Millisecond), "a.txt"); ok {
+		t.Error("Expected the entry to expire")
+	}
+}
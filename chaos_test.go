@@ -0,0 +1,251 @@
+package vercelblob_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	vercelblob "github.com/claywarren/vercel_blob"
+	"github.com/claywarren/vercel_blob/blobtest"
+	"github.com/claywarren/vercel_blob/testutil"
+)
+
+// The tests of this file inject faults between a client and a blobtest
+// server to check that retries, resumes and aborts behave as documented.
+
+// newChaosClient returns a client sending its requests to server through a
+// ChaosTransport injecting faults.
+func newChaosClient(t *testing.T, server *blobtest.Server, faults []testutil.Fault, opts ...vercelblob.ClientOption) (*vercelblob.Client, *testutil.ChaosTransport) {
+	t.Helper()
+	chaos := &testutil.ChaosTransport{Transport: http.DefaultTransport, Faults: faults}
+	client, err := vercelblob.NewClientWithOptions(append([]vercelblob.ClientOption{
+		vercelblob.WithBaseURL(server.URL),
+		vercelblob.WithTransport(chaos),
+		vercelblob.WithTokenProvider(vercelblob.StaticTokenProvider("token")),
+		vercelblob.WithNoEnv(),
+		vercelblob.WithRetry(vercelblob.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}),
+	}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, chaos
+}
+
+// chaosContent returns n bytes of content that differ from part to part.
+func chaosContent(n int) []byte {
+	content := make([]byte, n)
+	for i := range content {
+		content[i] = byte(i / 1000)
+	}
+	return content
+}
+
+func Test_Multipart_Chaos(t *testing.T) {
+	content := chaosContent(2*vercelblob.MultipartThreshold + 1000)
+	part := func(n int) testutil.Matcher {
+		return testutil.Matcher{Operation: vercelblob.OperationMultipartPart, Pathname: "big.bin", PartNumber: n}
+	}
+	complete := testutil.Matcher{Operation: vercelblob.OperationMultipartComplete, Pathname: "big.bin"}
+
+	t.Run("failed part is retried alone", func(t *testing.T) {
+		server := blobtest.NewServer()
+		defer server.Close()
+		client, chaos := newChaosClient(t, server, []testutil.Fault{
+			{Match: part(1), Kind: testutil.FaultResetRequest, Bytes: 1024, Times: 1},
+			{Match: part(2), Kind: testutil.FaultStatus, Status: http.StatusServiceUnavailable, Times: 2},
+		})
+
+		if _, err := client.Put(context.Background(), "big.bin", bytes.NewReader(content), vercelblob.PutCommandOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if blob, ok := server.Blob("big.bin"); !ok || !bytes.Equal(blob.Content, content) {
+			t.Error("Expected the whole content to be stored")
+		}
+		create := testutil.Matcher{Operation: vercelblob.OperationMultipartCreate, Pathname: "big.bin"}
+		for m, want := range map[testutil.Matcher]int{create: 1, part(1): 2, part(2): 3, part(3): 1, complete: 1} {
+			if n := chaos.Attempts(m); n != want {
+				t.Errorf("Expected %d attempts at %+v, got %d", want, m, n)
+			}
+		}
+	})
+
+	t.Run("upload aborts on failure", func(t *testing.T) {
+		server := blobtest.NewServer()
+		defer server.Close()
+		var events []vercelblob.Event
+		client, chaos := newChaosClient(t, server, []testutil.Fault{
+			{Match: part(2), Kind: testutil.FaultStatus, Status: http.StatusServiceUnavailable},
+		}, vercelblob.WithEventListener(func(e vercelblob.Event) { events = append(events, e) }))
+
+		_, err := client.Put(context.Background(), "big.bin", bytes.NewReader(content), vercelblob.PutCommandOptions{})
+		if !errors.Is(err, vercelblob.ErrServiceUnavailable) {
+			t.Fatalf("Expected the part failure, got %v", err)
+		}
+		if n := chaos.Attempts(part(2)); n != 3 {
+			t.Errorf("Expected the part to be sent 3 times, got %d", n)
+		}
+		if n, m := chaos.Attempts(part(3)), chaos.Attempts(complete); n != 0 || m != 0 {
+			t.Errorf("Expected no request after the failed part, got %d parts and %d completes", n, m)
+		}
+		if _, ok := server.Blob("big.bin"); ok {
+			t.Error("Expected no blob to be stored")
+		}
+		abort := testutil.Matcher{Operation: vercelblob.OperationMultipartAbort, Pathname: "big.bin"}
+		if n := chaos.Attempts(abort); n != 1 || server.OpenUploads() != 0 {
+			t.Errorf("Expected the upload to be aborted, got %d aborts and %d open uploads", n, server.OpenUploads())
+		}
+		if len(events) == 0 {
+			t.Fatal("Expected events")
+		}
+		if aborted, ok := events[len(events)-1].(vercelblob.UploadAborted); !ok || !errors.Is(aborted.Err, vercelblob.ErrServiceUnavailable) {
+			t.Errorf("Expected the upload to end aborted, got %+v", events[len(events)-1])
+		}
+	})
+}
+
+func Test_Download_Resume_Chaos(t *testing.T) {
+	content := chaosContent(100_000)
+	download := func(attempt int) testutil.Matcher {
+		return testutil.Matcher{Operation: vercelblob.OperationDownload, Attempt: attempt}
+	}
+
+	t.Run("resumed twice", func(t *testing.T) {
+		server := blobtest.NewServer()
+		defer server.Close()
+		client, chaos := newChaosClient(t, server, []testutil.Fault{
+			{Match: download(1), Kind: testutil.FaultResetResponse, Bytes: 1000},
+			{Match: download(2), Kind: testutil.FaultTruncate, Bytes: 5000},
+		})
+		server.Seed("a.bin", content, "")
+
+		data, err := client.Download(context.Background(), server.BlobURL("a.bin"), vercelblob.DownloadCommandOptions{})
+		if err != nil || !bytes.Equal(data, content) {
+			t.Fatalf("Expected the whole content, got %d bytes, %v", len(data), err)
+		}
+		if injections := chaos.Injections(); len(injections) != 2 {
+			t.Errorf("Expected 2 faults, got %+v", injections)
+		}
+	})
+
+	t.Run("ranged", func(t *testing.T) {
+		server := blobtest.NewServer()
+		defer server.Close()
+		client, _ := newChaosClient(t, server, []testutil.Fault{
+			{Match: download(1), Kind: testutil.FaultResetResponse, Bytes: 10},
+		})
+		server.Seed("a.bin", content, "")
+
+		data, err := client.Download(context.Background(), server.BlobURL("a.bin"), vercelblob.DownloadCommandOptions{ByteRange: &vercelblob.Range{Start: 100, End: 1099}})
+		if err != nil || !bytes.Equal(data, content[100:1100]) {
+			t.Errorf("Expected the range, got %d bytes, %v", len(data), err)
+		}
+	})
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		server := blobtest.NewServer()
+		defer server.Close()
+		client, chaos := newChaosClient(t, server, []testutil.Fault{
+			{Match: download(0), Kind: testutil.FaultResetResponse, Bytes: 1000},
+		})
+		server.Seed("a.bin", content, "")
+
+		_, err := client.Download(context.Background(), server.BlobURL("a.bin"), vercelblob.DownloadCommandOptions{})
+		var transportErr *vercelblob.TransportError
+		if !errors.As(err, &transportErr) || !vercelblob.IsRetryable(err) {
+			t.Errorf("Expected a retryable transport error, got %v", err)
+		}
+		if n := chaos.Attempts(testutil.Matcher{Operation: vercelblob.OperationDownload, Pathname: server.BlobURL("a.bin")}); n != 3 {
+			t.Errorf("Expected 3 requests, got %d", n)
+		}
+	})
+
+	t.Run("blob changed", func(t *testing.T) {
+		server := blobtest.NewServer()
+		defer server.Close()
+		client, chaos := newChaosClient(t, server, []testutil.Fault{
+			{Match: download(1), Kind: testutil.FaultResetResponse, Bytes: 1000},
+		})
+		server.Seed("a.bin", content, "")
+		chaos.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get("If-Range") != "" {
+				server.Seed("a.bin", []byte("replaced"), "")
+			}
+			return http.DefaultTransport.RoundTrip(req)
+		})
+
+		_, err := client.Download(context.Background(), server.BlobURL("a.bin"), vercelblob.DownloadCommandOptions{})
+		if err == nil || !strings.Contains(err.Error(), "blob changed") {
+			t.Errorf("Expected the resume to be refused, got %v", err)
+		}
+	})
+}
+
+func Test_Retry_Budget_Chaos(t *testing.T) {
+	unavailable := []testutil.Fault{{Match: testutil.Matcher{Operation: vercelblob.OperationHead}, Kind: testutil.FaultStatus, Status: http.StatusServiceUnavailable}}
+
+	t.Run("attempts", func(t *testing.T) {
+		server := blobtest.NewServer()
+		defer server.Close()
+		var retries []vercelblob.RetryAttempt
+		client, chaos := newChaosClient(t, server, unavailable, vercelblob.WithOnRetry(func(attempt vercelblob.RetryAttempt) {
+			retries = append(retries, attempt)
+		}))
+
+		if _, err := client.Head(context.Background(), "a.txt"); !errors.Is(err, vercelblob.ErrServiceUnavailable) {
+			t.Errorf("Expected service_unavailable, got %v", err)
+		}
+		if n := chaos.Attempts(testutil.Matcher{Operation: vercelblob.OperationHead, Pathname: "a.txt"}); n != 3 || len(retries) != 2 {
+			t.Errorf("Expected 3 attempts and 2 retries, got %d and %d", n, len(retries))
+		}
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		server := blobtest.NewServer()
+		defer server.Close()
+		client, chaos := newChaosClient(t, server, unavailable, vercelblob.WithRetry(vercelblob.RetryPolicy{MaxAttempts: 10, BaseDelay: time.Hour}))
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		// The backoff is shortened so that one more attempt fits before the
+		// deadline, after which there is no time left for another.
+		start := time.Now()
+		_, err := client.Head(ctx, "a.txt")
+		if err == nil || !strings.Contains(err.Error(), "deadline would be exceeded") || !errors.Is(err, vercelblob.ErrServiceUnavailable) {
+			t.Errorf("Expected the retry to be given up, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed >= 200*time.Millisecond {
+			t.Errorf("Expected to give up before the deadline, took %v", elapsed)
+		}
+		if n := chaos.Attempts(testutil.Matcher{Operation: vercelblob.OperationHead, Pathname: "a.txt"}); n != 2 {
+			t.Errorf("Expected 2 attempts, got %d", n)
+		}
+	})
+
+	t.Run("slow response", func(t *testing.T) {
+		server := blobtest.NewServer()
+		defer server.Close()
+		server.Seed("a.txt", []byte("a"), "")
+		client, chaos := newChaosClient(t, server, []testutil.Fault{
+			{Match: testutil.Matcher{Operation: vercelblob.OperationHead}, Kind: testutil.FaultDelay, Delay: time.Minute},
+		})
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		if _, err := client.Head(ctx, "a.txt"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected the deadline to be exceeded, got %v", err)
+		}
+		if n := chaos.Attempts(testutil.Matcher{Operation: vercelblob.OperationHead, Pathname: "a.txt"}); n != 1 {
+			t.Errorf("Expected the slow request not to be retried, got %d attempts", n)
+		}
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -4,12 +4,16 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // BlobAPIVersion is the version of the Vercel Blob API.
@@ -18,12 +22,64 @@ const (
 	DefaultBaseURL = "https://blob.vercel-storage.com"
 )
 
+// Version is the version of this package.
+const Version = "0.1.0"
+
+// DefaultUserAgent is the User-Agent header sent with every request unless it
+// is replaced with WithUserAgent.
+const DefaultUserAgent = "vercel-blob-go/" + Version
+
 // Client is a client for the Vercel Blob Storage API.
+//
+// A Client is safe for concurrent use by multiple goroutines. Its
+// configuration is fixed when it is created and cannot be changed afterwards;
+// Clone and the methods returning a modified copy, such as ForStore and
+// WithPrefix, create a new client and leave the original untouched. The state
+// that changes as requests are made, such as the head cache and the counters
+// of hooks, is synchronized internally.
 type Client struct {
-	tokenProvider TokenProvider
-	baseURL       string
-	apiVersion    string
-	httpClient    *http.Client
+	tokenProvider     TokenProvider
+	baseURL           string
+	apiVersion        string
+	httpClient        *http.Client
+	baseHTTPClient    *http.Client
+	headCache         *headCache
+	storeID           string
+	tokenRefresh      *tokenRefreshGuard
+	tokenRenewal      TokenRenewal
+	authAudit         *authAudit
+	timeout           time.Duration
+	operationTimeouts map[Operation]time.Duration
+	transport         http.RoundTripper
+	userAgent         string
+	scope             string
+	keepPrefixInList  bool
+	middleware        []Middleware
+	noEnv             bool
+	defaultHeaders    http.Header
+	logger            *slog.Logger
+	logLevel          slog.Level
+	dryRun            bool
+	dryRunRecorder    DryRunRecorder
+	lifecycle         *lifecycle
+	rateLimits        *rateLimits
+	retryPolicy       RetryPolicy
+	operationRetries  map[Operation]RetryPolicy
+	retryHook         *retryHook
+	hedgePolicy       HedgePolicy
+	breaker           *circuitBreaker
+	circuitHook       func(CircuitStateChange)
+	idempotencyHeader string
+	failover          *failover
+	failoverPolicy    FailoverPolicy
+	metrics           MetricsRecorder
+	debugDump         *debugDump
+	eventListener     func(Event)
+	usage             *usageCounters
+	slowThreshold     time.Duration
+	headerInjector    func(context.Context, http.Header)
+	clock             func() time.Time
+	rand              *lockedRand
 }
 
 // BlobAPIErrorDetail contains details about a blob API error.
@@ -39,21 +95,43 @@ type BlobAPIError struct {
 
 // NewClient creates a new client for use inside a Vercel function.
 func NewClient() *Client {
-	return &Client{
-		baseURL:    getEnv("VERCEL_BLOB_API_URL", getEnv("NEXT_PUBLIC_VERCEL_BLOB_API_URL", DefaultBaseURL)),
-		apiVersion: getEnv("VERCEL_BLOB_API_VERSION", BlobAPIVersion),
-		httpClient: &http.Client{},
-	}
+	c, _ := NewClientWithOptions()
+	return c
 }
 
 // NewClientExternal creates a new client for use outside of Vercel.
 func NewClientExternal(tokenProvider TokenProvider) *Client {
-	return &Client{
-		tokenProvider: tokenProvider,
-		baseURL:       getEnv("VERCEL_BLOB_API_URL", getEnv("NEXT_PUBLIC_VERCEL_BLOB_API_URL", DefaultBaseURL)),
-		apiVersion:    getEnv("VERCEL_BLOB_API_VERSION", BlobAPIVersion),
-		httpClient:    &http.Client{},
+	if tokenProvider == nil {
+		return NewClient()
 	}
+	c, _ := NewClientWithOptions(WithTokenProvider(tokenProvider))
+	return c
+}
+
+// NewClientWithToken creates a new client that authenticates with the given
+// token. The token takes precedence over the BLOB_READ_WRITE_TOKEN environment
+// variable.
+func NewClientWithToken(token string) *Client {
+	return NewClientExternal(StaticTokenProvider(token))
+}
+
+// BaseURL returns the URL of the blob API the client sends requests to; see
+// ActiveBaseURL for clients with fallback URLs.
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
+// ForStore returns a copy of the client that addresses the given blob store.
+// The store ID is passed to token providers implementing StoreTokenProvider,
+// such as MultiStoreTokenProvider; other providers are unaffected. The copy
+// gets its own head cache, if enabled, so results are not mixed between stores.
+func (c *Client) ForStore(storeID string) *Client {
+	clone := *c
+	clone.storeID = storeID
+	if c.headCache != nil {
+		clone.headCache = newHeadCache(c.headCache.ttl, c.headCache.maxEntries)
+	}
+	return &clone
 }
 
 func getEnv(key, fallback string) string {
@@ -63,43 +141,115 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
-func (c *Client) getAPIURL(pathname string) string {
-	base, _ := url.Parse(c.baseURL)
-	base.Path = pathname
-	return base.String()
+// getAPIURL returns the URL of pathname below the base URL of the client,
+// keeping any path of the base URL, e.g. of a gateway mounted at /blob. Each
+// segment of pathname is percent-encoded, so names containing spaces, '#',
+// '?' or '%' address the blob of that name.
+func (c *Client) getAPIURL(pathname string) (string, error) {
+	base, err := url.Parse(c.baseURL)
+	if err != nil {
+		return "", fmt.Errorf("parse base URL %q: %w", c.baseURL, err)
+	}
+	segments := strings.Split(strings.TrimPrefix(pathname, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	base.RawPath = strings.TrimSuffix(base.EscapedPath(), "/") + "/" + strings.Join(segments, "/")
+	if base.Path, err = url.PathUnescape(base.RawPath); err != nil {
+		return "", fmt.Errorf("parse base URL %q: %w", c.baseURL, err)
+	}
+	return base.String(), nil
 }
 
 func (c *Client) addAPIVersionHeader(req *http.Request) {
 	req.Header.Set("x-api-version", c.apiVersion)
 }
 
-func (c *Client) addAuthorizationHeader(req *http.Request, operation, pathname string) error {
+func (c *Client) addAuthorizationHeader(req *http.Request, operation Operation, pathname string) error {
+	token, err := c.resolveToken(operation, pathname)
+	c.auditAuth(operation, pathname, token, err)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+func (c *Client) resolveToken(operation Operation, pathname string) (string, error) {
 	var token string
 	if c.tokenProvider != nil {
-		token, _ = c.tokenProvider.GetToken(operation, pathname)
+		var err error
+		if sp, ok := c.tokenProvider.(StoreTokenProvider); ok && c.storeID != "" {
+			token, err = sp.GetStoreToken(c.storeID, string(operation), pathname)
+		} else {
+			token, err = c.tokenProvider.GetToken(string(operation), pathname)
+		}
+		if err != nil {
+			return "", fmt.Errorf("get token for %s %q: %w", operation, pathname, err)
+		}
 	} else {
 		token = os.Getenv("BLOB_READ_WRITE_TOKEN")
 	}
 
 	if token == "" {
-		return ErrNotAuthenticated
+		return "", ErrNotAuthenticated
 	}
-
-	req.Header.Set("Authorization", "Bearer "+token)
-	return nil
+	return token, nil
 }
 
+// handleError closes the body of an unsuccessful response and returns an
+// *APIError describing it.
 func (c *Client) handleError(resp *http.Response) error {
-	if resp.StatusCode >= 500 {
-		return NewUnknownError(resp.StatusCode, http.StatusText(resp.StatusCode))
+	defer func() { _ = resp.Body.Close() }()
+	return c.newAPIError(resp, decodeError(resp))
+}
+
+// newAPIError returns an *APIError for err, which was reported by resp.
+func (c *Client) newAPIError(resp *http.Response, err *Error) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		RequestID:  responseRequestID(resp),
+		RetryAfter: retryAfter(resp, c.now()),
+		Err:        err,
+	}
+	if resp.Request != nil {
+		if info, ok := RequestInfoFromContext(resp.Request.Context()); ok {
+			apiErr.Operation, apiErr.Pathname = info.Operation, info.Pathname
+		}
 	}
+	return apiErr
+}
 
-	var errResp BlobAPIError
-	defer func() { _ = resp.Body.Close() }()
-	if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
-		return err
+// decodeError returns the error described by the body of an unsuccessful
+// response.
+func decodeError(resp *http.Response) *Error {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return ErrRateLimited
 	}
 
+	var errResp BlobAPIError
+	if err := decodeResponse(resp, &errResp); err != nil {
+		// The blob host and proxies answer without a JSON body.
+		switch {
+		case resp.StatusCode == http.StatusNotFound:
+			return ErrBlobNotFound
+		case resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden:
+			return ErrForbidden
+		}
+		unknown := UnknownError(resp.StatusCode, http.StatusText(resp.StatusCode))
+		var respErr *UnexpectedResponseError
+		if !errors.As(err, &respErr) || respErr.Body != "" {
+			unknown.Err = err
+		}
+		return unknown
+	}
+
+	// The API may echo parts of the request, so never let the token through.
+	message := redactTokens(errResp.Error.Message, requestToken(resp.Request))
+	if message == "" {
+		message = http.StatusText(resp.StatusCode)
+	}
 	switch errResp.Error.Code {
 	case "store_suspended":
 		return ErrStoreSuspended
@@ -109,15 +259,105 @@ func (c *Client) handleError(resp *http.Response) error {
 		return ErrBlobNotFound
 	case "store_not_found":
 		return ErrStoreNotFound
+	case "rate_limited":
+		return ErrRateLimited
+	case "service_unavailable":
+		return ErrServiceUnavailable
+	case "blob_already_exists":
+		return ErrBlobAlreadyExists
 	case "bad_request":
-		return ErrBadRequest(errResp.Error.Message)
+		// Older API versions report existing blobs as bad requests.
+		if strings.Contains(strings.ToLower(message), "already exists") {
+			return ErrBlobAlreadyExists
+		}
+		return BadRequestError(message)
 	default:
-		return NewUnknownError(resp.StatusCode, errResp.Error.Message)
+		return UnknownError(resp.StatusCode, message)
+	}
+}
+
+// maxResponseBody is the size up to which a response body is read to be
+// decoded.
+const maxResponseBody = 16 << 20
+
+// decodeResponse decodes the JSON body of resp into v. If the body is not
+// valid JSON, the error includes its start.
+func decodeResponse(resp *http.Response, v any) error {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return newUnexpectedResponseError(resp, body, err)
+	}
+	if validator, ok := v.(responseValidator); ok {
+		if err := validator.validateResponse(); err != nil {
+			return newUnexpectedResponseError(resp, body, err)
+		}
+	}
+	if recorder, ok := v.(requestIDRecorder); ok {
+		recorder.setRequestID(responseRequestID(resp))
+	}
+	return nil
+}
+
+// requestIDRecorder is implemented by results that report the ID of the
+// request they were decoded from.
+type requestIDRecorder interface {
+	setRequestID(id string)
+}
+
+func (r *PutBlobPutResult) setRequestID(id string) { r.RequestID = id }
+func (r *HeadBlobResult) setRequestID(id string)   { r.RequestID = id }
+func (r *ListBlobResult) setRequestID(id string)   { r.RequestID = id }
+
+// responseValidator is implemented by results that reject responses missing
+// the fields callers rely on, so that a malformed success response does not
+// pass as an empty result.
+type responseValidator interface {
+	validateResponse() error
+}
+
+func (r *PutBlobPutResult) validateResponse() error {
+	switch {
+	case r.URL == "":
+		return NewMissingFieldError("url")
+	case r.Pathname == "":
+		return NewMissingFieldError("pathname")
+	}
+	return nil
+}
+
+// validateResponse only rejects responses that identify no blob at all;
+// HeadCommandOptions.Strict checks the fields one by one.
+func (r *HeadBlobResult) validateResponse() error {
+	if r.URL == "" && r.Pathname == "" {
+		return NewMissingFieldError("url and pathname")
+	}
+	return nil
+}
+
+func (r *ListBlobResult) validateResponse() error {
+	for i, blob := range r.Blobs {
+		switch {
+		case blob.URL == "":
+			return NewMissingFieldError(fmt.Sprintf("blobs[%d].url", i))
+		case blob.PathName == "":
+			return NewMissingFieldError(fmt.Sprintf("blobs[%d].pathname", i))
+		}
 	}
+	return nil
 }
 
 // List files in the blob store.
 func (c *Client) List(ctx context.Context, options ListCommandOptions) (*ListBlobResult, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	return c.listInScope(ctx, options, !c.keepPrefixInList)
+}
+
+func (c *Client) list(ctx context.Context, options ListCommandOptions) (*ListBlobResult, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL, nil)
 	if err != nil {
 		return nil, err
@@ -139,12 +379,12 @@ func (c *Client) List(ctx context.Context, options ListCommandOptions) (*ListBlo
 	req.URL.RawQuery = q.Encode()
 
 	c.addAPIVersionHeader(req)
-	err = c.addAuthorizationHeader(req, "list", "")
+	err = c.addAuthorizationHeader(req, OperationList, options.Prefix)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req, OperationList, options.Prefix)
 	if err != nil {
 		return nil, err
 	}
@@ -155,20 +395,15 @@ func (c *Client) List(ctx context.Context, options ListCommandOptions) (*ListBlo
 	}
 
 	var result ListBlobResult
-	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	if err = decodeResponse(resp, &result); err != nil {
 		return nil, err
 	}
 
 	return &result, nil
 }
 
-// Put uploads a file to the blob store.
-func (c *Client) Put(ctx context.Context, pathname string, body io.Reader, options PutCommandOptions) (*PutBlobPutResult, error) {
-	if len(pathname) == 0 {
-		return nil, NewInvalidInputError("pathname")
-	}
-
-	// Determine if we should use multipart
+// bodySize returns the size of a body that reports it or can seek, or -1.
+func bodySize(body io.Reader) int64 {
 	var size int64 = -1
 	if sizer, ok := body.(interface{ Size() int64 }); ok {
 		size = sizer.Size()
@@ -177,26 +412,75 @@ func (c *Client) Put(ctx context.Context, pathname string, body io.Reader, optio
 		size, _ = seeker.Seek(0, io.SeekEnd)
 		_, _ = seeker.Seek(curr, io.SeekStart)
 	}
+	return size
+}
 
-	if size > MultipartThreshold {
-		return c.putMultipart(ctx, pathname, body, options)
+// Put uploads a file to the blob store.
+func (c *Client) Put(ctx context.Context, pathname string, body io.Reader, options PutCommandOptions) (*PutBlobPutResult, error) {
+	if len(pathname) == 0 {
+		return nil, InvalidInputError("pathname")
+	}
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	if c.scope != "" {
+		scoped, err := c.scopePathname(pathname)
+		if err != nil {
+			return nil, err
+		}
+		return c.unscoped().Put(ctx, scoped, body, options)
+	}
+	defer c.invalidateHead(pathname)
+	ctx, key := c.withIdempotencyKey(ctx, OperationPut)
+	ctx, stats := withOperationStats(ctx)
+
+	size := bodySize(body)
+	multipart := size > MultipartThreshold
+	if c.eventListener != nil {
+		c.eventListener(UploadStarted{EventInfo: c.eventInfo(OperationPut, pathname, ""), Size: size, Multipart: multipart})
+	}
+	var result *PutBlobPutResult
+	var uploadID string
+	var err error
+	if multipart {
+		result, uploadID, err = c.putMultipart(ctx, pathname, body, size, options)
+	} else {
+		result, err = c.put(ctx, pathname, body, options)
+	}
+	if err != nil {
+		if c.eventListener != nil {
+			c.eventListener(UploadAborted{EventInfo: c.eventInfo(OperationPut, pathname, uploadID), Err: err})
+		}
+		return nil, err
+	}
+	result.IdempotencyKey = key
+	result.Stats = stats.snapshot()
+	if c.eventListener != nil {
+		c.eventListener(UploadCompleted{EventInfo: c.eventInfo(OperationPut, pathname, uploadID), URL: result.URL})
 	}
+	return result, nil
+}
 
-	apiURL := c.getAPIURL(pathname)
+// put uploads a blob in a single request.
+func (c *Client) put(ctx context.Context, pathname string, body io.Reader, options PutCommandOptions) (*PutBlobPutResult, error) {
+	apiURL, err := c.getAPIURL(pathname)
+	if err != nil {
+		return nil, err
+	}
 	req, err := http.NewRequestWithContext(ctx, http.MethodPut, apiURL, body)
 	if err != nil {
 		return nil, err
 	}
 
 	c.addAPIVersionHeader(req)
-	err = c.addAuthorizationHeader(req, "put", pathname)
+	err = c.addAuthorizationHeader(req, OperationPut, pathname)
 	if err != nil {
 		return nil, err
 	}
 
 	c.setPutHeaders(req, options)
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req, OperationPut, pathname)
 	if err != nil {
 		return nil, err
 	}
@@ -207,10 +491,9 @@ func (c *Client) Put(ctx context.Context, pathname string, body io.Reader, optio
 	}
 
 	var result PutBlobPutResult
-	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	if err = decodeResponse(resp, &result); err != nil {
 		return nil, err
 	}
-
 	return &result, nil
 }
 
@@ -224,6 +507,9 @@ func (c *Client) setPutHeaders(req *http.Request, options PutCommandOptions) {
 	if options.CacheControlMaxAge > 0 {
 		req.Header.Set("X-Cache-Control-Max-Age", strconv.FormatUint(options.CacheControlMaxAge, 10))
 	}
+	if options.AllowOverwrite {
+		req.Header.Set("X-Allow-Overwrite", "1")
+	}
 	access := options.Access
 	if access == "" {
 		access = "public"
@@ -231,36 +517,139 @@ func (c *Client) setPutHeaders(req *http.Request, options PutCommandOptions) {
 	req.Header.Set("X-Access", access)
 }
 
-// Head gets the metadata for a file in the blob store.
-func (c *Client) Head(ctx context.Context, pathname string) (*HeadBlobResult, error) {
-	apiURL := c.getAPIURL(pathname)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+// Head gets the metadata for a file in the blob store. The blob is addressed
+// by its full URL or by its pathname.
+func (c *Client) Head(ctx context.Context, pathnameOrURL string) (*HeadBlobResult, error) {
+	return c.HeadWithOptions(ctx, pathnameOrURL, HeadCommandOptions{})
+}
+
+// HeadWithOptions gets the metadata for a file in the blob store.
+//
+// When options.IfNoneMatch matches the current ETag of the blob, the result
+// only has NotModified and ETag set; no error is returned.
+func (c *Client) HeadWithOptions(ctx context.Context, pathnameOrURL string, options HeadCommandOptions) (*HeadBlobResult, error) {
+	if len(pathnameOrURL) == 0 {
+		return nil, InvalidInputError("pathnameOrURL")
+	}
+	if c.scope != "" {
+		scoped, err := c.scopePathname(pathnameOrURL)
+		if err != nil {
+			return nil, err
+		}
+		return c.unscoped().HeadWithOptions(ctx, scoped, options)
+	}
+	if c.headCache != nil && options.IfNoneMatch == "" {
+		if result, ok := c.headCache.get(c.now(), pathnameOrURL); ok && (!options.Strict || checkHeadFields(result) == nil) {
+			return result, nil
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL, nil)
 	if err != nil {
 		return nil, err
 	}
+	q := req.URL.Query()
+	q.Add("url", headTarget(pathnameOrURL))
+	req.URL.RawQuery = q.Encode()
+
 	c.addAPIVersionHeader(req)
-	_ = c.addAuthorizationHeader(req, "put", pathname)
+	if err = c.addAuthorizationHeader(req, OperationHead, pathnameOrURL); err != nil {
+		return nil, err
+	}
+	if options.IfNoneMatch != "" {
+		req.Header.Set("If-None-Match", options.IfNoneMatch)
+	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req, OperationHead, pathnameOrURL)
 	if err != nil {
 		return nil, err
 	}
 	defer func() { _ = resp.Body.Close() }()
 
-	if resp.StatusCode == http.StatusNotFound {
-		return nil, ErrBlobNotFound
+	if resp.StatusCode == http.StatusNotModified {
+		etag := resp.Header.Get("ETag")
+		if etag == "" {
+			etag = options.IfNoneMatch
+		}
+		return &HeadBlobResult{NotModified: true, ETag: etag, Headers: resp.Header, RequestID: responseRequestID(resp)}, nil
+	} else if resp.StatusCode == http.StatusNotFound {
+		return nil, c.newAPIError(resp, ErrBlobNotFound)
 	} else if resp.StatusCode != http.StatusOK {
 		return nil, c.handleError(resp)
 	}
 
 	var result HeadBlobResult
-	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	if err = decodeResponse(resp, &result); err != nil {
 		return nil, err
 	}
+	if options.Strict {
+		if err = checkHeadFields(&result); err != nil {
+			return nil, err
+		}
+	}
+	if result.DownloadURL == "" {
+		result.DownloadURL = downloadURL(result.URL)
+	}
+	result.Headers = resp.Header
+	result.ETag = resp.Header.Get("ETag")
+	if c.headCache != nil {
+		c.headCache.put(c.now(), pathnameOrURL, &result)
+	}
 
 	return &result, nil
 }
 
+// checkHeadFields returns an error for the first field missing from a head
+// response.
+func checkHeadFields(result *HeadBlobResult) error {
+	switch {
+	case result.URL == "":
+		return NewMissingFieldError("url")
+	case result.Pathname == "":
+		return NewMissingFieldError("pathname")
+	case !result.SizeKnown:
+		return NewMissingFieldError("size")
+	case !result.UploadedAtKnown:
+		return NewMissingFieldError("uploadedAt")
+	}
+	return nil
+}
+
+// downloadURL returns the URL that serves a blob as an attachment.
+func downloadURL(blobURL string) string {
+	u, err := url.Parse(blobURL)
+	if err != nil || blobURL == "" {
+		return ""
+	}
+	q := u.Query()
+	q.Set("download", "1")
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// Exists reports whether a blob exists. It returns false with a nil error only
+// when the API reports the blob as not found; every other failure, such as an
+// authentication error, is returned unchanged.
+func (c *Client) Exists(ctx context.Context, pathnameOrURL string) (bool, error) {
+	_, err := c.Head(ctx, pathnameOrURL)
+	if errors.Is(err, ErrBlobNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// headTarget returns the url query parameter for a head request. Full URLs are
+// sent as is; pathnames, which earlier versions of Head accepted with or
+// without a leading slash, are sent without one.
+func headTarget(pathnameOrURL string) string {
+	if u, err := url.Parse(pathnameOrURL); err == nil && u.IsAbs() {
+		return pathnameOrURL
+	}
+	return strings.TrimPrefix(pathnameOrURL, "/")
+}
+
 type deleteRequest struct {
 	URLs []string `json:"urls"`
 }
@@ -270,14 +659,31 @@ func (c *Client) Delete(ctx context.Context, urls ...string) error {
 	if len(urls) == 0 {
 		return nil
 	}
-	apiURL := c.getAPIURL("/delete")
+	if c.scope != "" {
+		scoped, err := c.scopePathnames(urls)
+		if err != nil {
+			return err
+		}
+		return c.unscoped().Delete(ctx, scoped...)
+	}
+	defer c.invalidateHead(urls...)
+	ctx, _ = c.withIdempotencyKey(ctx, OperationDelete)
+	apiURL, err := c.getAPIURL("/delete")
+	if err != nil {
+		return err
+	}
 	reqBody, _ := json.Marshal(deleteRequest{URLs: urls})
-	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewReader(reqBody))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
 	req.Header.Set("Content-Type", "application/json")
 	c.addAPIVersionHeader(req)
-	_ = c.addAuthorizationHeader(req, "delete", urls[0])
+	if err := c.addAuthorizationHeader(req, OperationDelete, urls[0]); err != nil {
+		return err
+	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req, OperationDelete, urls[0])
 	if err != nil {
 		return err
 	}
@@ -289,53 +695,178 @@ func (c *Client) Delete(ctx context.Context, urls ...string) error {
 }
 
 // Copy copies an existing blob object to a new path within the blob store.
+//
+// Copy is kept for compatibility; see CopyWithOptions for explicit control
+// over metadata inheritance.
 func (c *Client) Copy(ctx context.Context, fromURL, toPath string, options PutCommandOptions) (*PutBlobPutResult, error) {
-	if len(fromURL) == 0 {
-		return nil, NewInvalidInputError("fromURL")
+	result, err := c.CopyWithOptions(ctx, fromURL, toPath, copyOptionsFromPut(options))
+	if err != nil {
+		return nil, err
+	}
+	return &result.PutBlobPutResult, nil
+}
+
+// Download a blob from the blob store.
+func (c *Client) Download(ctx context.Context, urlPath string, options DownloadCommandOptions) ([]byte, error) {
+	result, err := c.DownloadWithResult(ctx, urlPath, options)
+	if err != nil {
+		return nil, err
 	}
-	if len(toPath) == 0 {
-		return nil, NewInvalidInputError("toPath")
+	return result.Content, nil
+}
+
+// DownloadResult is the response from the download operation.
+type DownloadResult struct {
+	Content     []byte
+	ContentType string
+	// RequestID identifies the request to Vercel support, from the
+	// X-Vercel-Id header of the response.
+	RequestID string
+	Stats     OperationStats
+}
+
+// DownloadWithResult downloads a blob like Download, and also reports the
+// content type and request ID of the response.
+func (c *Client) DownloadWithResult(ctx context.Context, urlPath string, options DownloadCommandOptions) (*DownloadResult, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
 	}
-	apiURL := c.getAPIURL(toPath)
-	req, _ := http.NewRequestWithContext(ctx, http.MethodPut, apiURL, nil)
-	q := req.URL.Query()
-	q.Add("fromUrl", fromURL)
-	req.URL.RawQuery = q.Encode()
+	if c.scope != "" {
+		if _, err := c.scopePathname(urlPath); err != nil {
+			return nil, err
+		}
+	}
+	ctx, stats := withOperationStats(ctx)
+	if c.eventListener != nil {
+		c.eventListener(DownloadStarted{EventInfo: c.eventInfo(OperationDownload, urlPath, ""), Range: options.ByteRange})
+	}
+	content, resp, err := c.downloadContent(ctx, urlPath, options)
+	if err != nil {
+		if c.eventListener != nil {
+			c.eventListener(DownloadFailed{EventInfo: c.eventInfo(OperationDownload, urlPath, ""), Err: err})
+		}
+		return nil, err
+	}
+	if c.eventListener != nil {
+		c.eventListener(DownloadCompleted{EventInfo: c.eventInfo(OperationDownload, urlPath, ""), Size: int64(len(content))})
+	}
+	return &DownloadResult{
+		Content:     content,
+		ContentType: resp.Header.Get("Content-Type"),
+		RequestID:   responseRequestID(resp),
+		Stats:       stats.snapshot(),
+	}, nil
+}
 
+// downloadContent downloads a blob and reads its content. If the body breaks
+// off and the retry policy of the client allows another attempt, the rest is
+// requested from where it broke off; see WithRetry. The returned response,
+// the first one, is closed.
+func (c *Client) downloadContent(ctx context.Context, urlPath string, options DownloadCommandOptions) ([]byte, *http.Response, error) {
+	first, err := c.download(ctx, urlPath, options)
+	if err != nil {
+		return nil, nil, err
+	}
+	policy := c.retryPolicyFor(OperationDownload)
+	resp := first
+	var content bytes.Buffer
+	for attempt := 1; ; attempt++ {
+		_, err = content.ReadFrom(resp.Body)
+		_ = resp.Body.Close()
+		if err == nil {
+			return content.Bytes(), first, nil
+		}
+		err = newTransportError(err, OperationDownload, urlPath)
+		etag := first.Header.Get("ETag")
+		if attempt >= policy.MaxAttempts || !IsRetryable(err) || etag == "" {
+			return nil, nil, err
+		}
+
+		delay := policy.delay(attempt, err, c.random())
+		req := resp.Request
+		if req == nil {
+			if req, err = http.NewRequestWithContext(ctx, http.MethodGet, urlPath, nil); err != nil {
+				return nil, nil, err
+			}
+		}
+		c.notifyRetry(req, policy, RetryAttempt{Operation: OperationDownload, Pathname: urlPath, Attempt: attempt, Delay: delay, Err: err})
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, nil, ctx.Err()
+		}
+		if resp, err = c.resumeDownload(ctx, urlPath, options, etag, uint(content.Len())); err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+// resumeDownload requests the content of a download from offset on, as
+// long as the blob still has etag. The caller must close the response body.
+func (c *Client) resumeDownload(ctx context.Context, urlPath string, options DownloadCommandOptions, etag string, offset uint) (*http.Response, error) {
+	byteRange := fmt.Sprintf("bytes=%d-", offset)
+	if options.ByteRange != nil {
+		byteRange = fmt.Sprintf("bytes=%d-%d", options.ByteRange.Start+offset, options.ByteRange.End)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlPath, nil)
+	if err != nil {
+		return nil, err
+	}
 	c.addAPIVersionHeader(req)
-	_ = c.addAuthorizationHeader(req, "put", toPath)
-	c.setPutHeaders(req, options)
+	if err := c.addAuthorizationHeader(req, OperationDownload, urlPath); err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", byteRange)
+	req.Header.Set("If-Range", etag)
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req, OperationDownload, urlPath)
 	if err != nil {
 		return nil, err
 	}
-	defer func() { _ = resp.Body.Close() }()
-	if resp.StatusCode != http.StatusOK {
+	if resp.StatusCode == http.StatusNotFound {
+		_ = resp.Body.Close()
+		return nil, c.newAPIError(resp, ErrBlobNotFound)
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		if resp.StatusCode == http.StatusOK {
+			// The blob changed since the download started.
+			_ = resp.Body.Close()
+			return nil, newTransportError(fmt.Errorf("blob changed while resuming download: %w", io.ErrUnexpectedEOF), OperationDownload, urlPath)
+		}
 		return nil, c.handleError(resp)
 	}
-	var result PutBlobPutResult
-	_ = json.NewDecoder(resp.Body).Decode(&result)
-	return &result, nil
+	return resp, nil
 }
 
-// Download a blob from the blob store.
-func (c *Client) Download(ctx context.Context, urlPath string, options DownloadCommandOptions) ([]byte, error) {
-	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, urlPath, nil)
+// download sends a download request and returns the successful response.
+// The caller must close the response body.
+func (c *Client) download(ctx context.Context, urlPath string, options DownloadCommandOptions) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlPath, nil)
+	if err != nil {
+		return nil, err
+	}
 	c.addAPIVersionHeader(req)
-	_ = c.addAuthorizationHeader(req, "download", urlPath)
+	if err := c.addAuthorizationHeader(req, OperationDownload, urlPath); err != nil {
+		return nil, err
+	}
 
 	if options.ByteRange != nil {
 		req.Header.Set("range", fmt.Sprintf("bytes=%d-%d", options.ByteRange.Start, options.ByteRange.End))
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req, OperationDownload, urlPath)
 	if err != nil {
 		return nil, err
 	}
-	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode == http.StatusNotFound {
+		// The blob host may not send a JSON body, or one naming the blob.
+		_ = resp.Body.Close()
+		return nil, c.newAPIError(resp, ErrBlobNotFound)
+	}
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
 		return nil, c.handleError(resp)
 	}
-	return io.ReadAll(resp.Body)
+	return resp, nil
 }
@@ -4,16 +4,19 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
-	"os"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
-var hasToken = os.Getenv("BLOB_READ_WRITE_TOKEN") != ""
-
 func Test_List_Mock(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -33,11 +36,9 @@ func Test_List_Mock(t *testing.T) {
 	}))
 	defer server.Close()
 
-	_ = os.Setenv("BLOB_READ_WRITE_TOKEN", "test-token")
-	defer func() { _ = os.Unsetenv("BLOB_READ_WRITE_TOKEN") }()
+	t.Setenv("BLOB_READ_WRITE_TOKEN", "test-token")
 
-	client := NewClient()
-	client.baseURL = server.URL // Override for mock server
+	client := newTestClient(t, WithBaseURL(server.URL))
 
 	res, err := client.List(context.Background(), ListCommandOptions{})
 	if err != nil {
@@ -52,6 +53,133 @@ func Test_List_Mock(t *testing.T) {
 	}
 }
 
+func Test_NewClientWithToken_Mock(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer static-token" {
+			t.Errorf("Expected Auth header Bearer static-token, got %s", r.Header.Get("Authorization"))
+		}
+		_ = json.NewEncoder(w).Encode(ListBlobResult{})
+	}))
+	defer server.Close()
+
+	t.Setenv("BLOB_READ_WRITE_TOKEN", "env-token")
+	t.Setenv("VERCEL_BLOB_API_URL", server.URL)
+
+	client := NewClientWithToken("static-token")
+
+	if _, err := client.List(context.Background(), ListCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewClientWithToken("").List(context.Background(), ListCommandOptions{}); !errors.Is(err, ErrNotAuthenticated) {
+		t.Errorf("Expected ErrNotAuthenticated for an empty token, got %v", err)
+	}
+}
+
+// providerError is a custom TokenProvider failure.
+type providerError struct {
+	reason string
+}
+
+func (e *providerError) Error() string {
+	return "provider failed: " + e.reason
+}
+
+func Test_TokenProviderError_Mock(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	cause := &providerError{reason: "user unauthorized"}
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(&countingTokenProvider{err: cause}))
+	ctx := context.Background()
+
+	large := bytes.NewReader(make([]byte, MultipartThreshold+1))
+	operations := map[string]func() error{
+		"list": func() error { _, err := client.List(ctx, ListCommandOptions{}); return err },
+		"put": func() error {
+			_, err := client.Put(ctx, "a.txt", bytes.NewReader([]byte("a")), PutCommandOptions{})
+			return err
+		},
+		"multipart": func() error {
+			_, err := client.Put(ctx, "a.bin", large, PutCommandOptions{})
+			return err
+		},
+		"head":   func() error { _, err := client.Head(ctx, "a.txt"); return err },
+		"delete": func() error { return client.Delete(ctx, server.URL+"/a.txt") },
+		"copy": func() error {
+			_, err := client.Copy(ctx, server.URL+"/a.txt", "b.txt", PutCommandOptions{})
+			return err
+		},
+		"download": func() error {
+			_, err := client.Download(ctx, server.URL+"/a.txt", DownloadCommandOptions{})
+			return err
+		},
+	}
+	for name, operation := range operations {
+		err := operation()
+		var target *providerError
+		if !errors.As(err, &target) || !errors.Is(err, cause) {
+			t.Errorf("%s: expected the provider error, got %v", name, err)
+		}
+	}
+	if requests != 0 {
+		t.Errorf("Expected no requests without a token, got %d", requests)
+	}
+}
+
+func Test_TokenProviderOperations_Mock(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("User-Agent"); got != "vercel-blob-go/"+Version {
+			t.Errorf("Expected the default User-Agent on %s %s, got %s", r.Method, r.URL, got)
+		}
+		w.Header().Set("ETag", "etag")
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.txt","pathname":"a.txt","uploadId":"id","key":"key"}`))
+	}))
+	defer server.Close()
+
+	provider := &recordingTokenProvider{}
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(provider))
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		operation func() error
+		want      []Operation
+	}{
+		{"list", func() error { _, err := client.List(ctx, ListCommandOptions{}); return err }, []Operation{OperationList}},
+		{"put", func() error {
+			_, err := client.Put(ctx, "a.txt", bytes.NewReader([]byte("a")), PutCommandOptions{})
+			return err
+		}, []Operation{OperationPut}},
+		{"multipart", func() error {
+			_, err := client.Put(ctx, "a.bin", bytes.NewReader(make([]byte, MultipartThreshold+1)), PutCommandOptions{})
+			return err
+		}, []Operation{OperationMultipartCreate, OperationMultipartPart, OperationMultipartPart, OperationMultipartComplete}},
+		{"head", func() error { _, err := client.Head(ctx, "a.txt"); return err }, []Operation{OperationHead}},
+		{"delete", func() error { return client.Delete(ctx, server.URL+"/a.txt") }, []Operation{OperationDelete}},
+		{"copy", func() error {
+			_, err := client.Copy(ctx, server.URL+"/a.txt", "b.txt", PutCommandOptions{})
+			return err
+		}, []Operation{OperationCopy}},
+		{"download", func() error {
+			_, err := client.Download(ctx, server.URL+"/a.txt", DownloadCommandOptions{})
+			return err
+		}, []Operation{OperationDownload}},
+	}
+	for _, tt := range tests {
+		provider.operations = nil
+		if err := tt.operation(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if fmt.Sprint(provider.operations) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: expected operations %v, got %v", tt.name, tt.want, provider.operations)
+		}
+	}
+}
+
 func Test_Put_Mock(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPut {
@@ -65,9 +193,7 @@ func Test_Put_Mock(t *testing.T) {
 	}))
 	defer server.Close()
 
-	client := NewClient()
-	client.baseURL = server.URL
-	_ = os.Setenv("BLOB_READ_WRITE_TOKEN", "test")
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("test")))
 
 	res, err := client.Put(context.Background(), "test.txt", bytes.NewReader([]byte("hello")), PutCommandOptions{})
 	if err != nil {
@@ -87,9 +213,7 @@ func Test_Delete_Mock(t *testing.T) {
 	}))
 	defer server.Close()
 
-	client := NewClient()
-	client.baseURL = server.URL
-	_ = os.Setenv("BLOB_READ_WRITE_TOKEN", "test")
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("test")))
 
 	err := client.Delete(context.Background(), "https://blob.com/1.txt", "https://blob.com/2.txt")
 	if err != nil {
@@ -97,6 +221,136 @@ func Test_Delete_Mock(t *testing.T) {
 	}
 }
 
+// recordingTokenProvider returns a fixed token and records every request for one.
+type recordingTokenProvider struct {
+	operations []string
+	pathnames  []string
+}
+
+func (p *recordingTokenProvider) GetToken(operation string, pathname string) (string, error) {
+	p.operations = append(p.operations, operation)
+	p.pathnames = append(p.pathnames, pathname)
+	return "test-token", nil
+}
+
+func Test_Head_Mock(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("Expected Method GET, got %s", r.Method)
+		}
+		if r.URL.Path != "" && r.URL.Path != "/" {
+			t.Errorf("Expected request to the API root, got %s", r.URL.Path)
+		}
+		_ = json.NewEncoder(w).Encode(HeadBlobResult{URL: "https://blob.com/a.txt", Pathname: r.URL.Query().Get("url")})
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		input   string
+		wantURL string
+	}{
+		{input: "https://blob.com/a.txt", wantURL: "https://blob.com/a.txt"},
+		{input: "dir/a.txt", wantURL: "dir/a.txt"},
+		{input: "/dir/a.txt", wantURL: "dir/a.txt"},
+	}
+	for _, tt := range tests {
+		provider := &recordingTokenProvider{}
+		client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(provider))
+
+		res, err := client.Head(context.Background(), tt.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Pathname != tt.wantURL {
+			t.Errorf("Expected url query %s, got %s", tt.wantURL, res.Pathname)
+		}
+		if len(provider.operations) != 1 || provider.operations[0] != "head" {
+			t.Errorf("Expected token for operation head, got %v", provider.operations)
+		}
+		if res.DownloadURL != "https://blob.com/a.txt?download=1" {
+			t.Errorf("Expected synthesized download URL, got %s", res.DownloadURL)
+		}
+	}
+}
+
+func Test_Head_DownloadURL_Mock(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("X-Vercel-Cache", "HIT")
+		w.Header().Set("X-Vercel-Id", "iad1::abc")
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.txt","downloadUrl":"https://blob.com/a.txt?download=1&v=2","contentEncoding":"gzip"}`))
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("test")))
+
+	res, err := client.Head(context.Background(), "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.DownloadURL != "https://blob.com/a.txt?download=1&v=2" {
+		t.Errorf("Expected download URL from the response, got %s", res.DownloadURL)
+	}
+	if res.ContentEncoding != "gzip" {
+		t.Errorf("Expected content encoding gzip, got %s", res.ContentEncoding)
+	}
+	if res.Headers.Get("X-Vercel-Cache") != "HIT" || res.Headers.Get("X-Vercel-Id") != "iad1::abc" {
+		t.Errorf("Expected raw response headers, got %v", res.Headers)
+	}
+}
+
+func Test_Exists_Mock(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    bool
+		wantErr error
+	}{
+		{name: "found", status: http.StatusOK, body: `{"pathname":"a.txt"}`, want: true},
+		{name: "not found", status: http.StatusNotFound, want: false},
+		{name: "forbidden", status: http.StatusForbidden, body: `{"error":{"code":"forbidden"}}`, wantErr: ErrForbidden},
+		{name: "server error", status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("test")))
+
+			exists, err := client.Exists(context.Background(), "a.txt")
+			if exists != tt.want {
+				t.Errorf("Expected exists %v, got %v", tt.want, exists)
+			}
+			switch {
+			case tt.wantErr != nil && !errors.Is(err, tt.wantErr):
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			case tt.status >= 500 && err == nil:
+				t.Errorf("Expected an error for status %d", tt.status)
+			case tt.status < 300 || tt.status == http.StatusNotFound:
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+			}
+		})
+	}
+
+	t.Run("network failure", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+		server.Close()
+
+		client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("test")))
+
+		exists, err := client.Exists(context.Background(), "a.txt")
+		if exists || err == nil {
+			t.Errorf("Expected false with an error, got %v, %v", exists, err)
+		}
+	})
+}
+
 func Test_Download_Mock(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -104,8 +358,7 @@ func Test_Download_Mock(t *testing.T) {
 	}))
 	defer server.Close()
 
-	client := NewClient()
-	_ = os.Setenv("BLOB_READ_WRITE_TOKEN", "test")
+	client := newTestClient(t, WithTokenProvider(StaticTokenProvider("test")))
 
 	data, err := client.Download(context.Background(), server.URL, DownloadCommandOptions{})
 	if err != nil {
@@ -116,71 +369,263 @@ func Test_Download_Mock(t *testing.T) {
 	}
 }
 
-func Test_CountFiles(t *testing.T) {
-	if !hasToken {
-		t.Skip("Skipping test: BLOB_READ_WRITE_TOKEN not set")
+func Test_Download_InvalidURL(t *testing.T) {
+	client := newTestClient(t, WithTokenProvider(StaticTokenProvider("token")))
+	ctx := context.Background()
+
+	var urlErr *url.Error
+	if _, err := client.Download(ctx, "https://blob.com/a\x7f.txt", DownloadCommandOptions{}); !errors.As(err, &urlErr) {
+		t.Errorf("Expected a *url.Error for a malformed URL, got %v", err)
 	}
-	client := NewClient()
-	allFiles, err := client.List(context.Background(), ListCommandOptions{})
-	if err != nil {
-		t.Error(err)
-		return
-	}
-	fmt.Println(len(allFiles.Blobs))
-}
-
-func Test_PutWithRandomSuffix(t *testing.T) {
-	if !hasToken {
-		t.Skip("Skipping test: BLOB_READ_WRITE_TOKEN not set")
-	}
-	client := NewClient()
-	f, _ := os.Open("a.png")
-	defer func() { _ = f.Close() }()
-	file1, err := client.Put(
-		context.Background(),
-		"vercel_blob_unittest/a.png",
-		io.Reader(f),
-		PutCommandOptions{
-			AddRandomSuffix: true,
-			//ContentType:     "multipart/form-data",
-		})
-	if err != nil {
-		t.Error(err)
-		return
+	if _, err := client.resumeDownload(ctx, "https://blob.com/a\x7f.txt", DownloadCommandOptions{}, `"etag"`, 1); !errors.As(err, &urlErr) {
+		t.Errorf("Expected a *url.Error when resuming a malformed URL, got %v", err)
 	}
-	fmt.Println(file1.URL)
 }
 
-func Test_Copy(t *testing.T) {
-	if !hasToken {
-		t.Skip("Skipping test: BLOB_READ_WRITE_TOKEN not set")
+func Test_BareErrorStatus_Mock(t *testing.T) {
+	var status int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		// Like the blob host or a proxy, answer without a JSON body.
+		http.Error(w, http.StatusText(status), status)
+	}))
+	defer server.Close()
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")))
+	ctx := context.Background()
+
+	operations := map[string]func() error{
+		"download": func() error {
+			_, err := client.Download(ctx, server.URL+"/a.txt", DownloadCommandOptions{})
+			return err
+		},
+		"head": func() error {
+			_, err := client.Head(ctx, "a.txt")
+			return err
+		},
+		"copy": func() error {
+			_, err := client.CopyWithOptions(ctx, server.URL+"/a.txt", "b.txt", CopyCommandOptions{})
+			return err
+		},
+		"delete": func() error {
+			return client.Delete(ctx, server.URL+"/a.txt")
+		},
 	}
-	//https://fetegzn4vw3t5yqf.public.blob.vercel-storage.com/vercel_blob_unittest/a.txt
-	client := NewClient()
-	res, err := client.Copy(context.Background(),
-		"https://fetegzn4vw3t5yqf.public.blob.vercel-storage.com/vercel_blob_unittest/a.txt",
-		"vercel_blob_unittest/B.txt",
-		PutCommandOptions{})
+	for name, call := range operations {
+		for _, tt := range []struct {
+			status int
+			want   error
+		}{
+			{http.StatusNotFound, ErrBlobNotFound},
+			{http.StatusForbidden, ErrForbidden},
+		} {
+			t.Run(fmt.Sprintf("%s %d", name, tt.status), func(t *testing.T) {
+				status = tt.status
+				err := call()
+				var apiErr *APIError
+				if !errors.Is(err, tt.want) || !errors.As(err, &apiErr) || apiErr.StatusCode != tt.status {
+					t.Errorf("Expected %v with status %d, got %v", tt.want, tt.status, err)
+				}
+			})
+		}
+	}
+}
+
+// newTestClient creates a client with opts, failing the test on invalid options.
+func newTestClient(t testing.TB, opts ...ClientOption) *Client {
+	t.Helper()
+	client, err := NewClientWithOptions(opts...)
 	if err != nil {
-		t.Error(err)
-		return
+		t.Fatal(err)
 	}
-	fmt.Println(res.URL)
+	return client
 }
 
-func Test_Partial_Download(t *testing.T) {
-	if !hasToken {
-		t.Skip("Skipping test: BLOB_READ_WRITE_TOKEN not set")
+func Test_getAPIURL(t *testing.T) {
+	tests := []struct {
+		baseURL  string
+		pathname string
+		want     string
+	}{
+		{"https://blob.vercel-storage.com", "a.txt", "https://blob.vercel-storage.com/a.txt"},
+		{"https://blob.vercel-storage.com/", "/a.txt", "https://blob.vercel-storage.com/a.txt"},
+		{"https://gateway.example.com/blob", "dir/a.txt", "https://gateway.example.com/blob/dir/a.txt"},
+		{"https://gateway.example.com/blob/", "/mpu", "https://gateway.example.com/blob/mpu"},
+		{"https://gateway.example.com/a%2Fb", "a.txt", "https://gateway.example.com/a%2Fb/a.txt"},
+		{"https://blob.vercel-storage.com", "my file.txt", "https://blob.vercel-storage.com/my%20file.txt"},
+		{"https://blob.vercel-storage.com", "notes#1?.txt", "https://blob.vercel-storage.com/notes%231%3F.txt"},
+		{"https://blob.vercel-storage.com", "100%.txt", "https://blob.vercel-storage.com/100%25.txt"},
+		{"https://blob.vercel-storage.com", "a+b/ü.txt", "https://blob.vercel-storage.com/a+b/%C3%BC.txt"},
 	}
-	client := NewClient()
-	bytes, err := client.Download(context.Background(),
-		"vercel_blob_unittest/a.txt",
-		DownloadCommandOptions{
-			ByteRange: &Range{Start: 0, End: 4},
-		})
-	if err != nil {
-		t.Error(err)
-		return
+	for _, tt := range tests {
+		client := &Client{baseURL: tt.baseURL}
+		got, err := client.getAPIURL(tt.pathname)
+		if err != nil || got != tt.want {
+			t.Errorf("Expected %s for %s + %s, got %s, %v", tt.want, tt.baseURL, tt.pathname, got, err)
+			continue
+		}
+		if u, _ := url.Parse(got); u.Fragment != "" || u.RawQuery != "" {
+			t.Errorf("Expected %s to round-trip without query or fragment", got)
+		}
+	}
+
+	client := &Client{baseURL: "http://%zz"}
+	if _, err := client.getAPIURL("a.txt"); err == nil {
+		t.Error("Expected an error for an unparsable base URL")
+	}
+}
+
+func Test_Put_EscapedPathname_Mock(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/blob/my file#1.txt" {
+			t.Errorf("Expected /blob/my file#1.txt, got %s", r.URL.Path)
+		}
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.txt","pathname":"my file#1.txt"}`))
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, WithBaseURL(server.URL+"/blob"), WithTokenProvider(StaticTokenProvider("token")))
+	if _, err := client.Put(context.Background(), "my file#1.txt", strings.NewReader("a"), PutCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	client.baseURL = "http://%zz"
+	if _, err := client.Put(context.Background(), "a.txt", strings.NewReader("a"), PutCommandOptions{}); err == nil {
+		t.Error("Expected the base URL error to be returned")
+	}
+}
+
+func Test_Client_Concurrent_Mock(t *testing.T) {
+	var mu sync.Mutex
+	rejected := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		// Reject the first request of each operation to exercise the token
+		// refresh guard.
+		mu.Lock()
+		first := !rejected[r.Method]
+		rejected[r.Method] = true
+		mu.Unlock()
+		if first {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"error":{"code":"forbidden","message":"token rejected"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.txt","pathname":"a.txt","blobs":[]}`))
+	}))
+	defer server.Close()
+
+	var events atomic.Int64
+	client := newTestClient(t,
+		WithBaseURL(server.URL),
+		WithTokenProvider(NewCachingTokenProvider(&countingTokenProvider{}, time.Hour)),
+		WithMiddleware(func(next RoundTripFunc) RoundTripFunc { return next }),
+		WithDefaultHeaders(map[string]string{"X-Org-Id": "org-1"}),
+		WithHeadCache(time.Minute, 8),
+		WithAuthAudit(func(AuthEvent) { events.Add(1) }),
+	)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := client
+			if i%4 == 0 {
+				// Derive clients while the shared one is in use.
+				var err error
+				if c, err = client.Clone(WithUserAgentSuffix(fmt.Sprintf("worker-%d", i))); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+			for j := range 10 {
+				pathname := fmt.Sprintf("%d/%d.txt", i, j%3)
+				if _, err := c.Put(ctx, pathname, strings.NewReader("a"), PutCommandOptions{}); err != nil && !errors.Is(err, ErrForbidden) {
+					t.Error(err)
+				}
+				if _, err := c.Head(ctx, pathname); err != nil && !errors.Is(err, ErrForbidden) {
+					t.Error(err)
+				}
+				if _, err := c.List(ctx, ListCommandOptions{Prefix: pathname}); err != nil && !errors.Is(err, ErrForbidden) {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if events.Load() == 0 {
+		t.Error("Expected audit events")
+	}
+	if stats := client.HeadCacheStats(); stats.Hits+stats.Misses == 0 {
+		t.Error("Expected head cache lookups")
+	}
+}
+
+func Test_RequestID_Mock(t *testing.T) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		id := fmt.Sprintf("iad1::%d", requests.Add(1))
+		if r.URL.Path == "/gateway.txt" {
+			w.Header().Set("X-Request-Id", id)
+		} else {
+			w.Header().Set("X-Vercel-Id", id)
+		}
+		switch {
+		case r.URL.Path == "/missing.txt" || r.URL.Query().Get("url") == "missing.txt":
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":{"code":"not_found","message":"not found"}}`))
+		case r.Header.Get("If-None-Match") != "":
+			w.WriteHeader(http.StatusNotModified)
+		case r.Method == http.MethodGet && (r.URL.Path == "/a.txt" || r.URL.Path == "/gateway.txt"):
+			_, _ = w.Write([]byte("a"))
+		default:
+			w.Header().Set("ETag", `"etag"`)
+			_, _ = w.Write([]byte(`{"url":"https://blob.com/a.txt","pathname":"a.txt","uploadId":"id","key":"key","blobs":[]}`))
+		}
+	}))
+	defer server.Close()
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")))
+	ctx := context.Background()
+	last := func() string { return fmt.Sprintf("iad1::%d", requests.Load()) }
+
+	put, err := client.Put(ctx, "a.txt", strings.NewReader("a"), PutCommandOptions{})
+	if err != nil || put.RequestID != last() {
+		t.Errorf("Expected the put to report %s, got %+v, %v", last(), put, err)
+	}
+	multipart, err := client.Put(ctx, "a.bin", strings.NewReader(strings.Repeat("a", MultipartThreshold+1)), PutCommandOptions{})
+	if err != nil || multipart.RequestID != last() {
+		t.Errorf("Expected the multipart upload to report the completion %s, got %+v, %v", last(), multipart, err)
+	}
+	copied, err := client.CopyWithOptions(ctx, "https://blob.com/a.txt", "b.txt", CopyCommandOptions{})
+	if err != nil || copied.RequestID != last() {
+		t.Errorf("Expected the copy to report %s, got %+v, %v", last(), copied, err)
+	}
+	head, err := client.Head(ctx, "a.txt")
+	if err != nil || head.RequestID != last() {
+		t.Errorf("Expected the head to report %s, got %+v, %v", last(), head, err)
+	}
+	head, err = client.HeadWithOptions(ctx, "a.txt", HeadCommandOptions{IfNoneMatch: `"etag"`})
+	if err != nil || !head.NotModified || head.RequestID != last() {
+		t.Errorf("Expected the unmodified head to report %s, got %+v, %v", last(), head, err)
+	}
+	list, err := client.List(ctx, ListCommandOptions{})
+	if err != nil || list.RequestID != last() {
+		t.Errorf("Expected the list to report %s, got %+v, %v", last(), list, err)
+	}
+	download, err := client.DownloadWithResult(ctx, server.URL+"/a.txt", DownloadCommandOptions{})
+	if err != nil || download.RequestID != last() || string(download.Content) != "a" {
+		t.Errorf("Expected the download to report %s, got %+v, %v", last(), download, err)
+	}
+	download, err = client.DownloadWithResult(ctx, server.URL+"/gateway.txt", DownloadCommandOptions{})
+	if err != nil || download.RequestID != last() {
+		t.Errorf("Expected the X-Request-Id fallback %s, got %+v, %v", last(), download, err)
+	}
+
+	_, err = client.Head(ctx, "missing.txt")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.RequestID != last() {
+		t.Errorf("Expected the error to report %s, got %v", last(), err)
 	}
-	fmt.Println(string(bytes))
 }
@@ -0,0 +1,102 @@
+package vercelblob
+
+import (
+	cryptorand "crypto/rand"
+	"encoding/binary"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// WithClock sets the clock the client reads the time from to decide when
+// cached heads, token refresh cooldowns and the windows of the circuit
+// breaker and failover expire, whether a client token lasts for the rest of
+// an upload, how long a Retry-After date asks to wait, and when events
+// happen. Tests pass a fake clock to cross these boundaries without waiting.
+// Delays, such as retry backoffs and rate limits, still wait on real timers.
+// The token providers take clocks of their own, e.g. WithCacheClock, and
+// GenerateClientTokenAt and VerifyClientTokenAt a time. Defaults to time.Now.
+func WithClock(now func() time.Time) ClientOption {
+	return func(c *Client) error {
+		if now == nil {
+			return NewInvalidOptionError("WithClock", "the clock is nil")
+		}
+		c.clock = now
+		return nil
+	}
+}
+
+// WithRandSource sets the source of the randomness of the client: the jitter
+// of ExponentialWithJitter backoffs, random suffixes chosen by the client and
+// idempotency keys. Tests pass a seeded source, such as rand.NewPCG(1, 2),
+// for reproducible results. The source is only used under a lock, so it need
+// not be safe for concurrent use. Defaults to a ChaCha8 source seeded from
+// crypto/rand.
+func WithRandSource(src rand.Source) ClientOption {
+	return func(c *Client) error {
+		if src == nil {
+			return NewInvalidOptionError("WithRandSource", "the source is nil")
+		}
+		c.rand = &lockedRand{r: rand.New(src)}
+		return nil
+	}
+}
+
+// now returns the time of the clock of the client.
+func (c *Client) now() time.Time {
+	if c.clock != nil {
+		return c.clock()
+	}
+	return time.Now()
+}
+
+// random returns the random source of the client.
+func (c *Client) random() *lockedRand {
+	if c.rand != nil {
+		return c.rand
+	}
+	return defaultRand
+}
+
+// defaultRand is the random source of clients without WithRandSource.
+var defaultRand = func() *lockedRand {
+	var seed [32]byte
+	_, _ = cryptorand.Read(seed[:])
+	return &lockedRand{r: rand.New(rand.NewChaCha8(seed))}
+}()
+
+// lockedRand is a *rand.Rand safe for concurrent use.
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+// Float64 returns a number in [0, 1).
+func (l *lockedRand) Float64() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Float64()
+}
+
+// IntN returns a number in [0, n).
+func (l *lockedRand) IntN(n int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.IntN(n)
+}
+
+// Text returns a random string of 26 base32 characters, like rand.Text of
+// crypto/rand.
+func (l *lockedRand) Text() string {
+	const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567"
+	var src [16]byte
+	l.mu.Lock()
+	binary.LittleEndian.PutUint64(src[:8], l.r.Uint64())
+	binary.LittleEndian.PutUint64(src[8:], l.r.Uint64())
+	l.mu.Unlock()
+	text := make([]byte, 26)
+	for i := range text {
+		text[i] = alphabet[src[i%16]>>(i/16*3)&31]
+	}
+	return string(text)
+}
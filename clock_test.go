@@ -0,0 +1,141 @@
+package vercelblob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_WithRandSource_Reproducible(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		mu.Lock()
+		requests = append(requests, r.URL.Path+" "+r.Header.Get("X-Request-Key"))
+		mu.Unlock()
+		_, _ = fmt.Fprintf(w, `{"url":"https://blob.com%s","pathname":%q}`, r.URL.Path, r.URL.Path[1:])
+	}))
+	defer server.Close()
+
+	run := func(seed uint64) []string {
+		requests = nil
+		client := newTestClient(t,
+			WithBaseURL(server.URL),
+			WithTokenProvider(StaticTokenProvider("token")),
+			WithIdempotencyHeader("X-Request-Key"),
+			WithRandSource(rand.NewPCG(seed, 0)),
+			WithOperationRetry(OperationCopy, RetryPolicy{MaxAttempts: 2}),
+		)
+		ctx := context.Background()
+		if _, err := client.CopyWithOptions(ctx, "https://blob.com/a.txt", "b.txt", CopyCommandOptions{AddRandomSuffix: true}); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.Delete(ctx, "https://blob.com/a.txt"); err != nil {
+			t.Fatal(err)
+		}
+		policy := RetryPolicy{BaseDelay: time.Second, Jitter: 1}
+		return append(requests, policy.delay(1, nil, client.random()).String())
+	}
+
+	first := run(1)
+	if len(first) != 3 || first[0][:3] != "/b-" {
+		t.Fatalf("Expected a suffixed copy, a delete and a delay, got %q", first)
+	}
+	if again := run(1); fmt.Sprint(again) != fmt.Sprint(first) {
+		t.Errorf("Expected the same seed to give %q, got %q", first, again)
+	}
+	if other := run(2); other[0] == first[0] || other[1] == first[1] || other[2] == first[2] {
+		t.Errorf("Expected another seed to give other values than %q, got %q", first, other)
+	}
+}
+
+func Test_WithClock(t *testing.T) {
+	clock := &fakeClock{current: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	heads := 0
+	fail := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		heads++
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.txt","pathname":"a.txt","size":1}`))
+	}))
+	defer server.Close()
+	client := newTestClient(t,
+		WithBaseURL(server.URL),
+		WithTokenProvider(StaticTokenProvider("token")),
+		WithCircuitBreaker(1, 0, time.Minute),
+		WithClock(clock.Now),
+		WithHeadCache(time.Minute, 0),
+	)
+	ctx := context.Background()
+
+	// The head cache expires on the clock of the client.
+	for range 2 {
+		if _, err := client.Head(ctx, "a.txt"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clock.Advance(time.Minute + time.Second)
+	if _, err := client.Head(ctx, "a.txt"); err != nil || heads != 2 {
+		t.Errorf("Expected the cached head to expire, got %d heads, %v", heads, err)
+	}
+
+	// So does the cooldown of the circuit breaker.
+	fail = true
+	client.FlushHeadCache()
+	if _, err := client.Head(ctx, "a.txt"); err == nil || client.CircuitState() != CircuitOpen {
+		t.Fatalf("Expected the failure to open the circuit, got %v", err)
+	}
+	fail = false
+	if _, err := client.Head(ctx, "a.txt"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected the circuit to stay open, got %v", err)
+	}
+	clock.Advance(time.Minute)
+	if _, err := client.Head(ctx, "a.txt"); err != nil || client.CircuitState() != CircuitClosed {
+		t.Errorf("Expected the probe to close the circuit, got %v", err)
+	}
+
+	// Events carry the time of the clock.
+	var events []Event
+	client, _ = client.Clone(WithEventListener(func(e Event) { events = append(events, e) }))
+	if _, err := client.Put(ctx, "a.txt", nil, PutCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) == 0 || !events[0].(UploadStarted).Time.Equal(clock.Now()) {
+		t.Errorf("Expected events at %v, got %+v", clock.Now(), events)
+	}
+}
+
+func Test_WithClock_RetryAfterDate(t *testing.T) {
+	clock := newFakeClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Retry-After", clock.Now().Add(30*time.Second).Format(http.TimeFormat))
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")), WithClock(clock.Now))
+
+	_, err := client.Head(context.Background(), "a.txt")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.RetryAfter != 30*time.Second {
+		t.Errorf("Expected a Retry-After of 30s on the clock of the client, got %v", err)
+	}
+}
+
+func Test_WithClock_Invalid(t *testing.T) {
+	for _, opt := range []ClientOption{WithClock(nil), WithRandSource(nil)} {
+		if _, err := NewClientWithOptions(opt); CodeOf(err) != "invalid_option" {
+			t.Errorf("Expected invalid_option, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,476 @@
+package vercelblob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CopyWithOptions copies an existing blob object to a new path within the blob store.
+//
+// Unlike Copy, the options make it explicit whether metadata is inherited from
+// the source blob or overridden for the destination.
+func (c *Client) CopyWithOptions(ctx context.Context, fromURL, toPath string, options CopyCommandOptions) (*CopyResult, error) {
+	if len(fromURL) == 0 {
+		return nil, InvalidInputError("fromURL")
+	}
+	if len(toPath) == 0 {
+		return nil, InvalidInputError("toPath")
+	}
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	if c.scope != "" {
+		scoped, err := c.scopePathnames([]string{fromURL, toPath})
+		if err != nil {
+			return nil, err
+		}
+		return c.unscoped().CopyWithOptions(ctx, scoped[0], scoped[1], options)
+	}
+	ctx, key := c.withIdempotencyKey(ctx, OperationCopy)
+	ctx, stats := withOperationStats(ctx)
+
+	if c.dryRun {
+		// The copy is not made, so there is nothing to verify.
+		options.Verify = false
+	}
+
+	retried := c.retryPolicyFor(OperationCopy).MaxAttempts > 1
+	if options.AddRandomSuffix && retried {
+		// Choose the final pathname up front so every attempt targets it,
+		// rather than each one creating a blob under a suffix of its own.
+		toPath = addRandomSuffix(c.random(), toPath)
+		options.AddRandomSuffix = false
+	}
+
+	var source *HeadBlobResult
+	if options.InheritMetadata || options.Verify {
+		var err error
+		source, err = c.Head(ctx, fromURL)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	method := CopyMethodServer
+	var transferred int64
+	inherited := source
+	if !options.InheritMetadata {
+		inherited = nil
+	}
+	result, err := c.copyWithRetries(ctx, fromURL, toPath, copyPutOptions(options, inherited), source)
+	if err != nil && options.StreamFallback && isBadRequest(err) {
+		if source == nil {
+			if source, err = c.Head(ctx, fromURL); err != nil {
+				return nil, err
+			}
+		}
+		method = CopyMethodStream
+		result, transferred, err = streamCopy(ctx, c, c, fromURL, toPath, copyPutOptions(options, source), source)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if options.Verify {
+		if err := c.verifyCopy(ctx, source, result); err != nil {
+			if method == CopyMethodStream {
+				_ = c.Delete(ctx, result.URL)
+			}
+			return nil, err
+		}
+	}
+	result.IdempotencyKey = key
+	result.Stats = stats.snapshot()
+	return &CopyResult{PutBlobPutResult: *result, Method: method, BytesTransferred: transferred}, nil
+}
+
+// CopyAcrossStores copies a blob from the store addressed by src to the store
+// addressed by dst, for example from a staging store to a production store.
+//
+// Public sources are copied on the server by dst with the fromUrl mechanism.
+// Other sources are downloaded with src and uploaded again with dst. The
+// source metadata is carried over in both cases unless overridden.
+func CopyAcrossStores(ctx context.Context, src *Client, fromURL string, dst *Client, toPath string, options CopyCommandOptions) (*CopyResult, error) {
+	if len(fromURL) == 0 {
+		return nil, InvalidInputError("fromURL")
+	}
+	if len(toPath) == 0 {
+		return nil, InvalidInputError("toPath")
+	}
+	if src.scope != "" {
+		var err error
+		if fromURL, err = src.scopePathname(fromURL); err != nil {
+			return nil, err
+		}
+		src = src.unscoped()
+	}
+	if dst.scope != "" {
+		var err error
+		if toPath, err = dst.scopePathname(toPath); err != nil {
+			return nil, err
+		}
+		dst = dst.unscoped()
+	}
+
+	ctx, stats := withOperationStats(ctx)
+	source, err := src.Head(ctx, fromURL)
+	if err != nil {
+		return nil, err
+	}
+	putOptions := copyPutOptions(options, source)
+
+	if isPublicBlobURL(fromURL) {
+		ctx, key := dst.withIdempotencyKey(ctx, OperationCopy)
+		result, err := dst.copyFromURL(ctx, fromURL, toPath, putOptions)
+		if err != nil {
+			return nil, err
+		}
+		result.IdempotencyKey = key
+		result.Stats = stats.snapshot()
+		return &CopyResult{PutBlobPutResult: *result, Method: CopyMethodServer}, nil
+	}
+
+	result, transferred, err := streamCopy(ctx, src, dst, fromURL, toPath, putOptions, source)
+	if err != nil {
+		return nil, err
+	}
+	result.Stats = stats.snapshot()
+	return &CopyResult{PutBlobPutResult: *result, Method: CopyMethodStream, BytesTransferred: transferred}, nil
+}
+
+// copyWithRetries performs a server-side copy, retried by the retry policy
+// of OperationCopy. A retry rejected because the destination already exists
+// succeeds if the destination matches the source, since the failed attempt
+// may have been applied before its response was lost.
+func (c *Client) copyWithRetries(ctx context.Context, fromURL, toPath string, options PutCommandOptions, source *HeadBlobResult) (*PutBlobPutResult, error) {
+	ctx, retries := withRetryCount(ctx)
+	result, err := c.copyFromURL(ctx, fromURL, toPath, options)
+	if err != nil && retries.Load() > 0 && !options.AllowOverwrite && isAlreadyExists(err) {
+		return c.existingCopy(ctx, fromURL, toPath, source, err)
+	}
+	return result, err
+}
+
+// existingCopy returns the destination of a copy if it matches the source,
+// or cause otherwise.
+func (c *Client) existingCopy(ctx context.Context, fromURL, toPath string, source *HeadBlobResult, cause error) (*PutBlobPutResult, error) {
+	if source == nil {
+		var err error
+		if source, err = c.Head(ctx, fromURL); err != nil {
+			return nil, err
+		}
+	}
+	destination, err := c.Head(ctx, toPath)
+	if err != nil {
+		return nil, err
+	}
+	if !sameContent(source, destination) {
+		return nil, cause
+	}
+	return &PutBlobPutResult{
+		URL:                destination.URL,
+		Pathname:           destination.Pathname,
+		ContentType:        destination.ContentType,
+		ContentDisposition: destination.ContentDisposition,
+		RequestID:          destination.RequestID,
+	}, nil
+}
+
+// copyFromURL performs a server-side copy using the fromUrl mechanism.
+func (c *Client) copyFromURL(ctx context.Context, fromURL, toPath string, options PutCommandOptions) (*PutBlobPutResult, error) {
+	defer c.invalidateHead(toPath)
+	apiURL, err := c.getAPIURL(toPath)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	q := req.URL.Query()
+	q.Add("fromUrl", fromURL)
+	req.URL.RawQuery = q.Encode()
+
+	c.addAPIVersionHeader(req)
+	if err = c.addAuthorizationHeader(req, OperationCopy, toPath); err != nil {
+		return nil, err
+	}
+	c.setPutHeaders(req, options)
+
+	resp, err := c.do(req, OperationCopy, toPath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.handleError(resp)
+	}
+	var result PutBlobPutResult
+	if err := decodeResponse(resp, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// streamCopy downloads the source with src and uploads it again with dst
+// through Put, which switches to a multipart upload for large blobs. It
+// returns the number of bytes read from the source.
+func streamCopy(ctx context.Context, src, dst *Client, fromURL, toPath string, options PutCommandOptions, source *HeadBlobResult) (*PutBlobPutResult, int64, error) {
+	resp, err := src.download(ctx, fromURL, DownloadCommandOptions{})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	size := resp.ContentLength
+	if size < 0 {
+		size = int64(source.Size)
+	}
+	body := &sizedReader{Reader: resp.Body, size: size}
+	result, err := dst.Put(ctx, toPath, body, options)
+	if err != nil {
+		return nil, body.read, err
+	}
+	return result, body.read, nil
+}
+
+// sizedReader reports a known size so Put can pick the upload strategy, and
+// counts the bytes read through it.
+type sizedReader struct {
+	io.Reader
+	size int64
+	read int64
+}
+
+func (r *sizedReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.read += int64(n)
+	return n, err
+}
+
+// Size returns the number of bytes the reader will produce.
+func (r *sizedReader) Size() int64 {
+	return r.size
+}
+
+// isPublicBlobURL reports whether blobURL points at a public blob store host,
+// which any store can read from.
+func isPublicBlobURL(blobURL string) bool {
+	u, err := url.Parse(blobURL)
+	return err == nil && strings.HasSuffix(u.Hostname(), ".public.blob.vercel-storage.com")
+}
+
+// blobURLAccess returns the access of the blob at blobURL as told by its
+// host, <store>.public.blob.vercel-storage.com or
+// <store>.private.blob.vercel-storage.com, or "" for other hosts.
+func blobURLAccess(blobURL string) string {
+	u, err := url.Parse(blobURL)
+	if err != nil {
+		return ""
+	}
+	host, ok := strings.CutSuffix(u.Hostname(), blobHostSuffix)
+	if !ok {
+		return ""
+	}
+	switch {
+	case strings.HasSuffix(host, ".public"):
+		return "public"
+	case strings.HasSuffix(host, ".private"):
+		return "private"
+	}
+	return ""
+}
+
+// randomSuffixAlphabet is the alphabet of client-side random suffixes.
+const randomSuffixAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// addRandomSuffix inserts a suffix drawn from r before the extension of
+// pathname, the way the API does for AddRandomSuffix.
+func addRandomSuffix(r *lockedRand, pathname string) string {
+	suffix := make([]byte, 30)
+	for i := range suffix {
+		suffix[i] = randomSuffixAlphabet[r.IntN(len(randomSuffixAlphabet))]
+	}
+	ext := path.Ext(pathname)
+	return strings.TrimSuffix(pathname, ext) + "-" + string(suffix) + ext
+}
+
+// isNetworkError reports whether err is a transport failure that was not
+// caused by ctx ending.
+func isNetworkError(ctx context.Context, err error) bool {
+	var urlErr *url.Error
+	return err != nil && ctx.Err() == nil && errors.As(err, &urlErr)
+}
+
+// isAlreadyExists reports whether err is the API rejecting an upload because
+// the blob already exists.
+func isAlreadyExists(err error) bool {
+	return errors.Is(err, ErrBlobAlreadyExists)
+}
+
+// isBadRequest reports whether err is a bad_request error from the API.
+func isBadRequest(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Code == "bad_request"
+}
+
+// UpdateMetadata changes the metadata of an existing blob without uploading
+// its content again. The blob is copied onto itself, so the bytes never leave
+// the server; every attribute not set in update is read from the blob first
+// and preserved, including whether the blob is public or private.
+func (c *Client) UpdateMetadata(ctx context.Context, blobURL string, update MetadataUpdate) (*PutBlobPutResult, error) {
+	if len(blobURL) == 0 {
+		return nil, InvalidInputError("url")
+	}
+	if c.scope != "" {
+		scoped, err := c.scopePathname(blobURL)
+		if err != nil {
+			return nil, err
+		}
+		return c.unscoped().UpdateMetadata(ctx, scoped, update)
+	}
+	pathname := strings.TrimPrefix(pathnameFromURL(blobURL), "/")
+
+	result, err := c.CopyWithOptions(ctx, blobURL, pathname, CopyCommandOptions{
+		AllowOverwrite:       true,
+		InheritMetadata:      true,
+		ContentTypeOverride:  update.ContentType,
+		CacheControlOverride: update.CacheControlMaxAge,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimPrefix(result.Pathname, "/") != pathname {
+		_ = c.Delete(ctx, result.URL)
+		return nil, ErrPathnameChanged
+	}
+	return &result.PutBlobPutResult, nil
+}
+
+// verifyCopy compares the destination of a copy against its source with
+// sameContent. The destination is read a few times to allow for propagation
+// delay.
+func (c *Client) verifyCopy(ctx context.Context, source *HeadBlobResult, result *PutBlobPutResult) error {
+	target := result.URL
+	if target == "" {
+		target = result.Pathname
+	}
+
+	var destination *HeadBlobResult
+	var err error
+	for attempt := 0; attempt < copyVerifyAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(copyVerifyRetryDelay * time.Duration(attempt)):
+			}
+		}
+		destination, err = c.Head(ctx, target)
+		if errors.Is(err, ErrBlobNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if sameContent(source, destination) {
+			return nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return &CopyVerificationError{Source: source, Destination: destination}
+}
+
+// sameContent reports whether destination has the content of source. Their
+// ETags, which the API derives from the content, are compared when both are
+// known; only the sizes otherwise.
+func sameContent(source, destination *HeadBlobResult) bool {
+	if source.ETag != "" && destination.ETag != "" {
+		return strings.TrimPrefix(source.ETag, "W/") == strings.TrimPrefix(destination.ETag, "W/")
+	}
+	return destination.Size == source.Size
+}
+
+// copyVerifyAttempts is the number of times the destination of a verified copy
+// is read before the copy is declared failed.
+const copyVerifyAttempts = 3
+
+// copyVerifyRetryDelay is the base delay between destination reads.
+var copyVerifyRetryDelay = 250 * time.Millisecond
+
+// copyPutOptions resolves the headers for a copy destination. Overrides
+// always win; otherwise the source metadata is forwarded when given.
+func copyPutOptions(options CopyCommandOptions, source *HeadBlobResult) PutCommandOptions {
+	put := PutCommandOptions{
+		AddRandomSuffix: options.AddRandomSuffix,
+		Access:          options.Access,
+		AllowOverwrite:  options.AllowOverwrite,
+	}
+	if source != nil {
+		put.ContentType = source.ContentType
+		put.CacheControlMaxAge, _ = parseMaxAge(source.CacheControl)
+		if put.Access == "" {
+			put.Access = blobURLAccess(source.URL)
+		}
+	}
+	if options.ContentTypeOverride != nil {
+		put.ContentType = *options.ContentTypeOverride
+	}
+	if options.CacheControlOverride != nil {
+		put.CacheControlMaxAge = *options.CacheControlOverride
+	}
+	return put
+}
+
+// copyOptionsFromPut adapts the legacy PutCommandOptions used by Copy.
+func copyOptionsFromPut(options PutCommandOptions) CopyCommandOptions {
+	copyOptions := CopyCommandOptions{
+		AddRandomSuffix: options.AddRandomSuffix,
+		Access:          options.Access,
+		AllowOverwrite:  options.AllowOverwrite,
+	}
+	if options.ContentType != "" {
+		contentType := options.ContentType
+		copyOptions.ContentTypeOverride = &contentType
+	}
+	if options.CacheControlMaxAge > 0 {
+		maxAge := options.CacheControlMaxAge
+		copyOptions.CacheControlOverride = &maxAge
+	}
+	return copyOptions
+}
+
+// pathnameFromURL returns the pathname of a blob URL, or the input unchanged
+// if it is not an absolute URL.
+func pathnameFromURL(blobURL string) string {
+	u, err := url.Parse(blobURL)
+	if err != nil || !u.IsAbs() {
+		return blobURL
+	}
+	return u.Path
+}
+
+// parseMaxAge extracts the max-age directive from a Cache-Control header value.
+func parseMaxAge(cacheControl string) (uint64, bool) {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(directive), "=")
+		if !ok || !strings.EqualFold(name, "max-age") {
+			continue
+		}
+		maxAge, err := strconv.ParseUint(strings.Trim(value, `"`), 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		return maxAge, true
+	}
+	return 0, false
+}
@@ -0,0 +1,448 @@
+package vercelblob
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_CopyWithOptions_Metadata_Mock(t *testing.T) {
+	contentType := "text/plain"
+	maxAge := uint64(60)
+
+	tests := []struct {
+		name             string
+		options          CopyCommandOptions
+		wantHead         bool
+		wantContentType  string
+		wantCacheControl string
+	}{
+		{
+			name:    "no inherit, no override",
+			options: CopyCommandOptions{},
+		},
+		{
+			name:             "no inherit, override",
+			options:          CopyCommandOptions{ContentTypeOverride: &contentType, CacheControlOverride: &maxAge},
+			wantContentType:  "text/plain",
+			wantCacheControl: "60",
+		},
+		{
+			name:             "inherit, no override",
+			options:          CopyCommandOptions{InheritMetadata: true},
+			wantHead:         true,
+			wantContentType:  "image/png",
+			wantCacheControl: "3600",
+		},
+		{
+			name:             "inherit, override",
+			options:          CopyCommandOptions{InheritMetadata: true, ContentTypeOverride: &contentType, CacheControlOverride: &maxAge},
+			wantHead:         true,
+			wantContentType:  "text/plain",
+			wantCacheControl: "60",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var headCalled bool
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					headCalled = true
+					if r.URL.Query().Get("url") != "https://blob.com/a.png" {
+						t.Errorf("Expected head of https://blob.com/a.png, got %s", r.URL.Query().Get("url"))
+					}
+					_ = json.NewEncoder(w).Encode(HeadBlobResult{
+						Pathname:     "a.png",
+						ContentType:  "image/png",
+						CacheControl: "public, max-age=3600",
+					})
+				case http.MethodPut:
+					if r.URL.Query().Get("fromUrl") != "https://blob.com/a.png" {
+						t.Errorf("Expected fromUrl https://blob.com/a.png, got %s", r.URL.Query().Get("fromUrl"))
+					}
+					if got := r.Header.Get("X-Content-Type"); got != tt.wantContentType {
+						t.Errorf("Expected X-Content-Type %q, got %q", tt.wantContentType, got)
+					}
+					if got := r.Header.Get("X-Cache-Control-Max-Age"); got != tt.wantCacheControl {
+						t.Errorf("Expected X-Cache-Control-Max-Age %q, got %q", tt.wantCacheControl, got)
+					}
+					_ = json.NewEncoder(w).Encode(PutBlobPutResult{URL: "https://blob.com/b.png", Pathname: "b.png"})
+				default:
+					t.Errorf("Unexpected method %s", r.Method)
+				}
+			}))
+			defer server.Close()
+
+			client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("test")))
+
+			res, err := client.CopyWithOptions(context.Background(), "https://blob.com/a.png", "b.png", tt.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Pathname != "b.png" {
+				t.Errorf("Expected b.png, got %s", res.Pathname)
+			}
+			if headCalled != tt.wantHead {
+				t.Errorf("Expected head called %v, got %v", tt.wantHead, headCalled)
+			}
+		})
+	}
+}
+
+func Test_Copy_Adapter_Mock(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			t.Errorf("Expected Method PUT, got %s", r.Method)
+		}
+		if r.Header.Get("X-Content-Type") != "text/plain" {
+			t.Errorf("Expected X-Content-Type text/plain, got %s", r.Header.Get("X-Content-Type"))
+		}
+		if r.Header.Get("X-Add-Random-Suffix") != "" {
+			t.Errorf("Expected random suffix to be enabled, got %s", r.Header.Get("X-Add-Random-Suffix"))
+		}
+		_ = json.NewEncoder(w).Encode(PutBlobPutResult{URL: "https://blob.com/b.txt", Pathname: "b.txt"})
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("test")))
+
+	_, err := client.Copy(context.Background(), "https://blob.com/a.txt", "b.txt", PutCommandOptions{
+		AddRandomSuffix: true,
+		ContentType:     "text/plain",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_CopyWithOptions_Verify_Mock(t *testing.T) {
+	previous := copyVerifyRetryDelay
+	copyVerifyRetryDelay = 0
+	t.Cleanup(func() { copyVerifyRetryDelay = previous })
+
+	tests := []struct {
+		name       string
+		sourceETag string
+		destSizes  []int // per destination head; -1 means not found
+		destETag   string
+		wantErr    bool
+		wantChecks int
+	}{
+		{name: "match", destSizes: []int{10}, wantChecks: 1},
+		{name: "eventually visible", destSizes: []int{-1, -1, 10}, wantChecks: 3},
+		{name: "mismatch", destSizes: []int{4, 4, 4}, wantErr: true, wantChecks: 3},
+		{name: "etag match", sourceETag: `"abc"`, destSizes: []int{10}, destETag: `"abc"`, wantChecks: 1},
+		{name: "stale content of the same size", sourceETag: `"abc"`, destSizes: []int{10, 10, 10}, destETag: `"old"`, wantErr: true, wantChecks: 3},
+		{name: "etag unknown", sourceETag: `"abc"`, destSizes: []int{10}, wantChecks: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checks := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodGet && r.URL.Query().Get("url") == "https://blob.com/a.txt":
+					if tt.sourceETag != "" {
+						w.Header().Set("ETag", tt.sourceETag)
+					}
+					_ = json.NewEncoder(w).Encode(HeadBlobResult{Pathname: "a.txt", Size: 10})
+				case r.Method == http.MethodGet && r.URL.Query().Get("url") == "https://blob.com/b.txt":
+					size := tt.destSizes[checks]
+					checks++
+					if size < 0 {
+						w.WriteHeader(http.StatusNotFound)
+						return
+					}
+					if tt.destETag != "" {
+						w.Header().Set("ETag", tt.destETag)
+					}
+					_ = json.NewEncoder(w).Encode(HeadBlobResult{Pathname: "b.txt", Size: uint64(size)})
+				case r.Method == http.MethodPut:
+					_ = json.NewEncoder(w).Encode(PutBlobPutResult{URL: "https://blob.com/b.txt", Pathname: "b.txt"})
+				}
+			}))
+			defer server.Close()
+
+			client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("test")))
+
+			_, err := client.CopyWithOptions(context.Background(), "https://blob.com/a.txt", "b.txt", CopyCommandOptions{Verify: true})
+			if tt.wantErr {
+				var verr *CopyVerificationError
+				if !errors.As(err, &verr) {
+					t.Fatalf("Expected CopyVerificationError, got %v", err)
+				}
+				if !errors.Is(err, ErrCopyVerificationFailed) {
+					t.Errorf("Expected errors.Is ErrCopyVerificationFailed")
+				}
+				if verr.Source.Size != 10 || verr.Destination.Size != uint64(tt.destSizes[0]) || verr.Destination.ETag != tt.destETag {
+					t.Errorf("Unexpected snapshots: %+v, %+v", verr.Source, verr.Destination)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if checks != tt.wantChecks {
+				t.Errorf("Expected %d destination checks, got %d", tt.wantChecks, checks)
+			}
+		})
+	}
+}
+
+func Test_CopyWithOptions_StreamFallback_Mock(t *testing.T) {
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer source.Close()
+
+	var uploaded string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet:
+			_ = json.NewEncoder(w).Encode(HeadBlobResult{Pathname: "a.txt", Size: 5, ContentType: "text/plain"})
+		case r.Method == http.MethodPut && r.URL.Query().Get("fromUrl") != "":
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(BlobAPIError{Error: BlobAPIErrorDetail{Code: "bad_request", Message: "copy failed"}})
+		case r.Method == http.MethodPut:
+			if r.Header.Get("X-Content-Type") != "text/plain" {
+				t.Errorf("Expected X-Content-Type text/plain, got %s", r.Header.Get("X-Content-Type"))
+			}
+			body, _ := io.ReadAll(r.Body)
+			uploaded = string(body)
+			_ = json.NewEncoder(w).Encode(PutBlobPutResult{URL: "https://blob.com/b.txt", Pathname: "b.txt"})
+		}
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("test")))
+
+	fromURL := source.URL + "/a.txt"
+	if _, err := client.CopyWithOptions(context.Background(), fromURL, "b.txt", CopyCommandOptions{}); !isBadRequest(err) {
+		t.Fatalf("Expected bad_request without fallback, got %v", err)
+	}
+
+	res, err := client.CopyWithOptions(context.Background(), fromURL, "b.txt", CopyCommandOptions{StreamFallback: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Method != CopyMethodStream {
+		t.Errorf("Expected method %s, got %s", CopyMethodStream, res.Method)
+	}
+	if uploaded != "hello" {
+		t.Errorf("Expected uploaded body hello, got %s", uploaded)
+	}
+}
+
+func Test_UpdateMetadata_Mock(t *testing.T) {
+	resultPathname := "a.txt"
+	deleted := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			_ = json.NewEncoder(w).Encode(HeadBlobResult{Pathname: "a.txt", ContentType: "text/plain", CacheControl: "public, max-age=300"})
+		case http.MethodPut:
+			if r.URL.Path != "/a.txt" {
+				t.Errorf("Expected copy to /a.txt, got %s", r.URL.Path)
+			}
+			if r.Header.Get("X-Allow-Overwrite") != "1" {
+				t.Errorf("Expected X-Allow-Overwrite 1, got %s", r.Header.Get("X-Allow-Overwrite"))
+			}
+			if r.Header.Get("X-Add-Random-Suffix") != "0" {
+				t.Errorf("Expected X-Add-Random-Suffix 0, got %s", r.Header.Get("X-Add-Random-Suffix"))
+			}
+			if r.Header.Get("X-Content-Type") != "text/markdown" {
+				t.Errorf("Expected X-Content-Type text/markdown, got %s", r.Header.Get("X-Content-Type"))
+			}
+			if r.Header.Get("X-Cache-Control-Max-Age") != "300" {
+				t.Errorf("Expected X-Cache-Control-Max-Age 300, got %s", r.Header.Get("X-Cache-Control-Max-Age"))
+			}
+			_ = json.NewEncoder(w).Encode(PutBlobPutResult{URL: "https://blob.com/" + resultPathname, Pathname: resultPathname})
+		case http.MethodPost:
+			deleted = true
+		}
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("test")))
+
+	contentType := "text/markdown"
+	update := MetadataUpdate{ContentType: &contentType}
+	if _, err := client.UpdateMetadata(context.Background(), "https://blob.com/a.txt", update); err != nil {
+		t.Fatal(err)
+	}
+
+	resultPathname = "a-x1y2.txt"
+	_, err := client.UpdateMetadata(context.Background(), "https://blob.com/a.txt", update)
+	if !errors.Is(err, ErrPathnameChanged) {
+		t.Errorf("Expected ErrPathnameChanged, got %v", err)
+	}
+	if !deleted {
+		t.Errorf("Expected the renamed copy to be deleted")
+	}
+}
+
+func Test_UpdateMetadata_PrivateBlob(t *testing.T) {
+	const blobURL = "https://store.private.blob.vercel-storage.com/a.txt"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			_ = json.NewEncoder(w).Encode(HeadBlobResult{URL: blobURL, Pathname: "a.txt", ContentType: "text/plain"})
+		case http.MethodPut:
+			if r.Header.Get("X-Access") != "private" {
+				t.Errorf("Expected X-Access private, got %s", r.Header.Get("X-Access"))
+			}
+			_ = json.NewEncoder(w).Encode(PutBlobPutResult{URL: blobURL, Pathname: "a.txt"})
+		}
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("test")))
+
+	contentType := "text/markdown"
+	if _, err := client.UpdateMetadata(context.Background(), blobURL, MetadataUpdate{ContentType: &contentType}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_blobURLAccess(t *testing.T) {
+	tests := map[string]string{
+		"https://store.public.blob.vercel-storage.com/a.txt":  "public",
+		"https://store.private.blob.vercel-storage.com/a.txt": "private",
+		"https://blob.com/a.txt":                              "",
+		"://bad":                                              "",
+	}
+	for blobURL, want := range tests {
+		if got := blobURLAccess(blobURL); got != want {
+			t.Errorf("blobURLAccess(%q) = %q, want %q", blobURL, got, want)
+		}
+	}
+}
+
+func Test_CopyAcrossStores_Mock(t *testing.T) {
+	staging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer staging-token" {
+			t.Errorf("Expected staging token, got %s", r.Header.Get("Authorization"))
+		}
+		_ = json.NewEncoder(w).Encode(HeadBlobResult{Pathname: "a.txt", Size: 5, ContentType: "text/plain"})
+	}))
+	defer staging.Close()
+
+	stagingFiles := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer staging-token" {
+			t.Errorf("Expected staging token, got %s", r.Header.Get("Authorization"))
+		}
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer stagingFiles.Close()
+
+	var gotFromURL, gotBody string
+	production := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer production-token" {
+			t.Errorf("Expected production token, got %s", r.Header.Get("Authorization"))
+		}
+		if r.Header.Get("X-Content-Type") != "text/plain" {
+			t.Errorf("Expected X-Content-Type text/plain, got %s", r.Header.Get("X-Content-Type"))
+		}
+		gotFromURL = r.URL.Query().Get("fromUrl")
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		_ = json.NewEncoder(w).Encode(PutBlobPutResult{URL: "https://blob.com/b.txt", Pathname: "b.txt"})
+	}))
+	defer production.Close()
+
+	src := newTestClient(t, WithBaseURL(staging.URL), WithTokenProvider(StaticTokenProvider("staging-token")))
+	dst := newTestClient(t, WithBaseURL(production.URL), WithTokenProvider(StaticTokenProvider("production-token")))
+
+	publicURL := "https://store.public.blob.vercel-storage.com/a.txt"
+	res, err := CopyAcrossStores(context.Background(), src, publicURL, dst, "b.txt", CopyCommandOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Method != CopyMethodServer || gotFromURL != publicURL || res.BytesTransferred != 0 {
+		t.Errorf("Expected server copy from %s, got %s from %s (%d bytes)", publicURL, res.Method, gotFromURL, res.BytesTransferred)
+	}
+
+	res, err = CopyAcrossStores(context.Background(), src, stagingFiles.URL+"/a.txt", dst, "b.txt", CopyCommandOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Method != CopyMethodStream || gotFromURL != "" || gotBody != "hello" {
+		t.Errorf("Expected streamed copy of hello, got %s with body %q", res.Method, gotBody)
+	}
+	if res.BytesTransferred != 5 {
+		t.Errorf("Expected 5 bytes transferred, got %d", res.BytesTransferred)
+	}
+}
+
+func Test_CopyWithOptions_RetryAfterDroppedResponse_Mock(t *testing.T) {
+	var copiedTo []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			pathname := strings.TrimPrefix(pathnameFromURL(r.URL.Query().Get("url")), "/")
+			_ = json.NewEncoder(w).Encode(HeadBlobResult{URL: "https://blob.com/" + pathname, Pathname: pathname, Size: 5})
+		case http.MethodPut:
+			if r.Header.Get("X-Add-Random-Suffix") != "0" {
+				t.Errorf("Expected server-side suffix to be disabled, got %s", r.Header.Get("X-Add-Random-Suffix"))
+			}
+			copiedTo = append(copiedTo, r.URL.Path)
+			if len(copiedTo) == 1 {
+				// The copy is applied but the response never arrives.
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				_ = conn.Close()
+				return
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(BlobAPIError{Error: BlobAPIErrorDetail{Code: "bad_request", Message: "This blob already exists"}})
+		}
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, WithBaseURL(server.URL), WithOperationRetry(OperationCopy, RetryPolicy{MaxAttempts: 3}), WithTokenProvider(StaticTokenProvider("test")))
+
+	res, err := client.CopyWithOptions(context.Background(), "https://blob.com/a.txt", "dir/b.txt", CopyCommandOptions{
+		AddRandomSuffix: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(copiedTo) != 2 || copiedTo[0] != copiedTo[1] {
+		t.Fatalf("Expected two attempts at the same pathname, got %v", copiedTo)
+	}
+	if !strings.HasPrefix(copiedTo[0], "/dir/b-") || !strings.HasSuffix(copiedTo[0], ".txt") {
+		t.Errorf("Expected a suffixed pathname, got %s", copiedTo[0])
+	}
+	if "/"+res.Pathname != copiedTo[0] {
+		t.Errorf("Expected result pathname %s, got %s", copiedTo[0], res.Pathname)
+	}
+}
+
+func Test_CopyWithOptions_ExistingDestinationNotRetried_Mock(t *testing.T) {
+	var puts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			pathname := strings.TrimPrefix(pathnameFromURL(r.URL.Query().Get("url")), "/")
+			_ = json.NewEncoder(w).Encode(HeadBlobResult{URL: "https://blob.com/" + pathname, Pathname: pathname, Size: 5})
+		case http.MethodPut:
+			puts++
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(BlobAPIError{Error: BlobAPIErrorDetail{Code: "bad_request", Message: "This blob already exists"}})
+		}
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")), WithRetry(RetryPolicy{MaxAttempts: 3}))
+
+	// The destination existed before the copy, which was never retried, so
+	// it is not mistaken for the result of a lost response.
+	_, err := client.CopyWithOptions(context.Background(), "https://blob.com/a.txt", "b.txt", CopyCommandOptions{})
+	if !errors.Is(err, ErrBlobAlreadyExists) || puts != 1 {
+		t.Errorf("Expected one copy failing with ErrBlobAlreadyExists, got %d, %v", puts, err)
+	}
+}
@@ -0,0 +1,146 @@
+package vercelblob
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DryRunRequest describes a request that a client in dry-run mode did not
+// send.
+type DryRunRequest struct {
+	Operation Operation
+	// Pathname is the pathname written by a put or copy, or the first blob
+	// of a delete.
+	Pathname string
+	// FromURL is the source of a copy.
+	FromURL string
+	// URLs are the blobs of a delete.
+	URLs []string
+	// Overwrite is set if the request would replace an existing blob.
+	Overwrite bool
+	// PartNumber is the number of a multipart upload part.
+	PartNumber int
+}
+
+// String formats the request on one line, e.g. for snapshot tests:
+//
+//	put a.txt overwrite
+//	copy b.txt from https://store.public.blob.vercel-storage.com/a.txt
+//	delete https://store.public.blob.vercel-storage.com/a.txt
+func (r DryRunRequest) String() string {
+	var b strings.Builder
+	b.WriteString(string(r.Operation))
+	switch {
+	case len(r.URLs) > 0:
+		b.WriteString(" " + strings.Join(r.URLs, " "))
+	case r.Pathname != "":
+		b.WriteString(" " + r.Pathname)
+	}
+	if r.PartNumber > 0 {
+		fmt.Fprintf(&b, " part %d", r.PartNumber)
+	}
+	if r.FromURL != "" {
+		b.WriteString(" from " + r.FromURL)
+	}
+	if r.Overwrite {
+		b.WriteString(" overwrite")
+	}
+	return b.String()
+}
+
+// DryRunRecorder is called with every request a client in dry-run mode did
+// not send, synchronously on the goroutine of the operation.
+type DryRunRecorder func(DryRunRequest)
+
+// WithDryRun makes the client skip every request that changes the store: Put,
+// including multipart uploads, Copy, UpdateMetadata, Delete and the prefix
+// operations built on them. These operations succeed with a result
+// synthesized from their arguments, and copies are not verified. Requests
+// that only read, such as List, Head and Download, are sent as usual, so
+// that, for instance, DeletePrefix lists the blobs it would delete.
+func WithDryRun() ClientOption {
+	return func(c *Client) error {
+		c.dryRun = true
+		return nil
+	}
+}
+
+// WithDryRunRecorder sets the function called with each request skipped by
+// WithDryRun.
+func WithDryRunRecorder(recorder DryRunRecorder) ClientOption {
+	return func(c *Client) error {
+		c.dryRunRecorder = recorder
+		return nil
+	}
+}
+
+// isWrite reports whether requests for operation change the store.
+func isWrite(operation Operation) bool {
+	switch operation {
+	case OperationPut, OperationCopy, OperationDelete,
+		OperationMultipartCreate, OperationMultipartPart, OperationMultipartComplete, OperationMultipartAbort:
+		return true
+	}
+	return false
+}
+
+// skipDryRun records req, a request of a write operation, and returns the
+// response synthesized in its place.
+func (c *Client) skipDryRun(req *http.Request, operation Operation, pathname string) *http.Response {
+	skipped := DryRunRequest{
+		Operation: operation,
+		Pathname:  pathname,
+		FromURL:   req.URL.Query().Get("fromUrl"),
+		Overwrite: req.Header.Get("X-Allow-Overwrite") == "1",
+	}
+	skipped.PartNumber, _ = strconv.Atoi(req.Header.Get("X-MPU-Part-Number"))
+	if operation == OperationDelete && req.GetBody != nil {
+		var deleted deleteRequest
+		if body, err := req.GetBody(); err == nil {
+			_ = json.NewDecoder(body).Decode(&deleted)
+		}
+		skipped.URLs = deleted.URLs
+	}
+	if req.Body != nil {
+		_, _ = io.Copy(io.Discard, req.Body)
+		_ = req.Body.Close()
+	}
+	if c.dryRunRecorder != nil {
+		c.dryRunRecorder(skipped)
+	}
+
+	result := map[string]string{}
+	switch operation {
+	case OperationPut, OperationCopy, OperationMultipartComplete:
+		result["pathname"] = pathname
+		storeID, err := storeIDFromToken(requestToken(req))
+		if err != nil {
+			storeID = "dry-run"
+		}
+		result["url"] = "https://" + strings.ToLower(storeID) + ".public" + blobHostSuffix + "/" + pathname
+	case OperationMultipartCreate:
+		result["uploadId"] = "dry-run"
+		result["key"] = "dry-run"
+	}
+	body, _ := json.Marshal(result)
+	header := http.Header{"Content-Type": {"application/json"}}
+	if operation == OperationMultipartPart {
+		header.Set("ETag", fmt.Sprintf(`"dry-run-%d"`, skipped.PartNumber))
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
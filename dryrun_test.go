@@ -0,0 +1,83 @@
+package vercelblob
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_WithDryRun_Mock(t *testing.T) {
+	var sent []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = append(sent, r.Method)
+		if r.Method != http.MethodGet {
+			t.Errorf("Expected no write request, got %s %s", r.Method, r.URL)
+		}
+		if r.URL.Query().Has("url") {
+			_, _ = w.Write([]byte(`{"url":"https://storeid123.public.blob.vercel-storage.com/logs/a.txt","pathname":"logs/a.txt","size":1}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"blobs":[
+			{"url":"https://storeid123.public.blob.vercel-storage.com/logs/a.txt","pathname":"logs/a.txt"},
+			{"url":"https://storeid123.public.blob.vercel-storage.com/logs/b.txt","pathname":"logs/b.txt"}
+		]}`))
+	}))
+	defer server.Close()
+
+	var recorded []string
+	client := newTestClient(t,
+		WithBaseURL(server.URL),
+		WithTokenProvider(StaticTokenProvider(testReadWriteToken)),
+		WithDryRun(),
+		WithDryRunRecorder(func(r DryRunRequest) { recorded = append(recorded, r.String()) }),
+	)
+	ctx := context.Background()
+
+	result, err := client.Put(ctx, "a.txt", strings.NewReader("a"), PutCommandOptions{AllowOverwrite: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Pathname != "a.txt" || result.URL != "https://storeid123.public.blob.vercel-storage.com/a.txt" {
+		t.Errorf("Expected a synthesized result, got %+v", result)
+	}
+	if _, err := client.Put(ctx, "big.bin", bytes.NewReader(make([]byte, MultipartThreshold+1)), PutCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Delete(ctx, "https://storeid123.public.blob.vercel-storage.com/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.DeletePrefix(ctx, "logs/", PrefixOptions{Concurrency: 1}); err != nil {
+		t.Fatal(err)
+	}
+	renamed, err := client.RenamePrefix(ctx, "logs/", "archive/", PrefixOptions{Concurrency: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(renamed.Completed) != 2 {
+		t.Errorf("Expected both blobs to be reported as renamed, got %+v", renamed)
+	}
+
+	want := []string{
+		"put a.txt overwrite",
+		"multipart-create big.bin",
+		"multipart-part big.bin part 1",
+		"multipart-part big.bin part 2",
+		"multipart-complete big.bin",
+		"delete https://storeid123.public.blob.vercel-storage.com/a.txt",
+		"delete https://storeid123.public.blob.vercel-storage.com/logs/a.txt",
+		"delete https://storeid123.public.blob.vercel-storage.com/logs/b.txt",
+		"copy archive/a.txt from https://storeid123.public.blob.vercel-storage.com/logs/a.txt",
+		"delete https://storeid123.public.blob.vercel-storage.com/logs/a.txt",
+		"copy archive/b.txt from https://storeid123.public.blob.vercel-storage.com/logs/b.txt",
+		"delete https://storeid123.public.blob.vercel-storage.com/logs/b.txt",
+	}
+	if strings.Join(recorded, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(recorded, "\n"))
+	}
+	if len(sent) == 0 {
+		t.Error("Expected the list and head requests to be sent")
+	}
+}
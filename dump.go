@@ -0,0 +1,217 @@
+package vercelblob
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// debugDumpBodyLimit is the number of bytes of each body written by
+// WithDebugDump.
+const debugDumpBodyLimit = 16 << 10
+
+// WithDebugDump writes every request of the client and its response to w,
+// e.g. to send an exact reproduction of an API issue to Vercel support. Each
+// exchange is written at once, between delimiters carrying a sequence number
+// and a timestamp, once its response body is closed or the request failed.
+//
+// Headers are always written; bodies only if includeBodies is set, up to
+// 16 KiB each. The bodies of multipart parts are summarized by their part
+// number and size. The Authorization header, query parameters named like a
+// token and every occurrence of the token of the request are redacted.
+// Bodies are copied as they are sent and read, so dumping does not consume
+// them. A nil w disables dumping, which is the default.
+func WithDebugDump(w io.Writer, includeBodies bool) ClientOption {
+	return func(c *Client) error {
+		if w == nil {
+			c.debugDump = nil
+			return nil
+		}
+		c.debugDump = &debugDump{w: w, bodies: includeBodies}
+		return nil
+	}
+}
+
+// debugDump holds the state of WithDebugDump.
+type debugDump struct {
+	w      io.Writer
+	bodies bool
+
+	mu  sync.Mutex
+	seq int
+}
+
+// write writes an exchange to the dump in one piece.
+func (d *debugDump) write(entry []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, _ = d.w.Write(entry)
+}
+
+// next returns the sequence number of a new exchange.
+func (d *debugDump) next() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.seq++
+	return d.seq
+}
+
+// dumpRequests dumps each request sent through next.
+func (c *Client) dumpRequests(next RoundTripFunc) RoundTripFunc {
+	d := c.debugDump
+	return func(req *http.Request) (*http.Response, error) {
+		seq := d.next()
+		start, began := c.now(), time.Now()
+		var reqBody *capture
+		if d.bodies && req.Body != nil && req.Body != http.NoBody {
+			reqBody = &capture{ReadCloser: req.Body}
+			req = req.Clone(req.Context())
+			req.Body = reqBody
+		}
+		resp, err := next(req)
+		duration := time.Since(began)
+
+		entry := &bytes.Buffer{}
+		token := requestToken(req)
+		info, _ := RequestInfoFromContext(req.Context())
+		fmt.Fprintf(entry, "=== vercelblob #%d %s %s %q ===\n", seq, start.UTC().Format(time.RFC3339Nano), info.Operation, redactTokens(info.Pathname, token))
+		fmt.Fprintf(entry, "%s %s %s\n", req.Method, redactURL(req.URL, token), req.Proto)
+		writeDumpHeaders(entry, req.Header, token)
+		if d.bodies {
+			if info.Operation == OperationMultipartPart {
+				fmt.Fprintf(entry, "\n[part %s: %d bytes]\n", req.Header.Get("X-MPU-Part-Number"), reqBody.size())
+			} else {
+				writeDumpBody(entry, reqBody, token)
+			}
+		}
+		fmt.Fprintf(entry, "--- vercelblob #%d response after %v ---\n", seq, duration.Round(time.Microsecond))
+		if err != nil {
+			fmt.Fprintf(entry, "error: %s\n", redactTokens(err.Error(), token))
+			fmt.Fprintf(entry, "=== vercelblob #%d end ===\n", seq)
+			d.write(entry.Bytes())
+			return resp, err
+		}
+		fmt.Fprintf(entry, "%s %s\n", resp.Proto, resp.Status)
+		writeDumpHeaders(entry, resp.Header, token)
+		if !d.bodies {
+			fmt.Fprintf(entry, "=== vercelblob #%d end ===\n", seq)
+			d.write(entry.Bytes())
+			return resp, nil
+		}
+		respBody := &capture{ReadCloser: resp.Body}
+		respBody.done = func() {
+			writeDumpBody(entry, respBody, token)
+			fmt.Fprintf(entry, "=== vercelblob #%d end ===\n", seq)
+			d.write(entry.Bytes())
+		}
+		resp.Body = respBody
+		return resp, nil
+	}
+}
+
+// redactURL formats u with the query parameters named like a token and the
+// occurrences of token redacted.
+func redactURL(u *url.URL, token string) string {
+	redacted := *u
+	if q := u.Query(); len(q) > 0 {
+		for name, values := range q {
+			if strings.Contains(strings.ToLower(name), "token") {
+				for i := range values {
+					values[i] = redactedMarker
+				}
+			}
+		}
+		redacted.RawQuery = q.Encode()
+	}
+	return redactTokens(redacted.RequestURI(), token)
+}
+
+// writeDumpHeaders writes header sorted by name, with the Authorization
+// header and token redacted.
+func writeDumpHeaders(w *bytes.Buffer, header http.Header, token string) {
+	for _, name := range slices.Sorted(maps.Keys(header)) {
+		for _, value := range header[name] {
+			if strings.EqualFold(name, "Authorization") {
+				value = redactedMarker
+			}
+			fmt.Fprintf(w, "%s: %s\n", name, redactTokens(value, token))
+		}
+	}
+}
+
+// writeDumpBody writes the captured part of a body, if any.
+func writeDumpBody(w *bytes.Buffer, body *capture, token string) {
+	if body == nil {
+		return
+	}
+	body.mu.Lock()
+	defer body.mu.Unlock()
+	if body.n == 0 {
+		return
+	}
+	data := body.buf.Bytes()
+	if body.n > int64(len(data)) {
+		// The limit may have cut the last character.
+		for i := 0; i < utf8.UTFMax-1 && len(data) > 0 && !utf8.Valid(data); i++ {
+			data = data[:len(data)-1]
+		}
+	}
+	w.WriteString("\n")
+	if utf8.Valid(data) {
+		w.WriteString(redactTokens(string(data), token))
+		if body.n > int64(len(data)) {
+			fmt.Fprintf(w, "... [%d more bytes]", body.n-int64(len(data)))
+		}
+	} else {
+		fmt.Fprintf(w, "[%d bytes of binary data]", body.n)
+	}
+	w.WriteString("\n")
+}
+
+// capture copies up to debugDumpBodyLimit bytes of a body as it is read and
+// counts them all. done, if set, is called once the body is closed.
+type capture struct {
+	io.ReadCloser
+	mu   sync.Mutex
+	buf  bytes.Buffer
+	n    int64
+	once sync.Once
+	done func()
+}
+
+func (c *capture) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if room := debugDumpBodyLimit - c.buf.Len(); room > 0 {
+		c.buf.Write(p[:min(n, room)])
+	}
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *capture) Close() error {
+	err := c.ReadCloser.Close()
+	if c.done != nil {
+		c.once.Do(c.done)
+	}
+	return err
+}
+
+// size returns the number of bytes read from c, which may be nil.
+func (c *capture) size() int64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.n
+}
@@ -0,0 +1,108 @@
+package vercelblob
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_WithDebugDump_Mock(t *testing.T) {
+	const token = "vercel_blob_rw_store_0123456789abcdefwxyz"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path == "/a.txt" && string(body) != "hello world" {
+			t.Errorf("Expected the body to reach the server, got %q", body)
+		}
+		w.Header().Set("X-Vercel-Id", "iad1::abc")
+		w.Header().Set("ETag", `"etag"`)
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.txt","pathname":"a.txt","uploadId":"id","key":"key","echo":"` + token + `"}`))
+	}))
+	defer server.Close()
+	clock := newFakeClock(time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC))
+	var dump bytes.Buffer
+	client := newTestClient(t,
+		WithClock(clock.Now),
+		WithBaseURL(server.URL),
+		WithTokenProvider(StaticTokenProvider(token)),
+		WithDebugDump(&dump, true),
+	)
+	ctx := context.Background()
+
+	result, err := client.Put(ctx, "a.txt", strings.NewReader("hello world"), PutCommandOptions{})
+	if err != nil || result.URL != "https://blob.com/a.txt" {
+		t.Fatalf("Expected the response to reach the caller, got %+v, %v", result, err)
+	}
+	out := dump.String()
+	for _, want := range []string{
+		`=== vercelblob #1 2025-01-02T03:04:05Z put "a.txt" ===`,
+		"PUT /a.txt HTTP/1.1\n",
+		"Authorization: ****\n",
+		"\nhello world\n",
+		"--- vercelblob #1 response after ",
+		"HTTP/1.1 200 OK\n",
+		"X-Vercel-Id: iad1::abc\n",
+		`"echo":"vercel_blob_rw_store_****wxyz"`,
+		"=== vercelblob #1 end ===\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected the dump to contain %q, got\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, token) {
+		t.Errorf("Expected the token to be redacted, got\n%s", out)
+	}
+
+	// Parts are summarized and long bodies truncated.
+	dump.Reset()
+	data := strings.Repeat("a", MultipartThreshold+1)
+	if _, err := client.Put(ctx, "a.bin", strings.NewReader(data), PutCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	out = dump.String()
+	if !strings.Contains(out, "\n[part 1: "+strconv.Itoa(MultipartThreshold)+" bytes]\n") || !strings.Contains(out, "\n[part 2: 1 bytes]\n") || strings.Contains(out, "aaaa") {
+		t.Errorf("Expected summarized parts, got\n%s", out)
+	}
+	if n := strings.Count(out, "=== vercelblob #"); n != 8 {
+		t.Errorf("Expected 4 delimited exchanges, got %d delimiters", n)
+	}
+
+	dump.Reset()
+	long := strings.Repeat("é", debugDumpBodyLimit)
+	_, _ = client.Put(ctx, "b.txt", strings.NewReader(long), PutCommandOptions{})
+	if want := "... [" + strconv.Itoa(len(long)-debugDumpBodyLimit) + " more bytes]"; !strings.Contains(dump.String(), want) {
+		t.Errorf("Expected the body to be truncated with %q", want)
+	}
+	if strings.Contains(dump.String(), "binary") {
+		t.Error("Expected a truncated character not to make the body binary")
+	}
+}
+
+func Test_WithDebugDump_Headers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.txt","pathname":"a.txt"}`))
+	}))
+	defer server.Close()
+	var dump bytes.Buffer
+	client := newTestClient(t,
+		WithBaseURL(server.URL),
+		WithTokenProvider(StaticTokenProvider("token")),
+		WithDebugDump(&dump, false),
+	)
+	if _, err := client.Put(context.Background(), "a.txt", strings.NewReader("secret body"), PutCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if out := dump.String(); strings.Contains(out, "secret body") || strings.Contains(out, `"pathname"`) || !strings.Contains(out, "Content-Type: ") {
+		t.Errorf("Expected only headers, got\n%s", out)
+	}
+	u, _ := url.Parse("https://x/a?token=abc&b=1")
+	if got := redactURL(u, ""); got != "/a?b=1&token=%2A%2A%2A%2A" {
+		t.Errorf("Expected the token parameter to be redacted, got %q", got)
+	}
+}
@@ -1,31 +1,134 @@
 package vercelblob
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
 )
 
-// Error will be the type of all errors raised by this crate.
+// Error will be the type of all errors raised by this crate. Errors are
+// always returned as *Error; use errors.As with a *Error target to inspect
+// them.
 type Error struct {
 	Msg  string
 	Code string
+	// Err is the underlying failure, such as a transport error, if any.
+	Err error
 }
 
 func (e Error) Error() string {
+	if e.Err != nil {
+		return e.Msg + ": " + e.Err.Error()
+	}
 	return e.Msg
 }
 
-// All errors raised by this crate will be instances of Error
+// Unwrap returns the underlying failure, if any.
+func (e Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is an Error with the same Code, so that errors
+// compare equal to the sentinels below whatever their message and however
+// they are wrapped. A not_found error also matches fs.ErrNotExist, so
+// missing blobs can be handled like missing files.
+func (e Error) Is(target error) bool {
+	if target == fs.ErrNotExist {
+		return e.Code == ErrBlobNotFound.Code
+	}
+	var code string
+	switch t := target.(type) {
+	case *Error:
+		if t == nil {
+			return false
+		}
+		code = t.Code
+	case Error:
+		code = t.Code
+	default:
+		return false
+	}
+	return code != "" && code == e.Code
+}
+
+// All errors raised by this crate will be instances of *Error, or wrap one.
 var (
 	ErrNotAuthenticated = &Error{
 		Msg:  "No authentication token. Expected environment variable BLOB_READ_WRITE_TOKEN to contain a token",
 		Code: "not_authenticated",
 	}
 
+	ErrInvalidReadWriteToken = &Error{
+		Msg:  "Invalid read-write token, expected vercel_blob_rw_<storeId>_<secret>",
+		Code: "invalid_token",
+	}
+
+	ErrMalformedClientToken = &Error{
+		Msg:  "The client token is malformed",
+		Code: "malformed_client_token",
+	}
+
+	ErrInvalidClientTokenSignature = &Error{
+		Msg:  "The client token signature is invalid",
+		Code: "invalid_client_token_signature",
+	}
+
+	ErrUnsupportedClientTokenVersion = &Error{
+		Msg:  "The client token is of a newer format than this package supports",
+		Code: "unsupported_client_token_version",
+	}
+
+	ErrClientTokenExpired = &Error{
+		Msg:  "The client token has expired",
+		Code: "client_token_expired",
+	}
+
+	ErrUploadNotAllowed = &Error{
+		Msg:  "The upload is not allowed by the client token",
+		Code: "upload_not_allowed",
+	}
+
+	ErrClientClosed = &Error{
+		Msg:  "The client has been closed",
+		Code: "client_closed",
+	}
+
+	ErrOutsidePrefix = &Error{
+		Msg:  "The pathname is outside the prefix of the client",
+		Code: "outside_prefix",
+	}
+
+	ErrWebhookSignatureMissing = &Error{
+		Msg:  "The webhook request has no signature",
+		Code: "webhook_signature_missing",
+	}
+
+	ErrWebhookSignatureInvalid = &Error{
+		Msg:  "The webhook signature is invalid",
+		Code: "webhook_signature_invalid",
+	}
+
+	ErrWebhookTimestampStale = &Error{
+		Msg:  "The webhook timestamp is outside the accepted window",
+		Code: "webhook_timestamp_stale",
+	}
+
+	ErrWebhookTimestampMissing = &Error{
+		Msg:  "The webhook request has no timestamp",
+		Code: "webhook_timestamp_missing",
+	}
+
+	// ErrBadRequest returns a bad_request Error. It returns a value for
+	// compatibility; the package returns BadRequestError.
 	ErrBadRequest = func(msg string) Error {
-		return Error{
-			Msg:  fmt.Sprintf("Invalid request: %s", msg),
-			Code: "bad_request",
-		}
+		return *BadRequestError(msg)
 	}
 
 	ErrForbidden = &Error{
@@ -38,6 +141,26 @@ var (
 		Code: "store_not_found",
 	}
 
+	ErrUnknownStore = &Error{
+		Msg:  "The blob store is not registered",
+		Code: "unknown_store",
+	}
+
+	ErrRateLimited = &Error{
+		Msg:  "Too many requests, please slow down",
+		Code: "rate_limited",
+	}
+
+	ErrServiceUnavailable = &Error{
+		Msg:  "The blob service is temporarily unavailable",
+		Code: "service_unavailable",
+	}
+
+	ErrCircuitOpen = &Error{
+		Msg:  "The circuit breaker is open after repeated failures of the API",
+		Code: "circuit_open",
+	}
+
 	ErrStoreSuspended = &Error{
 		Msg:  "The requested store has been suspended",
 		Code: "store_suspended",
@@ -47,20 +170,439 @@ var (
 		Msg:  "The requested blob does not exist",
 		Code: "not_found",
 	}
+
+	ErrMalformedResponse = &Error{
+		Msg:  "The API returned a response that could not be understood",
+		Code: "malformed_response",
+	}
+
+	ErrBlobAlreadyExists = &Error{
+		Msg:  "A blob already exists at the pathname and overwriting it is not allowed",
+		Code: "blob_already_exists",
+	}
+
+	ErrPathnameChanged = &Error{
+		Msg:  "The blob pathname changed while updating its metadata",
+		Code: "pathname_changed",
+	}
+
+	ErrCopyVerificationFailed = &Error{
+		Msg:  "The copied blob does not match its source",
+		Code: "copy_verification_failed",
+	}
 )
 
-// NewUnknownError creates a new Error for an unknown error.
-func NewUnknownError(statusCode int, message string) Error {
-	return Error{
+// BadRequestError creates a new *Error for a request the API or a fake store
+// rejected as invalid.
+func BadRequestError(msg string) *Error {
+	return &Error{
+		Msg:  fmt.Sprintf("Invalid request: %s", msg),
+		Code: "bad_request",
+	}
+}
+
+// UnknownError creates a new *Error for an unknown error.
+func UnknownError(statusCode int, message string) *Error {
+	return &Error{
 		Msg:  fmt.Sprintf("Unknown error, please visit https://vercel.com/help (%d): %s", statusCode, message),
 		Code: "unknown_error",
 	}
 }
 
-// NewInvalidInputError creates a new Error for an invalid input field.
-func NewInvalidInputError(field string) Error {
-	return Error{
+// InvalidInputError creates a new *Error for an invalid input field.
+func InvalidInputError(field string) *Error {
+	return &Error{
 		Msg:  fmt.Sprintf("%s is required", field),
 		Code: "invalid_input",
 	}
 }
+
+// NewUnknownError creates a new Error for an unknown error. It returns a
+// value for compatibility; the package returns UnknownError.
+func NewUnknownError(statusCode int, message string) Error {
+	return *UnknownError(statusCode, message)
+}
+
+// NewInvalidInputError creates a new Error for an invalid input field. It
+// returns a value for compatibility; the package returns InvalidInputError.
+func NewInvalidInputError(field string) Error {
+	return *InvalidInputError(field)
+}
+
+// NewInvalidOptionError creates a new Error for a client option given an
+// invalid value.
+func NewInvalidOptionError(option, reason string) *Error {
+	return &Error{
+		Msg:  fmt.Sprintf("invalid %s: %s", option, reason),
+		Code: "invalid_option",
+	}
+}
+
+// CodeOf returns the Code of the *Error that err is or wraps, or "" if it
+// wraps none.
+func CodeOf(err error) string {
+	var blobErr *Error
+	if errors.As(err, &blobErr) {
+		return blobErr.Code
+	}
+	var value Error
+	if errors.As(err, &value) {
+		return value.Code
+	}
+	return ""
+}
+
+// IsNotFound reports whether err means that the blob does not exist.
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrBlobNotFound)
+}
+
+// IsForbidden reports whether err means that the token does not allow the
+// operation.
+func IsForbidden(err error) bool {
+	return errors.Is(err, ErrForbidden)
+}
+
+// IsNotAuthenticated reports whether err means that no token was available
+// for the operation.
+func IsNotAuthenticated(err error) bool {
+	return errors.Is(err, ErrNotAuthenticated)
+}
+
+// IsRateLimited reports whether err means that the API rejected the request
+// for exceeding its rate limit.
+func IsRateLimited(err error) bool {
+	return errors.Is(err, ErrRateLimited)
+}
+
+// RetryAfter returns the delay the API asked for before the request that
+// failed with err is retried, from the Retry-After header of a 429 or 503
+// response. It reports false if the API asked for none.
+func RetryAfter(err error) (time.Duration, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		return apiErr.RetryAfter, true
+	}
+	return 0, false
+}
+
+// Classification is the class of an error for retrying, as returned by
+// RetryClass.
+type Classification int
+
+const (
+	// NonRetryable errors fail again if the operation is retried unchanged.
+	NonRetryable Classification = iota
+	// Retryable errors are transient: the API failed with an unexplained
+	// server error or was unavailable, or the request failed in transit.
+	Retryable
+	// Throttled errors come from the API rate limiting the client. They are
+	// retryable after the delay reported by RetryAfter.
+	Throttled
+	// AuthExpired errors come from a token that expired or was rejected. They
+	// are retryable with a fresh token.
+	AuthExpired
+)
+
+func (c Classification) String() string {
+	switch c {
+	case Retryable:
+		return "retryable"
+	case Throttled:
+		return "throttled"
+	case AuthExpired:
+		return "auth_expired"
+	default:
+		return "non_retryable"
+	}
+}
+
+// RetryClass classifies err for retrying the operation that failed with it.
+// It is the classification the client uses for WithRetry, so that external
+// retry frameworks agree with it. Errors of the context of the operation are
+// NonRetryable, and so are failures in transit that a retry cannot fix: a
+// malformed URL, an unsupported scheme or a certificate that does not verify.
+func RetryClass(err error) Classification {
+	var apiErr *APIError
+	var transportErr *TransportError
+	var urlErr *url.Error
+	switch {
+	case err == nil, errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return NonRetryable
+	case IsRateLimited(err):
+		return Throttled
+	case errors.Is(err, ErrClientTokenExpired):
+		return AuthExpired
+	case errors.Is(err, ErrServiceUnavailable):
+		return Retryable
+	case errors.As(err, &apiErr):
+		switch {
+		case apiErr.StatusCode == http.StatusUnauthorized:
+			return AuthExpired
+		case apiErr.StatusCode >= 500 && (apiErr.Err == nil || apiErr.Err.Code == "unknown_error"):
+			// Errors the API reports with a code of their own, such as
+			// store_suspended, persist whatever the status.
+			return Retryable
+		}
+		return NonRetryable
+	case errors.As(err, &transportErr), errors.As(err, &urlErr):
+		if isPermanentTransportError(err) {
+			return NonRetryable
+		}
+		return Retryable
+	default:
+		return NonRetryable
+	}
+}
+
+// isPermanentTransportError reports whether err, a failure in transit, comes
+// from the request or the server being misconfigured rather than from the
+// network, so that sending the request again fails the same way.
+func isPermanentTransportError(err error) bool {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) && urlErr.Op == "parse" {
+		return true
+	}
+	var verifyErr *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	var invalid x509.CertificateInvalidError
+	var hostname x509.HostnameError
+	var recordHeader tls.RecordHeaderError
+	if errors.As(err, &verifyErr) || errors.As(err, &unknownAuthority) || errors.As(err, &invalid) ||
+		errors.As(err, &hostname) || errors.As(err, &recordHeader) {
+		return true
+	}
+	// net/http reports these with unexported types.
+	msg := err.Error()
+	return strings.Contains(msg, "unsupported protocol scheme") || strings.Contains(msg, "no Host in request URL")
+}
+
+// IsRetryable reports whether the operation that failed with err may succeed
+// if it is tried again unchanged, after a delay: RetryClass classifies err as
+// Retryable or Throttled.
+func IsRetryable(err error) bool {
+	class := RetryClass(err)
+	return class == Retryable || class == Throttled
+}
+
+// requestIDHeader is the response header identifying a request to Vercel
+// support. fallbackRequestIDHeader is read if it is missing, e.g. behind a
+// gateway.
+const (
+	requestIDHeader         = "X-Vercel-Id"
+	fallbackRequestIDHeader = "X-Request-Id"
+)
+
+// responseRequestID returns the ID of the request answered by resp, or "".
+func responseRequestID(resp *http.Response) string {
+	if id := resp.Header.Get(requestIDHeader); id != "" {
+		return id
+	}
+	return resp.Header.Get(fallbackRequestIDHeader)
+}
+
+// APIError is returned when the API rejects a request. It describes the
+// request for debugging and support tickets, and unwraps to the *Error
+// reported by the API, so it matches sentinels such as ErrBlobNotFound with
+// errors.Is.
+type APIError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// RequestID is the x-vercel-id header of the response, if any.
+	RequestID string
+	// Operation and Pathname are the operation that failed and the pathname
+	// or URL it addressed.
+	Operation Operation
+	Pathname  string
+	// RetryAfter is the delay requested by the Retry-After header of the
+	// response, such as on a 429, or 0 if there was none.
+	RetryAfter time.Duration
+	Err        *Error
+}
+
+func (e *APIError) Error() string {
+	var b strings.Builder
+	if e.Err != nil {
+		b.WriteString(e.Err.Error())
+	} else {
+		b.WriteString(http.StatusText(e.StatusCode))
+	}
+	b.WriteString(" (")
+	if e.Operation != "" {
+		fmt.Fprintf(&b, "%s %q: ", e.Operation, e.Pathname)
+	}
+	fmt.Fprintf(&b, "status %d", e.StatusCode)
+	if e.RequestID != "" {
+		fmt.Fprintf(&b, ", request ID %s", e.RequestID)
+	}
+	if e.RetryAfter > 0 {
+		fmt.Fprintf(&b, ", retry after %v", e.RetryAfter)
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+// Unwrap returns the error reported by the API.
+func (e *APIError) Unwrap() error {
+	if e.Err == nil {
+		return nil
+	}
+	return e.Err
+}
+
+// TransportError is returned when a request fails in transit, such as when
+// the connection is refused or reset, as opposed to being rejected by the
+// API. It unwraps to the error of the transport. A request that fails
+// because its context is done returns the context error instead, which
+// errors.Is matches against context.Canceled or context.DeadlineExceeded.
+type TransportError struct {
+	Operation Operation
+	Pathname  string
+	Err       error
+}
+
+func (e *TransportError) Error() string {
+	return fmt.Sprintf("%s %q: %v", e.Operation, e.Pathname, e.Err)
+}
+
+// Unwrap returns the error of the transport.
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// newTransportError wraps err, a failure of a request of operation in
+// transit, in a *TransportError, unless it comes from a context being done.
+func newTransportError(err error, operation Operation, pathname string) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return &TransportError{Operation: operation, Pathname: pathname, Err: err}
+}
+
+// maxBodySnippet is the number of bytes of an unexpected response body kept
+// by an UnexpectedResponseError.
+const maxBodySnippet = 4 << 10
+
+// UnexpectedResponseError is returned when a response body is not the JSON
+// the API sends, such as the HTML error page of a proxy in front of it, or a
+// successful response lacks a field its result needs, such as the url of a
+// Put. It matches ErrMalformedResponse with errors.Is and unwraps to the
+// decoding error or the missing_field *Error.
+type UnexpectedResponseError struct {
+	StatusCode  int
+	ContentType string
+	// Body is the start of the response body, with any token redacted.
+	Body string
+	Err  error
+}
+
+func (e *UnexpectedResponseError) Error() string {
+	contentType := e.ContentType
+	if contentType == "" {
+		contentType = "untyped"
+	}
+	return fmt.Sprintf("unexpected %s response (status %d): %v: %q", contentType, e.StatusCode, e.Err, e.Body)
+}
+
+// Unwrap returns the decoding error.
+func (e *UnexpectedResponseError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrMalformedResponse.
+func (e *UnexpectedResponseError) Is(target error) bool {
+	return target == ErrMalformedResponse
+}
+
+// newUnexpectedResponseError returns an *UnexpectedResponseError for body,
+// read from resp, that failed to decode with err.
+func newUnexpectedResponseError(resp *http.Response, body []byte, err error) *UnexpectedResponseError {
+	snippet := body
+	if len(snippet) > maxBodySnippet {
+		snippet = snippet[:maxBodySnippet]
+	}
+	text := strings.ToValidUTF8(string(snippet), "")
+	if len(body) > maxBodySnippet {
+		text += "..."
+	}
+	return &UnexpectedResponseError{
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Body:        redactTokens(text, requestToken(resp.Request)),
+		Err:         err,
+	}
+}
+
+// CopyVerificationError is returned by a verified copy when the destination
+// does not match the source. It matches ErrCopyVerificationFailed with errors.Is.
+type CopyVerificationError struct {
+	Source      *HeadBlobResult
+	Destination *HeadBlobResult
+}
+
+func (e *CopyVerificationError) Error() string {
+	if e.Source.ETag != "" && e.Destination.ETag != "" {
+		return fmt.Sprintf("%s: source %s (ETag %s), destination %s (ETag %s)",
+			ErrCopyVerificationFailed.Msg, e.Source.Pathname, e.Source.ETag, e.Destination.Pathname, e.Destination.ETag)
+	}
+	return fmt.Sprintf("%s: source %s (%d bytes), destination %s (%d bytes)",
+		ErrCopyVerificationFailed.Msg, e.Source.Pathname, e.Source.Size, e.Destination.Pathname, e.Destination.Size)
+}
+
+// Unwrap returns ErrCopyVerificationFailed.
+func (e *CopyVerificationError) Unwrap() error {
+	return ErrCopyVerificationFailed
+}
+
+// StoreTokenError is returned by MultiStoreTokenProvider when it has no token
+// for the store an operation addresses. It matches ErrNotAuthenticated with
+// errors.Is, so a ChainTokenProvider moves on to its next provider.
+type StoreTokenError struct {
+	// StoreID is the store that was resolved, or "" if the pathname matched
+	// no prefix and no DefaultStore is set.
+	StoreID  string
+	Pathname string
+	// EnvVar is the environment variable configured for the store, if it
+	// was unset or empty.
+	EnvVar string
+}
+
+func (e *StoreTokenError) Error() string {
+	switch {
+	case e.StoreID == "":
+		return fmt.Sprintf("no blob store configured for %q", e.Pathname)
+	case e.EnvVar != "":
+		return fmt.Sprintf("no token for blob store %q: environment variable %s is not set", e.StoreID, e.EnvVar)
+	default:
+		return fmt.Sprintf("no token configured for blob store %q (addressed by %q)", e.StoreID, e.Pathname)
+	}
+}
+
+// Unwrap returns ErrNotAuthenticated.
+func (e *StoreTokenError) Unwrap() error {
+	return ErrNotAuthenticated
+}
+
+// PolicyDeniedError is returned by PolicyTokenProvider when no rule allows an
+// operation. It matches ErrForbidden with errors.Is.
+type PolicyDeniedError struct {
+	Operation Operation
+	Pathname  string
+}
+
+func (e *PolicyDeniedError) Error() string {
+	return fmt.Sprintf("%s %q is not allowed by the token policy", e.Operation, e.Pathname)
+}
+
+// Unwrap returns ErrForbidden.
+func (e *PolicyDeniedError) Unwrap() error {
+	return ErrForbidden
+}
+
+// NewMissingFieldError creates a new Error for a field missing from an API response.
+func NewMissingFieldError(field string) *Error {
+	return &Error{
+		Msg:  fmt.Sprintf("response is missing %s", field),
+		Code: "missing_field",
+	}
+}
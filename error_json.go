@@ -0,0 +1,77 @@
+package vercelblob
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// errorJSON is the JSON form of the errors of this package.
+type errorJSON struct {
+	Code      string    `json:"code"`
+	Message   string    `json:"message"`
+	Status    int       `json:"status,omitempty"`
+	RequestID string    `json:"requestId,omitempty"`
+	Operation Operation `json:"operation,omitempty"`
+	Pathname  string    `json:"pathname,omitempty"`
+}
+
+// MarshalJSON encodes the error as {"code", "message"}.
+func (e Error) MarshalJSON() ([]byte, error) {
+	return json.Marshal(errorJSON{Code: e.Code, Message: e.Msg})
+}
+
+// UnmarshalJSON decodes an error encoded by MarshalJSON. The decoded error
+// matches the sentinel of its code with errors.Is.
+func (e *Error) UnmarshalJSON(data []byte) error {
+	var v errorJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*e = Error{Msg: v.Message, Code: v.Code}
+	return nil
+}
+
+// MarshalJSON encodes the error as {"code", "message", "status",
+// "requestId"}, along with the operation and pathname that failed.
+func (e *APIError) MarshalJSON() ([]byte, error) {
+	v := errorJSON{Status: e.StatusCode, RequestID: e.RequestID, Operation: e.Operation, Pathname: e.Pathname}
+	if e.Err != nil {
+		v.Code, v.Message = e.Err.Code, e.Err.Msg
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON decodes an error encoded by MarshalJSON. The decoded error
+// matches the sentinel of its code with errors.Is.
+func (e *APIError) UnmarshalJSON(data []byte) error {
+	var v errorJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*e = APIError{
+		StatusCode: v.Status,
+		RequestID:  v.RequestID,
+		Operation:  v.Operation,
+		Pathname:   v.Pathname,
+		Err:        &Error{Msg: v.Message, Code: v.Code},
+	}
+	return nil
+}
+
+// AsJSON encodes the *APIError or *Error nearest to err in its chain, for
+// passing failures on to clients that branch on their code. Errors of other
+// packages are encoded with the code unknown_error and their message. A nil
+// err is encoded as null.
+func AsJSON(err error) ([]byte, error) {
+	if err == nil {
+		return []byte("null"), nil
+	}
+	var marshaler interface {
+		error
+		json.Marshaler
+	}
+	if errors.As(err, &marshaler) {
+		return marshaler.MarshalJSON()
+	}
+	return json.Marshal(errorJSON{Code: "unknown_error", Message: err.Error()})
+}
@@ -0,0 +1,67 @@
+package vercelblob
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func Test_Error_JSON(t *testing.T) {
+	apiErr := &APIError{
+		StatusCode: http.StatusNotFound,
+		RequestID:  "iad1::abc",
+		Operation:  OperationHead,
+		Pathname:   "a.txt",
+		Err:        ErrBlobNotFound,
+	}
+	data, err := AsJSON(fmt.Errorf("load avatar: %w", apiErr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"code":"not_found","message":"The requested blob does not exist","status":404,"requestId":"iad1::abc","operation":"head","pathname":"a.txt"}`
+	if string(data) != want {
+		t.Errorf("Expected %s, got %s", want, data)
+	}
+
+	var decoded APIError
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !IsNotFound(&decoded) || decoded.StatusCode != http.StatusNotFound || decoded.RequestID != "iad1::abc" || decoded.Error() != apiErr.Error() {
+		t.Errorf("Expected the error to round-trip, got %+v", decoded)
+	}
+
+	var blobErr Error
+	if err := json.Unmarshal(data, &blobErr); err != nil {
+		t.Fatal(err)
+	}
+	if !IsNotFound(blobErr) || !IsNotFound(&blobErr) || CodeOf(blobErr) != "not_found" {
+		t.Errorf("Expected the decoded *Error to match ErrBlobNotFound, got %+v", blobErr)
+	}
+	if data, _ := json.Marshal(ErrForbidden); string(data) != `{"code":"forbidden","message":"`+ErrForbidden.Msg+`"}` {
+		t.Errorf("Unexpected encoding %s", data)
+	}
+}
+
+func Test_AsJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"nil", nil, `null`},
+		{"sentinel", fmt.Errorf("put: %w", ErrClientClosed), `{"code":"client_closed","message":"The client has been closed"}`},
+		{"nearest", &TransportError{Operation: OperationPut, Pathname: "a.txt", Err: NewInvalidInputError("pathname")}, `{"code":"invalid_input","message":"pathname is required"}`},
+		{"foreign", errors.New("boom"), `{"code":"unknown_error","message":"boom"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := AsJSON(tt.err)
+			if err != nil || string(data) != tt.want {
+				t.Errorf("Expected %s, got %s, %v", tt.want, data, err)
+			}
+		})
+	}
+}
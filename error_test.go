@@ -0,0 +1,577 @@
+package vercelblob
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// testSentinels are the sentinel errors of the package.
+var testSentinels = []*Error{
+	ErrNotAuthenticated,
+	ErrInvalidReadWriteToken,
+	ErrMalformedClientToken,
+	ErrInvalidClientTokenSignature,
+	ErrUnsupportedClientTokenVersion,
+	ErrClientTokenExpired,
+	ErrUploadNotAllowed,
+	ErrClientClosed,
+	ErrOutsidePrefix,
+	ErrWebhookSignatureMissing,
+	ErrWebhookSignatureInvalid,
+	ErrWebhookTimestampStale,
+	ErrWebhookTimestampMissing,
+	ErrForbidden,
+	ErrStoreNotFound,
+	ErrUnknownStore,
+	ErrRateLimited,
+	ErrServiceUnavailable,
+	ErrCircuitOpen,
+	ErrStoreSuspended,
+	ErrBlobNotFound,
+	ErrMalformedResponse,
+	ErrBlobAlreadyExists,
+	ErrPathnameChanged,
+	ErrCopyVerificationFailed,
+}
+
+func Test_Error_IsAndAs(t *testing.T) {
+	sentinels := testSentinels
+	for _, sentinel := range sentinels {
+		t.Run(sentinel.Code, func(t *testing.T) {
+			// A copy with another message, as returned by the API, still
+			// matches the sentinel.
+			errs := []error{
+				sentinel,
+				fmt.Errorf("op: %w", sentinel),
+				fmt.Errorf("outer: %w", fmt.Errorf("inner: %w", sentinel)),
+				fmt.Errorf("op: %w", &Error{Msg: "other message", Code: sentinel.Code}),
+			}
+			for _, err := range errs {
+				if !errors.Is(err, sentinel) {
+					t.Errorf("Expected %v to match %s", err, sentinel.Code)
+				}
+				var blobErr *Error
+				if !errors.As(err, &blobErr) || blobErr.Code != sentinel.Code {
+					t.Errorf("Expected errors.As to extract %s from %v", sentinel.Code, err)
+				}
+				for _, other := range sentinels {
+					if other != sentinel && errors.Is(err, other) {
+						t.Errorf("Expected %v not to match %s", err, other.Code)
+					}
+				}
+				if got := errors.Is(err, fs.ErrNotExist); got != (sentinel == ErrBlobNotFound) {
+					t.Errorf("Expected errors.Is(%v, fs.ErrNotExist) to be %v", err, !got)
+				}
+			}
+		})
+	}
+
+	constructed := []*Error{
+		BadRequestError("invalid pathname"),
+		UnknownError(http.StatusTeapot, "teapot"),
+		InvalidInputError("pathname"),
+		NewInvalidOptionError("WithTimeout", "negative"),
+		NewMissingFieldError("url"),
+	}
+	for _, blobErr := range constructed {
+		t.Run(blobErr.Code, func(t *testing.T) {
+			err := fmt.Errorf("op: %w", blobErr)
+			if !errors.Is(err, &Error{Code: blobErr.Code}) || !errors.Is(err, Error{Code: blobErr.Code}) {
+				t.Errorf("Expected %v to match the code %s in both forms", err, blobErr.Code)
+			}
+			if errors.Is(err, &Error{}) || errors.Is(err, (*Error)(nil)) {
+				t.Errorf("Expected %v not to match an error without a code", err)
+			}
+			var target *Error
+			if !errors.As(err, &target) || target != blobErr {
+				t.Errorf("Expected errors.As to extract %v, got %v", blobErr, target)
+			}
+		})
+	}
+
+	if !errors.Is(BadRequestError("a"), BadRequestError("b")) {
+		t.Error("Expected bad requests to match regardless of their message")
+	}
+
+	// The value constructors keep their signatures and match the pointers
+	// returned by the package.
+	values := []Error{ErrBadRequest("a"), NewUnknownError(http.StatusTeapot, "teapot"), NewInvalidInputError("pathname")}
+	for i, want := range []*Error{BadRequestError("a"), UnknownError(http.StatusTeapot, "teapot"), InvalidInputError("pathname")} {
+		if values[i] != *want || !errors.Is(want, values[i]) || CodeOf(values[i]) != want.Code {
+			t.Errorf("Expected %v to equal %v", values[i], want)
+		}
+	}
+}
+
+func Test_handleError_Unwrap_Mock(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":`))
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")))
+	_, err := client.Head(t.Context(), "a.txt")
+	var blobErr *Error
+	if !errors.As(err, &blobErr) || blobErr.Code != "unknown_error" {
+		t.Fatalf("Expected an unknown_error, got %v", err)
+	}
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Errorf("Expected the decoding failure to be unwrapped, got %v", err)
+	}
+}
+
+func Test_UnexpectedResponseError_Mock(t *testing.T) {
+	var status int
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	defer server.Close()
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider(testReadWriteToken)))
+	ctx := t.Context()
+
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		call   func() error
+	}{
+		{"error page", http.StatusBadRequest, "<html>Bad gateway " + testReadWriteToken + "</html>", func() error {
+			_, err := client.Head(ctx, "a.txt")
+			return err
+		}},
+		{"put", http.StatusOK, "<html>maintenance</html>", func() error {
+			_, err := client.Put(ctx, "a.txt", strings.NewReader("a"), PutCommandOptions{})
+			return err
+		}},
+		{"list", http.StatusOK, "", func() error {
+			_, err := client.List(ctx, ListCommandOptions{})
+			return err
+		}},
+		{"head", http.StatusOK, strings.Repeat("x", 2*maxBodySnippet), func() error {
+			_, err := client.Head(ctx, "a.txt")
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body = tt.status, tt.body
+			err := tt.call()
+			var respErr *UnexpectedResponseError
+			if !errors.As(err, &respErr) {
+				t.Fatalf("Expected an *UnexpectedResponseError, got %v", err)
+			}
+			if respErr.StatusCode != tt.status || respErr.ContentType != "text/html" {
+				t.Errorf("Unexpected error fields: %+v", respErr)
+			}
+			if strings.Contains(err.Error(), testReadWriteToken) {
+				t.Errorf("Expected the token to be redacted, got %v", err)
+			}
+			want := tt.body
+			if len(want) > maxBodySnippet {
+				want = want[:maxBodySnippet] + "..."
+			}
+			if tt.status == http.StatusOK && respErr.Body != want {
+				t.Errorf("Expected the body %q, got %q", want, respErr.Body)
+			}
+			var syntaxErr *json.SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Errorf("Expected the decoding error to be unwrapped, got %v", err)
+			}
+		})
+	}
+}
+
+func Test_APIError_Mock(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Vercel-Id", "iad1::abc")
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(BlobAPIError{Error: BlobAPIErrorDetail{Code: "not_found"}})
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")))
+	_, err := client.Head(t.Context(), "dir/a.txt")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Expected an *APIError, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusNotFound || apiErr.RequestID != "iad1::abc" || apiErr.Operation != OperationHead || apiErr.Pathname != "dir/a.txt" {
+		t.Errorf("Unexpected error fields: %+v", apiErr)
+	}
+	if !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("Expected the error to match ErrBlobNotFound, got %v", err)
+	}
+	want := `The requested blob does not exist (head "dir/a.txt": status 404, request ID iad1::abc)`
+	if err.Error() != want {
+		t.Errorf("Expected %q, got %q", want, err.Error())
+	}
+}
+
+func Test_ErrorPredicates(t *testing.T) {
+	apiErr := func(status int, err *Error) error {
+		return fmt.Errorf("op: %w", &APIError{StatusCode: status, Err: err})
+	}
+	tests := []struct {
+		name string
+		err  error
+		code string
+		// predicates holds the results of IsNotFound, IsForbidden,
+		// IsNotAuthenticated, IsRateLimited and IsRetryable.
+		predicates [5]bool
+	}{
+		{"nil", nil, "", [5]bool{}},
+		{"foreign", errors.New("boom"), "", [5]bool{}},
+		{"not found", apiErr(http.StatusNotFound, ErrBlobNotFound), "not_found", [5]bool{true, false, false, false, false}},
+		{"not found value", fmt.Errorf("op: %w", Error{Code: "not_found"}), "not_found", [5]bool{true, false, false, false, false}},
+		{"forbidden", apiErr(http.StatusForbidden, ErrForbidden), "forbidden", [5]bool{false, true, false, false, false}},
+		{"policy denied", &PolicyDeniedError{Operation: OperationPut, Pathname: "a.txt"}, "forbidden", [5]bool{false, true, false, false, false}},
+		{"not authenticated", &StoreTokenError{Pathname: "a.txt"}, "not_authenticated", [5]bool{false, false, true, false, false}},
+		{"rate limited", apiErr(http.StatusTooManyRequests, ErrRateLimited), "rate_limited", [5]bool{false, false, false, true, true}},
+		{"server error", apiErr(http.StatusBadGateway, UnknownError(http.StatusBadGateway, "Bad Gateway")), "unknown_error", [5]bool{false, false, false, false, true}},
+		{"service unavailable", apiErr(http.StatusServiceUnavailable, ErrServiceUnavailable), "service_unavailable", [5]bool{false, false, false, false, true}},
+		{"store suspended", apiErr(http.StatusServiceUnavailable, ErrStoreSuspended), "store_suspended", [5]bool{}},
+		{"bad request", apiErr(http.StatusBadRequest, BadRequestError("invalid")), "bad_request", [5]bool{}},
+		{"invalid input", NewInvalidInputError("pathname"), "invalid_input", [5]bool{}},
+		{"transport", &url.Error{Op: "Get", URL: "https://blob.com", Err: errors.New("connection reset")}, "", [5]bool{false, false, false, false, true}},
+		{"canceled", &url.Error{Op: "Get", URL: "https://blob.com", Err: context.Canceled}, "", [5]bool{}},
+		{"deadline", fmt.Errorf("op: %w", context.DeadlineExceeded), "", [5]bool{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := CodeOf(tt.err); code != tt.code {
+				t.Errorf("Expected the code %q, got %q", tt.code, code)
+			}
+			got := [5]bool{IsNotFound(tt.err), IsForbidden(tt.err), IsNotAuthenticated(tt.err), IsRateLimited(tt.err), IsRetryable(tt.err)}
+			if got != tt.predicates {
+				t.Errorf("Expected the predicates %v, got %v", tt.predicates, got)
+			}
+		})
+	}
+}
+
+func Test_RateLimited_Mock(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")))
+	_, err := client.List(t.Context(), ListCommandOptions{})
+	if !IsRateLimited(err) || !IsRetryable(err) {
+		t.Errorf("Expected a retryable rate limit error, got %v", err)
+	}
+}
+
+func Test_ServerErrorBody_Mock(t *testing.T) {
+	var status int
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	defer server.Close()
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")))
+
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		want      error
+		retryable bool
+		snippet   bool
+	}{
+		{"store suspended", http.StatusServiceUnavailable, `{"error":{"code":"store_suspended","message":"suspended"}}`, ErrStoreSuspended, false, false},
+		{"service unavailable", http.StatusServiceUnavailable, `{"error":{"code":"service_unavailable"}}`, ErrServiceUnavailable, true, false},
+		{"unknown code", http.StatusInternalServerError, `{"error":{"code":"internal","message":"database timeout"}}`, &Error{Code: "unknown_error"}, true, false},
+		{"empty", http.StatusInternalServerError, "", &Error{Code: "unknown_error"}, true, false},
+		{"html", http.StatusBadGateway, "<html>Bad Gateway</html>", &Error{Code: "unknown_error"}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body = tt.status, tt.body
+			_, err := client.List(t.Context(), ListCommandOptions{})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Expected %v, got %v", tt.want, err)
+			}
+			if IsRetryable(err) != tt.retryable {
+				t.Errorf("Expected IsRetryable to be %v for %v", tt.retryable, err)
+			}
+			var respErr *UnexpectedResponseError
+			if errors.As(err, &respErr) != tt.snippet {
+				t.Errorf("Expected a body snippet to be %v in %v", tt.snippet, err)
+			}
+			if tt.name == "unknown code" && !strings.Contains(err.Error(), "database timeout") {
+				t.Errorf("Expected the message of the API, got %v", err)
+			}
+		})
+	}
+}
+
+func Test_TransportError_Mock(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/partial.txt" {
+			// Promise more than is sent, then drop the connection.
+			w.Header().Set("Content-Length", "100")
+			_, _ = w.Write([]byte("partial"))
+			w.(http.Flusher).Flush()
+		}
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_ = conn.Close()
+	}))
+	defer server.Close()
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")))
+	ctx := t.Context()
+
+	_, headErr := client.Head(ctx, "a.txt")
+	_, putErr := client.Put(ctx, "a.txt", strings.NewReader("a"), PutCommandOptions{})
+	_, downloadErr := client.Download(ctx, server.URL+"/partial.txt", DownloadCommandOptions{})
+	for _, tt := range []struct {
+		err       error
+		operation Operation
+	}{
+		{headErr, OperationHead},
+		{putErr, OperationPut},
+		{downloadErr, OperationDownload},
+	} {
+		var transportErr *TransportError
+		if !errors.As(tt.err, &transportErr) || transportErr.Operation != tt.operation {
+			t.Errorf("Expected a *TransportError of %s, got %v", tt.operation, tt.err)
+		}
+		if !IsRetryable(tt.err) {
+			t.Errorf("Expected a dropped connection to be retryable, got %v", tt.err)
+		}
+		var apiErr *APIError
+		if errors.As(tt.err, &apiErr) {
+			t.Errorf("Expected no *APIError, got %v", tt.err)
+		}
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err := client.Put(canceled, "a.txt", strings.NewReader("a"), PutCommandOptions{})
+	var transportErr *TransportError
+	if !errors.Is(err, context.Canceled) || errors.As(err, &transportErr) || IsRetryable(err) {
+		t.Errorf("Expected a non-retryable context.Canceled, got %v", err)
+	}
+}
+
+func Test_BlobAlreadyExists_Mock(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(body))
+	}))
+	defer server.Close()
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")))
+	ctx := t.Context()
+
+	tests := []struct {
+		name string
+		body string
+		want error
+	}{
+		{"code", `{"error":{"code":"blob_already_exists","message":"This blob already exists"}}`, ErrBlobAlreadyExists},
+		{"legacy message", `{"error":{"code":"bad_request","message":"This blob already exists, use allowOverwrite: true to overwrite it."}}`, ErrBlobAlreadyExists},
+		{"other bad request", `{"error":{"code":"bad_request","message":"Invalid pathname"}}`, &Error{Code: "bad_request"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body = tt.body
+			_, putErr := client.Put(ctx, "a.txt", strings.NewReader("a"), PutCommandOptions{})
+			_, copyErr := client.CopyWithOptions(ctx, server.URL+"/b.txt", "a.txt", CopyCommandOptions{})
+			for _, err := range []error{putErr, copyErr} {
+				if !errors.Is(err, tt.want) {
+					t.Errorf("Expected %v, got %v", tt.want, err)
+				}
+				if got := errors.Is(err, ErrBlobAlreadyExists); got != (tt.want == ErrBlobAlreadyExists) {
+					t.Errorf("Unexpected match of ErrBlobAlreadyExists for %v", err)
+				}
+			}
+		})
+	}
+}
+
+func Test_MalformedSuccessResponse_Mock(t *testing.T) {
+	var body, completeBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		switch r.Header.Get("X-MPU-Action") {
+		case "create":
+			_, _ = w.Write([]byte(`{"uploadId":"id","key":"key"}`))
+		case "upload":
+			w.Header().Set("ETag", `"etag"`)
+		case "complete":
+			_, _ = w.Write([]byte(completeBody))
+		default:
+			_, _ = w.Write([]byte(body))
+		}
+	}))
+	defer server.Close()
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")))
+	ctx := t.Context()
+
+	operations := map[string]func() error{
+		"put": func() error {
+			_, err := client.Put(ctx, "a.txt", strings.NewReader("a"), PutCommandOptions{})
+			return err
+		},
+		"multipart": func() error {
+			completeBody = body
+			defer func() { completeBody = "" }()
+			_, err := client.Put(ctx, "a.bin", bytes.NewReader(make([]byte, MultipartThreshold+1)), PutCommandOptions{})
+			return err
+		},
+		"copy": func() error {
+			_, err := client.CopyWithOptions(ctx, server.URL+"/a.txt", "b.txt", CopyCommandOptions{})
+			return err
+		},
+		"head": func() error {
+			_, err := client.Head(ctx, "a.txt")
+			return err
+		},
+		"list": func() error {
+			_, err := client.List(ctx, ListCommandOptions{})
+			return err
+		},
+	}
+	bodies := map[string]string{
+		"empty":     "",
+		"truncated": `{"url":"https://blob.com/a.txt","pathn`,
+		"no fields": `{"blobs":[{"size":1}]}`,
+	}
+	for name, call := range operations {
+		for bodyName, b := range bodies {
+			t.Run(name+" "+bodyName, func(t *testing.T) {
+				body = b
+				err := call()
+				var respErr *UnexpectedResponseError
+				if !errors.Is(err, ErrMalformedResponse) || !errors.As(err, &respErr) || respErr.Body != b {
+					t.Errorf("Expected ErrMalformedResponse with the body %q, got %v", b, err)
+				}
+			})
+		}
+	}
+
+	body = `{"error":"missing"}`
+	completeBody = body
+	if _, err := client.Put(ctx, "a.bin", bytes.NewReader(make([]byte, MultipartThreshold+1)), PutCommandOptions{}); CodeOf(err) != "missing_field" {
+		t.Errorf("Expected a missing_field error from the multipart upload, got %v", err)
+	}
+}
+
+func Test_APIError_WithoutErr(t *testing.T) {
+	// An APIError built or decoded without Err is still usable.
+	err := &APIError{StatusCode: http.StatusServiceUnavailable}
+	if got := err.Error(); got != "Service Unavailable (status 503)" {
+		t.Errorf("Unexpected message %q", got)
+	}
+	if !IsRetryable(err) || CodeOf(err) != "" || errors.Is(err, ErrServiceUnavailable) {
+		t.Errorf("Expected a retryable error without a code, got %v", err)
+	}
+}
+
+func Test_RetryClass(t *testing.T) {
+	// Every sentinel is final on its own, except these.
+	classes := map[*Error]Classification{
+		ErrRateLimited:        Throttled,
+		ErrClientTokenExpired: AuthExpired,
+		ErrServiceUnavailable: Retryable,
+	}
+	for _, sentinel := range testSentinels {
+		for _, err := range []error{
+			sentinel,
+			fmt.Errorf("op: %w", sentinel),
+			&APIError{StatusCode: http.StatusBadRequest, Err: sentinel},
+		} {
+			if got := RetryClass(err); got != classes[sentinel] {
+				t.Errorf("Expected %v to be %v, got %v", err, classes[sentinel], got)
+			}
+		}
+	}
+
+	transport := &url.Error{Op: "Put", URL: "https://blob.com", Err: errors.New("connection reset by peer")}
+	_, unsupportedScheme := http.Get("ftp://blob.com/a.txt")
+	_, noHost := http.Get("http:///a.txt")
+	_, malformed := url.Parse("https://blob.com/a\x7f.txt")
+	tlsServer := httptest.NewTLSServer(http.NotFoundHandler())
+	defer tlsServer.Close()
+	_, untrusted := http.Get(tlsServer.URL)
+	for _, err := range []error{unsupportedScheme, noHost, malformed, untrusted} {
+		var urlErr *url.Error
+		if !errors.As(err, &urlErr) {
+			t.Fatalf("Expected a *url.Error, got %v", err)
+		}
+	}
+	expired := &url.Error{Op: "Get", URL: "https://blob.com", Err: &tls.CertificateVerificationError{Err: x509.CertificateInvalidError{Reason: x509.Expired}}}
+	wrongHost := &url.Error{Op: "Get", URL: "https://blob.com", Err: x509.HostnameError{Certificate: &x509.Certificate{}, Host: "blob.com"}}
+	notTLS := &url.Error{Op: "Get", URL: "https://blob.com", Err: tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}}
+	tests := []struct {
+		name string
+		err  error
+		want Classification
+	}{
+		{"nil", nil, NonRetryable},
+		{"foreign", errors.New("boom"), NonRetryable},
+		{"canceled", context.Canceled, NonRetryable},
+		{"deadline", fmt.Errorf("op: %w", context.DeadlineExceeded), NonRetryable},
+		{"canceled in transit", &url.Error{Op: "Get", URL: "https://blob.com", Err: context.Canceled}, NonRetryable},
+		{"url error", transport, Retryable},
+		{"transport error", fmt.Errorf("op: %w", &TransportError{Operation: OperationPut, Err: transport}), Retryable},
+		{"unsupported scheme", unsupportedScheme, NonRetryable},
+		{"no host", noHost, NonRetryable},
+		{"malformed url", malformed, NonRetryable},
+		{"untrusted certificate", untrusted, NonRetryable},
+		{"expired certificate", &TransportError{Operation: OperationDownload, Err: expired}, NonRetryable},
+		{"wrong host certificate", wrongHost, NonRetryable},
+		{"not tls", notTLS, NonRetryable},
+		{"server error", &APIError{StatusCode: http.StatusBadGateway, Err: UnknownError(http.StatusBadGateway, "Bad Gateway")}, Retryable},
+		{"client error", &APIError{StatusCode: http.StatusConflict, Err: UnknownError(http.StatusConflict, "Conflict")}, NonRetryable},
+		{"suspended", &APIError{StatusCode: http.StatusServiceUnavailable, Err: ErrStoreSuspended}, NonRetryable},
+		{"unavailable", &APIError{StatusCode: http.StatusServiceUnavailable, Err: ErrServiceUnavailable}, Retryable},
+		{"bare server error", &APIError{StatusCode: http.StatusServiceUnavailable}, Retryable},
+		{"bare client error", &APIError{StatusCode: http.StatusConflict}, NonRetryable},
+		{"rate limited", &APIError{StatusCode: http.StatusTooManyRequests, Err: ErrRateLimited}, Throttled},
+		{"unauthorized", &APIError{StatusCode: http.StatusUnauthorized, Err: ErrForbidden}, AuthExpired},
+		{"forbidden", &APIError{StatusCode: http.StatusForbidden, Err: ErrForbidden}, NonRetryable},
+		{"bad request", &APIError{StatusCode: http.StatusBadRequest, Err: BadRequestError("invalid")}, NonRetryable},
+		{"malformed 200", &UnexpectedResponseError{StatusCode: http.StatusOK, Err: errors.New("unexpected end of JSON input")}, NonRetryable},
+		{"invalid input", NewInvalidInputError("pathname"), NonRetryable},
+		{"validation", PutCommandOptions{Access: "secret"}.Validate(), NonRetryable},
+		{"token endpoint", &TokenEndpointError{URL: "https://example.com", Err: transport}, Retryable},
+		{"store token", &StoreTokenError{Pathname: "a.txt"}, NonRetryable},
+		{"policy denied", &PolicyDeniedError{Operation: OperationPut}, NonRetryable},
+		{"batch", newBatchError(map[string]error{"a": ErrForbidden}, 1), NonRetryable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RetryClass(tt.err)
+			if got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+			if IsRetryable(tt.err) != (got == Retryable || got == Throttled) {
+				t.Errorf("Expected IsRetryable to agree with %v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package vercelblob
+
+import (
+	"time"
+)
+
+// Event is a step in the lifecycle of an upload or download, reported to the
+// listener of WithEventListener. It is one of UploadStarted,
+// MultipartCreated, PartUploaded, UploadCompleted, UploadAborted,
+// DownloadStarted, DownloadCompleted and DownloadFailed; use a type switch
+// to tell them apart.
+type Event interface {
+	// Info returns the fields common to every event.
+	Info() EventInfo
+	isEvent()
+}
+
+// EventInfo holds the fields common to every Event.
+type EventInfo struct {
+	// Operation is OperationPut or OperationDownload.
+	Operation Operation
+	// Pathname is the pathname of the put, or the URL of the download.
+	Pathname string
+	// UploadID is the ID of the multipart upload, once it is created.
+	UploadID string
+	// Time is when the event happened.
+	Time time.Time
+}
+
+func (e EventInfo) Info() EventInfo { return e }
+func (EventInfo) isEvent()          {}
+
+// UploadStarted is emitted when a put starts.
+type UploadStarted struct {
+	EventInfo
+	// Size is the size of the body, or -1 if it is unknown.
+	Size int64
+	// Multipart is set if the body is uploaded in parts.
+	Multipart bool
+}
+
+// MultipartCreated is emitted when the multipart upload of a put is created.
+type MultipartCreated struct {
+	EventInfo
+}
+
+// PartUploaded is emitted when a part of a multipart upload is uploaded.
+type PartUploaded struct {
+	EventInfo
+	PartNumber int
+	Size       int64
+}
+
+// UploadCompleted is emitted when a put succeeds.
+type UploadCompleted struct {
+	EventInfo
+	URL string
+}
+
+// UploadAborted is emitted when a put fails.
+type UploadAborted struct {
+	EventInfo
+	Err error
+}
+
+// DownloadStarted is emitted when a download starts.
+type DownloadStarted struct {
+	EventInfo
+	// Range is the range of bytes requested, or nil for the whole blob.
+	Range *Range
+}
+
+// DownloadCompleted is emitted when a download succeeds.
+type DownloadCompleted struct {
+	EventInfo
+	// Size is the number of bytes downloaded.
+	Size int64
+}
+
+// DownloadFailed is emitted when a download fails.
+type DownloadFailed struct {
+	EventInfo
+	Err error
+}
+
+// WithEventListener makes the client call listener at each step of its puts
+// and downloads, e.g. to show the status of an upload or write an audit log.
+// The events of an operation are delivered in order, on the goroutine of
+// the operation, and never after it returned, so listener must be quick. A
+// nil listener, the default, disables events.
+func WithEventListener(listener func(Event)) ClientOption {
+	return func(c *Client) error {
+		c.eventListener = listener
+		return nil
+	}
+}
+
+// eventInfo returns the info of an event of operation happening now.
+func (c *Client) eventInfo(operation Operation, pathname, uploadID string) EventInfo {
+	return EventInfo{Operation: operation, Pathname: pathname, UploadID: uploadID, Time: c.now()}
+}
@@ -0,0 +1,105 @@
+package vercelblob
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_WithEventListener_Mock(t *testing.T) {
+	failComplete := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/missing.txt":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodGet:
+			_, _ = w.Write([]byte("hello"))
+		case r.Header.Get("X-MPU-Action") == "complete" && failComplete:
+			failComplete = false
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":{"code":"bad_request","message":"bad parts"}}`))
+		default:
+			w.Header().Set("ETag", `"etag"`)
+			_, _ = w.Write([]byte(`{"url":"https://blob.com/a.txt","pathname":"a.txt","uploadId":"upload-1","key":"key"}`))
+		}
+	}))
+	defer server.Close()
+	var events []string
+	client := newTestClient(t,
+		WithBaseURL(server.URL),
+		WithTokenProvider(StaticTokenProvider("token")),
+		WithEventListener(func(e Event) {
+			info := e.Info()
+			if info.Time.IsZero() {
+				t.Errorf("Expected %T to carry a time", e)
+			}
+			switch e := e.(type) {
+			case UploadStarted:
+				events = append(events, fmt.Sprintf("started %s %d %t", info.Pathname, e.Size, e.Multipart))
+			case MultipartCreated:
+				events = append(events, "created "+info.UploadID)
+			case PartUploaded:
+				events = append(events, fmt.Sprintf("part %d %d %s", e.PartNumber, e.Size, info.UploadID))
+			case UploadCompleted:
+				events = append(events, fmt.Sprintf("completed %s %q", e.URL, info.UploadID))
+			case UploadAborted:
+				events = append(events, fmt.Sprintf("aborted %s %s", CodeOf(e.Err), info.UploadID))
+			case DownloadStarted:
+				events = append(events, "download started "+info.Pathname)
+			case DownloadCompleted:
+				events = append(events, fmt.Sprintf("download completed %d", e.Size))
+			case DownloadFailed:
+				events = append(events, "download failed "+CodeOf(e.Err))
+			default:
+				t.Errorf("Unexpected event %T", e)
+			}
+		}),
+	)
+	ctx := context.Background()
+	expect := func(want ...string) {
+		t.Helper()
+		if strings.Join(events, "\n") != strings.Join(want, "\n") {
+			t.Errorf("Expected events\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(events, "\n"))
+		}
+		events = nil
+	}
+
+	if _, err := client.Put(ctx, "a.txt", strings.NewReader("a"), PutCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expect("started a.txt 1 false", `completed https://blob.com/a.txt ""`)
+
+	size := MultipartThreshold + 1
+	body := strings.Repeat("a", size)
+	if _, err := client.Put(ctx, "a.bin", strings.NewReader(body), PutCommandOptions{}); err == nil {
+		t.Fatal("Expected the completion to fail")
+	}
+	expect(
+		fmt.Sprintf("started a.bin %d true", size),
+		"created upload-1",
+		fmt.Sprintf("part 1 %d upload-1", MultipartThreshold),
+		"part 2 1 upload-1",
+		"aborted bad_request upload-1",
+	)
+	if _, err := client.Put(ctx, "a.bin", strings.NewReader(body), PutCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 5 || events[4] != `completed https://blob.com/a.txt "upload-1"` {
+		t.Errorf("Expected the multipart upload to complete, got %q", events)
+	}
+	events = nil
+
+	if _, err := client.Download(ctx, server.URL+"/a.txt", DownloadCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expect("download started "+server.URL+"/a.txt", "download completed 5")
+	if _, err := client.Download(ctx, server.URL+"/missing.txt", DownloadCommandOptions{}); err == nil {
+		t.Fatal("Expected the download to fail")
+	}
+	expect("download started "+server.URL+"/missing.txt", "download failed not_found")
+}
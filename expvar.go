@@ -0,0 +1,44 @@
+package vercelblob
+
+import (
+	"expvar"
+	"strconv"
+	"sync"
+)
+
+// expvarMu serializes PublishExpvar, so that concurrent calls choose distinct
+// names.
+var expvarMu sync.Mutex
+
+// PublishExpvar publishes the counters of Stats as an expvar variable named
+// prefix, e.g. to watch them on /debug/vars. The variable is a JSON object
+// with the fields requests, bytes_uploaded, bytes_downloaded, retries,
+// open_multipart_uploads and errors, by class, read live on every scrape.
+//
+// If prefix is taken, e.g. by another client, a suffix is added: prefix_2,
+// prefix_3 and so on. PublishExpvar returns the name used. Since expvar
+// variables cannot be removed, call it once per client.
+func (c *Client) PublishExpvar(prefix string) string {
+	expvarMu.Lock()
+	defer expvarMu.Unlock()
+	name := prefix
+	for n := 2; expvar.Get(name) != nil; n++ {
+		name = prefix + "_" + strconv.Itoa(n)
+	}
+	expvar.Publish(name, expvar.Func(func() any {
+		stats := c.Stats()
+		errors := make(map[string]int64, len(stats.Errors))
+		for class, n := range stats.Errors {
+			errors[class.String()] = n
+		}
+		return map[string]any{
+			"requests":               stats.Requests,
+			"bytes_uploaded":         stats.BytesUploaded,
+			"bytes_downloaded":       stats.BytesDownloaded,
+			"retries":                stats.Retries,
+			"open_multipart_uploads": stats.OpenMultipartUploads,
+			"errors":                 errors,
+		}
+	}))
+	return name
+}
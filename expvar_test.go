@@ -0,0 +1,59 @@
+package vercelblob
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_PublishExpvar_Mock(t *testing.T) {
+	server, _ := newFlakyServer(t, 1, http.StatusServiceUnavailable, "")
+	client := newTestClient(t,
+		WithBaseURL(server.URL),
+		WithTokenProvider(StaticTokenProvider("token")),
+		WithRetry(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}),
+	)
+	other := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")))
+
+	name := client.PublishExpvar("test_blob")
+	otherName := other.PublishExpvar("test_blob")
+	if otherName == name || !strings.HasPrefix(otherName, "test_blob_") {
+		t.Errorf("Expected a suffix for a taken prefix, got %s and %s", name, otherName)
+	}
+
+	ctx := context.Background()
+	if _, err := client.Put(ctx, "a.txt", strings.NewReader("abc"), PutCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Head(ctx, "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	vars := map[string]string{}
+	expvar.Do(func(kv expvar.KeyValue) {
+		if strings.HasPrefix(kv.Key, "test_blob") {
+			vars[kv.Key] = kv.Value.String()
+		}
+	})
+	var got struct {
+		Requests             int64            `json:"requests"`
+		BytesUploaded        int64            `json:"bytes_uploaded"`
+		BytesDownloaded      int64            `json:"bytes_downloaded"`
+		Retries              int64            `json:"retries"`
+		OpenMultipartUploads int64            `json:"open_multipart_uploads"`
+		Errors               map[string]int64 `json:"errors"`
+	}
+	if err := json.Unmarshal([]byte(vars[name]), &got); err != nil {
+		t.Fatalf("Expected JSON, got %q: %v", vars[name], err)
+	}
+	if got.Requests != 3 || got.Retries != 1 || got.BytesUploaded != 6 || got.BytesDownloaded == 0 || got.Errors["retryable"] != 1 || got.OpenMultipartUploads != 0 {
+		t.Errorf("Unexpected counters %+v", got)
+	}
+	if !strings.Contains(vars[otherName], `"requests":0`) {
+		t.Errorf("Expected the other client to have no requests, got %s", vars[otherName])
+	}
+}
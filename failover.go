@@ -0,0 +1,252 @@
+package vercelblob
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of FailoverPolicy.
+const (
+	defaultFailoverThreshold     = 3
+	defaultFailoverProbeInterval = 30 * time.Second
+)
+
+// FailoverPolicy configures when a client given fallback base URLs with
+// WithBaseURLs switches between them.
+type FailoverPolicy struct {
+	// Threshold is the number of consecutive failures in transit or 5xx
+	// responses of the active base URL after which the next one is used.
+	// Zero means 3.
+	Threshold int
+	// ProbeInterval is how long the client waits after leaving the primary
+	// base URL before it sends a request to it again to check whether it
+	// has recovered. Zero means 30 seconds.
+	ProbeInterval time.Duration
+	// OnFailover, if set, is called whenever the active base URL changes.
+	OnFailover func(FailoverEvent)
+}
+
+// FailoverEvent describes a change of the active base URL of a client.
+type FailoverEvent struct {
+	From, To string
+	// Err is the last failure of From, or nil if the client returns to the
+	// primary base URL after a successful probe.
+	Err error
+}
+
+// WithBaseURLs sets the URL of the blob API like WithBaseURL, and fallback
+// URLs to send requests to while it is failing, e.g. an endpoint in another
+// region. After consecutive failures of the active URL, later requests,
+// including the retries of WithRetry, go to the next URL in order. While a
+// fallback is active, a request is sent to the primary URL every probe
+// interval, and the client returns to it once one succeeds. See
+// WithFailoverPolicy for the thresholds.
+//
+// Only requests to the API fail over; downloads from blob URLs do not. The
+// active URL is shared by the copies returned by ForStore and WithPrefix,
+// while Clone starts over from the primary URL. Changes are logged by
+// WithLogger and reported to FailoverPolicy.OnFailover.
+func WithBaseURLs(primary string, fallbacks ...string) ClientOption {
+	return func(c *Client) error {
+		endpoints := make([]*url.URL, 0, 1+len(fallbacks))
+		for _, baseURL := range append([]string{primary}, fallbacks...) {
+			u, err := parseBaseURL("WithBaseURLs", baseURL)
+			if err != nil {
+				return err
+			}
+			endpoints = append(endpoints, u)
+		}
+		c.baseURL = primary
+		c.failover = newFailover(endpoints)
+		return nil
+	}
+}
+
+// WithFailoverPolicy sets when the client switches between the base URLs
+// given to WithBaseURLs.
+func WithFailoverPolicy(policy FailoverPolicy) ClientOption {
+	return func(c *Client) error {
+		switch {
+		case policy.Threshold < 0:
+			return NewInvalidOptionError("WithFailoverPolicy", fmt.Sprintf("Threshold %d is negative", policy.Threshold))
+		case policy.ProbeInterval < 0:
+			return NewInvalidOptionError("WithFailoverPolicy", fmt.Sprintf("ProbeInterval %v is a negative duration", policy.ProbeInterval))
+		}
+		c.failoverPolicy = policy
+		return nil
+	}
+}
+
+// ActiveBaseURL returns the URL of the blob API requests are currently sent
+// to: the base URL of the client, or one of its fallbacks while it is
+// failing.
+func (c *Client) ActiveBaseURL() string {
+	if c.failover == nil {
+		return c.baseURL
+	}
+	c.failover.mu.Lock()
+	defer c.failover.mu.Unlock()
+	return c.failover.endpoints[c.failover.active].String()
+}
+
+// failover holds the state of WithBaseURLs.
+type failover struct {
+	// endpoints are the base URLs, the primary first.
+	endpoints []*url.URL
+
+	mu           sync.Mutex
+	active       int
+	failures     int
+	failedOverAt time.Time
+	probing      bool
+}
+
+func newFailover(endpoints []*url.URL) *failover {
+	return &failover{endpoints: endpoints}
+}
+
+// target returns the index of the base URL to send the next request to at
+// now, and whether the request probes the primary URL.
+func (f *failover) target(now time.Time, policy FailoverPolicy) (index int, probe bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	interval := policy.ProbeInterval
+	if interval == 0 {
+		interval = defaultFailoverProbeInterval
+	}
+	if f.active != 0 && !f.probing && now.Sub(f.failedOverAt) >= interval {
+		f.probing = true
+		return 0, true
+	}
+	return f.active, false
+}
+
+// record records the outcome at now of a request sent to the base URL at
+// index.
+// failure is the failure of the request, or nil on success; ignore is set
+// for requests that neither failed nor succeeded.
+func (f *failover) record(now time.Time, policy FailoverPolicy, index int, probe bool, failure error, ignore bool) *FailoverEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if probe {
+		f.probing = false
+		if ignore {
+			return nil
+		}
+		if failure != nil {
+			f.failedOverAt = now
+			return nil
+		}
+		return f.switchTo(now, 0, nil)
+	}
+	if ignore || index != f.active {
+		return nil
+	}
+	if failure == nil {
+		f.failures = 0
+		return nil
+	}
+	threshold := policy.Threshold
+	if threshold == 0 {
+		threshold = defaultFailoverThreshold
+	}
+	if f.failures++; f.failures < threshold || len(f.endpoints) == 1 {
+		return nil
+	}
+	return f.switchTo(now, (f.active+1)%len(f.endpoints), failure)
+}
+
+// switchTo makes the base URL at index active at now. f.mu must be held.
+func (f *failover) switchTo(now time.Time, index int, err error) *FailoverEvent {
+	event := &FailoverEvent{From: f.endpoints[f.active].String(), To: f.endpoints[index].String(), Err: err}
+	f.active = index
+	f.failures = 0
+	f.failedOverAt = now
+	return event
+}
+
+// rebase returns u moved from below the primary base URL to below the base
+// URL at index, and whether u is below the primary base URL.
+func (f *failover) rebase(u *url.URL, index int) (*url.URL, bool) {
+	primary := f.endpoints[0]
+	prefix := strings.TrimSuffix(primary.EscapedPath(), "/")
+	rest, ok := strings.CutPrefix(u.EscapedPath(), prefix)
+	if u.Scheme != primary.Scheme || u.Host != primary.Host || !ok || rest != "" && !strings.HasPrefix(rest, "/") {
+		return u, false
+	}
+	if index == 0 {
+		return u, true
+	}
+	target := f.endpoints[index]
+	rebased := *u
+	rebased.Scheme = target.Scheme
+	rebased.Host = target.Host
+	rebased.RawPath = strings.TrimSuffix(target.EscapedPath(), "/") + rest
+	rebased.Path, _ = url.PathUnescape(rebased.RawPath)
+	return &rebased, true
+}
+
+// sendFailover sends req with sendHedged to the active base URL of the
+// client, and records the outcome.
+func (c *Client) sendFailover(req *http.Request, operation Operation, pathname string) (*http.Response, error) {
+	f := c.failover
+	if f == nil {
+		return c.sendHedged(req, operation, pathname)
+	}
+	index, probe := f.target(c.now(), c.failoverPolicy)
+	target, ok := f.rebase(req.URL, index)
+	if !ok {
+		if probe {
+			f.record(c.now(), c.failoverPolicy, index, probe, nil, true)
+		}
+		return c.sendHedged(req, operation, pathname)
+	}
+	if target != req.URL {
+		req = req.Clone(req.Context())
+		req.URL = target
+		req.Host = ""
+	}
+	resp, err := c.sendHedged(req, operation, pathname)
+	failure, ignore := c.failoverFailure(resp, err)
+	c.notifyFailover(req.Context(), f.record(c.now(), c.failoverPolicy, index, probe, failure, ignore))
+	return resp, err
+}
+
+// failoverFailure classifies the outcome of a request for failover: it
+// returns the failure, if the request failed, and whether the outcome must
+// be ignored.
+func (c *Client) failoverFailure(resp *http.Response, err error) (failure error, ignore bool) {
+	if err != nil {
+		if IsRetryable(err) {
+			return err, false
+		}
+		return nil, true
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return c.peekAPIError(resp), false
+	}
+	return nil, false
+}
+
+// notifyFailover reports event, if any, to the hook and the logger.
+func (c *Client) notifyFailover(ctx context.Context, event *FailoverEvent) {
+	if event == nil {
+		return
+	}
+	if c.failoverPolicy.OnFailover != nil {
+		c.failoverPolicy.OnFailover(*event)
+	}
+	if c.logEnabled(ctx) {
+		attrs := []slog.Attr{slog.String("from", event.From), slog.String("to", event.To)}
+		if event.Err != nil {
+			attrs = append(attrs, slog.String("error", event.Err.Error()))
+		}
+		c.logger.LogAttrs(ctx, c.logLevel, "blob failover", attrs...)
+	}
+}
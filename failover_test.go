@@ -0,0 +1,131 @@
+package vercelblob
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_WithBaseURLs_Mock(t *testing.T) {
+	clock := newFakeClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	var primaryDown atomic.Bool
+	primaryDown.Store(true)
+	var primaryPaths, fallbackPaths []string
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryPaths = append(primaryPaths, r.URL.Path)
+		if primaryDown.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.txt","pathname":"a.txt"}`))
+	}))
+	defer primary.Close()
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fallbackPaths = append(fallbackPaths, r.URL.Path)
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.txt","pathname":"a.txt"}`))
+	}))
+	defer fallback.Close()
+
+	var events []FailoverEvent
+	var logs bytes.Buffer
+	client := newTestClient(t,
+		WithBaseURLs(primary.URL+"/v1", fallback.URL+"/alt/"),
+		WithClock(clock.Now),
+		WithTokenProvider(StaticTokenProvider("token")),
+		WithFailoverPolicy(FailoverPolicy{
+			Threshold:     2,
+			ProbeInterval: time.Minute,
+			OnFailover:    func(e FailoverEvent) { events = append(events, e) },
+		}),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))),
+	)
+	ctx := context.Background()
+	head := func() error {
+		_, err := client.Head(ctx, "dir/a b.txt")
+		return err
+	}
+
+	// Two failures of the primary switch to the fallback.
+	_ = head()
+	_ = head()
+	if len(events) != 1 || events[0].From != primary.URL+"/v1" || events[0].To != fallback.URL+"/alt/" || !IsRetryable(events[0].Err) {
+		t.Fatalf("Expected a failover, got %+v", events)
+	}
+	if client.ActiveBaseURL() != fallback.URL+"/alt/" || client.BaseURL() != primary.URL+"/v1" {
+		t.Errorf("Unexpected base URLs %q and %q", client.ActiveBaseURL(), client.BaseURL())
+	}
+	if _, err := client.Put(ctx, "dir/a b.txt", strings.NewReader("a"), PutCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(fallbackPaths) != 1 || fallbackPaths[0] != "/alt/dir/a b.txt" {
+		t.Errorf("Expected the path below the fallback, got %v", fallbackPaths)
+	}
+
+	// A failed probe keeps the fallback until the next probe.
+	clock.Advance(time.Minute)
+	_ = head()
+	_ = head()
+	if len(primaryPaths) != 3 || len(fallbackPaths) != 2 || len(events) != 1 {
+		t.Errorf("Expected one failed probe, got %v, %v and %+v", primaryPaths, fallbackPaths, events)
+	}
+
+	// A successful probe returns to the primary.
+	clock.Advance(time.Minute)
+	primaryDown.Store(false)
+	if err := head(); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[1].To != primary.URL+"/v1" || events[1].Err != nil || client.ActiveBaseURL() != primary.URL+"/v1" {
+		t.Errorf("Expected a return to the primary, got %+v", events)
+	}
+	if n := strings.Count(logs.String(), `msg="blob failover"`); n != 2 {
+		t.Errorf("Expected 2 logged failovers, got %s", logs.String())
+	}
+
+	// Downloads from blob URLs do not fail over.
+	primaryDown.Store(true)
+	for range 3 {
+		_, _ = client.Download(ctx, primary.URL+"/a.txt", DownloadCommandOptions{})
+	}
+	if client.ActiveBaseURL() != primary.URL+"/v1" {
+		t.Errorf("Expected downloads not to fail over, got %q", client.ActiveBaseURL())
+	}
+}
+
+func Test_WithBaseURLs_Unreachable_Mock(t *testing.T) {
+	server, requests := newFlakyServer(t, 0, http.StatusOK, "")
+	unreachable := closedPortURL(t)
+	client := newTestClient(t,
+		WithBaseURLs(unreachable, server.URL),
+		WithTokenProvider(StaticTokenProvider("token")),
+		WithFailoverPolicy(FailoverPolicy{Threshold: 1}),
+		WithRetry(RetryPolicy{MaxAttempts: 2}),
+	)
+
+	// The retry of a request that could not connect goes to the fallback.
+	if _, err := client.Head(context.Background(), "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if requests.Load() != 1 || client.ActiveBaseURL() != server.URL {
+		t.Errorf("Expected the retry to use the fallback, got %d requests to %q", requests.Load(), client.ActiveBaseURL())
+	}
+
+	clone, err := client.Clone()
+	if err != nil || clone.ActiveBaseURL() != unreachable {
+		t.Errorf("Expected the clone to start from the primary, got %q, %v", clone.ActiveBaseURL(), err)
+	}
+	for _, opt := range []ClientOption{
+		WithBaseURLs(server.URL, "ftp://example.com"),
+		WithFailoverPolicy(FailoverPolicy{Threshold: -1}),
+	} {
+		if _, err := NewClientWithOptions(opt); CodeOf(err) != "invalid_option" {
+			t.Errorf("Expected an invalid_option error, got %v", err)
+		}
+	}
+}
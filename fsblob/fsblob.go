@@ -0,0 +1,602 @@
+// Package fsblob implements vercelblob.BlobStore on a directory on disk, to
+// run an application locally without a blob store or token:
+//
+//	var store vercelblob.BlobStore = client
+//	if os.Getenv("BLOB_READ_WRITE_TOKEN") == "" {
+//		store, err = fsblob.New("./.blobs", fsblob.Options{BaseURL: "http://localhost:8080/blobs/"})
+//	}
+//
+// The content of a blob is the file at its pathname under the directory, so
+// the directory can be served with http.FileServer. Its metadata is kept in a
+// JSON file under the .fsblob subdirectory.
+//
+// A Store behaves like the API, including its error codes, with one
+// exception: since a pathname cannot be both a file and a directory, a blob
+// cannot be put at "a" if a blob exists under "a/", and vice versa.
+package fsblob
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"math/rand/v2"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	vercelblob "github.com/claywarren/vercel_blob"
+)
+
+// DefaultCacheControlMaxAge is the max-age in seconds of blobs put without
+// one, one month like the API.
+const DefaultCacheControlMaxAge = 30 * 24 * 60 * 60
+
+// metaDir is the subdirectory holding the metadata of the blobs.
+const metaDir = ".fsblob"
+
+// defaultListLimit is the number of blobs of a list page when the options
+// set no limit.
+const defaultListLimit = 1000
+
+// Options configure a Store.
+type Options struct {
+	// BaseURL is the URL under which the directory is served, e.g. by
+	// http.FileServer. The URL of a blob is its pathname appended to
+	// BaseURL. It defaults to the file URL of the directory.
+	BaseURL string
+}
+
+// Store is a vercelblob.BlobStore backed by a directory. It is safe for
+// concurrent use, but not for use by several processes on one directory.
+type Store struct {
+	dir  string
+	base *url.URL
+	mu   sync.Mutex
+}
+
+var (
+	_ vercelblob.BlobStore        = (*Store)(nil)
+	_ vercelblob.OptionsBlobStore = (*Store)(nil)
+)
+
+// metadata is the metadata of a blob, stored beside its content.
+type metadata struct {
+	ContentType        string    `json:"contentType"`
+	CacheControlMaxAge uint64    `json:"cacheControlMaxAge"`
+	UploadedAt         time.Time `json:"uploadedAt"`
+	ETag               string    `json:"etag"`
+	Size               uint64    `json:"size"`
+}
+
+// New returns a Store of the blobs in dir, which is created if missing.
+func New(dir string, options Options) (*Store, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(dir, metaDir), 0o755); err != nil {
+		return nil, err
+	}
+	baseURL := options.BaseURL
+	if baseURL == "" {
+		baseURL = (&url.URL{Scheme: "file", Path: filepath.ToSlash(dir)}).String()
+	}
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, vercelblob.NewInvalidOptionError("BaseURL", err.Error())
+	}
+	base.Path = strings.TrimSuffix(base.Path, "/") + "/"
+	base.RawPath = ""
+	return &Store{dir: dir, base: base}, nil
+}
+
+// Dir returns the absolute path of the directory of the store.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// BlobURL returns the URL of the blob at pathname.
+func (s *Store) BlobURL(pathname string) string {
+	return s.base.JoinPath(pathname).String()
+}
+
+// List lists the blobs in the store.
+func (s *Store) List(ctx context.Context, options vercelblob.ListCommandOptions) (*vercelblob.ListBlobResult, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	limit := defaultListLimit
+	if options.Limit > 0 {
+		limit = int(options.Limit)
+	}
+	after := ""
+	if options.Cursor != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(options.Cursor)
+		if err != nil {
+			return nil, vercelblob.BadRequestError("invalid cursor")
+		}
+		after = string(decoded)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pathnames, err := s.pathnames()
+	if err != nil {
+		return nil, err
+	}
+
+	// Entries are the pathnames of blobs and, in folded mode, the folders
+	// directly under the prefix, paginated together.
+	entries := map[string]bool{}
+	for _, pathname := range pathnames {
+		rest, ok := strings.CutPrefix(pathname, options.Prefix)
+		if !ok {
+			continue
+		}
+		if i := strings.Index(rest, "/"); options.Mode == "folded" && i >= 0 {
+			entries[options.Prefix+rest[:i+1]] = true
+		} else {
+			entries[pathname] = false
+		}
+	}
+	keys := slices.Sorted(maps.Keys(entries))
+	start, _ := slices.BinarySearch(keys, after)
+	if start < len(keys) && keys[start] == after {
+		start++
+	}
+	page := keys[start:min(start+limit, len(keys))]
+
+	result := &vercelblob.ListBlobResult{Blobs: []vercelblob.ListBlobResultBlob{}}
+	for _, key := range page {
+		if entries[key] {
+			result.Folders = append(result.Folders, key)
+			continue
+		}
+		meta, err := s.readMetadata(key)
+		if err != nil {
+			return nil, err
+		}
+		result.Blobs = append(result.Blobs, vercelblob.ListBlobResultBlob{
+			URL:        s.BlobURL(key),
+			PathName:   key,
+			Size:       meta.Size,
+			UploadedAt: meta.UploadedAt,
+		})
+	}
+	if start+limit < len(keys) {
+		result.HasMore = true
+		result.Cursor = base64.RawURLEncoding.EncodeToString([]byte(page[len(page)-1]))
+	}
+	return result, nil
+}
+
+// Put stores a blob, reading its content from body.
+func (s *Store) Put(ctx context.Context, pathname string, body io.Reader, options vercelblob.PutCommandOptions) (*vercelblob.PutBlobPutResult, error) {
+	if len(pathname) == 0 {
+		return nil, vercelblob.InvalidInputError("pathname")
+	}
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	if err := checkPathname(pathname); err != nil {
+		return nil, err
+	}
+	temp, meta, err := s.writeTemp(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = os.Remove(temp) }()
+
+	if options.AddRandomSuffix {
+		pathname = addRandomSuffix(pathname)
+	}
+	meta.ContentType = cmp.Or(options.ContentType, contentTypeOf(pathname))
+	meta.CacheControlMaxAge = cmp.Or(options.CacheControlMaxAge, DefaultCacheControlMaxAge)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.store(temp, pathname, meta, options.AllowOverwrite); err != nil {
+		return nil, err
+	}
+	return s.putResult(pathname, meta), nil
+}
+
+// Head returns the metadata of the blob at a pathname or URL.
+func (s *Store) Head(ctx context.Context, pathnameOrURL string) (*vercelblob.HeadBlobResult, error) {
+	return s.HeadWithOptions(ctx, pathnameOrURL, vercelblob.HeadCommandOptions{})
+}
+
+// HeadWithOptions is like Head, with options.
+func (s *Store) HeadWithOptions(ctx context.Context, pathnameOrURL string, options vercelblob.HeadCommandOptions) (*vercelblob.HeadBlobResult, error) {
+	pathname, ok := s.pathnameOf(pathnameOrURL)
+	if !ok {
+		return nil, vercelblob.ErrBlobNotFound
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	meta, err := s.readMetadata(pathname)
+	if err != nil {
+		return nil, err
+	}
+	if options.IfNoneMatch != "" && options.IfNoneMatch == meta.ETag {
+		return &vercelblob.HeadBlobResult{ETag: meta.ETag, NotModified: true}, nil
+	}
+	blobURL := s.BlobURL(pathname)
+	return &vercelblob.HeadBlobResult{
+		URL:                blobURL,
+		Size:               meta.Size,
+		UploadedAt:         meta.UploadedAt,
+		Pathname:           pathname,
+		ContentType:        meta.ContentType,
+		ContentDisposition: contentDisposition(pathname),
+		CacheControl:       "public, max-age=" + strconv.FormatUint(meta.CacheControlMaxAge, 10),
+		DownloadURL:        blobURL + "?download=1",
+		ETag:               meta.ETag,
+		SizeKnown:          true,
+		UploadedAtKnown:    true,
+	}, nil
+}
+
+// Delete deletes the blobs at the given URLs or pathnames. Like the API,
+// deleting a blob that does not exist succeeds.
+func (s *Store) Delete(ctx context.Context, urls ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range urls {
+		pathname, ok := s.pathnameOf(u)
+		if !ok {
+			continue
+		}
+		if err := s.remove(pathname); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Copy copies the blob at fromURL to toPath.
+func (s *Store) Copy(ctx context.Context, fromURL, toPath string, options vercelblob.PutCommandOptions) (*vercelblob.PutBlobPutResult, error) {
+	copyOptions := vercelblob.CopyCommandOptions{
+		AddRandomSuffix: options.AddRandomSuffix,
+		Access:          options.Access,
+		AllowOverwrite:  options.AllowOverwrite,
+	}
+	if options.ContentType != "" {
+		copyOptions.ContentTypeOverride = &options.ContentType
+	}
+	if options.CacheControlMaxAge > 0 {
+		copyOptions.CacheControlOverride = &options.CacheControlMaxAge
+	}
+	result, err := s.CopyWithOptions(ctx, fromURL, toPath, copyOptions)
+	if err != nil {
+		return nil, err
+	}
+	return &result.PutBlobPutResult, nil
+}
+
+// CopyWithOptions copies the blob at fromURL to toPath. Like the API, the
+// copy keeps the content type and cache control of the source unless
+// overridden. Verify and the options for network failures have no effect.
+func (s *Store) CopyWithOptions(ctx context.Context, fromURL, toPath string, options vercelblob.CopyCommandOptions) (*vercelblob.CopyResult, error) {
+	if len(toPath) == 0 {
+		return nil, vercelblob.InvalidInputError("toPath")
+	}
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	if err := checkPathname(toPath); err != nil {
+		return nil, err
+	}
+	source, ok := s.pathnameOf(fromURL)
+	if !ok {
+		return nil, vercelblob.BadRequestError(fromURL + " is not a blob of this store")
+	}
+	if options.AddRandomSuffix {
+		toPath = addRandomSuffix(toPath)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	meta, err := s.readMetadata(source)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.Open(s.contentPath(source))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = content.Close() }()
+	temp, _, err := s.writeTemp(ctx, content)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = os.Remove(temp) }()
+
+	if options.ContentTypeOverride != nil {
+		meta.ContentType = *options.ContentTypeOverride
+	}
+	if options.CacheControlOverride != nil {
+		meta.CacheControlMaxAge = *options.CacheControlOverride
+	}
+	meta.UploadedAt = time.Now().UTC()
+	if err := s.store(temp, toPath, meta, options.AllowOverwrite); err != nil {
+		return nil, err
+	}
+	return &vercelblob.CopyResult{PutBlobPutResult: *s.putResult(toPath, meta), Method: vercelblob.CopyMethodServer}, nil
+}
+
+// Download returns the content of the blob at urlPath, a URL or pathname.
+func (s *Store) Download(ctx context.Context, urlPath string, options vercelblob.DownloadCommandOptions) ([]byte, error) {
+	result, err := s.DownloadWithResult(ctx, urlPath, options)
+	if err != nil {
+		return nil, err
+	}
+	return result.Content, nil
+}
+
+// DownloadWithResult downloads a blob like Download, and also reports its
+// content type.
+func (s *Store) DownloadWithResult(ctx context.Context, urlPath string, options vercelblob.DownloadCommandOptions) (*vercelblob.DownloadResult, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	pathname, ok := s.pathnameOf(urlPath)
+	if !ok {
+		return nil, vercelblob.ErrBlobNotFound
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	meta, err := s.readMetadata(pathname)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(s.contentPath(pathname))
+	if err != nil {
+		return nil, err
+	}
+	if r := options.ByteRange; r != nil {
+		if uint64(r.Start) >= meta.Size {
+			return nil, &vercelblob.Error{
+				Msg:  fmt.Sprintf("The range %d-%d is not satisfiable for a blob of %d bytes", r.Start, r.End, meta.Size),
+				Code: "range_not_satisfiable",
+			}
+		}
+		content = content[r.Start:min(uint64(r.End)+1, meta.Size)]
+	}
+	return &vercelblob.DownloadResult{Content: content, ContentType: meta.ContentType}, nil
+}
+
+// writeTemp copies body to a temporary file in the directory of the store,
+// and returns its path and the size and ETag of the content.
+func (s *Store) writeTemp(ctx context.Context, body io.Reader) (string, metadata, error) {
+	file, err := os.CreateTemp(filepath.Join(s.dir, metaDir), "upload-*")
+	if err != nil {
+		return "", metadata{}, err
+	}
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(file, hash), readerWithContext{ctx, body})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return "", metadata{}, err
+	}
+	return file.Name(), metadata{
+		UploadedAt: time.Now().UTC(),
+		ETag:       `"` + hex.EncodeToString(hash.Sum(nil)[:8]) + `"`,
+		Size:       uint64(n),
+	}, nil
+}
+
+// store moves the content at temp to pathname and writes its metadata. It
+// fails with ErrBlobAlreadyExists if a blob exists at pathname and overwrite
+// is not set. The caller holds s.mu.
+func (s *Store) store(temp, pathname string, meta metadata, overwrite bool) error {
+	info, err := os.Stat(s.contentPath(pathname))
+	switch {
+	case err == nil && info.IsDir():
+		return vercelblob.BadRequestError(pathname + " is a folder of other blobs")
+	case err == nil && !overwrite:
+		return vercelblob.ErrBlobAlreadyExists
+	case errors.Is(err, syscall.ENOTDIR):
+		return vercelblob.BadRequestError(pathname + " is under another blob")
+	case err != nil && !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	for _, dir := range []string{filepath.Dir(s.contentPath(pathname)), filepath.Dir(s.metadataPath(pathname))} {
+		if err := os.MkdirAll(dir, 0o755); errors.Is(err, syscall.ENOTDIR) {
+			return vercelblob.BadRequestError(pathname + " is under another blob")
+		} else if err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(s.metadataPath(pathname), data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(temp, s.contentPath(pathname))
+}
+
+// remove deletes the blob at pathname, if any, and the directories left
+// empty. The caller holds s.mu.
+func (s *Store) remove(pathname string) error {
+	if checkPathname(pathname) != nil {
+		return nil
+	}
+	for _, name := range []string{s.contentPath(pathname), s.metadataPath(pathname)} {
+		if info, err := os.Stat(name); err == nil && info.IsDir() {
+			return nil
+		}
+		if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		for dir := filepath.Dir(name); dir != s.dir && dir != filepath.Join(s.dir, metaDir); dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// readMetadata returns the metadata of the blob at pathname, or
+// ErrBlobNotFound. The metadata of a file added to the directory by other
+// means is derived from the file. The caller holds s.mu.
+func (s *Store) readMetadata(pathname string) (metadata, error) {
+	if checkPathname(pathname) != nil {
+		return metadata{}, vercelblob.ErrBlobNotFound
+	}
+	info, err := os.Stat(s.contentPath(pathname))
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) || err == nil && !info.Mode().IsRegular() {
+		return metadata{}, vercelblob.ErrBlobNotFound
+	} else if err != nil {
+		return metadata{}, err
+	}
+	var meta metadata
+	data, err := os.ReadFile(s.metadataPath(pathname))
+	if err == nil {
+		err = json.Unmarshal(data, &meta)
+	}
+	if err == nil && meta.Size == uint64(info.Size()) {
+		return meta, nil
+	}
+	content, err := os.ReadFile(s.contentPath(pathname))
+	if err != nil {
+		return metadata{}, err
+	}
+	sum := sha256.Sum256(content)
+	return metadata{
+		ContentType:        contentTypeOf(pathname),
+		CacheControlMaxAge: DefaultCacheControlMaxAge,
+		UploadedAt:         info.ModTime().UTC(),
+		ETag:               `"` + hex.EncodeToString(sum[:8]) + `"`,
+		Size:               uint64(len(content)),
+	}, nil
+}
+
+// pathnames returns the pathnames of every blob, sorted. The caller holds
+// s.mu.
+func (s *Store) pathnames() ([]string, error) {
+	var pathnames []string
+	err := filepath.WalkDir(s.dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && name == filepath.Join(s.dir, metaDir) {
+			return filepath.SkipDir
+		}
+		if d.Type().IsRegular() {
+			rel, err := filepath.Rel(s.dir, name)
+			if err != nil {
+				return err
+			}
+			pathnames = append(pathnames, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	slices.Sort(pathnames)
+	return pathnames, err
+}
+
+// pathnameOf returns the pathname addressed by a blob URL of the store or a
+// pathname, and whether it addresses a blob of the store.
+func (s *Store) pathnameOf(urlOrPathname string) (string, bool) {
+	u, err := url.Parse(urlOrPathname)
+	if err != nil {
+		return "", false
+	}
+	if !u.IsAbs() {
+		return strings.TrimPrefix(urlOrPathname, "/"), true
+	}
+	if u.Scheme != s.base.Scheme || u.Host != s.base.Host {
+		return "", false
+	}
+	return strings.CutPrefix(u.Path, s.base.Path)
+}
+
+func (s *Store) contentPath(pathname string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(pathname))
+}
+
+func (s *Store) metadataPath(pathname string) string {
+	return filepath.Join(s.dir, metaDir, filepath.FromSlash(pathname)+".json")
+}
+
+func (s *Store) putResult(pathname string, meta metadata) *vercelblob.PutBlobPutResult {
+	return &vercelblob.PutBlobPutResult{
+		URL:                s.BlobURL(pathname),
+		Pathname:           pathname,
+		ContentType:        meta.ContentType,
+		ContentDisposition: contentDisposition(pathname),
+	}
+}
+
+// checkPathname rejects pathnames that do not map to a file under the
+// directory of the store.
+func checkPathname(pathname string) error {
+	if !fs.ValidPath(pathname) || pathname == "." || strings.SplitN(pathname, "/", 2)[0] == metaDir {
+		return vercelblob.BadRequestError("invalid pathname " + pathname)
+	}
+	return nil
+}
+
+// readerWithContext stops reading once ctx is done.
+type readerWithContext struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r readerWithContext) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// contentTypeOf returns the content type the API derives from the extension
+// of pathname.
+func contentTypeOf(pathname string) string {
+	if contentType := mime.TypeByExtension(path.Ext(pathname)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+func contentDisposition(pathname string) string {
+	return fmt.Sprintf("inline; filename=%q", path.Base(pathname))
+}
+
+// addRandomSuffix inserts a random suffix before the extension of pathname,
+// like the API.
+func addRandomSuffix(pathname string) string {
+	ext := path.Ext(pathname)
+	if strings.Contains(ext, "/") {
+		ext = ""
+	}
+	const alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	suffix := make([]byte, 30)
+	for i := range suffix {
+		suffix[i] = alphabet[rand.IntN(len(alphabet))]
+	}
+	return strings.TrimSuffix(pathname, ext) + "-" + string(suffix) + ext
+}
@@ -0,0 +1,245 @@
+package fsblob_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	vercelblob "github.com/claywarren/vercel_blob"
+	"github.com/claywarren/vercel_blob/blobtest"
+	"github.com/claywarren/vercel_blob/fsblob"
+)
+
+// stores returns the implementations the parity suite runs against: a Store
+// and a Client of a blobtest server.
+func stores(t *testing.T) map[string]func(t *testing.T) vercelblob.OptionsBlobStore {
+	return map[string]func(t *testing.T) vercelblob.OptionsBlobStore{
+		"fsblob": func(t *testing.T) vercelblob.OptionsBlobStore {
+			store, err := fsblob.New(t.TempDir(), fsblob.Options{BaseURL: "http://localhost:8080/blobs"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return store
+		},
+		"client": func(t *testing.T) vercelblob.OptionsBlobStore {
+			server := blobtest.NewServer()
+			t.Cleanup(server.Close)
+			client, err := vercelblob.NewClientWithOptions(
+				vercelblob.WithBaseURL(server.URL),
+				vercelblob.WithTokenProvider(vercelblob.StaticTokenProvider("token")),
+				vercelblob.WithNoEnv(),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return client
+		},
+	}
+}
+
+func Test_Parity_PutHeadDownload(t *testing.T) {
+	for name, newStore := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			ctx := context.Background()
+
+			put, err := store.Put(ctx, "docs/a.txt", strings.NewReader("hello world"), vercelblob.PutCommandOptions{CacheControlMaxAge: 60})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if put.Pathname != "docs/a.txt" || !strings.HasPrefix(put.ContentType, "text/plain") || put.ContentDisposition != `inline; filename="a.txt"` {
+				t.Errorf("Unexpected put result %+v", put)
+			}
+			if _, err := store.Put(ctx, "docs/a.txt", strings.NewReader("again"), vercelblob.PutCommandOptions{}); !errors.Is(err, vercelblob.ErrBlobAlreadyExists) {
+				t.Errorf("Expected blob_already_exists, got %v", err)
+			}
+			suffixed, err := store.Put(ctx, "docs/b.json", strings.NewReader("{}"), vercelblob.PutCommandOptions{AddRandomSuffix: true})
+			if err != nil || !strings.HasPrefix(suffixed.Pathname, "docs/b-") || !strings.HasSuffix(suffixed.Pathname, ".json") {
+				t.Errorf("Expected a random suffix, got %+v, %v", suffixed, err)
+			}
+
+			for _, pathnameOrURL := range []string{"docs/a.txt", put.URL} {
+				head, err := store.Head(ctx, pathnameOrURL)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if head.URL != put.URL || head.Pathname != "docs/a.txt" || head.Size != 11 || head.CacheControl != "public, max-age=60" || head.ETag == "" || head.UploadedAt.IsZero() {
+					t.Errorf("Unexpected head result %+v", head)
+				}
+				if again, err := store.HeadWithOptions(ctx, pathnameOrURL, vercelblob.HeadCommandOptions{IfNoneMatch: head.ETag}); err != nil || !again.NotModified {
+					t.Errorf("Expected the blob not to be modified, got %+v, %v", again, err)
+				}
+			}
+			if _, err := store.Head(ctx, "docs/missing.txt"); !vercelblob.IsNotFound(err) {
+				t.Errorf("Expected not_found, got %v", err)
+			}
+
+			if _, err := store.Put(ctx, "docs/a.txt", strings.NewReader("hello there"), vercelblob.PutCommandOptions{AllowOverwrite: true, ContentType: "text/markdown"}); err != nil {
+				t.Fatal(err)
+			}
+			result, err := store.DownloadWithResult(ctx, put.URL, vercelblob.DownloadCommandOptions{})
+			if err != nil || string(result.Content) != "hello there" || result.ContentType != "text/markdown" {
+				t.Errorf("Expected the new content, got %+v, %v", result, err)
+			}
+			data, err := store.Download(ctx, put.URL, vercelblob.DownloadCommandOptions{ByteRange: &vercelblob.Range{Start: 6, End: 100}})
+			if err != nil || string(data) != "there" {
+				t.Errorf("Expected the range, got %q, %v", data, err)
+			}
+			if _, err := store.Download(ctx, strings.Replace(put.URL, "a.txt", "missing.txt", 1), vercelblob.DownloadCommandOptions{}); !vercelblob.IsNotFound(err) {
+				t.Errorf("Expected not_found, got %v", err)
+			}
+		})
+	}
+}
+
+func Test_Parity_List(t *testing.T) {
+	for name, newStore := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			ctx := context.Background()
+			for _, pathname := range []string{"docs/a.txt", "docs/b.txt", "docs/old/c.txt", "docs/old/d.txt", "docs/z.txt", "img/e.png"} {
+				if _, err := store.Put(ctx, pathname, strings.NewReader(pathname), vercelblob.PutCommandOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var pathnames []string
+			cursor := ""
+			for {
+				page, err := store.List(ctx, vercelblob.ListCommandOptions{Prefix: "docs/", Cursor: cursor, Limit: 2})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(page.Blobs) > 2 {
+					t.Errorf("Expected pages of 2 blobs, got %d", len(page.Blobs))
+				}
+				for _, blob := range page.Blobs {
+					pathnames = append(pathnames, blob.PathName)
+					if blob.Size != uint64(len(blob.PathName)) || blob.UploadedAt.IsZero() {
+						t.Errorf("Unexpected blob %+v", blob)
+					}
+				}
+				if !page.HasMore {
+					break
+				}
+				cursor = page.Cursor
+			}
+			if want := []string{"docs/a.txt", "docs/b.txt", "docs/old/c.txt", "docs/old/d.txt", "docs/z.txt"}; !slices.Equal(pathnames, want) {
+				t.Errorf("Expected %v, got %v", want, pathnames)
+			}
+
+			folded, err := store.List(ctx, vercelblob.ListCommandOptions{Prefix: "docs/", Mode: "folded"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(folded.Blobs) != 3 || !slices.Equal(folded.Folders, []string{"docs/old/"}) || folded.HasMore {
+				t.Errorf("Expected 3 blobs and one folder, got %+v", folded)
+			}
+			root, err := store.List(ctx, vercelblob.ListCommandOptions{Mode: "folded"})
+			if err != nil || len(root.Blobs) != 0 || !slices.Equal(root.Folders, []string{"docs/", "img/"}) {
+				t.Errorf("Expected two folders, got %+v, %v", root, err)
+			}
+		})
+	}
+}
+
+func Test_Parity_CopyDelete(t *testing.T) {
+	for name, newStore := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			ctx := context.Background()
+			source, err := store.Put(ctx, "a.json", strings.NewReader(`{}`), vercelblob.PutCommandOptions{CacheControlMaxAge: 60})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			copied, err := store.CopyWithOptions(ctx, source.URL, "b.json", vercelblob.CopyCommandOptions{Verify: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			head, err := store.Head(ctx, copied.URL)
+			if err != nil || copied.Pathname != "b.json" || head.ContentType != "application/json" || head.CacheControl != "public, max-age=60" {
+				t.Errorf("Unexpected copy %+v with %+v, %v", copied, head, err)
+			}
+			contentType := "text/plain"
+			if _, err := store.Copy(ctx, source.URL, "b.json", vercelblob.PutCommandOptions{}); !errors.Is(err, vercelblob.ErrBlobAlreadyExists) {
+				t.Errorf("Expected blob_already_exists, got %v", err)
+			}
+			if _, err := store.CopyWithOptions(ctx, source.URL, "b.json", vercelblob.CopyCommandOptions{AllowOverwrite: true, ContentTypeOverride: &contentType}); err != nil {
+				t.Fatal(err)
+			}
+			if head, err := store.Head(ctx, "b.json"); err != nil || head.ContentType != "text/plain" {
+				t.Errorf("Expected the content type to be overridden, got %+v, %v", head, err)
+			}
+			missing := strings.Replace(source.URL, "a.json", "missing.json", 1)
+			if _, err := store.Copy(ctx, missing, "c.json", vercelblob.PutCommandOptions{}); !vercelblob.IsNotFound(err) {
+				t.Errorf("Expected not_found, got %v", err)
+			}
+			if _, err := store.Copy(ctx, "https://elsewhere.example.com/a.json", "c.json", vercelblob.PutCommandOptions{}); vercelblob.CodeOf(err) != "bad_request" {
+				t.Errorf("Expected bad_request, got %v", err)
+			}
+
+			if err := store.Delete(ctx, source.URL, "b.json", missing); err != nil {
+				t.Fatal(err)
+			}
+			if list, err := store.List(ctx, vercelblob.ListCommandOptions{}); err != nil || len(list.Blobs) != 0 {
+				t.Errorf("Expected every blob to be deleted, got %+v, %v", list, err)
+			}
+		})
+	}
+}
+
+func Test_Store_Layout(t *testing.T) {
+	dir := t.TempDir()
+	store, err := fsblob.New(dir, fsblob.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	put, err := store.Put(ctx, "docs/a.txt", strings.NewReader("hello"), vercelblob.PutCommandOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "docs", "a.txt")); err != nil || string(data) != "hello" {
+		t.Errorf("Expected the content in a file, got %q, %v", data, err)
+	}
+	if !strings.HasPrefix(put.URL, "file://") || !strings.HasSuffix(put.URL, "/docs/a.txt") {
+		t.Errorf("Expected a file URL, got %s", put.URL)
+	}
+	if data, err := store.Download(ctx, put.URL, vercelblob.DownloadCommandOptions{}); err != nil || string(data) != "hello" {
+		t.Errorf("Expected the content by URL, got %q, %v", data, err)
+	}
+
+	// Files added by other means are blobs too.
+	if err := os.WriteFile(filepath.Join(dir, "docs", "b.json"), []byte(`{}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if head, err := store.Head(ctx, "docs/b.json"); err != nil || head.Size != 2 || head.ContentType != "application/json" {
+		t.Errorf("Expected derived metadata, got %+v, %v", head, err)
+	}
+
+	if _, err := store.Put(ctx, "docs/a.txt/c.txt", bytes.NewReader(nil), vercelblob.PutCommandOptions{}); vercelblob.CodeOf(err) != "bad_request" {
+		t.Errorf("Expected bad_request under a blob, got %v", err)
+	}
+	for _, pathname := range []string{"../a.txt", ".fsblob/a.txt", "docs/"} {
+		if _, err := store.Put(ctx, pathname, strings.NewReader("x"), vercelblob.PutCommandOptions{}); vercelblob.CodeOf(err) != "bad_request" {
+			t.Errorf("Expected bad_request for %s, got %v", pathname, err)
+		}
+	}
+
+	if err := store.Delete(ctx, "docs/a.txt", "docs/b.json"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "docs")); !os.IsNotExist(err) {
+		t.Errorf("Expected the empty folder to be removed, got %v", err)
+	}
+	if _, err := store.Put(ctx, "docs", strings.NewReader("x"), vercelblob.PutCommandOptions{}); err != nil {
+		t.Errorf("Expected a blob at the former folder, got %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+package vercelblob
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path"
+	"sync"
+	"time"
+)
+
+// HeadResultOrError is the outcome of a single lookup in HeadMany.
+type HeadResultOrError struct {
+	// The pathname or URL that was looked up.
+	PathnameOrURL string
+	Result        *HeadBlobResult
+	// Err is set instead of Result when the lookup failed, including with
+	// ErrBlobNotFound.
+	Err error
+}
+
+// HeadMany gets the metadata for several blobs with at most concurrency
+// requests in flight. The output is in input order. Failed lookups are
+// recorded per item and do not stop the batch; only cancellation of ctx does,
+// in which case the items not yet looked up carry the context error.
+func (c *Client) HeadMany(ctx context.Context, pathsOrURLs []string, concurrency int) ([]HeadResultOrError, error) {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	results := make([]HeadResultOrError, len(pathsOrURLs))
+	for i, pathnameOrURL := range pathsOrURLs {
+		results[i].PathnameOrURL = pathnameOrURL
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i, pathnameOrURL := range pathsOrURLs {
+		select {
+		case <-ctx.Done():
+		case sem <- struct{}{}:
+		}
+		if ctx.Err() != nil {
+			for j := i; j < len(results); j++ {
+				results[j].Err = ctx.Err()
+			}
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i].Result, results[i].Err = c.Head(ctx, pathnameOrURL)
+		}()
+	}
+	wg.Wait()
+
+	return results, ctx.Err()
+}
+
+// Delays between polls of WaitForBlob, doubling from the initial delay up to
+// the maximum.
+var (
+	waitForBlobInitialDelay = 100 * time.Millisecond
+	waitForBlobMaxDelay     = 2 * time.Second
+)
+
+// WaitForBlob polls Head until the blob is visible or timeout elapses, and
+// returns its metadata. It is meant for upload-then-verify flows, where a
+// blob may briefly be reported missing after Put.
+//
+// Not found, rate limit, server and network errors are retried with capped
+// exponential backoff; any other error, such as ErrForbidden, is returned
+// immediately.
+// When the deadline passes the last error reported before it is returned.
+func (c *Client) WaitForBlob(ctx context.Context, pathnameOrURL string, timeout time.Duration) (*HeadBlobResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	delay := waitForBlobInitialDelay
+	var lastErr error
+	for {
+		result, err := c.Head(ctx, pathnameOrURL)
+		if err == nil {
+			return result, nil
+		}
+		if ctx.Err() != nil && lastErr != nil {
+			return nil, lastErr
+		}
+		if !isWaitRetryable(ctx, err) {
+			return nil, err
+		}
+		lastErr = err
+
+		select {
+		case <-ctx.Done():
+			return nil, lastErr
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, waitForBlobMaxDelay)
+	}
+}
+
+// isWaitRetryable reports whether WaitForBlob should poll again after err.
+func isWaitRetryable(ctx context.Context, err error) bool {
+	switch {
+	case errors.Is(err, ErrBlobNotFound):
+		return true
+	case errors.Is(err, ErrForbidden):
+		return false
+	default:
+		return IsRetryable(err) || isNetworkError(ctx, err)
+	}
+}
+
+// FileInfo returns a read-only fs.FileInfo describing the blob, for code
+// written against os.Stat. Sys returns the HeadBlobResult.
+func (r *HeadBlobResult) FileInfo() fs.FileInfo {
+	return blobFileInfo{result: r}
+}
+
+// Stat gets the metadata for a blob as an fs.FileInfo. Errors are returned as
+// *fs.PathError; a missing blob satisfies errors.Is(err, fs.ErrNotExist).
+func (c *Client) Stat(ctx context.Context, pathname string) (fs.FileInfo, error) {
+	result, err := c.Head(ctx, pathname)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: pathname, Err: err}
+	}
+	return result.FileInfo(), nil
+}
+
+// blobFileInfo implements fs.FileInfo for a blob.
+type blobFileInfo struct {
+	result *HeadBlobResult
+}
+
+func (fi blobFileInfo) Name() string {
+	return path.Base(fi.result.Pathname)
+}
+
+func (fi blobFileInfo) Size() int64 {
+	return int64(fi.result.Size)
+}
+
+func (fi blobFileInfo) Mode() fs.FileMode {
+	return 0o444
+}
+
+func (fi blobFileInfo) ModTime() time.Time {
+	return fi.result.UploadedAt
+}
+
+func (fi blobFileInfo) IsDir() bool {
+	return false
+}
+
+func (fi blobFileInfo) Sys() any {
+	return fi.result
+}
@@ -0,0 +1,238 @@
+package vercelblob
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_HeadMany_Mock(t *testing.T) {
+	var inFlight, maxInFlight int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			m := atomic.LoadInt32(&maxInFlight)
+			if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		pathname := r.URL.Query().Get("url")
+		if pathname == "missing.txt" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(HeadBlobResult{Pathname: pathname})
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("test")))
+
+	inputs := []string{"a.txt", "b.txt", "missing.txt", "c.txt", "d.txt", "e.txt"}
+	results, err := client.HeadMany(context.Background(), inputs, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, res := range results {
+		if res.PathnameOrURL != inputs[i] {
+			t.Errorf("Expected %s at %d, got %s", inputs[i], i, res.PathnameOrURL)
+		}
+		if inputs[i] == "missing.txt" {
+			if !errors.Is(res.Err, ErrBlobNotFound) {
+				t.Errorf("Expected ErrBlobNotFound for missing.txt, got %v", res.Err)
+			}
+			continue
+		}
+		if res.Err != nil || res.Result.Pathname != inputs[i] {
+			t.Errorf("Expected result for %s, got %+v", inputs[i], res)
+		}
+	}
+	if maxInFlight > 2 {
+		t.Errorf("Expected at most 2 requests in flight, got %d", maxInFlight)
+	}
+}
+
+func Test_HeadMany_Cancelled(t *testing.T) {
+	client := newTestClient(t, WithTokenProvider(StaticTokenProvider("test")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err := client.HeadMany(ctx, []string{"a.txt", "b.txt"}, 1)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	for _, res := range results {
+		if !errors.Is(res.Err, context.Canceled) {
+			t.Errorf("Expected context.Canceled for %s, got %v", res.PathnameOrURL, res.Err)
+		}
+	}
+}
+
+func Test_HeadWithOptions_IfNoneMatch_Mock(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("url") {
+		case "missing.txt":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", `"v2"`)
+		if r.Header.Get("If-None-Match") == `"v2"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(HeadBlobResult{Pathname: "a.txt", Size: 5})
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("test")))
+	ctx := context.Background()
+
+	res, err := client.HeadWithOptions(ctx, "a.txt", HeadCommandOptions{IfNoneMatch: `"v1"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.NotModified || res.ETag != `"v2"` || res.Size != 5 {
+		t.Errorf("Expected a modified result with ETag \"v2\", got %+v", res)
+	}
+
+	res, err = client.HeadWithOptions(ctx, "a.txt", HeadCommandOptions{IfNoneMatch: res.ETag})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.NotModified || res.ETag != `"v2"` {
+		t.Errorf("Expected a not modified result, got %+v", res)
+	}
+
+	_, err = client.HeadWithOptions(ctx, "missing.txt", HeadCommandOptions{IfNoneMatch: `"v2"`})
+	if !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("Expected ErrBlobNotFound, got %v", err)
+	}
+}
+
+func Test_Stat_Mock(t *testing.T) {
+	uploadedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("url") == "missing.txt" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(HeadBlobResult{Pathname: "dir/a.txt", Size: 5, UploadedAt: uploadedAt})
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("test")))
+
+	fi, err := client.Stat(context.Background(), "dir/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Name() != "a.txt" || fi.Size() != 5 || !fi.ModTime().Equal(uploadedAt) || fi.Mode() != 0o444 || fi.IsDir() {
+		t.Errorf("Unexpected file info: %s %d %s %s %v", fi.Name(), fi.Size(), fi.ModTime(), fi.Mode(), fi.IsDir())
+	}
+	if _, ok := fi.Sys().(*HeadBlobResult); !ok {
+		t.Errorf("Expected Sys to return *HeadBlobResult, got %T", fi.Sys())
+	}
+
+	_, err = client.Stat(context.Background(), "missing.txt")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist, got %v", err)
+	}
+	if !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("Expected ErrBlobNotFound, got %v", err)
+	}
+}
+
+func Test_WaitForBlob_Mock(t *testing.T) {
+	waitForBlobInitialDelay = time.Millisecond
+	waitForBlobMaxDelay = 4 * time.Millisecond
+
+	tests := []struct {
+		name      string
+		statuses  []int
+		timeout   time.Duration
+		wantErr   error
+		wantPolls int
+	}{
+		{name: "visible after propagation", statuses: []int{404, 404, 500, 200}, timeout: time.Second, wantPolls: 4},
+		{name: "service unavailable", statuses: []int{503, 429, 200}, timeout: time.Second, wantPolls: 3},
+		{name: "forbidden aborts", statuses: []int{404, 403, 200}, timeout: time.Second, wantErr: ErrForbidden, wantPolls: 2},
+		{name: "deadline", statuses: []int{404}, timeout: 20 * time.Millisecond, wantErr: ErrBlobNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			polls := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				status := tt.statuses[min(polls, len(tt.statuses)-1)]
+				polls++
+				w.WriteHeader(status)
+				switch status {
+				case http.StatusOK:
+					_ = json.NewEncoder(w).Encode(HeadBlobResult{Pathname: "a.txt"})
+				case http.StatusForbidden:
+					_ = json.NewEncoder(w).Encode(BlobAPIError{Error: BlobAPIErrorDetail{Code: "forbidden"}})
+				case http.StatusServiceUnavailable:
+					_ = json.NewEncoder(w).Encode(BlobAPIError{Error: BlobAPIErrorDetail{Code: "service_unavailable"}})
+				case http.StatusTooManyRequests:
+					_ = json.NewEncoder(w).Encode(BlobAPIError{Error: BlobAPIErrorDetail{Code: "rate_limited"}})
+				}
+			}))
+			defer server.Close()
+
+			client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("test")))
+
+			res, err := client.WaitForBlob(context.Background(), "a.txt", tt.timeout)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Expected %v, got %v", tt.wantErr, err)
+				}
+			} else if err != nil || res.Pathname != "a.txt" {
+				t.Fatalf("Expected a.txt, got %v, %v", res, err)
+			}
+			if tt.wantPolls > 0 && polls != tt.wantPolls {
+				t.Errorf("Expected %d polls, got %d", tt.wantPolls, polls)
+			}
+		})
+	}
+}
+
+func Test_Head_MissingFields_Mock(t *testing.T) {
+	body := `{"url":"https://blob.com/a.txt","pathname":"a.txt","size":0,"uploadedAt":"2024-01-02T03:04:05Z"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("test")))
+	ctx := context.Background()
+
+	res, err := client.HeadWithOptions(ctx, "a.txt", HeadCommandOptions{Strict: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.SizeKnown || res.Size != 0 || !res.UploadedAtKnown {
+		t.Errorf("Expected a known empty blob, got %+v", res)
+	}
+
+	body = `{"url":"https://blob.com/a.txt","pathname":"a.txt"}`
+	res, err = client.Head(ctx, "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.SizeKnown || res.UploadedAtKnown || !res.UploadedAt.IsZero() {
+		t.Errorf("Expected unknown size and upload time, got %+v", res)
+	}
+
+	_, err = client.HeadWithOptions(ctx, "a.txt", HeadCommandOptions{Strict: true})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Code != "missing_field" || apiErr.Msg != "response is missing size" {
+		t.Errorf("Expected a missing size error, got %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package vercelblob
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// HedgePolicy configures the hedging of metadata reads. The zero value
+// disables hedging.
+type HedgePolicy struct {
+	// Delay is how long a request may go unanswered before a duplicate is
+	// sent. Zero disables hedging.
+	Delay time.Duration
+	// OnHedge, if set, is called when a duplicate request is sent. Hedges
+	// are also counted by a MetricsRecorder implementing HedgeRecorder.
+	OnHedge func(HedgeAttempt)
+}
+
+// HedgeAttempt describes a duplicate request about to be sent.
+type HedgeAttempt struct {
+	Operation Operation
+	Pathname  string
+	// Delay is the time the first request went unanswered.
+	Delay time.Duration
+}
+
+// WithHedging cuts the tail latency of Head and List: if a request has not
+// been answered after policy.Delay, one duplicate is sent, the first response
+// is used and the other request is cancelled. If one of the two requests
+// fails in transit, the other one is waited for. Other operations, and in
+// particular those that modify blobs, are never hedged.
+//
+// Hedging happens within each attempt of WithRetry, so a request is sent at
+// most twice per attempt.
+func WithHedging(policy HedgePolicy) ClientOption {
+	return func(c *Client) error {
+		if policy.Delay < 0 {
+			return NewInvalidOptionError("WithHedging", fmt.Sprintf("%v is a negative duration", policy.Delay))
+		}
+		c.hedgePolicy = policy
+		return nil
+	}
+}
+
+// isHedged reports whether requests of operation may be hedged.
+func isHedged(operation Operation) bool {
+	return operation == OperationHead || operation == OperationList
+}
+
+// hedgeResult is the outcome of one of the requests of sendHedged.
+type hedgeResult struct {
+	resp   *http.Response
+	err    error
+	cancel context.CancelFunc
+}
+
+// sendHedged sends req with send, and a duplicate of it if it is hedged and
+// unanswered after the hedge delay of the client.
+func (c *Client) sendHedged(req *http.Request, operation Operation, pathname string) (*http.Response, error) {
+	policy := c.hedgePolicy
+	if policy.Delay <= 0 || !isHedged(operation) || req.Body != nil && req.Body != http.NoBody {
+		return c.send(req, operation, pathname)
+	}
+
+	results := make(chan hedgeResult, 2)
+	launch := func(req *http.Request) {
+		ctx, cancel := context.WithCancel(req.Context())
+		go func() {
+			resp, err := c.send(req.Clone(ctx), operation, pathname)
+			results <- hedgeResult{resp, err, cancel}
+		}()
+	}
+	launch(req)
+	pending := 1
+
+	timer := time.NewTimer(policy.Delay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			if req.Context().Err() != nil {
+				continue
+			}
+			if policy.OnHedge != nil {
+				policy.OnHedge(HedgeAttempt{Operation: operation, Pathname: pathname, Delay: policy.Delay})
+			}
+			c.recordHedge(operation)
+			launch(req)
+			pending++
+		case result := <-results:
+			pending--
+			if result.err != nil && pending > 0 {
+				// Wait for the other request, which may still succeed.
+				result.cancel()
+				continue
+			}
+			if pending > 0 {
+				// Cancel the loser and release its response, if any.
+				go func() {
+					loser := <-results
+					loser.cancel()
+					if loser.resp != nil {
+						_ = loser.resp.Body.Close()
+					}
+				}()
+			}
+			return finishHedge(result)
+		}
+	}
+}
+
+// finishHedge returns the outcome of the request that won, releasing its
+// context once its body is closed.
+func finishHedge(result hedgeResult) (*http.Response, error) {
+	if result.err != nil {
+		result.cancel()
+		return nil, result.err
+	}
+	result.resp.Body = cancelOnClose{result.resp.Body, result.cancel}
+	return result.resp, nil
+}
@@ -0,0 +1,80 @@
+package vercelblob
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_WithHedging_Mock(t *testing.T) {
+	var requests atomic.Int64
+	cancelled := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		// The first request of each test is slow, the duplicate is fast.
+		if requests.Add(1) == 1 {
+			select {
+			case <-r.Context().Done():
+				cancelled <- struct{}{}
+				return
+			case <-time.After(5 * time.Second):
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.txt","pathname":"a.txt","blobs":[]}`))
+	}))
+	defer server.Close()
+	var hedges []HedgeAttempt
+	client := newTestClient(t,
+		WithBaseURL(server.URL),
+		WithTokenProvider(StaticTokenProvider("token")),
+		WithHedging(HedgePolicy{
+			Delay:   20 * time.Millisecond,
+			OnHedge: func(h HedgeAttempt) { hedges = append(hedges, h) },
+		}),
+	)
+	ctx := context.Background()
+
+	start := time.Now()
+	if _, err := client.Head(ctx, "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the hedge to answer quickly, took %v", elapsed)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("Expected 2 requests, got %d", n)
+	}
+	if len(hedges) != 1 || hedges[0].Operation != OperationHead || hedges[0].Pathname != "a.txt" || hedges[0].Delay != 20*time.Millisecond {
+		t.Errorf("Unexpected hedges: %+v", hedges)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("Expected the slow request to be cancelled")
+	}
+
+	// A fast answer is not hedged.
+	hedges = nil
+	if _, err := client.List(ctx, ListCommandOptions{}); err != nil || len(hedges) != 0 {
+		t.Errorf("Expected no hedge, got %+v, %v", hedges, err)
+	}
+
+	// Mutating operations are never hedged.
+	requests.Store(0)
+	putCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	_, _ = client.Put(putCtx, "a.txt", strings.NewReader("a"), PutCommandOptions{})
+	if n := requests.Load(); n != 1 || len(hedges) != 0 {
+		t.Errorf("Expected the put not to be hedged, got %d requests and %+v", n, hedges)
+	}
+
+	if _, err := NewClientWithOptions(WithHedging(HedgePolicy{Delay: -time.Second})); CodeOf(err) != "invalid_option" {
+		t.Errorf("Expected an invalid_option error, got %v", err)
+	}
+}
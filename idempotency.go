@@ -0,0 +1,105 @@
+package vercelblob
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// DefaultIdempotencyHeader is the header that carries the idempotency key of
+// write requests unless it is changed with WithIdempotencyHeader.
+const DefaultIdempotencyHeader = "Idempotency-Key"
+
+// WithIdempotencyHeader sets the header that carries the idempotency key of
+// write requests, for APIs or gateways that expect another name. An empty
+// name stops the client from sending idempotency keys.
+//
+// Every put, copy and delete gets a key that is sent with each of its
+// requests, including the retries of WithRetry, so that a request applied by
+// the server before its response was lost can be recognized when it is sent
+// again. The first and last steps of a multipart upload carry the key of the
+// put with the suffix -create or -complete, so that a response to one step
+// is never replayed for the other. The key of a put or copy is reported in
+// the IdempotencyKey of its result; use ContextWithIdempotencyKey to choose
+// it.
+func WithIdempotencyHeader(name string) ClientOption {
+	return func(c *Client) error {
+		if strings.ContainsAny(name, " \t\r\n:") {
+			return NewInvalidOptionError("WithIdempotencyHeader", "the header name "+name+" is invalid")
+		}
+		c.idempotencyHeader = name
+		return nil
+	}
+}
+
+type idempotencyKeyKey struct{}
+
+// idempotencyScope is the idempotency key of an operation in progress. An
+// empty operation is a key chosen by the caller for the next operation.
+type idempotencyScope struct {
+	operation Operation
+	key       string
+}
+
+// ContextWithIdempotencyKey returns a copy of ctx in which the next put, copy
+// or delete started with it uses key as its idempotency key, e.g. to keep the
+// same key when the caller retries the whole operation. Requests of other
+// operations started by that one, such as the deletion of a copy that failed
+// verification, get keys of their own.
+func ContextWithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyKey{}, idempotencyScope{key: key})
+}
+
+// withIdempotencyKey is like bindIdempotencyKey, but returns no key if the
+// client sends none.
+func (c *Client) withIdempotencyKey(ctx context.Context, operation Operation) (context.Context, string) {
+	if c.idempotencyHeader == "" {
+		return ctx, ""
+	}
+	return bindIdempotencyKey(ctx, operation, c.random())
+}
+
+// bindIdempotencyKey returns the idempotency key of operation and a context
+// carrying it, reusing the key of ctx if it belongs to operation or was
+// chosen by the caller. New keys are drawn from r.
+func bindIdempotencyKey(ctx context.Context, operation Operation, r *lockedRand) (context.Context, string) {
+	scope, ok := ctx.Value(idempotencyKeyKey{}).(idempotencyScope)
+	if ok && scope.operation == operation {
+		return ctx, scope.key
+	}
+	if !ok || scope.operation != "" || scope.key == "" {
+		scope.key = r.Text()
+	}
+	scope.operation = operation
+	return context.WithValue(ctx, idempotencyKeyKey{}, scope), scope.key
+}
+
+// idempotentOperation returns the operation whose idempotency key requests of
+// operation carry, or "" if they carry none. Parts of a multipart upload are
+// addressed by their number and need no key.
+func idempotentOperation(operation Operation) Operation {
+	switch operation {
+	case OperationPut, OperationCopy, OperationDelete:
+		return operation
+	case OperationMultipartCreate, OperationMultipartComplete:
+		return OperationPut
+	}
+	return ""
+}
+
+// setIdempotencyKey adds the idempotency key of the operation of req, if any,
+// to its headers.
+func (c *Client) setIdempotencyKey(req *http.Request, operation Operation) {
+	logical := idempotentOperation(operation)
+	if c.idempotencyHeader == "" || logical == "" || req.Header.Get(c.idempotencyHeader) != "" {
+		return
+	}
+	_, key := bindIdempotencyKey(req.Context(), logical, c.random())
+	switch operation {
+	case OperationMultipartCreate:
+		key += "-create"
+	case OperationMultipartComplete:
+		key += "-complete"
+	}
+	req.Header.Set(c.idempotencyHeader, key)
+}
@@ -0,0 +1,91 @@
+package vercelblob
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_IdempotencyKey_Mock(t *testing.T) {
+	var mu sync.Mutex
+	keys := map[string][]string{}
+	failPut := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		kind := r.Method + " " + r.Header.Get("X-MPU-Action")
+		keys[kind] = append(keys[kind], r.Header.Get("X-Request-Key"))
+		if kind == "PUT " && failPut {
+			failPut = false
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("ETag", `"etag"`)
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.txt","pathname":"a.txt","uploadId":"id","key":"key"}`))
+	}))
+	defer server.Close()
+	client := newTestClient(t,
+		WithBaseURL(server.URL),
+		WithTokenProvider(StaticTokenProvider("token")),
+		WithRetry(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}),
+		WithIdempotencyHeader("X-Request-Key"),
+	)
+	ctx := context.Background()
+
+	// Retries of a put reuse its key, which is reported on the result.
+	result, err := client.Put(ctx, "a.txt", strings.NewReader("a"), PutCommandOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if puts := keys["PUT "]; len(puts) != 2 || puts[0] == "" || puts[0] != puts[1] || result.IdempotencyKey != puts[0] {
+		t.Errorf("Expected the retry to reuse the key %q, got %v", result.IdempotencyKey, puts)
+	}
+
+	// The first and last steps of a multipart upload derive their keys from
+	// the key of the put.
+	result, err = client.Put(ctx, "a.bin", strings.NewReader(strings.Repeat("a", MultipartThreshold+1)), PutCommandOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	create, complete := keys["POST create"], keys["POST complete"]
+	if len(create) != 1 || len(complete) != 1 || create[0] != result.IdempotencyKey+"-create" || complete[0] != result.IdempotencyKey+"-complete" {
+		t.Errorf("Expected create and complete to carry keys derived from %q, got %v and %v", result.IdempotencyKey, create, complete)
+	}
+	if parts := keys["PUT upload"]; len(parts) != 2 || parts[0] != "" {
+		t.Errorf("Expected the parts to carry no key, got %v", parts)
+	}
+	if result.IdempotencyKey == keys["PUT "][0] {
+		t.Error("Expected every put to get a new key")
+	}
+
+	// A key chosen by the caller is used by the next operation only.
+	copied, err := client.CopyWithOptions(ContextWithIdempotencyKey(ctx, "copy-1"), "https://blob.com/a.txt", "b.txt", CopyCommandOptions{})
+	if err != nil || copied.IdempotencyKey != "copy-1" || keys["PUT "][2] != "copy-1" {
+		t.Errorf("Expected the copy to use the key of the caller, got %+v, %v", copied, err)
+	}
+	if err := client.Delete(ctx, "https://blob.com/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if deletes := keys["POST "]; len(deletes) != 1 || deletes[0] == "" {
+		t.Errorf("Expected the delete to carry a key, got %v", deletes)
+	}
+	if _, err := client.Head(ctx, "a.txt"); err != nil || keys["GET "][0] != "" {
+		t.Errorf("Expected reads to carry no key, got %v, %v", keys["GET "], err)
+	}
+
+	// An empty header name disables the keys.
+	client, _ = client.Clone(WithIdempotencyHeader(""))
+	if result, err := client.Put(ctx, "a.txt", strings.NewReader("a"), PutCommandOptions{}); err != nil || keys["PUT "][3] != "" || result.IdempotencyKey != "" {
+		t.Errorf("Expected no key, got %v, %+v, %v", keys["PUT "], result, err)
+	}
+
+	if _, err := NewClientWithOptions(WithIdempotencyHeader("Bad Header")); CodeOf(err) != "invalid_option" {
+		t.Errorf("Expected an invalid_option error, got %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package vercelblob_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	vercelblob "github.com/claywarren/vercel_blob"
+	"github.com/claywarren/vercel_blob/testutil"
+)
+
+// The tests of this file run against the recorded responses of the API in
+// testdata/cassettes. Run them with BLOB_READ_WRITE_TOKEN set to record them
+// again.
+
+// newCassetteClient returns a client recording or replaying the cassette
+// name.
+func newCassetteClient(t *testing.T, name string) *vercelblob.Client {
+	t.Helper()
+	cassette := testutil.NewCassette(t, name)
+	client, err := vercelblob.NewClientWithOptions(cassette.ClientOptions()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func Test_Put_Cassette(t *testing.T) {
+	client := newCassetteClient(t, "put")
+	ctx := context.Background()
+
+	put, err := client.Put(ctx, "vercel_blob_unittest/cassette/put.txt", strings.NewReader("hello cassette"), vercelblob.PutCommandOptions{
+		AddRandomSuffix: true,
+		ContentType:     "text/plain",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(put.Pathname, "vercel_blob_unittest/cassette/put-") || !strings.HasSuffix(put.URL, put.Pathname) || put.ContentType != "text/plain" || put.RequestID == "" {
+		t.Errorf("Unexpected put result %+v", put)
+	}
+
+	head, err := client.Head(ctx, put.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Pathname != put.Pathname || head.Size != 14 || head.ContentType != "text/plain" || !head.UploadedAtKnown {
+		t.Errorf("Unexpected head result %+v", head)
+	}
+
+	if err := client.Delete(ctx, put.URL); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_List_Cassette(t *testing.T) {
+	client := newCassetteClient(t, "list")
+	ctx := context.Background()
+	prefix := "vercel_blob_unittest/cassette/list/"
+
+	var urls []string
+	for _, name := range []string{"a.txt", "b.txt"} {
+		put, err := client.Put(ctx, prefix+name, strings.NewReader(name), vercelblob.PutCommandOptions{AllowOverwrite: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		urls = append(urls, put.URL)
+	}
+
+	first, err := client.List(ctx, vercelblob.ListCommandOptions{Prefix: prefix, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.Blobs) != 1 || first.Blobs[0].PathName != prefix+"a.txt" || first.Blobs[0].Size != 5 || !first.HasMore || first.Cursor == "" {
+		t.Errorf("Unexpected first page %+v", first)
+	}
+	second, err := client.List(ctx, vercelblob.ListCommandOptions{Prefix: prefix, Limit: 1, Cursor: first.Cursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second.Blobs) != 1 || second.Blobs[0].PathName != prefix+"b.txt" || second.HasMore {
+		t.Errorf("Unexpected second page %+v", second)
+	}
+
+	if err := client.Delete(ctx, urls...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_Copy_Cassette(t *testing.T) {
+	client := newCassetteClient(t, "copy")
+	ctx := context.Background()
+
+	source, err := client.Put(ctx, "vercel_blob_unittest/cassette/copy-a.txt", strings.NewReader("copy me"), vercelblob.PutCommandOptions{AllowOverwrite: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied, err := client.Copy(ctx, source.URL, "vercel_blob_unittest/cassette/copy-b.txt", vercelblob.PutCommandOptions{AllowOverwrite: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copied.Pathname != "vercel_blob_unittest/cassette/copy-b.txt" || !strings.HasPrefix(copied.ContentType, "text/plain") {
+		t.Errorf("Unexpected copy result %+v", copied)
+	}
+	data, err := client.Download(ctx, copied.URL, vercelblob.DownloadCommandOptions{})
+	if err != nil || string(data) != "copy me" {
+		t.Errorf("Expected the copied content, got %q, %v", data, err)
+	}
+
+	if err := client.Delete(ctx, source.URL, copied.URL); err != nil {
+		t.Fatal(err)
+	}
+}
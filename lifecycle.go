@@ -0,0 +1,126 @@
+package vercelblob
+
+import (
+	"context"
+	"sync"
+)
+
+// lifecycle tracks the operations in flight on a client so that Close can
+// wait for them. It is shared by the copies of a client returned by methods
+// such as ForStore and WithPrefix, but not by clients created with Clone.
+type lifecycle struct {
+	mu       sync.Mutex
+	closed   bool
+	inflight int
+	idle     chan struct{}
+	// uploads holds the cancel functions of the multipart uploads in flight.
+	uploads map[*context.CancelFunc]struct{}
+}
+
+func newLifecycle() *lifecycle {
+	return &lifecycle{idle: make(chan struct{}), uploads: map[*context.CancelFunc]struct{}{}}
+}
+
+// begin starts an operation, or returns ErrClientClosed.
+func (l *lifecycle) begin() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return ErrClientClosed
+	}
+	l.inflight++
+	return nil
+}
+
+// end finishes an operation started by begin.
+func (l *lifecycle) end() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inflight--
+	if l.closed && l.inflight == 0 {
+		close(l.idle)
+	}
+}
+
+// trackedOperationKey marks the context of an operation made of several
+// requests, such as a multipart upload, that has begun; its requests are
+// sent even once the client is closed, so that it can finish.
+type trackedOperationKey struct{}
+
+// beginUpload starts a multipart upload. The returned context is canceled if
+// Close gives up waiting for the upload; the returned function ends it.
+func (c *Client) beginUpload(ctx context.Context) (context.Context, func(), error) {
+	l := c.lifecycle
+	if l == nil || ctx.Value(trackedOperationKey{}) != nil {
+		return ctx, func() {}, nil
+	}
+	if err := l.begin(); err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.WithCancel(context.WithValue(ctx, trackedOperationKey{}, true))
+	l.mu.Lock()
+	l.uploads[&cancel] = struct{}{}
+	l.mu.Unlock()
+	return ctx, func() {
+		l.mu.Lock()
+		delete(l.uploads, &cancel)
+		l.mu.Unlock()
+		cancel()
+		l.end()
+	}, nil
+}
+
+// beginRequest starts the operation of a single request, unless it belongs to
+// an operation that has begun already. The returned function ends it.
+func (c *Client) beginRequest(ctx context.Context) (func(), error) {
+	if c.lifecycle == nil || ctx.Value(trackedOperationKey{}) != nil {
+		return func() {}, nil
+	}
+	if err := c.lifecycle.begin(); err != nil {
+		return nil, err
+	}
+	return c.lifecycle.end, nil
+}
+
+// Close stops the client from starting new operations, which fail with
+// ErrClientClosed from then on, and waits for the operations in flight to
+// finish. A download is in flight until its body is closed. If ctx is done
+// first, the multipart uploads still in flight are canceled and aborted, so
+// that the API drops the parts sent so far, and ctx.Err() is returned; other
+// requests are left to finish on their own.
+//
+// Close affects the copies of the client returned by ForStore, WithPrefix and
+// similar methods, which share its operations, but not clients created with
+// Clone. Calling Close again waits again.
+func (c *Client) Close(ctx context.Context) error {
+	l := c.lifecycle
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	if !l.closed {
+		l.closed = true
+		if l.inflight == 0 {
+			close(l.idle)
+		}
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-l.idle:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		for cancel := range l.uploads {
+			(*cancel)()
+		}
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,126 @@
+package vercelblob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_Client_Close_Mock(t *testing.T) {
+	arrived := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		if r.Method == http.MethodPut && r.Header.Get("X-MPU-Action") == "" {
+			arrived <- struct{}{}
+			<-release
+		}
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.txt","pathname":"a.txt","blobs":[]}`))
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")))
+	scoped := client.WithPrefix("tenants/42")
+	ctx := context.Background()
+
+	putErr := make(chan error)
+	go func() {
+		_, err := scoped.Put(ctx, "a.txt", strings.NewReader("a"), PutCommandOptions{})
+		putErr <- err
+	}()
+	<-arrived
+
+	closed := make(chan error)
+	go func() { closed <- client.Close(ctx) }()
+	// The client refuses new operations while it waits for the upload.
+	time.Sleep(10 * time.Millisecond)
+	if _, err := client.List(ctx, ListCommandOptions{}); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("Expected ErrClientClosed, got %v", err)
+	}
+	select {
+	case err := <-closed:
+		t.Fatalf("Expected Close to wait for the upload, got %v", err)
+	default:
+	}
+
+	close(release)
+	if err := <-putErr; err != nil {
+		t.Errorf("Expected the upload to finish, got %v", err)
+	}
+	if err := <-closed; err != nil {
+		t.Errorf("Expected Close to succeed, got %v", err)
+	}
+	if _, err := scoped.Head(ctx, "a.txt"); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("Expected ErrClientClosed from a copy of the client, got %v", err)
+	}
+	if err := client.Close(ctx); err != nil {
+		t.Errorf("Expected a second Close to succeed, got %v", err)
+	}
+
+	clone, err := client.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := clone.List(ctx, ListCommandOptions{}); err != nil {
+		t.Errorf("Expected a clone to have its own lifecycle, got %v", err)
+	}
+}
+
+func Test_Client_Close_AbortsMultipart_Mock(t *testing.T) {
+	var mu sync.Mutex
+	var actions []string
+	arrived := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		action := r.Header.Get("X-MPU-Action")
+		mu.Lock()
+		actions = append(actions, action)
+		mu.Unlock()
+		if action == "abort" && (r.Header.Get("X-MPU-Upload-Id") != "id" || r.Header.Get("X-MPU-Key") != "key") {
+			t.Errorf("Expected the abort of the upload, got %v", r.Header)
+		}
+		if action == "upload" {
+			select {
+			case arrived <- struct{}{}:
+			default:
+			}
+			// A slow part, which the client stops waiting for.
+			<-r.Context().Done()
+			return
+		}
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.bin","pathname":"a.bin","uploadId":"id","key":"key"}`))
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")))
+	putErr := make(chan error)
+	go func() {
+		_, err := client.Put(context.Background(), "a.bin", bytes.NewReader(make([]byte, MultipartThreshold+1)), PutCommandOptions{})
+		putErr <- err
+	}()
+	<-arrived
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := client.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if err := <-putErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the upload to be canceled, got %v", err)
+	}
+	mu.Lock()
+	if strings.Join(actions, ",") != "create,upload,abort" {
+		t.Errorf("Expected the upload to be aborted after the slow part, got %v", actions)
+	}
+	mu.Unlock()
+	if err := client.Close(context.Background()); err != nil {
+		t.Errorf("Expected Close to succeed once the upload stopped, got %v", err)
+	}
+}
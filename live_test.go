@@ -0,0 +1,120 @@
+package vercelblob_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	vercelblob "github.com/claywarren/vercel_blob"
+	"github.com/claywarren/vercel_blob/testutil"
+)
+
+// The tests of this file run against the store of BLOB_READ_WRITE_TOKEN, in
+// a sandbox prefix deleted when each test ends, and are skipped without it.
+
+func Test_Live_PutWithRandomSuffix(t *testing.T) {
+	sandbox := testutil.NewSandbox(t)
+	ctx := context.Background()
+	content := testutil.Fixture("a.png", 4096)
+
+	put, err := sandbox.Client.Put(ctx, "a.png", bytes.NewReader(content), vercelblob.PutCommandOptions{AddRandomSuffix: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(put.Pathname, sandbox.Pathname("a-")) || !strings.HasSuffix(put.Pathname, ".png") || put.ContentType != "image/png" {
+		t.Errorf("Unexpected put result %+v", put)
+	}
+	head, err := sandbox.Client.Head(ctx, put.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Size != uint64(len(content)) || head.URL != put.URL {
+		t.Errorf("Unexpected head result %+v", head)
+	}
+}
+
+func Test_Live_Copy(t *testing.T) {
+	sandbox := testutil.NewSandbox(t)
+	ctx := context.Background()
+	content := testutil.Fixture("a.txt", 1024)
+
+	source, err := sandbox.Client.Put(ctx, "a.txt", bytes.NewReader(content), vercelblob.PutCommandOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied, err := sandbox.Client.Copy(ctx, source.URL, "b.txt", vercelblob.PutCommandOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copied.Pathname != sandbox.Pathname("b.txt") {
+		t.Errorf("Expected the copy at %s, got %s", sandbox.Pathname("b.txt"), copied.Pathname)
+	}
+	data, err := sandbox.Client.Download(ctx, copied.URL, vercelblob.DownloadCommandOptions{})
+	if err != nil || !bytes.Equal(data, content) {
+		t.Errorf("Expected the copied content, got %d bytes, %v", len(data), err)
+	}
+}
+
+func Test_Live_RangedDownload(t *testing.T) {
+	sandbox := testutil.NewSandbox(t)
+	ctx := context.Background()
+	content := testutil.Fixture("a.txt", 1000)
+
+	put, err := sandbox.Client.Put(ctx, "a.txt", bytes.NewReader(content), vercelblob.PutCommandOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, byteRange := range []vercelblob.Range{{Start: 0, End: 4}, {Start: 100, End: 199}, {Start: 990, End: 999}} {
+		data, err := sandbox.Client.Download(ctx, put.URL, vercelblob.DownloadCommandOptions{ByteRange: &byteRange})
+		if err != nil || !bytes.Equal(data, content[byteRange.Start:byteRange.End+1]) {
+			t.Errorf("Expected bytes %d-%d, got %d bytes, %v", byteRange.Start, byteRange.End, len(data), err)
+		}
+	}
+}
+
+func Test_Live_Multipart(t *testing.T) {
+	sandbox := testutil.NewSandbox(t)
+	ctx := context.Background()
+	content := testutil.Fixture("big.bin", 2*vercelblob.MultipartThreshold+123)
+
+	put, err := sandbox.Client.Put(ctx, "big.bin", bytes.NewReader(content), vercelblob.PutCommandOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !put.Stats.UsedMultipart {
+		t.Error("Expected a multipart upload")
+	}
+	head, err := sandbox.Client.Head(ctx, "big.bin")
+	if err != nil || head.Size != uint64(len(content)) {
+		t.Fatalf("Expected %d bytes, got %+v, %v", len(content), head, err)
+	}
+	data, err := sandbox.Client.Download(ctx, put.URL, vercelblob.DownloadCommandOptions{})
+	if err != nil || !bytes.Equal(data, content) {
+		t.Errorf("Expected the uploaded content, got %d bytes, %v", len(data), err)
+	}
+	// A range across the boundary of the first two parts.
+	boundary := uint(vercelblob.MultipartThreshold)
+	data, err = sandbox.Client.Download(ctx, put.URL, vercelblob.DownloadCommandOptions{ByteRange: &vercelblob.Range{Start: boundary - 10, End: boundary + 9}})
+	if err != nil || !bytes.Equal(data, content[boundary-10:boundary+10]) {
+		t.Errorf("Expected the bytes around the part boundary, got %d bytes, %v", len(data), err)
+	}
+}
+
+func Test_Live_List(t *testing.T) {
+	sandbox := testutil.NewSandbox(t)
+	ctx := context.Background()
+
+	for _, name := range []string{"a.txt", "dir/b.txt", "dir/c.txt"} {
+		if _, err := sandbox.Client.Put(ctx, name, bytes.NewReader(testutil.Fixture(name, 10)), vercelblob.PutCommandOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	result, err := sandbox.Client.List(ctx, vercelblob.ListCommandOptions{Prefix: "dir/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Blobs) != 2 || result.Blobs[0].PathName != "dir/b.txt" || result.Blobs[1].PathName != "dir/c.txt" {
+		t.Errorf("Unexpected blobs %+v", result.Blobs)
+	}
+}
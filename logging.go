@@ -0,0 +1,159 @@
+package vercelblob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WithLogger logs every request attempt of the client to logger, including
+// retries and each request of a multipart upload, with its operation,
+// pathname, status, duration and sizes, as well as the lifecycle of
+// multipart uploads and the cause and delay of each retry of WithRetry.
+// Entries are logged at slog.LevelDebug unless changed with WithLogLevel.
+// Headers are not logged, and tokens are redacted from pathnames and URLs. A
+// nil logger disables logging, which is the default.
+func WithLogger(logger *slog.Logger) ClientOption {
+	return func(c *Client) error {
+		c.logger = logger
+		return nil
+	}
+}
+
+// WithLogLevel sets the level of the entries logged by WithLogger.
+func WithLogLevel(level slog.Level) ClientOption {
+	return func(c *Client) error {
+		c.logLevel = level
+		return nil
+	}
+}
+
+// logEnabled reports whether the client logs at its level, so that callers
+// build attributes only when they are needed.
+func (c *Client) logEnabled(ctx context.Context) bool {
+	return c.logger != nil && c.logger.Enabled(ctx, c.logLevel)
+}
+
+// logRequests logs each request sent through next.
+func (c *Client) logRequests(next RoundTripFunc) RoundTripFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		ctx := req.Context()
+		if !c.logEnabled(ctx) {
+			return next(req)
+		}
+		start := time.Now()
+		resp, err := next(req)
+
+		token := requestToken(req)
+		info, _ := RequestInfoFromContext(ctx)
+		attrs := []slog.Attr{
+			slog.String("operation", string(info.Operation)),
+			slog.String("pathname", redactTokens(info.Pathname, token)),
+			slog.String("method", req.Method),
+			slog.String("url", redactTokens(req.URL.Redacted(), token)),
+			slog.Duration("duration", time.Since(start)),
+			slog.Int64("request_bytes", req.ContentLength),
+		}
+		if err != nil {
+			attrs = append(attrs, slog.String("error", redactTokens(err.Error(), token)))
+		} else {
+			attrs = append(attrs, slog.Int("status", resp.StatusCode), slog.Int64("response_bytes", resp.ContentLength))
+		}
+		c.logger.LogAttrs(ctx, c.logLevel, "blob request", attrs...)
+		return resp, err
+	}
+}
+
+// logMultipart logs an event in the lifecycle of a multipart upload.
+func (c *Client) logMultipart(ctx context.Context, msg, pathname, uploadID string, attrs ...slog.Attr) {
+	if !c.logEnabled(ctx) {
+		return
+	}
+	attrs = append([]slog.Attr{slog.String("pathname", pathname), slog.String("upload_id", uploadID)}, attrs...)
+	c.logger.LogAttrs(ctx, c.logLevel, msg, attrs...)
+}
+
+// WithSlowRequestThreshold makes the client log a warning to the logger of
+// WithLogger for every request that takes longer than d, such as a head, a
+// download or one part of a multipart upload. The duration runs until the
+// response body is closed, so it includes retries and the reading of the
+// body. The entry carries the operation, pathname, duration, status, number
+// of attempts and request ID, and is logged at slog.LevelWarn whatever the
+// level of WithLogLevel. Zero, the default, disables the warnings.
+func WithSlowRequestThreshold(d time.Duration) ClientOption {
+	return func(c *Client) error {
+		if d < 0 {
+			return NewInvalidOptionError("WithSlowRequestThreshold", fmt.Sprintf("threshold %v is a negative duration", d))
+		}
+		c.slowThreshold = d
+		return nil
+	}
+}
+
+type slowRequestKey struct{}
+
+// slowRequest measures a request for WithSlowRequestThreshold.
+type slowRequest struct {
+	c         *Client
+	req       *http.Request
+	operation Operation
+	pathname  string
+	start     time.Time
+	attempts  atomic.Int64
+	once      sync.Once
+}
+
+// watchSlowRequest starts measuring req, if slow requests are logged. The
+// returned request counts its attempts.
+func (c *Client) watchSlowRequest(req *http.Request, operation Operation, pathname string) (*http.Request, *slowRequest) {
+	if c.slowThreshold <= 0 || c.logger == nil || !c.logger.Enabled(req.Context(), slog.LevelWarn) {
+		return req, nil
+	}
+	s := &slowRequest{c: c, operation: operation, pathname: pathname, start: time.Now()}
+	s.req = req.WithContext(context.WithValue(req.Context(), slowRequestKey{}, s))
+	return s.req, s
+}
+
+// countAttempt counts an attempt of the request of ctx, if it is measured.
+func countAttempt(ctx context.Context) {
+	if s, ok := ctx.Value(slowRequestKey{}).(*slowRequest); ok {
+		s.attempts.Add(1)
+	}
+}
+
+// finish logs the request if it was slow. resp is its response, or nil if
+// it failed with err. s may be nil.
+func (s *slowRequest) finish(resp *http.Response, err error) {
+	if s == nil {
+		return
+	}
+	s.once.Do(func() {
+		duration := time.Since(s.start)
+		if duration <= s.c.slowThreshold {
+			return
+		}
+		token := requestToken(s.req)
+		attrs := []slog.Attr{
+			slog.String("operation", string(s.operation)),
+			slog.String("pathname", redactTokens(s.pathname, token)),
+			slog.Duration("duration", duration),
+			slog.Duration("threshold", s.c.slowThreshold),
+			slog.Int64("attempts", s.attempts.Load()),
+		}
+		if err != nil {
+			attrs = append(attrs, slog.String("error", redactTokens(err.Error(), token)))
+			var apiErr *APIError
+			if errors.As(err, &apiErr) {
+				attrs = append(attrs, slog.Int("status", apiErr.StatusCode), slog.String("request_id", apiErr.RequestID))
+			}
+		} else {
+			attrs = append(attrs, slog.Int("status", resp.StatusCode), slog.String("request_id", responseRequestID(resp)))
+		}
+		s.c.logger.LogAttrs(s.req.Context(), slog.LevelWarn, "blob slow request", attrs...)
+	})
+}
@@ -0,0 +1,188 @@
+package vercelblob
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_WithLogger_Mock(t *testing.T) {
+	var parts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		if r.Header.Get("X-MPU-Action") == "upload" {
+			if parts++; parts == 2 {
+				w.WriteHeader(http.StatusInternalServerError)
+				_, _ = w.Write([]byte(`{"error":{"code":"internal","message":"boom"}}`))
+				return
+			}
+		}
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.bin","pathname":"a.bin","uploadId":"upload-1","key":"key"}`))
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider(testReadWriteToken)), WithLogger(logger))
+	ctx := context.Background()
+
+	if _, err := client.Head(ctx, "a.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Put(ctx, "a.bin", bytes.NewReader(make([]byte, MultipartThreshold+1)), PutCommandOptions{}); err == nil {
+		t.Fatal("Expected the failed part to fail the upload")
+	}
+
+	var messages []string
+	var entries []map[string]any
+	for line := range strings.Lines(buf.String()) {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry["level"] != "DEBUG" {
+			t.Errorf("Expected debug entries, got %v", entry["level"])
+		}
+		entries = append(entries, entry)
+		messages = append(messages, entry["msg"].(string)+" "+toString(entry["operation"])+toString(entry["upload_id"]))
+	}
+	want := []string{
+		"blob request head",
+		"blob request multipart-create",
+		"multipart upload created upload-1",
+		"blob request multipart-part",
+		"multipart part uploaded upload-1",
+		"blob request multipart-part",
+		"multipart upload aborted upload-1",
+		"blob request multipart-abort",
+	}
+	if strings.Join(messages, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(messages, "\n"))
+	}
+	head := entries[0]
+	if head["pathname"] != "a.bin" || head["status"] != float64(http.StatusOK) || head["method"] != http.MethodGet {
+		t.Errorf("Unexpected head entry: %v", head)
+	}
+	if _, ok := head["duration"]; !ok {
+		t.Errorf("Expected a duration, got %v", head)
+	}
+	if entries[3]["request_bytes"] != float64(MultipartThreshold) {
+		t.Errorf("Expected the part size, got %v", entries[3]["request_bytes"])
+	}
+	if strings.Contains(buf.String(), testReadWriteToken) {
+		t.Error("Expected no token in the log")
+	}
+}
+
+func toString(v any) string {
+	if v == nil {
+		return ""
+	}
+	return v.(string)
+}
+
+func Test_WithLogger_Level_Mock(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"blobs":[]}`))
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	for _, opts := range [][]ClientOption{
+		{WithLogger(logger)},
+		{WithLogger(nil)},
+		{WithLogger(logger), WithLogLevel(slog.LevelInfo)},
+	} {
+		client := newTestClient(t, append(opts, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")))...)
+		if _, err := client.List(context.Background(), ListCommandOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := strings.Count(buf.String(), "blob request"); n != 1 {
+		t.Errorf("Expected only the info entry to be logged, got %d entries:\n%s", n, buf.String())
+	}
+}
+
+func Test_WithSlowRequestThreshold_Mock(t *testing.T) {
+	var heads atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.Header().Set("X-Vercel-Id", "iad1::slow")
+		switch {
+		case r.URL.Path == "/slow.txt":
+			// The headers arrive at once, the body late.
+			_, _ = w.Write([]byte("a"))
+			w.(http.Flusher).Flush()
+			time.Sleep(60 * time.Millisecond)
+			_, _ = w.Write([]byte("b"))
+		case r.URL.Query().Get("url") == "retried.txt" && heads.Add(1) == 1:
+			time.Sleep(40 * time.Millisecond)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			_, _ = w.Write([]byte(`{"url":"https://blob.com/a.txt","pathname":"a.txt"}`))
+		}
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	client := newTestClient(t,
+		WithBaseURL(server.URL),
+		WithTokenProvider(StaticTokenProvider(testReadWriteToken)),
+		WithLogger(logger),
+		WithRetry(RetryPolicy{MaxAttempts: 2, BaseDelay: 20 * time.Millisecond}),
+		WithSlowRequestThreshold(50*time.Millisecond),
+	)
+	ctx := context.Background()
+
+	if _, err := client.Head(ctx, "fast.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Head(ctx, "retried.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Download(ctx, server.URL+"/slow.txt", DownloadCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var entries []map[string]any
+	for line := range strings.Lines(buf.String()) {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected the two slow requests to be logged, got %s", buf.String())
+	}
+	for i, want := range []struct {
+		operation, pathname string
+		attempts            float64
+	}{
+		{"head", "retried.txt", 2},
+		{"download", server.URL + "/slow.txt", 1},
+	} {
+		entry := entries[i]
+		if entry["level"] != "WARN" || entry["msg"] != "blob slow request" || entry["operation"] != want.operation || entry["pathname"] != want.pathname ||
+			entry["attempts"] != want.attempts || entry["status"] != float64(http.StatusOK) || entry["request_id"] != "iad1::slow" {
+			t.Errorf("Unexpected entry %v", entry)
+		}
+		if d, _ := entry["duration"].(float64); time.Duration(d) <= 50*time.Millisecond {
+			t.Errorf("Expected a duration above the threshold, got %v", entry["duration"])
+		}
+	}
+
+	if _, err := NewClientWithOptions(WithSlowRequestThreshold(-time.Second)); CodeOf(err) != "invalid_option" {
+		t.Errorf("Expected a negative threshold to be rejected, got %v", err)
+	}
+}
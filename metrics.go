@@ -0,0 +1,216 @@
+package vercelblob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Codes recorded by a MetricsRecorder besides the codes of *Error.
+const (
+	// MetricsCodeOK is the code of requests answered with a success.
+	MetricsCodeOK = "ok"
+	// MetricsCodeTransportError is the code of requests that failed in
+	// transit.
+	MetricsCodeTransportError = "transport_error"
+	// MetricsCodeCanceled is the code of requests whose context ended.
+	MetricsCodeCanceled = "canceled"
+)
+
+// MetricsRecorder receives the metrics of a client; see WithMetrics. Its
+// methods are called synchronously on the request path, possibly
+// concurrently, so they must be cheap and safe for concurrent use.
+type MetricsRecorder interface {
+	// RecordRequest records a request sent for operation. code is
+	// MetricsCodeOK, MetricsCodeTransportError, MetricsCodeCanceled or the
+	// Code of the error the API answered with, such as "not_found".
+	// duration is the time until the response headers arrived; bytesIn is
+	// the size of the response body read, and bytesOut the size of the
+	// request body, if known.
+	RecordRequest(operation Operation, code string, duration time.Duration, bytesIn, bytesOut int64)
+	// RecordRetry records a retry of WithRetry of a request sent for
+	// operation.
+	RecordRetry(operation Operation)
+	// RecordMultipartPart records an uploaded part of a multipart upload,
+	// with its size and the time it took, including retries.
+	RecordMultipartPart(partNumber int, size int64, duration time.Duration)
+}
+
+// HedgeRecorder is implemented by a MetricsRecorder that counts the
+// duplicate requests of WithHedging.
+type HedgeRecorder interface {
+	RecordHedge(operation Operation)
+}
+
+// WithMetrics makes the client report its traffic to recorder: every
+// request it sends, including each part of a multipart upload, retries,
+// hedges and the resending of a request after its token was rejected, as
+// well as the retries and uploaded parts themselves. A nil recorder, the
+// default, records nothing at no cost.
+func WithMetrics(recorder MetricsRecorder) ClientOption {
+	return func(c *Client) error {
+		c.metrics = recorder
+		return nil
+	}
+}
+
+// recordRequests records the metrics of each request sent through next.
+func (c *Client) recordRequests(next RoundTripFunc) RoundTripFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		start := time.Now()
+		resp, err := next(req)
+		duration := time.Since(start)
+		info, _ := RequestInfoFromContext(req.Context())
+		bytesOut := max(req.ContentLength, 0)
+		switch {
+		case err != nil:
+			c.metrics.RecordRequest(info.Operation, metricsErrorCode(req.Context(), err), duration, 0, bytesOut)
+		case resp.StatusCode >= http.StatusBadRequest:
+			// peekAPIError reads the body, so ContentLength is then the
+			// number of bytes read, even for a chunked response.
+			code := c.peekAPIError(resp).Err.Code
+			c.metrics.RecordRequest(info.Operation, code, duration, max(resp.ContentLength, 0), bytesOut)
+		default:
+			resp.Body = &metricsBody{ReadCloser: resp.Body, record: func(bytesIn int64) {
+				c.metrics.RecordRequest(info.Operation, MetricsCodeOK, duration, bytesIn, bytesOut)
+			}}
+		}
+		return resp, err
+	}
+}
+
+// metricsErrorCode returns the code recorded for a request that failed with
+// err.
+func metricsErrorCode(ctx context.Context, err error) string {
+	if ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return MetricsCodeCanceled
+	}
+	if code := CodeOf(err); code != "" {
+		return code
+	}
+	return MetricsCodeTransportError
+}
+
+// metricsBody counts the bytes read from a response body and records the
+// request once the body is closed.
+type metricsBody struct {
+	io.ReadCloser
+	read   int64
+	once   sync.Once
+	record func(bytesIn int64)
+}
+
+func (b *metricsBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	return n, err
+}
+
+func (b *metricsBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.record(b.read) })
+	return err
+}
+
+// recordHedge reports a hedge to the metrics recorder, if it counts them.
+func (c *Client) recordHedge(operation Operation) {
+	if recorder, ok := c.metrics.(HedgeRecorder); ok {
+		recorder.RecordHedge(operation)
+	}
+}
+
+// OperationMetrics are the metrics of the requests of one operation.
+type OperationMetrics struct {
+	Requests int64
+	// Codes counts the requests by code; see MetricsRecorder.
+	Codes map[string]int64
+	// Duration is the total duration of the requests, and MaxDuration the
+	// longest.
+	Duration, MaxDuration time.Duration
+	BytesIn, BytesOut     int64
+	Retries               int64
+	Hedges                int64
+}
+
+// MetricsSnapshot is a copy of the metrics of an InMemoryMetrics.
+type MetricsSnapshot struct {
+	Operations map[Operation]OperationMetrics
+	// Parts is the number of uploaded parts of multipart uploads,
+	// PartBytes their total size and PartDuration the total time they took.
+	Parts        int64
+	PartBytes    int64
+	PartDuration time.Duration
+}
+
+// InMemoryMetrics is a MetricsRecorder and HedgeRecorder that keeps totals
+// in memory, e.g. for tests or a debug page. The zero value is ready to use.
+type InMemoryMetrics struct {
+	mu       sync.Mutex
+	snapshot MetricsSnapshot
+}
+
+// operation returns the metrics of operation for an update. m.mu must be
+// held.
+func (m *InMemoryMetrics) operation(operation Operation) OperationMetrics {
+	if m.snapshot.Operations == nil {
+		m.snapshot.Operations = map[Operation]OperationMetrics{}
+	}
+	return m.snapshot.Operations[operation]
+}
+
+func (m *InMemoryMetrics) RecordRequest(operation Operation, code string, duration time.Duration, bytesIn, bytesOut int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	metrics := m.operation(operation)
+	metrics.Requests++
+	if metrics.Codes == nil {
+		metrics.Codes = map[string]int64{}
+	}
+	metrics.Codes[code]++
+	metrics.Duration += duration
+	metrics.MaxDuration = max(metrics.MaxDuration, duration)
+	metrics.BytesIn += bytesIn
+	metrics.BytesOut += bytesOut
+	m.snapshot.Operations[operation] = metrics
+}
+
+func (m *InMemoryMetrics) RecordRetry(operation Operation) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	metrics := m.operation(operation)
+	metrics.Retries++
+	m.snapshot.Operations[operation] = metrics
+}
+
+func (m *InMemoryMetrics) RecordHedge(operation Operation) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	metrics := m.operation(operation)
+	metrics.Hedges++
+	m.snapshot.Operations[operation] = metrics
+}
+
+func (m *InMemoryMetrics) RecordMultipartPart(partNumber int, size int64, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snapshot.Parts++
+	m.snapshot.PartBytes += size
+	m.snapshot.PartDuration += duration
+}
+
+// Snapshot returns a copy of the metrics recorded so far.
+func (m *InMemoryMetrics) Snapshot() MetricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snapshot := m.snapshot
+	snapshot.Operations = make(map[Operation]OperationMetrics, len(m.snapshot.Operations))
+	for operation, metrics := range m.snapshot.Operations {
+		metrics.Codes = maps.Clone(metrics.Codes)
+		snapshot.Operations[operation] = metrics
+	}
+	return snapshot
+}
@@ -0,0 +1,143 @@
+package vercelblob
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_WithMetrics_Mock(t *testing.T) {
+	var failList atomic.Bool
+	failList.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		switch {
+		case r.Method == http.MethodGet && r.URL.Query().Get("url") != "":
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":{"code":"not_found","message":"gone"}}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/a.txt":
+			_, _ = w.Write([]byte("hello"))
+		case r.Method == http.MethodGet && failList.Swap(false):
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.Header().Set("ETag", `"etag"`)
+			_, _ = w.Write([]byte(`{"url":"https://blob.com/a.txt","pathname":"a.txt","uploadId":"id","key":"key","blobs":[]}`))
+		}
+	}))
+	defer server.Close()
+	metrics := &InMemoryMetrics{}
+	client := newTestClient(t,
+		WithBaseURL(server.URL),
+		WithTokenProvider(StaticTokenProvider("token")),
+		WithRetry(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}),
+		WithMetrics(metrics),
+	)
+	ctx := context.Background()
+
+	if _, err := client.Put(ctx, "a.txt", strings.NewReader("abc"), PutCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Head(ctx, "a.txt"); !IsNotFound(err) {
+		t.Fatalf("Expected not found, got %v", err)
+	}
+	if _, err := client.List(ctx, ListCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Put(ctx, "a.bin", strings.NewReader(strings.Repeat("a", MultipartThreshold+1)), PutCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := client.Download(ctx, server.URL+"/a.txt", DownloadCommandOptions{}); err != nil || string(data) != "hello" {
+		t.Fatalf("Unexpected download %q, %v", data, err)
+	}
+
+	snapshot := metrics.Snapshot()
+	put := snapshot.Operations[OperationPut]
+	if put.Requests != 1 || put.Codes[MetricsCodeOK] != 1 || put.BytesOut != 3 || put.BytesIn == 0 {
+		t.Errorf("Unexpected put metrics: %+v", put)
+	}
+	if head := snapshot.Operations[OperationHead]; head.Requests != 1 || head.Codes["not_found"] != 1 || head.BytesIn == 0 {
+		t.Errorf("Unexpected head metrics: %+v", head)
+	}
+	list := snapshot.Operations[OperationList]
+	if list.Requests != 2 || list.Codes["unknown_error"] != 1 || list.Codes[MetricsCodeOK] != 1 || list.Retries != 1 || list.Duration <= 0 || list.MaxDuration > list.Duration {
+		t.Errorf("Unexpected list metrics: %+v", list)
+	}
+	if parts := snapshot.Operations[OperationMultipartPart]; parts.Requests != 2 || parts.BytesOut != MultipartThreshold+1 {
+		t.Errorf("Unexpected part metrics: %+v", parts)
+	}
+	if snapshot.Parts != 2 || snapshot.PartBytes != MultipartThreshold+1 || snapshot.PartDuration <= 0 {
+		t.Errorf("Unexpected parts: %+v", snapshot)
+	}
+	if download := snapshot.Operations[OperationDownload]; download.Requests != 1 || download.BytesIn != 5 {
+		t.Errorf("Unexpected download metrics: %+v", download)
+	}
+
+	// A snapshot is a copy.
+	snapshot.Operations[OperationList].Codes["ok"] = 100
+	if metrics.Snapshot().Operations[OperationList].Codes["ok"] != 1 {
+		t.Error("Expected the snapshot to be a copy")
+	}
+}
+
+func Test_WithMetrics_ChunkedError_Mock(t *testing.T) {
+	const body = `{"error":{"code":"not_found","message":"gone"}}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		// Flushing before the body is written sends it chunked, without a
+		// Content-Length.
+		w.WriteHeader(http.StatusNotFound)
+		w.(http.Flusher).Flush()
+		_, _ = w.Write([]byte(body))
+	}))
+	defer server.Close()
+	metrics := &InMemoryMetrics{}
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")), WithMetrics(metrics))
+
+	if _, err := client.Head(context.Background(), "a.txt"); !IsNotFound(err) {
+		t.Fatalf("Expected not found, got %v", err)
+	}
+	if head := metrics.Snapshot().Operations[OperationHead]; head.Codes["not_found"] != 1 || head.BytesIn != int64(len(body)) {
+		t.Errorf("Expected the %d bytes of the chunked body to be counted, got %+v", len(body), head)
+	}
+}
+
+func Test_WithMetrics_Transport(t *testing.T) {
+	metrics := &InMemoryMetrics{}
+	client := newTestClient(t,
+		WithBaseURL(closedPortURL(t)),
+		WithTokenProvider(StaticTokenProvider("token")),
+		WithMetrics(metrics),
+	)
+	_, _ = client.Head(context.Background(), "a.txt")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _ = client.List(ctx, ListCommandOptions{})
+
+	snapshot := metrics.Snapshot()
+	if head := snapshot.Operations[OperationHead]; head.Codes[MetricsCodeTransportError] != 1 {
+		t.Errorf("Expected a transport error, got %+v", head)
+	}
+	if list := snapshot.Operations[OperationList]; list.Codes[MetricsCodeCanceled] != 1 {
+		t.Errorf("Expected a canceled request, got %+v", list)
+	}
+}
+
+func Benchmark_roundTrip_NoMetrics(b *testing.B) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.txt","pathname":"a.txt"}`))
+	}))
+	defer server.Close()
+	client, err := NewClientWithOptions(WithNoEnv(), WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")))
+	if err != nil {
+		b.Fatal(err)
+	}
+	for b.Loop() {
+		if _, err := client.Head(context.Background(), "a.txt"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
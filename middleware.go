@@ -0,0 +1,79 @@
+package vercelblob
+
+import (
+	"context"
+	"net/http"
+	"slices"
+)
+
+// RoundTripFunc sends a request of the client and returns its response.
+type RoundTripFunc func(*http.Request) (*http.Response, error)
+
+// Middleware wraps the sending of every request of a client, e.g. to add
+// headers, record metrics or stamp request IDs. It returns a RoundTripFunc
+// that calls next to send the request, or returns an error to abort the
+// operation with that error.
+type Middleware func(next RoundTripFunc) RoundTripFunc
+
+// RequestInfo describes the operation a request is sent for.
+type RequestInfo struct {
+	Operation Operation
+	// Pathname is the pathname or URL the operation was called with, or the
+	// list prefix for list operations.
+	Pathname string
+}
+
+type requestInfoKey struct{}
+
+// RequestInfoFromContext returns the operation of a request passed to a
+// Middleware, from the context of the request.
+func RequestInfoFromContext(ctx context.Context) (RequestInfo, bool) {
+	info, ok := ctx.Value(requestInfoKey{}).(RequestInfo)
+	return info, ok
+}
+
+// WithMiddleware adds middleware around every request of the client,
+// including each request of a multipart upload and the retry of a request
+// after its token was rejected. The first middleware given is the outermost,
+// so it sees the request first and the response last; middleware added by a
+// later WithMiddleware option wraps inside earlier ones.
+func WithMiddleware(middleware ...Middleware) ClientOption {
+	return func(c *Client) error {
+		for _, mw := range middleware {
+			if mw == nil {
+				return NewInvalidOptionError("WithMiddleware", "a middleware is nil")
+			}
+		}
+		c.middleware = append(slices.Clip(c.middleware), middleware...)
+		return nil
+	}
+}
+
+// withRequestInfo adds the operation of req to its context for middleware.
+func withRequestInfo(req *http.Request, operation Operation, pathname string) *http.Request {
+	ctx := context.WithValue(req.Context(), requestInfoKey{}, RequestInfo{Operation: operation, Pathname: pathname})
+	return req.WithContext(ctx)
+}
+
+// roundTrip sends req through the rate limiter and the middleware of the
+// client.
+func (c *Client) roundTrip(req *http.Request) (*http.Response, error) {
+	info, _ := RequestInfoFromContext(req.Context())
+	if err := c.rateLimits.wait(req.Context(), info.Operation); err != nil {
+		return nil, err
+	}
+	next := c.countTraffic(c.httpClient.Do)
+	if c.debugDump != nil {
+		next = c.dumpRequests(next)
+	}
+	if c.metrics != nil {
+		next = c.recordRequests(next)
+	}
+	if c.logger != nil {
+		next = c.logRequests(next)
+	}
+	for _, middleware := range slices.Backward(c.middleware) {
+		next = middleware(next)
+	}
+	return next(req)
+}
@@ -0,0 +1,100 @@
+package vercelblob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_WithMiddleware_Mock(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Tenant") != "42" {
+			t.Errorf("Expected the tenant header on %s %s", r.Method, r.URL)
+		}
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.Header().Set("X-Request-Id", "req-1")
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.bin","pathname":"a.bin","uploadId":"id","key":"key"}`))
+	}))
+	defer server.Close()
+
+	var calls []string
+	tenant := func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			calls = append(calls, "tenant")
+			req.Header.Set("X-Tenant", "42")
+			return next(req)
+		}
+	}
+	record := func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			info, ok := RequestInfoFromContext(req.Context())
+			if !ok {
+				t.Error("Expected the request info in the context")
+			}
+			resp, err := next(req)
+			if err == nil {
+				calls = append(calls, string(info.Operation)+" "+info.Pathname+" "+resp.Header.Get("X-Request-Id"))
+			}
+			return resp, err
+		}
+	}
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")), WithMiddleware(tenant, record))
+	ctx := context.Background()
+
+	if _, err := client.Put(ctx, "a.bin", bytes.NewReader(make([]byte, MultipartThreshold+1)), PutCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Head(ctx, "a.bin"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"tenant", "multipart-create a.bin req-1",
+		"tenant", "multipart-part a.bin req-1",
+		"tenant", "multipart-part a.bin req-1",
+		"tenant", "multipart-complete a.bin req-1",
+		"tenant", "head a.bin req-1",
+	}
+	if strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected %v, got %v", want, calls)
+	}
+}
+
+func Test_WithMiddleware_Abort_Mock(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte(`{"blobs":[]}`))
+	}))
+	defer server.Close()
+
+	errQuota := errors.New("tenant quota exceeded")
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")), WithMiddleware(func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			if info, _ := RequestInfoFromContext(req.Context()); info.Operation == OperationPut {
+				return nil, errQuota
+			}
+			return next(req)
+		}
+	}))
+	ctx := context.Background()
+
+	if _, err := client.Put(ctx, "a.txt", strings.NewReader("a"), PutCommandOptions{}); !errors.Is(err, errQuota) {
+		t.Errorf("Expected the middleware error, got %v", err)
+	}
+	if _, err := client.List(ctx, ListCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 1 {
+		t.Errorf("Expected only the list request to be sent, got %d", requests)
+	}
+
+	if _, err := NewClientWithOptions(WithMiddleware(nil)); err == nil {
+		t.Error("Expected an error for a nil middleware")
+	}
+}
@@ -5,8 +5,11 @@ import (
 	"context"
 	"encoding/json"
 	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 )
 
 // MultipartThreshold is the minimum size for multipart uploads (5MB).
@@ -17,43 +20,94 @@ type createMultipartUploadResponse struct {
 	Key      string `json:"key"`
 }
 
+func (r *createMultipartUploadResponse) validateResponse() error {
+	switch {
+	case r.UploadID == "":
+		return NewMissingFieldError("uploadId")
+	case r.Key == "":
+		return NewMissingFieldError("key")
+	}
+	return nil
+}
+
 // Part represents a part of a multipart upload.
 type Part struct {
 	ETag       string `json:"etag"`
 	PartNumber int    `json:"partNumber"`
 }
 
+// multipartAbortTimeout bounds the request aborting a failed multipart
+// upload, which is sent on a context of its own since the context of the
+// upload may be done.
+const multipartAbortTimeout = 10 * time.Second
+
 type completeMultipartUploadRequest struct {
 	UploadID string `json:"uploadId"`
 	Key      string `json:"key"`
 	Parts    []Part `json:"parts"`
 }
 
-func (c *Client) putMultipart(ctx context.Context, pathname string, body io.Reader, options PutCommandOptions) (*PutBlobPutResult, error) {
+func (c *Client) putMultipart(ctx context.Context, pathname string, body io.Reader, size int64, options PutCommandOptions) (_ *PutBlobPutResult, uploadID string, err error) {
+	ctx, end, err := c.beginUpload(ctx)
+	if err != nil {
+		return nil, uploadID, err
+	}
+	defer end()
+	if stats := operationStatsFrom(ctx); stats != nil {
+		stats.multipart.Store(true)
+	}
+	auth := &uploadAuth{c: c, pathname: pathname}
+	ctx = contextWithAuthSource(ctx, auth.apply)
+
 	// 1. Create Multipart Upload
-	apiURL := c.getAPIURL("/mpu")
+	apiURL, err := c.getAPIURL("/mpu")
+	if err != nil {
+		return nil, uploadID, err
+	}
+	apiURL += "?" + url.Values{"pathname": {pathname}}.Encode()
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, nil)
 	if err != nil {
-		return nil, err
+		return nil, uploadID, err
 	}
 	c.addAPIVersionHeader(req)
-	_ = c.addAuthorizationHeader(req, "put", pathname)
+	if err = auth.authorize(req, OperationMultipartCreate, size); err != nil {
+		return nil, uploadID, err
+	}
 	c.setPutHeaders(req, options)
 	req.Header.Set("X-MPU-Action", "create")
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req, OperationMultipartCreate, pathname)
 	if err != nil {
-		return nil, err
+		return nil, uploadID, err
 	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, c.handleError(resp)
+		return nil, uploadID, c.handleError(resp)
 	}
 	var createResp createMultipartUploadResponse
-	_ = json.NewDecoder(resp.Body).Decode(&createResp)
+	err = decodeResponse(resp, &createResp)
 	_ = resp.Body.Close()
+	if err != nil {
+		return nil, uploadID, err
+	}
+	uploadID = createResp.UploadID
+	if c.usage != nil {
+		c.usage.uploads.Add(1)
+		defer c.usage.uploads.Add(-1)
+	}
+	c.logMultipart(ctx, "multipart upload created", pathname, uploadID, slog.Int64("size", size))
+	if c.eventListener != nil {
+		c.eventListener(MultipartCreated{EventInfo: c.eventInfo(OperationPut, pathname, uploadID)})
+	}
+	defer func() {
+		if err != nil {
+			c.logMultipart(ctx, "multipart upload aborted", pathname, createResp.UploadID, slog.String("error", err.Error()))
+			c.abortMultipart(ctx, apiURL, pathname, createResp, auth)
+		}
+	}()
 
 	// 2. Upload Parts
 	var parts []Part
+	var sent int64
 	partNumber := 1
 	buffer := make([]byte, MultipartThreshold)
 	for {
@@ -61,33 +115,44 @@ func (c *Client) putMultipart(ctx context.Context, pathname string, body io.Read
 		if n > 0 {
 			req, err := http.NewRequestWithContext(ctx, http.MethodPut, apiURL, bytes.NewReader(buffer[:n]))
 			if err != nil {
-				return nil, err
+				return nil, uploadID, err
 			}
 			c.addAPIVersionHeader(req)
-			_ = c.addAuthorizationHeader(req, "put", pathname)
+			if err = auth.authorize(req, OperationMultipartPart, size-sent); err != nil {
+				return nil, uploadID, err
+			}
 			req.Header.Set("X-MPU-Action", "upload")
 			req.Header.Set("X-MPU-Upload-Id", createResp.UploadID)
 			req.Header.Set("X-MPU-Key", createResp.Key)
 			req.Header.Set("X-MPU-Part-Number", strconv.Itoa(partNumber))
 
-			resp, err := c.httpClient.Do(req)
+			start := time.Now()
+			resp, err := c.do(req, OperationMultipartPart, pathname)
 			if err != nil {
-				return nil, err
+				return nil, uploadID, err
 			}
 			if resp.StatusCode != http.StatusOK {
-				return nil, c.handleError(resp)
+				return nil, uploadID, c.handleError(resp)
 			}
 			etag := resp.Header.Get("ETag")
 			_ = resp.Body.Close()
+			if c.metrics != nil {
+				c.metrics.RecordMultipartPart(partNumber, int64(n), time.Since(start))
+			}
 
 			parts = append(parts, Part{ETag: etag, PartNumber: partNumber})
+			c.logMultipart(ctx, "multipart part uploaded", pathname, uploadID, slog.Int("part_number", partNumber), slog.Int("bytes", n))
+			if c.eventListener != nil {
+				c.eventListener(PartUploaded{EventInfo: c.eventInfo(OperationPut, pathname, uploadID), PartNumber: partNumber, Size: int64(n)})
+			}
 			partNumber++
+			sent += int64(n)
 		}
 		if err == io.EOF || err == io.ErrUnexpectedEOF {
 			break
 		}
 		if err != nil {
-			return nil, err
+			return nil, uploadID, err
 		}
 	}
 
@@ -99,19 +164,53 @@ func (c *Client) putMultipart(ctx context.Context, pathname string, body io.Read
 	})
 	req, _ = http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewReader(completeReq))
 	c.addAPIVersionHeader(req)
-	_ = c.addAuthorizationHeader(req, "put", pathname)
+	if err = auth.authorize(req, OperationMultipartComplete, 0); err != nil {
+		return nil, uploadID, err
+	}
 	req.Header.Set("X-MPU-Action", "complete")
 
-	resp, err = c.httpClient.Do(req)
+	resp, err = c.do(req, OperationMultipartComplete, pathname)
 	if err != nil {
-		return nil, err
+		return nil, uploadID, err
 	}
 	defer func() { _ = resp.Body.Close() }()
 	if resp.StatusCode != http.StatusOK {
-		return nil, c.handleError(resp)
+		return nil, uploadID, c.handleError(resp)
 	}
 
 	var result PutBlobPutResult
-	_ = json.NewDecoder(resp.Body).Decode(&result)
-	return &result, nil
+	if err = decodeResponse(resp, &result); err != nil {
+		return nil, uploadID, err
+	}
+	c.logMultipart(ctx, "multipart upload completed", pathname, createResp.UploadID, slog.Int("parts", len(parts)))
+	return &result, uploadID, nil
+}
+
+// abortMultipart asks the API to drop a multipart upload that failed, with
+// the parts sent so far. It is sent even if ctx is done, e.g. when Close
+// gives up waiting for the upload; its failure is only logged.
+func (c *Client) abortMultipart(ctx context.Context, apiURL, pathname string, upload createMultipartUploadResponse, auth *uploadAuth) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), multipartAbortTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, nil)
+	if err != nil {
+		return
+	}
+	c.addAPIVersionHeader(req)
+	if err = auth.authorize(req, OperationMultipartAbort, 0); err == nil {
+		req.Header.Set("X-MPU-Action", "abort")
+		req.Header.Set("X-MPU-Upload-Id", upload.UploadID)
+		req.Header.Set("X-MPU-Key", upload.Key)
+		var resp *http.Response
+		if resp, err = c.do(req, OperationMultipartAbort, pathname); err == nil {
+			if resp.StatusCode != http.StatusOK {
+				err = c.handleError(resp)
+			} else {
+				_ = resp.Body.Close()
+			}
+		}
+	}
+	if err != nil {
+		c.logMultipart(ctx, "multipart upload abort failed", pathname, upload.UploadID, slog.String("error", err.Error()))
+	}
 }
@@ -0,0 +1,320 @@
+package vercelblob
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ClientOption configures a client created with NewClientWithOptions.
+type ClientOption func(*Client) error
+
+// NewClientWithOptions creates a new client configured by opts. Settings that
+// are not given fall back to the environment variables read by NewClient.
+// It returns an invalid_option error if an option is given an invalid value.
+//
+//	client, err := NewClientWithOptions(
+//		WithTokenProvider(provider),
+//		WithTimeout(30*time.Second),
+//	)
+func NewClientWithOptions(opts ...ClientOption) (*Client, error) {
+	c := &Client{
+		baseHTTPClient:    &http.Client{Transport: defaultTransport},
+		tokenRefresh:      newTokenRefreshGuard(defaultTokenRefreshCooldown),
+		userAgent:         DefaultUserAgent,
+		idempotencyHeader: DefaultIdempotencyHeader,
+		retryHook:         &retryHook{},
+		operationTimeouts: defaultOperationTimeouts(),
+		logLevel:          slog.LevelDebug,
+		lifecycle:         newLifecycle(),
+		usage:             &usageCounters{},
+	}
+	if err := c.applyOptions(opts); err != nil {
+		return nil, err
+	}
+	if c.noEnv {
+		c.baseURL = cmp.Or(c.baseURL, DefaultBaseURL)
+		c.apiVersion = cmp.Or(c.apiVersion, BlobAPIVersion)
+	} else {
+		c.baseURL = cmp.Or(c.baseURL, getEnv("VERCEL_BLOB_API_URL", getEnv("NEXT_PUBLIC_VERCEL_BLOB_API_URL", DefaultBaseURL)))
+		c.apiVersion = cmp.Or(c.apiVersion, getEnv("VERCEL_BLOB_API_VERSION", BlobAPIVersion))
+	}
+	return c, nil
+}
+
+// Clone returns a copy of the client with opts applied on top of its
+// configuration, e.g. a different token provider or timeout for one tenant.
+// The copy keeps the token provider, HTTP client, timeouts, token renewal and
+// audit hook of c unless opts replace them, and shares its HTTP client, and
+// so its connections, unless opts change the HTTP client, timeout or
+// transport. It gets its own head cache, if enabled, so that results are not
+// shared between token providers, and its own circuit breaker and Stats
+// counters. c is not modified, and both clients remain safe for concurrent
+// use.
+//
+// Like NewClientWithOptions, Clone returns an invalid_option error if an
+// option is given an invalid value.
+func (c *Client) Clone(opts ...ClientOption) (*Client, error) {
+	clone := *c
+	clone.operationTimeouts = maps.Clone(c.operationTimeouts)
+	clone.lifecycle = newLifecycle()
+	clone.usage = &usageCounters{}
+	if c.tokenRefresh != nil {
+		clone.tokenRefresh = newTokenRefreshGuard(c.tokenRefresh.cooldown)
+	}
+	if c.retryHook != nil {
+		clone.retryHook = &retryHook{fn: c.retryHook.fn}
+	}
+	if c.failover != nil {
+		clone.failover = newFailover(c.failover.endpoints)
+	}
+	if c.breaker != nil {
+		clone.breaker = newCircuitBreaker(c.breaker.threshold, c.breaker.window, c.breaker.cooldown)
+	}
+	if c.headCache != nil {
+		clone.headCache = newHeadCache(c.headCache.ttl, c.headCache.maxEntries)
+	}
+	if c.authAudit != nil {
+		clone.authAudit = &authAudit{fn: c.authAudit.fn}
+	}
+	if err := clone.applyOptions(opts); err != nil {
+		return nil, err
+	}
+	return &clone, nil
+}
+
+// applyOptions applies opts to c. Options that affect the HTTP client reset
+// c.httpClient, which is then rebuilt from c.baseHTTPClient.
+func (c *Client) applyOptions(opts []ClientOption) error {
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if err := opt(c); err != nil {
+			return err
+		}
+	}
+	if c.noEnv && c.tokenProvider == nil {
+		return NewInvalidOptionError("WithNoEnv", "no token provider is set; use WithTokenProvider")
+	}
+	if c.httpClient != nil {
+		return nil
+	}
+	c.httpClient = c.baseHTTPClient
+	if c.timeout > 0 || c.transport != nil {
+		// Copy the HTTP client so that one passed to WithHTTPClient is not modified.
+		httpClient := *c.baseHTTPClient
+		if c.timeout > 0 {
+			httpClient.Timeout = c.timeout
+		}
+		if c.transport != nil {
+			httpClient.Transport = c.transport
+		}
+		c.httpClient = &httpClient
+	}
+	return nil
+}
+
+// WithNoEnv makes the client ignore the environment variables read by
+// NewClient, so that its whole configuration is given as options. The base
+// URL and API version default to DefaultBaseURL and BlobAPIVersion instead,
+// and a token provider must be set with WithTokenProvider; without one,
+// NewClientWithOptions fails instead of reading BLOB_READ_WRITE_TOKEN on the
+// first request.
+func WithNoEnv() ClientOption {
+	return func(c *Client) error {
+		c.noEnv = true
+		return nil
+	}
+}
+
+// WithBaseURL sets the URL of the blob API, e.g. the URL of an
+// httptest.Server in tests. Unlike the VERCEL_BLOB_API_URL environment
+// variable it only affects this client, so tests using it can run in
+// parallel. It must be an absolute http or https URL without a query string
+// or fragment.
+func WithBaseURL(baseURL string) ClientOption {
+	return func(c *Client) error {
+		if _, err := parseBaseURL("WithBaseURL", baseURL); err != nil {
+			return err
+		}
+		c.baseURL = baseURL
+		c.failover = nil
+		return nil
+	}
+}
+
+// parseBaseURL parses a base URL given to option.
+func parseBaseURL(option, baseURL string) (*url.URL, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, NewInvalidOptionError(option, fmt.Sprintf("%q is not an absolute http or https URL", baseURL))
+	}
+	if u.RawQuery != "" || u.ForceQuery || u.Fragment != "" || strings.Contains(baseURL, "#") {
+		return nil, NewInvalidOptionError(option, fmt.Sprintf("%q has a query string or fragment", baseURL))
+	}
+	return u, nil
+}
+
+// WithHTTPClient sets the HTTP client used to send every request of the
+// client, including the parts of multipart uploads and downloads. Redirects,
+// cookies and timeouts follow the settings of httpClient; WithTimeout and
+// WithTransport override its Timeout and Transport on a copy. Without them, an
+// httpClient with a nil Transport uses http.DefaultTransport rather than
+// DefaultTransport.
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(c *Client) error {
+		if httpClient == nil {
+			return NewInvalidOptionError("WithHTTPClient", "the HTTP client is nil")
+		}
+		c.baseHTTPClient = httpClient
+		c.httpClient = nil
+		return nil
+	}
+}
+
+// WithTransport sets the http.RoundTripper of the client's HTTP client, e.g.
+// to route requests through a proxy, customize TLS or add tracing.
+func WithTransport(transport http.RoundTripper) ClientOption {
+	return func(c *Client) error {
+		if transport == nil {
+			return NewInvalidOptionError("WithTransport", "the transport is nil")
+		}
+		c.transport = transport
+		c.httpClient = nil
+		return nil
+	}
+}
+
+// WithAPIVersion sets the version of the blob API sent with every request.
+// Defaults to BlobAPIVersion.
+func WithAPIVersion(version string) ClientOption {
+	return func(c *Client) error {
+		if version == "" {
+			return NewInvalidOptionError("WithAPIVersion", "the version is empty")
+		}
+		c.apiVersion = version
+		return nil
+	}
+}
+
+// WithTokenProvider sets the provider of the tokens that authenticate
+// requests. Without it, the BLOB_READ_WRITE_TOKEN environment variable is used.
+func WithTokenProvider(provider TokenProvider) ClientOption {
+	return func(c *Client) error {
+		if provider == nil {
+			return NewInvalidOptionError("WithTokenProvider", "the provider is nil")
+		}
+		c.tokenProvider = provider
+		return nil
+	}
+}
+
+// WithTimeout sets the time limit of each request made by the client,
+// including reading the response body, as http.Client.Timeout does.
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) error {
+		if timeout <= 0 {
+			return NewInvalidOptionError("WithTimeout", fmt.Sprintf("%v is not a positive duration", timeout))
+		}
+		c.timeout = timeout
+		c.httpClient = nil
+		return nil
+	}
+}
+
+// WithDefaultHeaders adds headers to every request of the client, including
+// each request of a multipart upload and downloads, e.g. a header required by
+// a gateway. Headers set by an operation take precedence. Authorization,
+// x-api-version and the X-MPU-* headers of multipart uploads cannot be set.
+// Calling it again adds to the headers given before.
+func WithDefaultHeaders(headers map[string]string) ClientOption {
+	return func(c *Client) error {
+		defaultHeaders := c.defaultHeaders.Clone()
+		if defaultHeaders == nil {
+			defaultHeaders = http.Header{}
+		}
+		for name, value := range headers {
+			key := http.CanonicalHeaderKey(name)
+			if isClientHeader(key) {
+				return NewInvalidOptionError("WithDefaultHeaders", fmt.Sprintf("the %s header is set by the client", name))
+			}
+			defaultHeaders.Set(key, value)
+		}
+		c.defaultHeaders = defaultHeaders
+		return nil
+	}
+}
+
+// isClientHeader reports whether the header named key, in canonical form, is
+// set by the client alone.
+func isClientHeader(key string) bool {
+	return key == "Authorization" || key == "X-Api-Version" || strings.HasPrefix(key, "X-Mpu-")
+}
+
+// WithHeaderInjector makes the client call inject with the context of the
+// operation and the headers of every request it sends, including each
+// request of a multipart upload and downloads, e.g. to add a traceparent
+// header derived from the context. inject runs after the default headers
+// are added and before the request is sent, once per request of an
+// operation, not once per retry. Changes it makes to Authorization,
+// x-api-version and the X-MPU-* headers of multipart uploads are undone.
+// A nil inject removes the injector.
+func WithHeaderInjector(inject func(ctx context.Context, h http.Header)) ClientOption {
+	return func(c *Client) error {
+		c.headerInjector = inject
+		return nil
+	}
+}
+
+// injectHeaders calls the header injector, if any, on the headers of req,
+// keeping the headers set by the client alone.
+func (c *Client) injectHeaders(req *http.Request) {
+	if c.headerInjector == nil {
+		return
+	}
+	kept := http.Header{}
+	for key, values := range req.Header {
+		if isClientHeader(key) {
+			kept[key] = values
+		}
+	}
+	c.headerInjector(req.Context(), req.Header)
+	for key := range req.Header {
+		if isClientHeader(http.CanonicalHeaderKey(key)) {
+			delete(req.Header, key)
+		}
+	}
+	maps.Copy(req.Header, kept)
+}
+
+// WithUserAgent replaces the User-Agent header sent with every request,
+// which defaults to DefaultUserAgent.
+func WithUserAgent(userAgent string) ClientOption {
+	return func(c *Client) error {
+		if userAgent == "" {
+			return NewInvalidOptionError("WithUserAgent", "the user agent is empty")
+		}
+		c.userAgent = userAgent
+		return nil
+	}
+}
+
+// WithUserAgentSuffix appends a product token such as "my-app/1.0" to the
+// User-Agent header, so that traffic is attributed to both the application
+// and this package.
+func WithUserAgentSuffix(suffix string) ClientOption {
+	return func(c *Client) error {
+		if suffix == "" {
+			return NewInvalidOptionError("WithUserAgentSuffix", "the suffix is empty")
+		}
+		c.userAgent += " " + suffix
+		return nil
+	}
+}
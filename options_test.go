@@ -0,0 +1,374 @@
+package vercelblob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_NewClientWithOptions_Mock(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("User-Agent"); got != "my-app/1.0" {
+			t.Errorf("Expected User-Agent my-app/1.0, got %s", got)
+		}
+		if got := r.Header.Get("x-api-version"); got != "10" {
+			t.Errorf("Expected API version 10, got %s", got)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer option-token" {
+			t.Errorf("Expected Bearer option-token, got %s", got)
+		}
+		_, _ = w.Write([]byte(`{"blobs":[]}`))
+	}))
+	defer server.Close()
+
+	httpClient := &http.Client{}
+	client, err := NewClientWithOptions(
+		WithBaseURL(server.URL),
+		WithHTTPClient(httpClient),
+		WithAPIVersion("10"),
+		WithTokenProvider(StaticTokenProvider("option-token")),
+		WithTimeout(time.Minute),
+		WithUserAgent("my-app/1.0"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.List(context.Background(), ListCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if client.BaseURL() != server.URL {
+		t.Errorf("Expected base URL %s, got %s", server.URL, client.BaseURL())
+	}
+	if client.httpClient.Timeout != time.Minute || httpClient.Timeout != 0 {
+		t.Errorf("Expected the timeout on a copy of the HTTP client, got %v and %v", client.httpClient.Timeout, httpClient.Timeout)
+	}
+}
+
+// countingTransport counts the requests it sends and tags them with a header.
+type countingTransport struct {
+	requests []string
+}
+
+func (ct *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	action := req.Header.Get("X-MPU-Action")
+	if action == "" {
+		action = req.Method
+	}
+	ct.requests = append(ct.requests, action)
+	req = req.Clone(req.Context())
+	req.Header.Set("X-Traced", "yes")
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func Test_WithTransport_Mock(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Traced") != "yes" {
+			t.Errorf("Expected every request to pass through the transport, got %s %s", r.Method, r.URL)
+		}
+		_, _ = io.Copy(io.Discard, r.Body)
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.bin","pathname":"a.bin","uploadId":"id","key":"key"}`))
+	}))
+	defer server.Close()
+
+	transport := &countingTransport{}
+	httpClient := &http.Client{}
+	client := newTestClient(t,
+		WithBaseURL(server.URL),
+		WithHTTPClient(httpClient),
+		WithTransport(transport),
+		WithTokenProvider(StaticTokenProvider("token")),
+	)
+	ctx := context.Background()
+
+	if _, err := client.Put(ctx, "a.bin", bytes.NewReader(make([]byte, MultipartThreshold+1)), PutCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Download(ctx, server.URL+"/a.bin", DownloadCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "create,upload,upload,complete,GET"
+	if got := strings.Join(transport.requests, ","); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if httpClient.Transport != nil {
+		t.Error("Expected the injected HTTP client not to be modified")
+	}
+}
+
+func Test_NewClientWithOptions_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		option ClientOption
+	}{
+		{"relative base URL", WithBaseURL("/api")},
+		{"unparsable base URL", WithBaseURL("http://%zz")},
+		{"non-http base URL", WithBaseURL("ftp://blob.example.com")},
+		{"base URL with query", WithBaseURL("https://blob.example.com/?token=x")},
+		{"base URL with empty query", WithBaseURL("https://blob.example.com/?")},
+		{"base URL with fragment", WithBaseURL("https://blob.example.com/#api")},
+		{"nil HTTP client", WithHTTPClient(nil)},
+		{"nil transport", WithTransport(nil)},
+		{"empty API version", WithAPIVersion("")},
+		{"nil token provider", WithTokenProvider(nil)},
+		{"zero timeout", WithTimeout(0)},
+		{"empty user agent", WithUserAgent("")},
+		{"empty user agent suffix", WithUserAgentSuffix("")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClientWithOptions(tt.option)
+			var blobErr *Error
+			if client != nil || !errors.As(err, &blobErr) || blobErr.Code != "invalid_option" {
+				t.Errorf("Expected an invalid_option error, got %v, %v", client, err)
+			}
+		})
+	}
+}
+
+func Test_BaseURL(t *testing.T) {
+	t.Setenv("VERCEL_BLOB_API_URL", "https://env.example.com")
+	if got := NewClient().BaseURL(); got != "https://env.example.com" {
+		t.Errorf("Expected the environment base URL, got %s", got)
+	}
+	client := newTestClient(t, WithBaseURL("http://127.0.0.1:8080"))
+	if got := client.BaseURL(); got != "http://127.0.0.1:8080" {
+		t.Errorf("Expected the option to take precedence, got %s", got)
+	}
+}
+
+func Test_WithUserAgentSuffix_Mock(t *testing.T) {
+	var userAgents []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgents = append(userAgents, r.Header.Get("User-Agent"))
+		_, _ = w.Write([]byte(`{"blobs":[]}`))
+	}))
+	defer server.Close()
+
+	for _, opts := range [][]ClientOption{
+		{WithUserAgentSuffix("my-app/1.0")},
+		{WithUserAgent("my-app/1.0"), WithUserAgentSuffix("worker")},
+	} {
+		client := newTestClient(t, append(opts, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")))...)
+		if _, err := client.List(context.Background(), ListCommandOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"vercel-blob-go/" + Version + " my-app/1.0", "my-app/1.0 worker"}
+	if strings.Join(userAgents, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected %v, got %v", want, userAgents)
+	}
+}
+
+func Test_Client_Clone_Mock(t *testing.T) {
+	var auth []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = append(auth, r.Header.Get("Authorization")+" "+r.Header.Get("User-Agent"))
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.txt","pathname":"a.txt"}`))
+	}))
+	defer server.Close()
+
+	var events []AuthEvent
+	client := newTestClient(t,
+		WithBaseURL(server.URL),
+		WithTokenProvider(StaticTokenProvider("shared-token")),
+		WithUserAgent("my-app/1.0"),
+		WithOperationTimeout(OperationHead, time.Second),
+		WithHeadCache(time.Minute, 0),
+		WithAuthAudit(func(event AuthEvent) {
+			events = append(events, event)
+		}),
+	)
+
+	tenant, err := client.Clone(WithTokenProvider(StaticTokenProvider("tenant-token")), WithOperationTimeout(OperationHead, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, c := range []*Client{client, tenant} {
+		if _, err := c.Head(ctx, "a.txt"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"Bearer shared-token my-app/1.0", "Bearer tenant-token my-app/1.0"}
+	if strings.Join(auth, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected %v, got %v", want, auth)
+	}
+	if len(events) != 2 {
+		t.Errorf("Expected the audit hook to be inherited, got %d events", len(events))
+	}
+	if tenant.httpClient != client.httpClient {
+		t.Error("Expected the clone to share the HTTP client")
+	}
+	if tenant.headCache == client.headCache || tenant.headCache == nil {
+		t.Error("Expected the clone to have its own head cache")
+	}
+	if client.operationTimeouts[OperationHead] != time.Second {
+		t.Errorf("Expected the original timeouts to be untouched, got %v", client.operationTimeouts[OperationHead])
+	}
+
+	timed, err := client.Clone(WithTimeout(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timed.httpClient == client.httpClient || timed.httpClient.Timeout != time.Minute || client.httpClient.Timeout != 0 {
+		t.Errorf("Expected the timeout on a copy of the HTTP client, got %v and %v", timed.httpClient.Timeout, client.httpClient.Timeout)
+	}
+	if timed.httpClient.Transport != client.httpClient.Transport {
+		t.Error("Expected the copy to keep the transport")
+	}
+
+	if _, err := client.Clone(WithTokenProvider(nil)); err == nil {
+		t.Error("Expected an error for an invalid option")
+	}
+}
+
+func Test_WithNoEnv(t *testing.T) {
+	t.Setenv("VERCEL_BLOB_API_URL", "https://production.example.com")
+	t.Setenv("VERCEL_BLOB_API_VERSION", "99")
+	t.Setenv("BLOB_READ_WRITE_TOKEN", "production-token")
+
+	_, err := NewClientWithOptions(WithNoEnv())
+	var blobErr *Error
+	if !errors.As(err, &blobErr) || blobErr.Code != "invalid_option" || !strings.Contains(err.Error(), "WithTokenProvider") {
+		t.Errorf("Expected an invalid_option error asking for a token provider, got %v", err)
+	}
+
+	client := newTestClient(t, WithNoEnv(), WithTokenProvider(StaticTokenProvider("token")))
+	if client.BaseURL() != DefaultBaseURL || client.apiVersion != BlobAPIVersion {
+		t.Errorf("Expected the built-in defaults, got %s and %s", client.BaseURL(), client.apiVersion)
+	}
+	client = newTestClient(t, WithNoEnv(), WithTokenProvider(StaticTokenProvider("token")), WithBaseURL("http://127.0.0.1:8080"), WithAPIVersion("10"))
+	if client.BaseURL() != "http://127.0.0.1:8080" || client.apiVersion != "10" {
+		t.Errorf("Expected the options, got %s and %s", client.BaseURL(), client.apiVersion)
+	}
+
+	client = newTestClient(t)
+	if client.BaseURL() != "https://production.example.com" || client.apiVersion != "99" {
+		t.Errorf("Expected the environment without WithNoEnv, got %s and %s", client.BaseURL(), client.apiVersion)
+	}
+}
+
+func Test_WithDefaultHeaders_Mock(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		action := r.Header.Get("X-MPU-Action")
+		if action == "" {
+			action = r.Method
+		}
+		requests = append(requests, action+" "+r.Header.Get("X-Org-Id")+" "+r.Header.Get("X-Content-Type"))
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.bin","pathname":"a.bin","uploadId":"id","key":"key","blobs":[]}`))
+	}))
+	defer server.Close()
+
+	client := newTestClient(t,
+		WithBaseURL(server.URL),
+		WithTokenProvider(StaticTokenProvider("token")),
+		WithDefaultHeaders(map[string]string{"x-org-id": "org-1"}),
+		WithDefaultHeaders(map[string]string{"X-Content-Type": "application/octet-stream"}),
+	)
+	ctx := context.Background()
+
+	if _, err := client.List(ctx, ListCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Put(ctx, "a.txt", strings.NewReader("a"), PutCommandOptions{ContentType: "text/plain"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Put(ctx, "a.bin", bytes.NewReader(make([]byte, MultipartThreshold+1)), PutCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Head(ctx, "a.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Delete(ctx, "https://blob.com/a.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Copy(ctx, "https://blob.com/a.bin", "b.bin", PutCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Download(ctx, server.URL+"/a.bin", DownloadCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"GET org-1 application/octet-stream",
+		"PUT org-1 text/plain",
+		"create org-1 application/octet-stream",
+		"upload org-1 application/octet-stream",
+		"upload org-1 application/octet-stream",
+		"complete org-1 application/octet-stream",
+		"GET org-1 application/octet-stream",
+		"POST org-1 application/octet-stream",
+		"PUT org-1 application/octet-stream",
+		"GET org-1 application/octet-stream",
+	}
+	if strings.Join(requests, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(requests, "\n"))
+	}
+
+	for _, name := range []string{"authorization", "X-API-Version", "x-mpu-action"} {
+		if _, err := NewClientWithOptions(WithDefaultHeaders(map[string]string{name: "x"})); err == nil {
+			t.Errorf("Expected an error for the %s header", name)
+		}
+	}
+}
+
+type traceKey struct{}
+
+func Test_WithHeaderInjector_Mock(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		action := r.Header.Get("X-MPU-Action")
+		if action == "" {
+			action = r.Method
+		}
+		requests = append(requests, fmt.Sprintf("%s %s %s %s", action, r.Header.Get("Traceparent"), r.Header.Get("X-Org-Id"), r.Header.Get("Authorization")))
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.bin","pathname":"a.bin","uploadId":"id","key":"key","blobs":[]}`))
+	}))
+	defer server.Close()
+
+	client := newTestClient(t,
+		WithBaseURL(server.URL),
+		WithTokenProvider(StaticTokenProvider("token")),
+		WithDefaultHeaders(map[string]string{"X-Org-Id": "org-1"}),
+		WithHeaderInjector(func(ctx context.Context, h http.Header) {
+			if trace, ok := ctx.Value(traceKey{}).(string); ok {
+				h.Set("Traceparent", trace)
+			}
+			// Sees the default headers, and cannot replace the client's.
+			h.Set("X-Org-Id", h.Get("X-Org-Id")+"+tenant")
+			h.Set("Authorization", "Bearer stolen")
+			h.Del("X-Mpu-Action")
+		}),
+	)
+	ctx := context.WithValue(context.Background(), traceKey{}, "00-trace-01")
+
+	if _, err := client.Put(ctx, "a.bin", bytes.NewReader(make([]byte, MultipartThreshold+1)), PutCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Download(ctx, server.URL+"/a.bin", DownloadCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"create 00-trace-01 org-1+tenant Bearer token",
+		"upload 00-trace-01 org-1+tenant Bearer token",
+		"upload 00-trace-01 org-1+tenant Bearer token",
+		"complete 00-trace-01 org-1+tenant Bearer token",
+		"GET 00-trace-01 org-1+tenant Bearer token",
+	}
+	if !slices.Equal(requests, want) {
+		t.Errorf("Expected requests\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(requests, "\n"))
+	}
+}
@@ -0,0 +1,348 @@
+package vercelblob
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxPathnameLength is the length, in bytes, of the longest pathname the API
+// accepts.
+const MaxPathnameLength = 950
+
+// MaxSegmentLength is the length, in bytes, of the longest segment of a
+// pathname accepted by ValidatePathname, the longest file name of common
+// file systems, so that blobs can be mirrored to disk, e.g. by fsblob.
+const MaxSegmentLength = 255
+
+// PathnameProblem is what makes a pathname unusable.
+type PathnameProblem string
+
+const (
+	PathnameEmpty            PathnameProblem = "is empty"
+	PathnameTooLong          PathnameProblem = "is too long"
+	PathnameSegmentTooLong   PathnameProblem = "has a segment that is too long"
+	PathnameEmptySegment     PathnameProblem = "has an empty segment"
+	PathnameDotSegment       PathnameProblem = `has a "." or ".." segment`
+	PathnameInvalidUTF8      PathnameProblem = "is not valid UTF-8"
+	PathnameControlCharacter PathnameProblem = "contains a control character"
+	PathnameBackslash        PathnameProblem = "contains a backslash"
+)
+
+// PathnameError is returned by ValidatePathname and NormalizePathname for a
+// pathname that cannot be used. It unwraps to an invalid_input *Error.
+type PathnameError struct {
+	Pathname string
+	Problem  PathnameProblem
+}
+
+func (e *PathnameError) Error() string {
+	return fmt.Sprintf("pathname %q %s", e.Pathname, e.Problem)
+}
+
+// Unwrap returns an invalid_input *Error describing the problem.
+func (e *PathnameError) Unwrap() error {
+	return &Error{Msg: e.Error(), Code: "invalid_input"}
+}
+
+// ValidatePathname reports whether pathname can be used as is, returning a
+// *PathnameError if not: it must be valid UTF-8 of at most
+// MaxPathnameLength bytes, without control characters or backslashes, and
+// made of segments of at most MaxSegmentLength bytes separated by single
+// slashes, none of them "." or "..". NormalizePathname turns most
+// user-supplied names into valid pathnames.
+func ValidatePathname(pathname string) error {
+	return validatePathname(pathname, MaxPathnameLength, MaxSegmentLength)
+}
+
+func validatePathname(pathname string, maxLength, maxSegmentLength int) error {
+	problem := func(p PathnameProblem) error {
+		return &PathnameError{Pathname: pathname, Problem: p}
+	}
+	switch {
+	case pathname == "":
+		return problem(PathnameEmpty)
+	case !utf8.ValidString(pathname):
+		return problem(PathnameInvalidUTF8)
+	case len(pathname) > maxLength:
+		return problem(PathnameTooLong)
+	case strings.ContainsFunc(pathname, unicode.IsControl):
+		return problem(PathnameControlCharacter)
+	case strings.ContainsRune(pathname, '\\'):
+		return problem(PathnameBackslash)
+	}
+	for segment := range strings.SplitSeq(pathname, "/") {
+		switch {
+		case segment == "":
+			return problem(PathnameEmptySegment)
+		case segment == "." || segment == "..":
+			return problem(PathnameDotSegment)
+		case len(segment) > maxSegmentLength:
+			return problem(PathnameSegmentTooLong)
+		}
+	}
+	return nil
+}
+
+// NonASCIIMode is how NormalizePathname treats runes outside ASCII.
+type NonASCIIMode int
+
+const (
+	// KeepNonASCII keeps them, composing a Latin letter followed by a
+	// combining accent into the accented letter, as in the names macOS
+	// sends decomposed.
+	KeepNonASCII NonASCIIMode = iota
+	// TransliterateNonASCII spells accented Latin letters without their
+	// accent and a few other letters, such as ß, the usual way in ASCII,
+	// and percent-encodes the other runes.
+	TransliterateNonASCII
+	// PercentEncodeNonASCII percent-encodes them as UTF-8. A '%' of the
+	// input is kept as is, so that normalizing again changes nothing.
+	PercentEncodeNonASCII
+)
+
+// NormalizeOptions contains options for NormalizePathname.
+type NormalizeOptions struct {
+	NonASCII NonASCIIMode
+	// MaxLength caps the length of the pathname in bytes. Defaults to
+	// MaxPathnameLength.
+	MaxLength int
+	// MaxSegmentLength caps the length of each segment in bytes. Defaults
+	// to MaxSegmentLength.
+	MaxSegmentLength int
+	// TruncateSegments shortens segments that are too long, keeping their
+	// extension, instead of failing.
+	TruncateSegments bool
+}
+
+// Validate reports every invalid field of the options as a *ValidationError.
+func (o NormalizeOptions) Validate() error {
+	v := validator{options: "NormalizeOptions"}
+	v.check(o.NonASCII >= KeepNonASCII && o.NonASCII <= PercentEncodeNonASCII, "NonASCII", "must be a NonASCIIMode", o.NonASCII)
+	v.check(o.MaxLength >= 0 && o.MaxLength <= MaxPathnameLength, "MaxLength", fmt.Sprintf("must be between 0 and %d", MaxPathnameLength), o.MaxLength)
+	v.check(o.MaxSegmentLength >= 0 && o.MaxSegmentLength <= MaxSegmentLength, "MaxSegmentLength", fmt.Sprintf("must be between 0 and %d", MaxSegmentLength), o.MaxSegmentLength)
+	return v.err()
+}
+
+// NormalizePathname turns input, such as a file name chosen by a user, into
+// a pathname that passes ValidatePathname and that NormalizePathname leaves
+// unchanged. It drops bytes that are not UTF-8, control and invisible
+// formatting characters, turns backslashes into slashes, collapses runs of
+// slashes and of white space, trims the white space around segments, drops
+// empty and "." segments, and treats runes outside ASCII as options.NonASCII
+// says.
+//
+// Input that cannot be fixed, such as a ".." segment, a segment or pathname
+// that is too long, or nothing left once cleaned, is reported as a
+// *PathnameError; invalid options as a *ValidationError.
+func NormalizePathname(input string, options NormalizeOptions) (string, error) {
+	if err := options.Validate(); err != nil {
+		return "", err
+	}
+	maxLength := options.MaxLength
+	if maxLength == 0 {
+		maxLength = MaxPathnameLength
+	}
+	maxSegmentLength := options.MaxSegmentLength
+	if maxSegmentLength == 0 {
+		maxSegmentLength = MaxSegmentLength
+	}
+	problem := func(p PathnameProblem) error {
+		return &PathnameError{Pathname: input, Problem: p}
+	}
+
+	s := strings.ToValidUTF8(input, "")
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\\':
+			return '/'
+		case unicode.IsSpace(r):
+			return ' '
+		case unicode.IsControl(r), unicode.Is(unicode.Cf, r):
+			return -1
+		}
+		return r
+	}, s)
+	switch options.NonASCII {
+	case KeepNonASCII:
+		s = composeLatin(s)
+	case TransliterateNonASCII:
+		s = transliterate(s)
+	case PercentEncodeNonASCII:
+		s = percentEncodeNonASCII(s)
+	}
+
+	var segments []string
+	for segment := range strings.SplitSeq(s, "/") {
+		segment = strings.Join(strings.Fields(segment), " ")
+		switch {
+		case segment == "" || segment == ".":
+			continue
+		case segment == "..":
+			return "", problem(PathnameDotSegment)
+		case len(segment) > maxSegmentLength:
+			if !options.TruncateSegments {
+				return "", problem(PathnameSegmentTooLong)
+			}
+			if segment = truncateSegment(segment, maxSegmentLength); segment == "" || segment == "." || segment == ".." {
+				return "", problem(PathnameSegmentTooLong)
+			}
+		}
+		segments = append(segments, segment)
+	}
+	pathname := strings.Join(segments, "/")
+	switch {
+	case pathname == "":
+		return "", problem(PathnameEmpty)
+	case len(pathname) > maxLength:
+		return "", problem(PathnameTooLong)
+	}
+	return pathname, nil
+}
+
+// truncateSegment shortens segment to at most n bytes, keeping its extension
+// unless that is too long, without splitting a rune or a percent-encoded
+// byte.
+func truncateSegment(segment string, n int) string {
+	ext := path.Ext(segment)
+	if len(ext) > n/2 {
+		ext = ""
+	}
+	base := segment[:len(segment)-len(ext)]
+	cut := n - len(ext)
+	for cut > 0 && !utf8.RuneStart(base[cut]) {
+		cut--
+	}
+	return strings.TrimRight(trimPartialEscape(base[:cut]), " ") + ext
+}
+
+// trimPartialEscape drops the end of s cut in the middle of a percent-encoded
+// byte or rune.
+func trimPartialEscape(s string) string {
+	if i := strings.LastIndexByte(s, '%'); i >= 0 && i >= len(s)-2 {
+		s = s[:i]
+	}
+	var encoded []byte
+	i := len(s)
+	for i >= 3 && s[i-3] == '%' && len(encoded) < utf8.UTFMax {
+		c, err := strconv.ParseUint(s[i-2:i], 16, 8)
+		if err != nil || c < 0x80 {
+			break
+		}
+		i -= 3
+		encoded = append([]byte{byte(c)}, encoded...)
+		if utf8.RuneStart(byte(c)) {
+			break
+		}
+	}
+	if !utf8.Valid(encoded) {
+		return s[:i]
+	}
+	return s
+}
+
+// latinCompositions lists, for each combining accent, the ASCII letters it
+// composes with followed by the accented letter.
+var latinCompositions = map[rune]string{
+	0x0300: "AÀEÈIÌOÒUÙaàeèiìoòuùNǸnǹ",                                           // grave accent
+	0x0301: "AÁEÉIÍOÓUÚYÝaáeéiíoóuúyýCĆcćLĹlĺNŃnńRŔrŕSŚsśZŹzźGǴgǵ",               // acute accent
+	0x0302: "AÂEÊIÎOÔUÛaâeêiîoôuûCĈcĉGĜgĝHĤhĥJĴjĵSŜsŝWŴwŵYŶyŷ",                   // circumflex accent
+	0x0303: "AÃNÑOÕaãnñoõIĨiĩUŨuũ",                                               // tilde
+	0x0304: "AĀaāEĒeēIĪiīOŌoōUŪuūYȲyȳ",                                           // macron
+	0x0306: "AĂaăEĔeĕGĞgğIĬiĭOŎoŏUŬuŭ",                                           // breve
+	0x0307: "CĊcċEĖeėGĠgġIİZŻzżAȦaȧOȮoȯ",                                         // dot above
+	0x0308: "AÄEËIÏOÖUÜaäeëiïoöuüyÿYŸ",                                           // diaeresis
+	0x030A: "AÅaåUŮuů",                                                           // ring above
+	0x030B: "OŐoőUŰuű",                                                           // double acute accent
+	0x030C: "CČcčDĎdďEĚeěLĽlľNŇnňRŘrřSŠsšTŤtťZŽzžAǍaǎIǏiǐOǑoǒUǓuǔGǦgǧKǨkǩjǰHȞhȟ", // caron
+	0x030F: "AȀaȁEȄeȅIȈiȉOȌoȍRȐrȑUȔuȕ",                                           // double grave accent
+	0x0311: "AȂaȃEȆeȇIȊiȋOȎoȏRȒrȓUȖuȗ",                                           // inverted breve
+	0x031B: "OƠoơUƯuư",                                                           // horn
+	0x0326: "SȘsșTȚtț",                                                           // comma below
+	0x0327: "CÇcçGĢgģKĶkķLĻlļNŅnņRŖrŗSŞsşTŢtţEȨeȩ",                               // cedilla
+	0x0328: "AĄaąEĘeęIĮiįUŲuųOǪoǫ",                                               // ogonek
+}
+
+// asciiSpellings are the ASCII spellings of letters that are not accented
+// ASCII letters, and of common typographic marks.
+var asciiSpellings = map[rune]string{
+	'ß': "ss", 'Æ': "AE", 'æ': "ae", 'Œ': "OE", 'œ': "oe", 'Ø': "O", 'ø': "o",
+	'Đ': "D", 'đ': "d", 'Ð': "D", 'ð': "d", 'Þ': "Th", 'þ': "th", 'Ł': "L", 'ł': "l",
+	'Ħ': "H", 'ħ': "h", 'Ŧ': "T", 'ŧ': "t", 'ı': "i", 'Ŋ': "NG", 'ŋ': "ng",
+	'‘': "'", '’': "'", '“': `"`, '”': `"`, '–': "-", '—': "-", '…': "...",
+}
+
+// composed maps an ASCII letter and a combining accent to the accented
+// letter, and decomposed the accented letter to the ASCII letter.
+var composed, decomposed = func() (map[[2]rune]rune, map[rune]rune) {
+	composed, decomposed := map[[2]rune]rune{}, map[rune]rune{}
+	for accent, pairs := range latinCompositions {
+		runes := []rune(pairs)
+		for i := 0; i+1 < len(runes); i += 2 {
+			composed[[2]rune{runes[i], accent}] = runes[i+1]
+			decomposed[runes[i+1]] = runes[i]
+		}
+	}
+	return composed, decomposed
+}()
+
+// composeLatin replaces each ASCII letter followed by a combining accent
+// with the accented letter.
+func composeLatin(s string) string {
+	var b strings.Builder
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		if i+1 < len(runes) {
+			if r, ok := composed[[2]rune{runes[i], runes[i+1]}]; ok {
+				b.WriteRune(r)
+				i++
+				continue
+			}
+		}
+		b.WriteRune(runes[i])
+	}
+	return b.String()
+}
+
+// transliterate spells s in ASCII, dropping accents and percent-encoding the
+// runes it cannot spell.
+func transliterate(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r < utf8.RuneSelf:
+			b.WriteRune(r)
+		case unicode.Is(unicode.Mn, r):
+			// A combining accent, dropped with the letter it belongs to.
+		case decomposed[r] != 0:
+			b.WriteRune(decomposed[r])
+		case asciiSpellings[r] != "":
+			b.WriteString(asciiSpellings[r])
+		default:
+			writePercentEncoded(&b, r)
+		}
+	}
+	return b.String()
+}
+
+// percentEncodeNonASCII percent-encodes the runes of s outside ASCII.
+func percentEncodeNonASCII(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			b.WriteRune(r)
+		} else {
+			writePercentEncoded(&b, r)
+		}
+	}
+	return b.String()
+}
+
+func writePercentEncoded(b *strings.Builder, r rune) {
+	for _, c := range []byte(string(r)) {
+		fmt.Fprintf(b, "%%%02X", c)
+	}
+}
@@ -0,0 +1,154 @@
+package vercelblob
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func Test_ValidatePathname(t *testing.T) {
+	for _, pathname := range []string{"a.txt", "dir/sub/a b.txt", "é/日本.txt", "100%.txt", strings.Repeat("a", MaxSegmentLength)} {
+		if err := ValidatePathname(pathname); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", pathname, err)
+		}
+	}
+
+	tests := []struct {
+		pathname string
+		want     PathnameProblem
+	}{
+		{"", PathnameEmpty},
+		{"a\xff.txt", PathnameInvalidUTF8},
+		{strings.Repeat("a/", MaxPathnameLength/2) + "a", PathnameTooLong},
+		{"a\x00.txt", PathnameControlCharacter},
+		{"a\n.txt", PathnameControlCharacter},
+		{`dir\a.txt`, PathnameBackslash},
+		{"/a.txt", PathnameEmptySegment},
+		{"dir/", PathnameEmptySegment},
+		{"dir//a.txt", PathnameEmptySegment},
+		{"dir/./a.txt", PathnameDotSegment},
+		{"../a.txt", PathnameDotSegment},
+		{strings.Repeat("a", MaxSegmentLength+1), PathnameSegmentTooLong},
+	}
+	for _, tt := range tests {
+		err := ValidatePathname(tt.pathname)
+		var pathnameErr *PathnameError
+		if !errors.As(err, &pathnameErr) || pathnameErr.Problem != tt.want || pathnameErr.Pathname != tt.pathname {
+			t.Errorf("Expected %q to be reported as %q, got %v", tt.pathname, tt.want, err)
+		}
+		if CodeOf(err) != "invalid_input" {
+			t.Errorf("Expected an invalid_input error, got %v", err)
+		}
+	}
+}
+
+func Test_NormalizePathname(t *testing.T) {
+	long := strings.Repeat("a", 300)
+	tests := []struct {
+		name    string
+		input   string
+		options NormalizeOptions
+		want    string
+	}{
+		{"clean", "dir/a.txt", NormalizeOptions{}, "dir/a.txt"},
+		{"separators", `\\dir\\sub//a.txt/`, NormalizeOptions{}, "dir/sub/a.txt"},
+		{"dot segments", "./dir/./a.txt", NormalizeOptions{}, "dir/a.txt"},
+		{"control characters", "a\x00b\x7f\u200b.txt", NormalizeOptions{}, "ab.txt"},
+		{"invalid UTF-8", "a\xffb.txt", NormalizeOptions{}, "ab.txt"},
+		{"white space", " dir /\ta \n  b.txt ", NormalizeOptions{}, "dir/a b.txt"},
+		{"decomposed", "café/ñ.txt", NormalizeOptions{}, "café/ñ.txt"},
+		{"kept", "日本/ß.txt", NormalizeOptions{}, "日本/ß.txt"},
+		{"transliterated", "Café Ñandú/Straße œuvre.txt", NormalizeOptions{NonASCII: TransliterateNonASCII}, "Cafe Nandu/Strasse oeuvre.txt"},
+		{"transliterated unknown", "日.txt", NormalizeOptions{NonASCII: TransliterateNonASCII}, "%E6%97%A5.txt"},
+		{"percent-encoded", "é 100%.txt", NormalizeOptions{NonASCII: PercentEncodeNonASCII}, "%C3%A9 100%.txt"},
+		{"truncated", long + ".txt", NormalizeOptions{TruncateSegments: true}, long[:251] + ".txt"},
+		{"truncated rune", "a" + strings.Repeat("é", 10), NormalizeOptions{MaxSegmentLength: 10, TruncateSegments: true}, "aéééé"},
+		{"truncated escape", strings.Repeat("é", 10), NormalizeOptions{NonASCII: PercentEncodeNonASCII, MaxSegmentLength: 10, TruncateSegments: true}, "%C3%A9"},
+		{"truncated without extension", "a." + long, NormalizeOptions{MaxSegmentLength: 10, TruncateSegments: true}, "a." + long[:8]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizePathname(tt.input, tt.options)
+			if err != nil || got != tt.want {
+				t.Fatalf("Expected %q, got %q, %v", tt.want, got, err)
+			}
+			if err := ValidatePathname(got); err != nil {
+				t.Errorf("Expected a valid pathname, got %v", err)
+			}
+		})
+	}
+}
+
+func Test_NormalizePathname_Invalid(t *testing.T) {
+	tests := []struct {
+		input   string
+		options NormalizeOptions
+		want    PathnameProblem
+	}{
+		{"", NormalizeOptions{}, PathnameEmpty},
+		{" /./\x00/", NormalizeOptions{}, PathnameEmpty},
+		{"dir/../a.txt", NormalizeOptions{}, PathnameDotSegment},
+		{`dir\..\a.txt`, NormalizeOptions{}, PathnameDotSegment},
+		{strings.Repeat("a", MaxSegmentLength+1), NormalizeOptions{}, PathnameSegmentTooLong},
+		{strings.Repeat("é", 10), NormalizeOptions{NonASCII: PercentEncodeNonASCII, MaxSegmentLength: 10}, PathnameSegmentTooLong},
+		{"é", NormalizeOptions{MaxSegmentLength: 1, TruncateSegments: true}, PathnameSegmentTooLong},
+		{"a/b/c", NormalizeOptions{MaxLength: 4}, PathnameTooLong},
+	}
+	for _, tt := range tests {
+		_, err := NormalizePathname(tt.input, tt.options)
+		var pathnameErr *PathnameError
+		if !errors.As(err, &pathnameErr) || pathnameErr.Problem != tt.want || pathnameErr.Pathname != tt.input {
+			t.Errorf("Expected %q to be reported as %q, got %v", tt.input, tt.want, err)
+		}
+		if CodeOf(err) != "invalid_input" {
+			t.Errorf("Expected an invalid_input error, got %v", err)
+		}
+	}
+
+	_, err := NormalizePathname("a.txt", NormalizeOptions{NonASCII: 3, MaxLength: MaxPathnameLength + 1})
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || len(validationErr.Problems) != 2 {
+		t.Errorf("Expected the options to be rejected, got %v", err)
+	}
+}
+
+func FuzzNormalizePathname(f *testing.F) {
+	for _, seed := range []string{
+		"dir/a.txt",
+		"a\x00b\x00",
+		`\\server\share\..\a`,
+		"café/ñ/日本語/ß",
+		"..",
+		" . / .. /",
+		"%E9%",
+		"a\xff\xfe\u200b\u0085b",
+		strings.Repeat("é", 200) + ".txt",
+		strings.Repeat("a/", 600),
+	} {
+		f.Add(seed, true)
+		f.Add(seed, false)
+	}
+	f.Fuzz(func(t *testing.T, input string, truncate bool) {
+		for _, mode := range []NonASCIIMode{KeepNonASCII, TransliterateNonASCII, PercentEncodeNonASCII} {
+			for _, options := range []NormalizeOptions{
+				{NonASCII: mode, TruncateSegments: truncate},
+				{NonASCII: mode, TruncateSegments: truncate, MaxLength: 20, MaxSegmentLength: 7},
+			} {
+				out, err := NormalizePathname(input, options)
+				if err != nil {
+					var pathnameErr *PathnameError
+					if !errors.As(err, &pathnameErr) || CodeOf(err) != "invalid_input" {
+						t.Fatalf("Expected a *PathnameError for %q with %+v, got %v", input, options, err)
+					}
+					continue
+				}
+				if err := ValidatePathname(out); err != nil {
+					t.Fatalf("Normalized %q with %+v to invalid %q: %v", input, options, out, err)
+				}
+				if again, err := NormalizePathname(out, options); err != nil || again != out {
+					t.Fatalf("Normalized %q with %+v to %q, then to %q, %v", input, options, out, again, err)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,207 @@
+package vercelblob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// defaultPrefixConcurrency is the number of blobs processed at once by the
+// prefix operations when PrefixOptions.Concurrency is not set.
+const defaultPrefixConcurrency = 4
+
+// PrefixOptions contains options for the prefix operations.
+type PrefixOptions struct {
+	// Maximum number of blobs processed at once. Defaults to 4.
+	Concurrency int
+	// Report the blobs that would be processed without changing the store.
+	DryRun bool
+	// Called after each blob is processed. Calls are serialized.
+	Progress func(PrefixProgress)
+	// Skip blobs whose pathname sorts at or before this one, to resume an
+	// interrupted run from its PrefixResult.Checkpoint.
+	StartAfter string
+}
+
+// PrefixProgress reports the outcome for a single blob of a prefix operation.
+type PrefixProgress struct {
+	Pathname string
+	// Number of blobs processed so far, including this one.
+	Processed int
+	Err       error
+}
+
+// PrefixResult is the summary of a prefix operation.
+type PrefixResult struct {
+	// Pathnames of the source blobs that were processed successfully, or
+	// would have been in a dry run.
+	Completed []string
+	// Source blobs that were copied but could not be deleted by
+	// RenamePrefix. Both the source and the copy exist.
+	CopiedNotDeleted map[string]error
+	// Source blobs that failed. They were left untouched.
+	Failed map[string]error
+	// The last pathname up to which every blob was processed. Pass it as
+	// PrefixOptions.StartAfter to resume an interrupted run.
+	Checkpoint string
+	// The timing and traffic of the whole run, including the listing.
+	Stats OperationStats
+}
+
+// Err returns a *BatchError keyed by pathname for the blobs that failed or
+// were copied but not deleted, or nil if every blob was processed.
+func (r *PrefixResult) Err() error {
+	errs := make(map[string]error, len(r.Failed)+len(r.CopiedNotDeleted))
+	for pathname, err := range r.Failed {
+		errs[pathname] = err
+	}
+	for pathname, err := range r.CopiedNotDeleted {
+		errs[pathname] = fmt.Errorf("copied but not deleted: %w", err)
+	}
+	return newBatchError(errs, len(r.Completed)+len(errs))
+}
+
+// errCopiedNotDeleted marks a rename whose copy succeeded but whose delete did not.
+type errCopiedNotDeleted struct {
+	err error
+}
+
+func (e errCopiedNotDeleted) Error() string {
+	return e.err.Error()
+}
+
+func (e errCopiedNotDeleted) Unwrap() error {
+	return e.err
+}
+
+// CopyPrefix copies every blob under fromPrefix to the same relative pathname
+// under toPrefix, preserving its metadata.
+func (c *Client) CopyPrefix(ctx context.Context, fromPrefix, toPrefix string, options PrefixOptions) (*PrefixResult, error) {
+	return c.forEachUnderPrefix(ctx, fromPrefix, options, func(ctx context.Context, blob ListBlobResultBlob) error {
+		_, err := c.CopyWithOptions(ctx, blob.URL, toPrefix+strings.TrimPrefix(blob.PathName, fromPrefix), CopyCommandOptions{
+			InheritMetadata: true,
+		})
+		return err
+	})
+}
+
+// DeletePrefix deletes every blob under prefix.
+func (c *Client) DeletePrefix(ctx context.Context, prefix string, options PrefixOptions) (*PrefixResult, error) {
+	return c.forEachUnderPrefix(ctx, prefix, options, func(ctx context.Context, blob ListBlobResultBlob) error {
+		return c.Delete(ctx, blob.URL)
+	})
+}
+
+// RenamePrefix moves every blob under fromPrefix to the same relative pathname
+// under toPrefix by copying it and then deleting the source.
+//
+// A source is only deleted once its copy has been verified against it, so an
+// interrupted run never loses data; blobs that were copied but not deleted
+// are reported separately in the result.
+func (c *Client) RenamePrefix(ctx context.Context, fromPrefix, toPrefix string, options PrefixOptions) (*PrefixResult, error) {
+	return c.forEachUnderPrefix(ctx, fromPrefix, options, func(ctx context.Context, blob ListBlobResultBlob) error {
+		_, err := c.CopyWithOptions(ctx, blob.URL, toPrefix+strings.TrimPrefix(blob.PathName, fromPrefix), CopyCommandOptions{
+			InheritMetadata: true,
+			Verify:          true,
+		})
+		if err != nil {
+			return err
+		}
+		if err := c.Delete(ctx, blob.URL); err != nil {
+			return errCopiedNotDeleted{err}
+		}
+		return nil
+	})
+}
+
+// forEachUnderPrefix lists the blobs under prefix page by page and calls fn
+// for each of them with bounded concurrency.
+func (c *Client) forEachUnderPrefix(ctx context.Context, prefix string, options PrefixOptions, fn func(context.Context, ListBlobResultBlob) error) (*PrefixResult, error) {
+	concurrency := options.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultPrefixConcurrency
+	}
+	result := &PrefixResult{
+		CopiedNotDeleted: map[string]error{},
+		Failed:           map[string]error{},
+		Checkpoint:       options.StartAfter,
+	}
+	ctx, stats := withOperationStats(ctx)
+	defer func() { result.Stats = stats.snapshot() }()
+
+	var mu sync.Mutex
+	processed := 0
+	report := func(pathname string, err error) {
+		if options.Progress == nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		processed++
+		options.Progress(PrefixProgress{Pathname: pathname, Processed: processed, Err: err})
+	}
+
+	contiguous := true
+	cursor := ""
+	for {
+		page, err := c.listInScope(ctx, ListCommandOptions{Prefix: prefix, Cursor: cursor}, true)
+		if err != nil {
+			return result, err
+		}
+
+		var blobs []ListBlobResultBlob
+		for _, blob := range page.Blobs {
+			if options.StartAfter == "" || blob.PathName > options.StartAfter {
+				blobs = append(blobs, blob)
+			}
+		}
+
+		errs := make([]error, len(blobs))
+		if options.DryRun {
+			for _, blob := range blobs {
+				report(blob.PathName, nil)
+			}
+		} else {
+			var wg sync.WaitGroup
+			sem := make(chan struct{}, concurrency)
+			for i, blob := range blobs {
+				wg.Add(1)
+				sem <- struct{}{}
+				go func() {
+					defer wg.Done()
+					defer func() { <-sem }()
+					errs[i] = fn(ctx, blob)
+					report(blob.PathName, errs[i])
+				}()
+			}
+			wg.Wait()
+		}
+
+		for i, blob := range blobs {
+			var notDeleted errCopiedNotDeleted
+			switch {
+			case errs[i] == nil:
+				result.Completed = append(result.Completed, blob.PathName)
+				if contiguous {
+					result.Checkpoint = blob.PathName
+				}
+				continue
+			case errors.As(errs[i], &notDeleted):
+				result.CopiedNotDeleted[blob.PathName] = notDeleted.err
+			default:
+				result.Failed[blob.PathName] = errs[i]
+			}
+			contiguous = false
+		}
+
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		if !page.HasMore {
+			return result, nil
+		}
+		cursor = page.Cursor
+	}
+}
@@ -0,0 +1,170 @@
+package vercelblob
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/claywarren/vercel_blob/blobtest"
+)
+
+// newPrefixServer serves list, head, copy and delete for an in-memory set of
+// pathnames, two blobs per list page. Copies of failCopy and deletes of
+// failDelete are rejected.
+func newPrefixServer(t *testing.T, blobs map[string]uint64, failCopy, failDelete string) *httptest.Server {
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		pathname := strings.TrimPrefix(r.URL.Path, "/")
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Query().Get("url") == "":
+			prefix := r.URL.Query().Get("prefix")
+			var names []string
+			for name := range blobs {
+				if strings.HasPrefix(name, prefix) && name > r.URL.Query().Get("cursor") {
+					names = append(names, name)
+				}
+			}
+			sort.Strings(names)
+			var result ListBlobResult
+			for i, name := range names {
+				if i == 2 {
+					result.HasMore = true
+					result.Cursor = names[1]
+					break
+				}
+				result.Blobs = append(result.Blobs, ListBlobResultBlob{URL: "https://blob.com/" + name, PathName: name, Size: blobs[name]})
+			}
+			_ = json.NewEncoder(w).Encode(result)
+		case r.Method == http.MethodGet:
+			pathname = strings.TrimPrefix(r.URL.Query().Get("url"), "https://blob.com/")
+			size, ok := blobs[pathname]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(HeadBlobResult{URL: "https://blob.com/" + pathname, Pathname: pathname, Size: size})
+		case r.Method == http.MethodPut:
+			from, _ := url.Parse(r.URL.Query().Get("fromUrl"))
+			source := strings.TrimPrefix(from.Path, "/")
+			if source == failCopy {
+				w.WriteHeader(http.StatusBadRequest)
+				_ = json.NewEncoder(w).Encode(BlobAPIError{Error: BlobAPIErrorDetail{Code: "bad_request", Message: "copy failed"}})
+				return
+			}
+			blobs[pathname] = blobs[source]
+			_ = json.NewEncoder(w).Encode(PutBlobPutResult{URL: "https://blob.com/" + pathname, Pathname: pathname})
+		case r.Method == http.MethodPost:
+			var req deleteRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			for _, u := range req.URLs {
+				name := strings.TrimPrefix(u, "https://blob.com/")
+				if name == failDelete {
+					w.WriteHeader(http.StatusForbidden)
+					_ = json.NewEncoder(w).Encode(BlobAPIError{Error: BlobAPIErrorDetail{Code: "forbidden"}})
+					return
+				}
+				delete(blobs, name)
+			}
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL)
+		}
+	}))
+}
+
+func Test_RenamePrefix_Mock(t *testing.T) {
+	blobs := map[string]uint64{
+		"uploads/a.txt":    1,
+		"uploads/b.txt":    2,
+		"uploads/bad.txt":  3,
+		"uploads/keep.txt": 4,
+		"uploads/z.txt":    5,
+		"other/c.txt":      6,
+	}
+	server := newPrefixServer(t, blobs, "uploads/bad.txt", "uploads/keep.txt")
+	defer server.Close()
+
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("test")))
+
+	var progress []string
+	res, err := client.RenamePrefix(context.Background(), "uploads/", "archive/uploads/", PrefixOptions{
+		Concurrency: 2,
+		Progress:    func(p PrefixProgress) { progress = append(progress, p.Pathname) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(res.Completed, ",") != "uploads/a.txt,uploads/b.txt,uploads/z.txt" {
+		t.Errorf("Unexpected completed: %v", res.Completed)
+	}
+	if _, ok := res.Failed["uploads/bad.txt"]; !ok || len(res.Failed) != 1 {
+		t.Errorf("Expected uploads/bad.txt to fail, got %v", res.Failed)
+	}
+	if _, ok := res.CopiedNotDeleted["uploads/keep.txt"]; !ok || len(res.CopiedNotDeleted) != 1 {
+		t.Errorf("Expected uploads/keep.txt to be copied but not deleted, got %v", res.CopiedNotDeleted)
+	}
+	if res.Checkpoint != "uploads/b.txt" {
+		t.Errorf("Expected checkpoint uploads/b.txt, got %s", res.Checkpoint)
+	}
+	var batchErr *BatchError
+	if err := res.Err(); !errors.As(err, &batchErr) || batchErr.Total != 5 ||
+		strings.Join(batchErr.Items(), ",") != "uploads/bad.txt,uploads/keep.txt" || !errors.Is(err, ErrForbidden) {
+		t.Errorf("Expected a batch error for the two failed blobs, got %v", err)
+	}
+	if len(progress) != 5 {
+		t.Errorf("Expected 5 progress reports, got %d", len(progress))
+	}
+
+	for _, name := range []string{"archive/uploads/a.txt", "archive/uploads/keep.txt", "uploads/bad.txt", "uploads/keep.txt", "other/c.txt"} {
+		if _, ok := blobs[name]; !ok {
+			t.Errorf("Expected %s to exist", name)
+		}
+	}
+	for _, name := range []string{"uploads/a.txt", "archive/uploads/bad.txt"} {
+		if _, ok := blobs[name]; ok {
+			t.Errorf("Expected %s not to exist", name)
+		}
+	}
+}
+
+func Test_RenamePrefix_DryRunAndResume_Mock(t *testing.T) {
+	server := blobtest.NewServer()
+	defer server.Close()
+	server.ListLimit = 2
+	for _, name := range []string{"uploads/a.txt", "uploads/b.txt", "uploads/c.txt"} {
+		server.Seed(name, []byte(name), "")
+	}
+
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")))
+
+	res, err := client.RenamePrefix(context.Background(), "uploads/", "archive/", PrefixOptions{DryRun: true, StartAfter: "uploads/a.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(res.Completed, ",") != "uploads/b.txt,uploads/c.txt" {
+		t.Errorf("Unexpected dry run: %v", res.Completed)
+	}
+	if pathnames := server.Pathnames(); len(pathnames) != 3 {
+		t.Errorf("Expected dry run not to change the store, got %v", pathnames)
+	}
+
+	if _, err = client.RenamePrefix(context.Background(), "uploads/", "archive/", PrefixOptions{StartAfter: "uploads/a.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if pathnames := strings.Join(server.Pathnames(), ","); pathnames != "archive/b.txt,archive/c.txt,uploads/a.txt" {
+		t.Errorf("Unexpected store after the rename: %s", pathnames)
+	}
+	if blob, _ := server.Blob("archive/b.txt"); string(blob.Content) != "uploads/b.txt" {
+		t.Errorf("Expected the content to be copied, got %q", blob.Content)
+	}
+}
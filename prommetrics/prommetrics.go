@@ -0,0 +1,114 @@
+// Package prommetrics reports the metrics of a vercelblob.Client to
+// Prometheus-style registries, without depending on a client library. Each
+// metric is given as a function returning the child of a metric vector for
+// its label values, e.g. with github.com/prometheus/client_golang:
+//
+//	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+//		Name: "blob_requests_total",
+//	}, []string{"operation", "code"})
+//	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+//		Name: "blob_request_duration_seconds",
+//	}, []string{"operation"})
+//	prometheus.MustRegister(requests, duration)
+//
+//	client, err := vercelblob.NewClientWithOptions(
+//		vercelblob.WithMetrics(prommetrics.New(prommetrics.Metrics{
+//			Requests: func(operation, code string) prommetrics.Counter {
+//				return requests.WithLabelValues(operation, code)
+//			},
+//			Duration: func(operation string) prommetrics.Observer {
+//				return duration.WithLabelValues(operation)
+//			},
+//		})),
+//	)
+package prommetrics
+
+import (
+	"time"
+
+	vercelblob "github.com/claywarren/vercel_blob"
+)
+
+// Counter is a counter of a metric vector, such as a prometheus.Counter.
+type Counter interface {
+	Add(float64)
+}
+
+// Observer is an observer of a metric vector, such as a prometheus.Histogram.
+type Observer interface {
+	Observe(float64)
+}
+
+// Metrics are the metrics to report. Metrics that are nil are not reported.
+type Metrics struct {
+	// Requests counts requests by operation and code, e.g.
+	// blob_requests_total{operation="put",code="ok"}.
+	Requests func(operation, code string) Counter
+	// Duration observes the duration of requests in seconds by operation.
+	Duration func(operation string) Observer
+	// BytesIn and BytesOut count the bytes of response and request bodies
+	// by operation.
+	BytesIn, BytesOut func(operation string) Counter
+	// Retries and Hedges count retries and hedges by operation.
+	Retries, Hedges func(operation string) Counter
+	// Parts counts the uploaded parts of multipart uploads and PartBytes
+	// their bytes; PartDuration observes the time each took in seconds.
+	Parts, PartBytes Counter
+	PartDuration     Observer
+}
+
+// Recorder is a vercelblob.MetricsRecorder and vercelblob.HedgeRecorder
+// reporting to Metrics.
+type Recorder struct {
+	metrics Metrics
+}
+
+var (
+	_ vercelblob.MetricsRecorder = (*Recorder)(nil)
+	_ vercelblob.HedgeRecorder   = (*Recorder)(nil)
+)
+
+// New returns a Recorder reporting to metrics.
+func New(metrics Metrics) *Recorder {
+	return &Recorder{metrics: metrics}
+}
+
+func (r *Recorder) RecordRequest(operation vercelblob.Operation, code string, duration time.Duration, bytesIn, bytesOut int64) {
+	op := string(operation)
+	if r.metrics.Requests != nil {
+		r.metrics.Requests(op, code).Add(1)
+	}
+	if r.metrics.Duration != nil {
+		r.metrics.Duration(op).Observe(duration.Seconds())
+	}
+	if r.metrics.BytesIn != nil && bytesIn > 0 {
+		r.metrics.BytesIn(op).Add(float64(bytesIn))
+	}
+	if r.metrics.BytesOut != nil && bytesOut > 0 {
+		r.metrics.BytesOut(op).Add(float64(bytesOut))
+	}
+}
+
+func (r *Recorder) RecordRetry(operation vercelblob.Operation) {
+	if r.metrics.Retries != nil {
+		r.metrics.Retries(string(operation)).Add(1)
+	}
+}
+
+func (r *Recorder) RecordHedge(operation vercelblob.Operation) {
+	if r.metrics.Hedges != nil {
+		r.metrics.Hedges(string(operation)).Add(1)
+	}
+}
+
+func (r *Recorder) RecordMultipartPart(partNumber int, size int64, duration time.Duration) {
+	if r.metrics.Parts != nil {
+		r.metrics.Parts.Add(1)
+	}
+	if r.metrics.PartBytes != nil {
+		r.metrics.PartBytes.Add(float64(size))
+	}
+	if r.metrics.PartDuration != nil {
+		r.metrics.PartDuration.Observe(duration.Seconds())
+	}
+}
@@ -0,0 +1,44 @@
+package prommetrics
+
+import (
+	"testing"
+	"time"
+
+	vercelblob "github.com/claywarren/vercel_blob"
+)
+
+// vec is a fake metric vector keeping the value of each child.
+type vec map[string]float64
+
+type child struct {
+	v   vec
+	key string
+}
+
+func (c child) Add(v float64)     { c.v[c.key] += v }
+func (c child) Observe(v float64) { c.v[c.key] += v }
+
+func Test_Recorder(t *testing.T) {
+	requests, duration, bytesIn, retries, parts := vec{}, vec{}, vec{}, vec{}, vec{}
+	recorder := New(Metrics{
+		Requests: func(operation, code string) Counter { return child{requests, operation + "," + code} },
+		Duration: func(operation string) Observer { return child{duration, operation} },
+		BytesIn:  func(operation string) Counter { return child{bytesIn, operation} },
+		Retries:  func(operation string) Counter { return child{retries, operation} },
+		Parts:    child{parts, ""},
+	})
+
+	recorder.RecordRequest(vercelblob.OperationPut, "ok", 1500*time.Millisecond, 10, 20)
+	recorder.RecordRequest(vercelblob.OperationPut, "ok", 500*time.Millisecond, 5, 0)
+	recorder.RecordRequest(vercelblob.OperationHead, "not_found", 0, 0, 0)
+	recorder.RecordRetry(vercelblob.OperationList)
+	recorder.RecordHedge(vercelblob.OperationList)
+	recorder.RecordMultipartPart(1, 100, time.Second)
+
+	if requests["put,ok"] != 2 || requests["head,not_found"] != 1 {
+		t.Errorf("Unexpected requests %v", requests)
+	}
+	if duration["put"] != 2 || bytesIn["put"] != 15 || retries["list"] != 1 || parts[""] != 1 {
+		t.Errorf("Unexpected metrics %v, %v, %v, %v", duration, bytesIn, retries, parts)
+	}
+}
@@ -0,0 +1,195 @@
+package vercelblob
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimitStats contains the counters of the rate limiter of a client.
+type RateLimitStats struct {
+	// Requests is the number of requests that passed the limiter.
+	Requests uint64
+	// Delayed is the number of requests that had to wait for a slot.
+	Delayed uint64
+	// Waited is the total time requests waited for a slot.
+	Waited time.Duration
+	// Available is the number of requests the client-wide limit allows right
+	// now without waiting.
+	Available float64
+}
+
+// rateLimiter is a token bucket allowing rate requests per second with bursts
+// of up to burst requests. It is safe for concurrent use.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// refill adds the tokens accrued since the last call. The caller must hold
+// l.mu.
+func (l *rateLimiter) refill() {
+	t := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+t.Sub(l.last).Seconds()*l.rate)
+	l.last = t
+}
+
+// wait takes a token, waiting until one is available or ctx is done. It
+// returns how long it waited.
+func (l *rateLimiter) wait(ctx context.Context) (time.Duration, error) {
+	l.mu.Lock()
+	l.refill()
+	l.tokens--
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+	if delay <= 0 {
+		return 0, nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return delay, nil
+	case <-ctx.Done():
+		// Return the token so that later requests do not wait for it.
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return 0, ctx.Err()
+	}
+}
+
+func (l *rateLimiter) available() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill()
+	return math.Max(0, l.tokens)
+}
+
+// rateLimits holds the limiters of a client. It is replaced, not modified, by
+// options, so that copies of a client share the limiters they were created
+// with.
+type rateLimits struct {
+	limiter *rateLimiter
+	// operations overrides limiter per operation; a nil limiter means the
+	// operation is not limited.
+	operations map[Operation]*rateLimiter
+
+	mu    sync.Mutex
+	stats RateLimitStats
+}
+
+func (rl *rateLimits) clone() *rateLimits {
+	if rl == nil {
+		return &rateLimits{operations: map[Operation]*rateLimiter{}}
+	}
+	return &rateLimits{limiter: rl.limiter, operations: maps.Clone(rl.operations)}
+}
+
+// wait takes a slot for a request of operation from its limiter, if any.
+func (rl *rateLimits) wait(ctx context.Context, operation Operation) error {
+	if rl == nil {
+		return nil
+	}
+	limiter, ok := rl.operations[operation]
+	if !ok {
+		limiter = rl.limiter
+	}
+	if limiter == nil {
+		return nil
+	}
+	waited, err := limiter.wait(ctx)
+	if err != nil {
+		return err
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.stats.Requests++
+	if waited > 0 {
+		rl.stats.Delayed++
+		rl.stats.Waited += waited
+	}
+	return nil
+}
+
+// validateRateLimit returns an error for an invalid rate or burst.
+func validateRateLimit(option string, requestsPerSecond float64, burst int) error {
+	if !(requestsPerSecond > 0) || math.IsInf(requestsPerSecond, 1) {
+		return NewInvalidOptionError(option, fmt.Sprintf("%v is not a positive rate", requestsPerSecond))
+	}
+	if burst < 1 {
+		return NewInvalidOptionError(option, fmt.Sprintf("the burst %d is less than 1", burst))
+	}
+	return nil
+}
+
+// WithRateLimit limits the client to requestsPerSecond requests per second,
+// with bursts of up to burst requests, so that a batch job does not exhaust
+// the rate limit of a token shared with other traffic. Every request counts,
+// including each part of a multipart upload and retries. A request that
+// exceeds the limit waits for a slot, or fails with the context error if its
+// context is done first.
+//
+// The limit is shared by the copies of the client, including those created
+// with Clone unless they are given a rate limit of their own.
+func WithRateLimit(requestsPerSecond float64, burst int) ClientOption {
+	return func(c *Client) error {
+		if err := validateRateLimit("WithRateLimit", requestsPerSecond, burst); err != nil {
+			return err
+		}
+		c.rateLimits = c.rateLimits.clone()
+		c.rateLimits.limiter = newRateLimiter(requestsPerSecond, burst)
+		return nil
+	}
+}
+
+// WithOperationRateLimit gives the requests of operation a limit of their own
+// instead of the one of WithRateLimit. A requestsPerSecond of zero removes
+// the limit for operation, e.g. to limit writes but not reads:
+//
+//	client, err := NewClientWithOptions(
+//		WithRateLimit(10, 10),
+//		WithOperationRateLimit(OperationHead, 0, 0),
+//		WithOperationRateLimit(OperationList, 0, 0),
+//	)
+func WithOperationRateLimit(operation Operation, requestsPerSecond float64, burst int) ClientOption {
+	return func(c *Client) error {
+		var limiter *rateLimiter
+		if requestsPerSecond != 0 {
+			if err := validateRateLimit("WithOperationRateLimit", requestsPerSecond, burst); err != nil {
+				return err
+			}
+			limiter = newRateLimiter(requestsPerSecond, burst)
+		}
+		c.rateLimits = c.rateLimits.clone()
+		c.rateLimits.operations[operation] = limiter
+		return nil
+	}
+}
+
+// RateLimitStats returns the counters of the rate limiter of the client.
+func (c *Client) RateLimitStats() RateLimitStats {
+	rl := c.rateLimits
+	if rl == nil {
+		return RateLimitStats{}
+	}
+	rl.mu.Lock()
+	stats := rl.stats
+	rl.mu.Unlock()
+	if rl.limiter != nil {
+		stats.Available = rl.limiter.available()
+	}
+	return stats
+}
@@ -0,0 +1,100 @@
+package vercelblob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newRateLimitServer(t *testing.T) (*httptest.Server, *atomic.Int64) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		_, _ = io.Copy(io.Discard, r.Body)
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.bin","pathname":"a.bin","uploadId":"id","key":"key","blobs":[]}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func Test_WithRateLimit_Mock(t *testing.T) {
+	server, _ := newRateLimitServer(t)
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")), WithRateLimit(100, 2))
+	ctx := context.Background()
+
+	start := time.Now()
+	for range 6 {
+		if _, err := client.Head(ctx, "a.bin"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The burst covers 2 requests; the other 4 wait 10ms each.
+	if elapsed := time.Since(start); elapsed < 35*time.Millisecond {
+		t.Errorf("Expected the requests to be spread out, took %v", elapsed)
+	}
+	stats := client.RateLimitStats()
+	if stats.Requests != 6 || stats.Delayed < 3 || stats.Waited <= 0 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	// Every part of a multipart upload counts.
+	client = newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")), WithRateLimit(1000, 10))
+	if _, err := client.Put(ctx, "a.bin", bytes.NewReader(make([]byte, MultipartThreshold+1)), PutCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if stats := client.RateLimitStats(); stats.Requests != 4 {
+		t.Errorf("Expected 4 requests to be counted, got %+v", stats)
+	}
+}
+
+func Test_WithOperationRateLimit_Mock(t *testing.T) {
+	server, requests := newRateLimitServer(t)
+	client := newTestClient(t,
+		WithBaseURL(server.URL),
+		WithTokenProvider(StaticTokenProvider("token")),
+		WithRateLimit(0.1, 1),
+		WithOperationRateLimit(OperationHead, 0, 0),
+	)
+	ctx := context.Background()
+
+	for range 5 {
+		if _, err := client.Head(ctx, "a.bin"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := client.List(ctx, ListCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	// The next list has to wait 10 seconds for a slot.
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.List(ctx, ListCommandOptions{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if n := requests.Load(); n != 6 {
+		t.Errorf("Expected the limited request not to be sent, got %d requests", n)
+	}
+	if stats := client.RateLimitStats(); stats.Requests != 1 || stats.Available >= 1 {
+		t.Errorf("Expected only the list to pass the limiter, got %+v", stats)
+	}
+}
+
+func Test_WithRateLimit_Invalid(t *testing.T) {
+	for _, opt := range []ClientOption{
+		WithRateLimit(0, 1),
+		WithRateLimit(-1, 1),
+		WithRateLimit(10, 0),
+		WithOperationRateLimit(OperationPut, 10, 0),
+		WithOperationRateLimit(OperationPut, -1, 1),
+	} {
+		if _, err := NewClientWithOptions(opt); err == nil {
+			t.Error("Expected an error for an invalid rate limit")
+		}
+	}
+}
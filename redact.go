@@ -0,0 +1,76 @@
+package vercelblob
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"strings"
+)
+
+// redactedMarker replaces the secret part of a redacted token.
+const redactedMarker = "****"
+
+// redactMinSecretLen is the length from which Redact keeps the last four
+// characters of a secret; shorter secrets are hidden entirely.
+const redactMinSecretLen = 16
+
+// Redact returns a form of token that is safe to log. The vercel_blob_rw_ and
+// vercel_blob_client_ prefixes and the store ID are kept, as they also appear
+// in blob URLs, and so are the last four characters of long secrets:
+//
+//	Redact("vercel_blob_rw_abc123_0123456789abcdefwxyz") == "vercel_blob_rw_abc123_****wxyz"
+func Redact(token string) string {
+	if token == "" {
+		return ""
+	}
+	visible, secret := "", token
+	for _, prefix := range []string{readWriteTokenPrefix, clientTokenPrefix} {
+		if rest, ok := strings.CutPrefix(token, prefix); ok {
+			if storeID, rest, ok := strings.Cut(rest, "_"); ok {
+				visible, secret = prefix+storeID+"_", rest
+			}
+			break
+		}
+	}
+	if len(secret) < redactMinSecretLen {
+		return visible + redactedMarker
+	}
+	return visible + redactedMarker + secret[len(secret)-4:]
+}
+
+// redactTokens replaces every occurrence of the tokens in s by their
+// redacted form.
+func redactTokens(s string, tokens ...string) string {
+	for _, token := range tokens {
+		if token != "" {
+			s = strings.ReplaceAll(s, token, Redact(token))
+		}
+	}
+	return s
+}
+
+// requestToken returns the bearer token a request was sent with, or "".
+func requestToken(req *http.Request) string {
+	if req == nil {
+		return ""
+	}
+	token, _ := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return token
+}
+
+// DumpRequest is httputil.DumpRequestOut with the Authorization header
+// redacted, for logging the requests of a custom http.RoundTripper. The body
+// of req is restored after dumping, as with httputil.DumpRequestOut.
+func DumpRequest(req *http.Request, body bool) ([]byte, error) {
+	token := requestToken(req)
+	clone := req.Clone(req.Context())
+	if auth := clone.Header.Get("Authorization"); auth != "" {
+		if token != "" {
+			clone.Header.Set("Authorization", "Bearer "+Redact(token))
+		} else {
+			clone.Header.Set("Authorization", redactedMarker)
+		}
+	}
+	dump, err := httputil.DumpRequestOut(clone, body)
+	req.Body = clone.Body
+	return dump, err
+}
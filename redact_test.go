@@ -0,0 +1,107 @@
+package vercelblob
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_Redact(t *testing.T) {
+	tests := []struct {
+		token string
+		want  string
+	}{
+		{"", ""},
+		{"vercel_blob_rw_abc123_0123456789abcdefwxyz", "vercel_blob_rw_abc123_****wxyz"},
+		{"vercel_blob_rw_abc123_short", "vercel_blob_rw_abc123_****"},
+		{"vercel_blob_client_abc123_MDEyMzQ1Njc4OWFiY2RlZg==", "vercel_blob_client_abc123_****Zg=="},
+		{"0123456789abcdefwxyz", "****wxyz"},
+		{"secret", "****"},
+	}
+	for _, tt := range tests {
+		if got := Redact(tt.token); got != tt.want {
+			t.Errorf("Expected %q, got %q", tt.want, got)
+		}
+	}
+}
+
+func Test_Errors_DoNotContainToken_Mock(t *testing.T) {
+	const token = "vercel_blob_rw_abc123_0123456789abcdefSECRET"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Echo the credentials back, as a misbehaving proxy might.
+		echo := r.Header.Get("Authorization")
+		switch r.URL.Query().Get("url") {
+		case "bad":
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":{"code":"bad_request","message":"invalid ` + echo + `"}}`))
+		default:
+			w.WriteHeader(http.StatusTeapot)
+			_, _ = w.Write([]byte(`{"error":{"code":"teapot","message":"` + echo + `"}}`))
+		}
+	}))
+	defer server.Close()
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer endpoint.Close()
+
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider(token)))
+	ctx := context.Background()
+
+	var errs []error
+	_, err := client.Head(ctx, "bad")
+	errs = append(errs, err)
+	_, err = client.Head(ctx, "other")
+	errs = append(errs, err)
+	_, err = NewHTTPTokenProvider("https://user:"+token+"@"+strings.TrimPrefix(endpoint.URL, "http://"),
+		WithEndpointBearer(func() (string, error) { return token, nil })).GetToken("put", "a.txt")
+	errs = append(errs, err)
+	_, err = NewHTTPTokenProvider(endpoint.URL,
+		WithEndpointBearer(func() (string, error) { return token, nil })).GetToken("put", "a.txt")
+	errs = append(errs, err)
+	_, err = NewMultiStoreTokenProvider().SetStoreEnv("abc123", "UNSET_BLOB_TOKEN").GetStoreToken("abc123", "put", "a.txt")
+	errs = append(errs, err)
+	_, err = VerifyClientToken(token, "vercel_blob_client_abc123_invalid")
+	errs = append(errs, err)
+
+	for i, err := range errs {
+		if err == nil {
+			t.Errorf("Expected scenario %d to fail", i)
+			continue
+		}
+		if strings.Contains(err.Error(), "0123456789abcdefSECRET") {
+			t.Errorf("Expected scenario %d not to contain the token, got %q", i, err)
+		}
+	}
+	if !strings.Contains(errs[0].Error(), Redact(token)) {
+		t.Errorf("Expected the redacted token in %q", errs[0])
+	}
+}
+
+func Test_DumpRequest(t *testing.T) {
+	const token = "vercel_blob_rw_abc123_0123456789abcdefSECRET"
+	req, _ := http.NewRequest(http.MethodPut, "https://blob.vercel-storage.com/a.txt", bytes.NewReader([]byte("hello")))
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	dump, err := DumpRequest(req, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(dump), token) {
+		t.Errorf("Expected the token to be redacted, got %s", dump)
+	}
+	if !strings.Contains(string(dump), "Authorization: Bearer "+Redact(token)) || !strings.Contains(string(dump), "hello") {
+		t.Errorf("Expected redacted header and body, got %s", dump)
+	}
+	if req.Header.Get("Authorization") != "Bearer "+token {
+		t.Errorf("Expected the request header to be untouched, got %s", req.Header.Get("Authorization"))
+	}
+	body := new(bytes.Buffer)
+	if _, err := body.ReadFrom(req.Body); err != nil || body.String() != "hello" {
+		t.Errorf("Expected the body to be restored, got %q, %v", body, err)
+	}
+}
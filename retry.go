@@ -0,0 +1,390 @@
+package vercelblob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// RetryPolicy configures how a client retries requests that failed with a
+// transient error: a server error, a rate limit or a failure in transit. The
+// zero value disables retries.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a request is sent, including the
+	// first. Zero and one disable retries.
+	MaxAttempts int
+	// Backoff computes the delay before each retry. If it is nil, the
+	// delays are those of ExponentialWithJitter with BaseDelay, MaxDelay
+	// and Jitter.
+	Backoff Backoff
+	// BaseDelay is the delay before the first retry. It doubles with each
+	// further retry.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between two attempts, if positive.
+	MaxDelay time.Duration
+	// MaxRetryAfter caps the delay requested by a Retry-After header, if
+	// positive.
+	MaxRetryAfter time.Duration
+	// Jitter is the fraction of each delay, between 0 and 1, that is
+	// randomized so that clients failing together do not retry together.
+	Jitter float64
+	// OnRetry, if set, is called before each retry, like the hook of
+	// WithOnRetry.
+	OnRetry func(RetryAttempt)
+}
+
+// RetryAttempt describes a retry about to happen.
+type RetryAttempt struct {
+	Operation Operation
+	Pathname  string
+	// Attempt is the number of the attempt that failed, starting at 1.
+	Attempt int
+	// Delay is the time until the next attempt.
+	Delay time.Duration
+	// Err is the error the attempt failed with.
+	Err error
+}
+
+// WithRetry makes the client retry requests that fail with a transient
+// error, as reported by IsRetryable, according to policy. Requests whose body
+// cannot be sent again, such as a Put from a plain io.Reader, are retried
+// only once, and only if the host could not be resolved or connected to
+// before any of the body was read. A Retry-After header sent with a 429 or
+// 503 response replaces the computed delay, up to MaxRetryAfter. Retries
+// stay within the deadline of the context: the last backoff is shortened so
+// that one more attempt fits, and if none fits the last failure is returned
+// at once, wrapped in an error saying that the deadline would be exceeded
+// before the retry. Without retries, RetryAfter reports the delay the API
+// asked for.
+//
+// Every request of a multipart upload is retried on its own, so a failed
+// part does not restart the upload. A download whose body breaks off is
+// resumed: the rest is requested with a range starting where it broke off,
+// as long as the blob keeps the ETag of the first response, up to
+// MaxAttempts-1 times.
+func WithRetry(policy RetryPolicy) ClientOption {
+	return func(c *Client) error {
+		if err := validateRetryPolicy("WithRetry", policy); err != nil {
+			return err
+		}
+		c.retryPolicy = policy
+		return nil
+	}
+}
+
+// WithOperationRetry gives the requests of operation a retry policy of their
+// own instead of the one of WithRetry, e.g. to retry reads eagerly but
+// uploads at most once:
+//
+//	client, err := NewClientWithOptions(
+//		WithRetry(RetryPolicy{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond}),
+//		WithOperationRetry(OperationPut, RetryPolicy{MaxAttempts: 2, BaseDelay: time.Second}),
+//	)
+//
+// The prefix operations and other helpers retry their requests with the
+// policy of each request's operation. The parts of a multipart upload are
+// retried with the policy of OperationMultipartPart and by nothing else, so
+// a zero RetryPolicy for it disables part retries.
+func WithOperationRetry(operation Operation, policy RetryPolicy) ClientOption {
+	return func(c *Client) error {
+		if err := validateRetryPolicy("WithOperationRetry", policy); err != nil {
+			return err
+		}
+		retries := maps.Clone(c.operationRetries)
+		if retries == nil {
+			retries = map[Operation]RetryPolicy{}
+		}
+		retries[operation] = policy
+		c.operationRetries = retries
+		return nil
+	}
+}
+
+// WithOnRetry makes the client call fn before each retry of WithRetry, with
+// the operation, the attempt that failed, its error and the delay before the
+// next one, e.g. to count retries. fn only observes the retry: it cannot
+// cancel or change it. It is called synchronously between two attempts, so
+// calls for one operation never overlap, but calls for different operations
+// may run concurrently. A panic in fn is recovered and counted in
+// RetryHookPanics, and the retry proceeds as if fn had returned. Retries are
+// also logged by WithLogger.
+func WithOnRetry(fn func(RetryAttempt)) ClientOption {
+	return func(c *Client) error {
+		c.retryHook = &retryHook{fn: fn}
+		return nil
+	}
+}
+
+// retryHook holds the hook of WithOnRetry and the number of panics recovered
+// from it and from RetryPolicy.OnRetry.
+type retryHook struct {
+	fn     func(RetryAttempt)
+	panics atomic.Uint64
+}
+
+// RetryHookPanics returns the number of panics recovered from the hook of
+// WithOnRetry and from the OnRetry of the retry policies of the client.
+func (c *Client) RetryHookPanics() uint64 {
+	if c.retryHook == nil {
+		return 0
+	}
+	return c.retryHook.panics.Load()
+}
+
+// notifyRetry reports attempt to the retry hooks and the logger.
+func (c *Client) notifyRetry(req *http.Request, policy RetryPolicy, attempt RetryAttempt) {
+	if stats := operationStatsFrom(req.Context()); stats != nil {
+		stats.retries.Add(1)
+	}
+	if count, ok := req.Context().Value(retryCountKey{}).(*atomic.Int64); ok {
+		count.Add(1)
+	}
+	if c.usage != nil {
+		c.usage.retries.Add(1)
+	}
+	if c.retryHook != nil {
+		c.callRetryHook(c.retryHook.fn, attempt)
+	}
+	c.callRetryHook(policy.OnRetry, attempt)
+	if c.metrics != nil {
+		c.metrics.RecordRetry(attempt.Operation)
+	}
+	if ctx := req.Context(); c.logEnabled(ctx) {
+		token := requestToken(req)
+		c.logger.LogAttrs(ctx, c.logLevel, "blob retry",
+			slog.String("operation", string(attempt.Operation)),
+			slog.String("pathname", redactTokens(attempt.Pathname, token)),
+			slog.Int("attempt", attempt.Attempt),
+			slog.Duration("delay", attempt.Delay),
+			slog.String("error", redactTokens(attempt.Err.Error(), token)),
+		)
+	}
+}
+
+// retryCountKey is the context key of the counter of withRetryCount.
+type retryCountKey struct{}
+
+// withRetryCount returns a context counting the retries of the requests sent
+// with it, and the counter. Unlike the OperationStats, the count is not shared
+// with an outer call.
+func withRetryCount(ctx context.Context) (context.Context, *atomic.Int64) {
+	count := new(atomic.Int64)
+	return context.WithValue(ctx, retryCountKey{}, count), count
+}
+
+// callRetryHook calls fn, if set, recovering from a panic in it.
+func (c *Client) callRetryHook(fn func(RetryAttempt), attempt RetryAttempt) {
+	if fn == nil {
+		return
+	}
+	defer func() {
+		if recover() != nil && c.retryHook != nil {
+			c.retryHook.panics.Add(1)
+		}
+	}()
+	fn(attempt)
+}
+
+// validateRetryPolicy returns an error for an invalid policy.
+func validateRetryPolicy(option string, policy RetryPolicy) error {
+	switch {
+	case policy.MaxAttempts < 0:
+		return NewInvalidOptionError(option, fmt.Sprintf("MaxAttempts %d is negative", policy.MaxAttempts))
+	case policy.BaseDelay < 0 || policy.MaxDelay < 0 || policy.MaxRetryAfter < 0:
+		return NewInvalidOptionError(option, "delays must not be negative")
+	case !(policy.Jitter >= 0 && policy.Jitter <= 1):
+		return NewInvalidOptionError(option, fmt.Sprintf("Jitter %v is not between 0 and 1", policy.Jitter))
+	}
+	return nil
+}
+
+// retryPolicyFor returns the retry policy of operation.
+func (c *Client) retryPolicyFor(operation Operation) RetryPolicy {
+	if policy, ok := c.operationRetries[operation]; ok {
+		return policy
+	}
+	return c.retryPolicy
+}
+
+// delay returns the delay before the retry following attempt, which failed
+// with cause. The jitter of ExponentialWithJitter is drawn from r.
+func (p RetryPolicy) delay(attempt int, cause error, r *lockedRand) time.Duration {
+	backoff := p.Backoff
+	if backoff == nil {
+		backoff = ExponentialWithJitter{Base: p.BaseDelay, Max: p.MaxDelay, Jitter: p.Jitter}
+	}
+	if jittered, ok := backoff.(ExponentialWithJitter); ok {
+		return max(0, jittered.next(attempt, cause, r.Float64))
+	}
+	return max(0, backoff.Next(attempt, cause))
+}
+
+// retryAfter returns the delay requested by the Retry-After header of resp,
+// in seconds or as an HTTP date counted from now, or 0 if there is none.
+func retryAfter(resp *http.Response, now time.Time) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	value := resp.Header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(0, time.Duration(seconds)*time.Second)
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(0, date.Sub(now))
+	}
+	return 0
+}
+
+// minRetryAttemptBudget is the least time left before the deadline of a
+// context for which a retry is attempted.
+const minRetryAttemptBudget = 10 * time.Millisecond
+
+// canResend reports whether the body of req can be sent again.
+func canResend(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// unsentBody wraps a request body that cannot be sent again, to tell whether
+// any of it was read. It is closed by release rather than by the transport,
+// so that it can be sent again after a failure to connect.
+type unsentBody struct {
+	io.ReadCloser
+	read    atomic.Int64
+	retried bool
+}
+
+func (b *unsentBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read.Add(int64(n))
+	return n, err
+}
+
+func (b *unsentBody) Close() error {
+	return nil
+}
+
+// release closes the wrapped body once no more attempts are made.
+func (b *unsentBody) release() {
+	_ = b.ReadCloser.Close()
+}
+
+// isDialError reports whether err is a failure to resolve or connect to the
+// host, which happens before any of the request is sent.
+func isDialError(err error) bool {
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	return errors.As(err, &dnsErr) || errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// retryCause returns the error that makes the outcome of an attempt worth
+// retrying, or nil if it is final. A response is classified by the error it
+// would be reported as; its body is kept for the caller.
+func (c *Client) retryCause(resp *http.Response, err error) error {
+	if err != nil {
+		if IsRetryable(err) {
+			return err
+		}
+		return nil
+	}
+	if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		return nil
+	}
+	if apiErr := c.peekAPIError(resp); IsRetryable(apiErr) {
+		return apiErr
+	}
+	return nil
+}
+
+// peekAPIError returns the error resp would be reported as, keeping its body
+// for the caller.
+func (c *Client) peekAPIError(resp *http.Response) *APIError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	apiErr := c.newAPIError(resp, decodeError(resp))
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	return apiErr
+}
+
+// sendWithRetries sends req with send, retrying it according to the retry
+// policy of the client.
+func (c *Client) sendWithRetries(req *http.Request, operation Operation, pathname string) (*http.Response, error) {
+	policy := c.retryPolicyFor(operation)
+	ctx := req.Context()
+	var unsent *unsentBody
+	if policy.MaxAttempts > 1 && !canResend(req) {
+		unsent = &unsentBody{ReadCloser: req.Body}
+		defer unsent.release()
+		req.Body = unsent
+	}
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		resp, err := c.sendThroughBreaker(req, operation, pathname)
+		if attempt >= policy.MaxAttempts {
+			return resp, err
+		}
+		if !canResend(req) {
+			// A body that cannot be sent again can still be sent once more
+			// if the request never reached the server.
+			if unsent.retried || unsent.read.Load() > 0 || !isDialError(err) {
+				return resp, err
+			}
+			unsent.retried = true
+		}
+		cause := c.retryCause(resp, err)
+		if cause == nil {
+			return resp, err
+		}
+		delay, fixed := policy.delay(attempt, cause, c.random()), false
+		if after := retryAfter(resp, c.now()); after > 0 {
+			delay, fixed = after, true
+			if policy.MaxRetryAfter > 0 {
+				delay = min(delay, policy.MaxRetryAfter)
+			}
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			// Leave time for one more attempt, shortening the backoff if
+			// need be; a delay asked for by the API cannot be shortened.
+			budget := time.Until(deadline) - max(2*time.Since(start), minRetryAttemptBudget)
+			if budget < delay && (fixed || budget <= 0) {
+				if resp != nil {
+					cause = c.handleError(resp)
+				}
+				return nil, fmt.Errorf("deadline would be exceeded before retry: %w", cause)
+			}
+			delay = min(delay, budget)
+		}
+
+		retry := req.Clone(ctx)
+		if req.GetBody != nil {
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return resp, err
+			}
+			retry.Body = body
+		}
+		if resp != nil {
+			_ = resp.Body.Close()
+		}
+		c.notifyRetry(req, policy, RetryAttempt{Operation: operation, Pathname: pathname, Attempt: attempt, Delay: delay, Err: cause})
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+		req = retry
+	}
+}
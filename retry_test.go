@@ -0,0 +1,440 @@
+package vercelblob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newFlakyServer returns a server that answers the first failures requests
+// with status and body, and later ones with a successful result.
+func newFlakyServer(t *testing.T, failures int, status int, body string) (*httptest.Server, *atomic.Int64) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		if requests.Add(1) <= int64(failures) {
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(body))
+			return
+		}
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.txt","pathname":"a.txt","blobs":[]}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func Test_WithRetry_Mock(t *testing.T) {
+	server, requests := newFlakyServer(t, 2, http.StatusServiceUnavailable, "")
+	var retries []RetryAttempt
+	client := newTestClient(t,
+		WithBaseURL(server.URL),
+		WithTokenProvider(StaticTokenProvider("token")),
+		WithRetry(RetryPolicy{
+			MaxAttempts: 3,
+			BaseDelay:   time.Millisecond,
+			OnRetry:     func(r RetryAttempt) { retries = append(retries, r) },
+		}),
+	)
+
+	if _, err := client.Head(context.Background(), "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("Expected 3 requests, got %d", n)
+	}
+	if len(retries) != 2 || retries[0].Attempt != 1 || retries[1].Attempt != 2 || retries[1].Delay != 2*time.Millisecond {
+		t.Errorf("Unexpected retries: %+v", retries)
+	}
+	if retries[0].Operation != OperationHead || retries[0].Pathname != "a.txt" || !IsRetryable(retries[0].Err) {
+		t.Errorf("Unexpected retry: %+v", retries[0])
+	}
+
+	// The last failure is returned once the attempts run out.
+	requests.Store(-10)
+	if _, err := client.Put(context.Background(), "a.txt", strings.NewReader("a"), PutCommandOptions{}); !errors.Is(err, &Error{Code: "unknown_error"}) {
+		t.Errorf("Expected the server error, got %v", err)
+	}
+	if n := requests.Load(); n != -7 {
+		t.Errorf("Expected 3 attempts, got %d", n+10)
+	}
+}
+
+func Test_WithRetry_NotRetried_Mock(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		opts   []ClientOption
+		put    io.Reader
+	}{
+		{name: "default policy", status: http.StatusServiceUnavailable},
+		{name: "not transient", status: http.StatusServiceUnavailable, body: `{"error":{"code":"store_suspended"}}`, opts: []ClientOption{WithRetry(RetryPolicy{MaxAttempts: 3})}},
+		{name: "client error", status: http.StatusBadRequest, body: `{"error":{"code":"bad_request"}}`, opts: []ClientOption{WithRetry(RetryPolicy{MaxAttempts: 3})}},
+		{name: "unsendable body", status: http.StatusServiceUnavailable, opts: []ClientOption{WithRetry(RetryPolicy{MaxAttempts: 3})}, put: io.MultiReader(strings.NewReader("a"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := newFlakyServer(t, 1, tt.status, tt.body)
+			opts := append([]ClientOption{WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token"))}, tt.opts...)
+			client := newTestClient(t, opts...)
+			var err error
+			if tt.put != nil {
+				_, err = client.Put(context.Background(), "a.txt", tt.put, PutCommandOptions{})
+			} else {
+				_, err = client.List(context.Background(), ListCommandOptions{})
+			}
+			if err == nil || requests.Load() != 1 {
+				t.Errorf("Expected a single failed request, got %d requests and %v", requests.Load(), err)
+			}
+		})
+	}
+}
+
+func Test_WithRetry_RetryAfter_Mock(t *testing.T) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	client := newTestClient(t,
+		WithBaseURL(server.URL),
+		WithTokenProvider(StaticTokenProvider("token")),
+		WithRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}),
+	)
+
+	// Waiting a second would exceed the deadline, so the 429 is returned.
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := client.List(ctx, ListCommandOptions{})
+	if !IsRateLimited(err) || requests.Load() != 1 || time.Since(start) > 250*time.Millisecond {
+		t.Errorf("Expected an immediate rate limit error after 1 request, got %v after %d requests", err, requests.Load())
+	}
+	if !strings.HasPrefix(err.Error(), "deadline would be exceeded before retry: ") {
+		t.Errorf("Expected the error to explain the missing retry, got %v", err)
+	}
+}
+
+func Test_WithRetry_Invalid(t *testing.T) {
+	for _, policy := range []RetryPolicy{
+		{MaxAttempts: -1},
+		{BaseDelay: -time.Second},
+		{MaxDelay: -time.Second},
+		{Jitter: 1.5},
+	} {
+		if _, err := NewClientWithOptions(WithRetry(policy)); CodeOf(err) != "invalid_option" {
+			t.Errorf("Expected an invalid_option error for %+v, got %v", policy, err)
+		}
+	}
+}
+
+func Test_RetryPolicy_delay(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for i, w := range want {
+		if d := policy.delay(i+1, nil, defaultRand); d != w {
+			t.Errorf("Expected a delay of %v after attempt %d, got %v", w, i+1, d)
+		}
+	}
+	policy.Jitter = 0.5
+	for range 100 {
+		if d := policy.delay(1, nil, defaultRand); d < 50*time.Millisecond || d > 100*time.Millisecond {
+			t.Fatalf("Expected a jittered delay between 50ms and 100ms, got %v", d)
+		}
+	}
+}
+
+func Test_retryAfter(t *testing.T) {
+	fixed := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", 0},
+		{"2", 2 * time.Second},
+		{"-1", 0},
+		{fixed.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{fixed.Add(-time.Minute).Format(http.TimeFormat), 0},
+		{"soon", 0},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{Header: http.Header{"Retry-After": {tt.header}}}
+		if got := retryAfter(resp, fixed); got != tt.want {
+			t.Errorf("Expected %v for %q, got %v", tt.want, tt.header, got)
+		}
+	}
+}
+
+func Test_RetryAfter_Mock(t *testing.T) {
+	var header string
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", header)
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte(`{"blobs":[]}`))
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	// Without retries, the delay is reported with the error.
+	header = "2"
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")))
+	_, err := client.List(ctx, ListCommandOptions{})
+	if after, ok := RetryAfter(err); !ok || after != 2*time.Second || !IsRateLimited(err) {
+		t.Errorf("Expected a rate limit error asking for 2s, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "retry after 2s") {
+		t.Errorf("Expected the delay in the message, got %v", err)
+	}
+	if _, ok := RetryAfter(errors.New("boom")); ok {
+		t.Error("Expected no delay for a foreign error")
+	}
+
+	// With retries, the client waits, capped by MaxRetryAfter.
+	for _, h := range []string{"30", time.Now().Add(30 * time.Second).Format(http.TimeFormat)} {
+		requests.Store(0)
+		header = h
+		var delays []time.Duration
+		client = newTestClient(t,
+			WithBaseURL(server.URL),
+			WithTokenProvider(StaticTokenProvider("token")),
+			WithRetry(RetryPolicy{
+				MaxAttempts:   2,
+				MaxRetryAfter: 10 * time.Millisecond,
+				OnRetry:       func(r RetryAttempt) { delays = append(delays, r.Delay) },
+			}),
+		)
+		if _, err := client.List(ctx, ListCommandOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if len(delays) != 1 || delays[0] != 10*time.Millisecond || requests.Load() != 2 {
+			t.Errorf("Expected one retry after 10ms for %q, got %v", h, delays)
+		}
+	}
+}
+
+func Test_WithRetry_Deadline_Mock(t *testing.T) {
+	server, requests := newFlakyServer(t, 100, http.StatusServiceUnavailable, "")
+	client := newTestClient(t,
+		WithBaseURL(server.URL),
+		WithTokenProvider(StaticTokenProvider("token")),
+		WithRetry(RetryPolicy{MaxAttempts: 10, BaseDelay: 100 * time.Millisecond}),
+	)
+
+	// The second backoff of 200ms is shortened to fit a third attempt, after
+	// which no time is left.
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := client.Head(ctx, "a.txt")
+	elapsed := time.Since(start)
+	if n := requests.Load(); n != 3 {
+		t.Errorf("Expected 3 attempts, got %d", n)
+	}
+	if !strings.HasPrefix(err.Error(), "deadline would be exceeded before retry: ") || !IsRetryable(err) || errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the last server error before the deadline, got %v", err)
+	}
+	if elapsed < 250*time.Millisecond || elapsed >= 300*time.Millisecond {
+		t.Errorf("Expected to return just before the deadline, took %v", elapsed)
+	}
+
+	// A deadline too close for any retry returns after the first attempt.
+	requests.Store(0)
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if _, err := client.Head(ctx, "a.txt"); requests.Load() != 1 || !IsRetryable(err) {
+		t.Errorf("Expected a single attempt, got %d and %v", requests.Load(), err)
+	}
+}
+
+func Test_WithOperationRetry_Mock(t *testing.T) {
+	var requests []string
+	failures := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		kind := r.Method + " " + r.Header.Get("X-MPU-Action")
+		requests = append(requests, kind)
+		if failures[kind] > 0 {
+			failures[kind]--
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("ETag", `"etag"`)
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.txt","pathname":"a.txt","uploadId":"id","key":"key","blobs":[{"url":"https://blob.com/a.txt","pathname":"a.txt"}]}`))
+	}))
+	defer server.Close()
+	client := newTestClient(t,
+		WithBaseURL(server.URL),
+		WithTokenProvider(StaticTokenProvider("token")),
+		WithRetry(RetryPolicy{MaxAttempts: 3}),
+		WithOperationRetry(OperationPut, RetryPolicy{MaxAttempts: 1}),
+		WithOperationRetry(OperationMultipartPart, RetryPolicy{MaxAttempts: 2}),
+	)
+	ctx := context.Background()
+
+	failures["GET "] = 2
+	if _, err := client.Head(ctx, "a.txt"); err != nil {
+		t.Errorf("Expected the head to be retried, got %v", err)
+	}
+	failures["PUT "] = 1
+	if _, err := client.Put(ctx, "a.txt", strings.NewReader("a"), PutCommandOptions{}); err == nil {
+		t.Error("Expected the put not to be retried")
+	}
+	failures["DELETE "], failures["POST "] = 0, 2
+	if res, err := client.DeletePrefix(ctx, "", PrefixOptions{}); err != nil || res.Err() != nil {
+		t.Errorf("Expected the deletes of the prefix to be retried, got %v, %v", err, res.Err())
+	}
+	failures["PUT upload"] = 1
+	if _, err := client.Put(ctx, "a.bin", strings.NewReader(strings.Repeat("a", MultipartThreshold+1)), PutCommandOptions{}); err != nil {
+		t.Errorf("Expected the part to be retried, got %v", err)
+	}
+
+	want := []string{
+		"GET ", "GET ", "GET ",
+		"PUT ",
+		"GET ", "POST ", "POST ", "POST ",
+		"POST create", "PUT upload", "PUT upload", "PUT upload", "POST complete",
+	}
+	if strings.Join(requests, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected the requests\n%v\ngot\n%v", want, requests)
+	}
+
+	if _, err := NewClientWithOptions(WithOperationRetry(OperationHead, RetryPolicy{MaxAttempts: -1})); CodeOf(err) != "invalid_option" {
+		t.Errorf("Expected an invalid_option error, got %v", err)
+	}
+}
+
+func Test_WithOnRetry_Mock(t *testing.T) {
+	server, requests := newFlakyServer(t, 2, http.StatusBadGateway, "")
+	var attempts []RetryAttempt
+	var logs bytes.Buffer
+	client := newTestClient(t,
+		WithBaseURL(server.URL),
+		WithTokenProvider(StaticTokenProvider("token")),
+		WithRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}),
+		WithOnRetry(func(a RetryAttempt) {
+			attempts = append(attempts, a)
+			if a.Attempt == 1 {
+				panic("boom")
+			}
+		}),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))),
+	)
+
+	if _, err := client.Put(context.Background(), "a.txt", bytes.NewReader([]byte("a")), PutCommandOptions{}); err != nil {
+		t.Fatalf("Expected the panic not to stop the retries, got %v", err)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("Expected 3 requests, got %d", n)
+	}
+	if len(attempts) != 2 || attempts[0].Attempt != 1 || attempts[1].Attempt != 2 || attempts[1].Operation != OperationPut || attempts[1].Delay != 2*time.Millisecond || !IsRetryable(attempts[1].Err) {
+		t.Errorf("Unexpected attempts: %+v", attempts)
+	}
+	if n := client.RetryHookPanics(); n != 1 {
+		t.Errorf("Expected 1 recovered panic, got %d", n)
+	}
+	if n := strings.Count(logs.String(), `msg="blob retry"`); n != 2 || !strings.Contains(logs.String(), "attempt=2") {
+		t.Errorf("Expected the retries to be logged, got %s", logs.String())
+	}
+
+	clone, _ := client.Clone()
+	if clone.RetryHookPanics() != 0 {
+		t.Error("Expected the clone to count its own panics")
+	}
+}
+
+// closedPortURL returns the URL of a local port that refuses connections.
+func closedPortURL(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	_ = listener.Close()
+	return "http://" + addr
+}
+
+// trackedReader is a body that cannot be sent again and records whether it
+// was closed.
+type trackedReader struct {
+	io.Reader
+	closed int
+}
+
+func (r *trackedReader) Close() error {
+	r.closed++
+	return nil
+}
+
+func Test_WithRetry_Unsent_Mock(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, string(body))
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.txt","pathname":"a.txt"}`))
+	}))
+	defer server.Close()
+	unreachable, err := url.Parse(closedPortURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first dials of each test go to a port that refuses connections.
+	var refused atomic.Int64
+	client := newTestClient(t,
+		WithBaseURL(server.URL),
+		WithTokenProvider(StaticTokenProvider("token")),
+		WithRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}),
+		WithMiddleware(func(next RoundTripFunc) RoundTripFunc {
+			return func(req *http.Request) (*http.Response, error) {
+				if refused.Add(-1) >= 0 {
+					req = req.Clone(req.Context())
+					req.URL.Host = unreachable.Host
+				}
+				return next(req)
+			}
+		}),
+	)
+	ctx := context.Background()
+
+	refused.Store(1)
+	body := &trackedReader{Reader: strings.NewReader("hello")}
+	if _, err := client.Put(ctx, "a.txt", body, PutCommandOptions{}); err != nil {
+		t.Fatalf("Expected the unsent body to be sent again, got %v", err)
+	}
+	if len(received) != 1 || received[0] != "hello" || body.closed != 1 {
+		t.Errorf("Expected the whole body once and a single close, got %q and %d closes", received, body.closed)
+	}
+
+	// Such a body is sent again only once.
+	refused.Store(3)
+	body = &trackedReader{Reader: strings.NewReader("hello")}
+	_, err = client.Put(ctx, "a.txt", body, PutCommandOptions{})
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) || opErr.Op != "dial" || refused.Load() != 1 || body.closed != 1 {
+		t.Errorf("Expected a dial error after 2 attempts, got %v, %d attempts left and %d closes", err, refused.Load(), body.closed)
+	}
+
+	// A body that was read is not sent again.
+	flaky, requests := newFlakyServer(t, 1, http.StatusServiceUnavailable, "")
+	client, _ = client.Clone(WithBaseURL(flaky.URL))
+	if _, err := client.Put(ctx, "a.txt", &trackedReader{Reader: strings.NewReader("hello")}, PutCommandOptions{}); err == nil || requests.Load() != 1 {
+		t.Errorf("Expected a single attempt, got %d and %v", requests.Load(), err)
+	}
+}
@@ -0,0 +1,143 @@
+package vercelblob_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	vercelblob "github.com/claywarren/vercel_blob"
+	"github.com/claywarren/vercel_blob/blobtest"
+)
+
+// The tests of this file script behaviors of the API on a blobtest server,
+// such as rate limits and expired cursors, to check how the client handles
+// them.
+
+// newScenarioClient returns a client of server retrying 3 times.
+func newScenarioClient(t *testing.T, server *blobtest.Server, opts ...vercelblob.ClientOption) *vercelblob.Client {
+	t.Helper()
+	client, err := vercelblob.NewClientWithOptions(append([]vercelblob.ClientOption{
+		vercelblob.WithBaseURL(server.URL),
+		vercelblob.WithTokenProvider(vercelblob.StaticTokenProvider("token")),
+		vercelblob.WithNoEnv(),
+		vercelblob.WithRetry(vercelblob.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxRetryAfter: 20 * time.Millisecond}),
+	}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func Test_RateLimit_Scenario(t *testing.T) {
+	t.Run("part retried after Retry-After", func(t *testing.T) {
+		server := blobtest.NewServer()
+		defer server.Close()
+		part := blobtest.Matcher{Operation: blobtest.OperationMultipartPart, Pathname: "big.bin", PartNumber: 2}
+		server.Fail(part, "rate_limited", 1).WithRetryAfter(time.Second)
+		var retries []vercelblob.RetryAttempt
+		client := newScenarioClient(t, server, vercelblob.WithOnRetry(func(attempt vercelblob.RetryAttempt) {
+			retries = append(retries, attempt)
+		}))
+		content := chaosContent(2*vercelblob.MultipartThreshold + 1000)
+
+		if _, err := client.Put(context.Background(), "big.bin", bytes.NewReader(content), vercelblob.PutCommandOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		// The Retry-After of a second is capped by MaxRetryAfter.
+		if len(retries) != 1 || retries[0].Delay != 20*time.Millisecond || !errors.Is(retries[0].Err, vercelblob.ErrRateLimited) {
+			t.Errorf("Expected one retry after 20ms, got %+v", retries)
+		}
+		log := server.RequestLog(part)
+		if len(log) != 2 || log[0].Status != http.StatusTooManyRequests || log[1].Status != http.StatusOK {
+			t.Errorf("Expected the part to be rate limited then sent again, got %+v", log)
+		}
+		if n := len(server.RequestLog(blobtest.Matcher{Operation: blobtest.OperationMultipartPart})); n != 4 {
+			t.Errorf("Expected only the rate limited part to be sent again, got %d parts", n)
+		}
+		if blob, ok := server.Blob("big.bin"); !ok || !bytes.Equal(blob.Content, content) {
+			t.Error("Expected the whole content to be stored")
+		}
+	})
+
+	t.Run("rate limit outlasting the retries", func(t *testing.T) {
+		server := blobtest.NewServer()
+		defer server.Close()
+		server.Fail(blobtest.Matcher{Operation: blobtest.OperationHead}, "rate_limited", 0).WithRetryAfter(time.Second)
+		server.Seed("a.txt", []byte("a"), "")
+		client := newScenarioClient(t, server)
+
+		_, err := client.Head(context.Background(), "a.txt")
+		if after, ok := vercelblob.RetryAfter(err); !errors.Is(err, vercelblob.ErrRateLimited) || !ok || after != time.Second {
+			t.Errorf("Expected rate_limited with the delay asked for, got %v", err)
+		}
+		if n := len(server.RequestLog(blobtest.Matcher{Operation: blobtest.OperationHead})); n != 3 {
+			t.Errorf("Expected 3 attempts, got %d", n)
+		}
+	})
+
+	t.Run("suspended store not retried", func(t *testing.T) {
+		server := blobtest.NewServer()
+		defer server.Close()
+		put := blobtest.Matcher{Operation: blobtest.OperationPut}
+		server.Fail(put, "store_suspended", 3)
+		client := newScenarioClient(t, server)
+
+		for range 3 {
+			if _, err := client.Put(context.Background(), "a.txt", strings.NewReader("a"), vercelblob.PutCommandOptions{}); !errors.Is(err, vercelblob.ErrStoreSuspended) {
+				t.Errorf("Expected store_suspended, got %v", err)
+			}
+		}
+		if _, err := client.Put(context.Background(), "a.txt", strings.NewReader("a"), vercelblob.PutCommandOptions{}); err != nil {
+			t.Errorf("Expected the put to succeed once the store is back, got %v", err)
+		}
+		if n := len(server.RequestLog(put)); n != 4 {
+			t.Errorf("Expected one request per put, got %d", n)
+		}
+	})
+}
+
+func Test_CursorExpiry_Scenario(t *testing.T) {
+	server := blobtest.NewServer()
+	defer server.Close()
+	server.ListLimit = 2
+	for i := range 5 {
+		server.Seed(fmt.Sprintf("docs/%d.txt", i), []byte("doc"), "")
+	}
+	client := newScenarioClient(t, server)
+	ctx := context.Background()
+
+	// The cursors expire while the first page is processed, breaking the
+	// listing of the second.
+	var once sync.Once
+	result, err := client.CopyPrefix(ctx, "docs/", "backup/", vercelblob.PrefixOptions{
+		Progress: func(vercelblob.PrefixProgress) { once.Do(server.ExpireCursors) },
+	})
+	if vercelblob.CodeOf(err) != "bad_request" || !strings.Contains(err.Error(), "expired") {
+		t.Fatalf("Expected the cursor to be expired, got %v", err)
+	}
+	if len(result.Completed) != 2 || result.Checkpoint != "docs/1.txt" {
+		t.Fatalf("Expected the first page to be copied, got %+v", result)
+	}
+
+	// Resuming from the checkpoint lists from the start again, with fresh
+	// cursors, and copies the rest.
+	result, err = client.CopyPrefix(ctx, "docs/", "backup/", vercelblob.PrefixOptions{StartAfter: result.Checkpoint})
+	if err != nil || result.Err() != nil {
+		t.Fatalf("Expected the resumed copy to succeed, got %v, %v", err, result.Err())
+	}
+	if len(result.Completed) != 3 || result.Checkpoint != "docs/4.txt" {
+		t.Errorf("Expected the rest to be copied, got %+v", result)
+	}
+	for i := range 5 {
+		pathname := fmt.Sprintf("backup/%d.txt", i)
+		if n := len(server.RequestLog(blobtest.Matcher{Operation: blobtest.OperationCopy, Pathname: pathname})); n != 1 {
+			t.Errorf("Expected %s to be copied once, got %d", pathname, n)
+		}
+	}
+}
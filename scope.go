@@ -0,0 +1,113 @@
+package vercelblob
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// PrefixScopeOptions contains options for a client scoped with
+// WithPrefixOptions.
+type PrefixScopeOptions struct {
+	// Keep the prefix in the pathnames and folders returned by List. By
+	// default it is stripped, so that results can be passed back to the
+	// scoped client.
+	KeepPrefixInList bool
+}
+
+// WithPrefix returns a copy of the client scoped to the pathnames under
+// prefix, e.g. "tenants/42/". Put, Head, List, Delete, UploadWithClientToken
+// and the destinations of copies prepend the prefix to the pathnames they are
+// given, as do the prefix operations, and the prefixed pathname is passed to
+// the token provider. Blobs given by URL must lie under the prefix, and
+// pathnames with a ".." segment are rejected, in both cases with an error
+// matching ErrOutsidePrefix. List strips the prefix from its results.
+//
+// A trailing slash is added to prefix if missing. Calling WithPrefix on a
+// scoped client appends prefix to its prefix.
+func (c *Client) WithPrefix(prefix string) *Client {
+	return c.WithPrefixOptions(prefix, PrefixScopeOptions{KeepPrefixInList: c.keepPrefixInList})
+}
+
+// WithPrefixOptions is like WithPrefix, with options for the scoped client.
+func (c *Client) WithPrefixOptions(prefix string, options PrefixScopeOptions) *Client {
+	clone := *c
+	if prefix = strings.Trim(prefix, "/"); prefix != "" {
+		clone.scope += prefix + "/"
+	}
+	clone.keepPrefixInList = options.KeepPrefixInList
+	return &clone
+}
+
+// Prefix returns the prefix of a client scoped with WithPrefix, or "".
+func (c *Client) Prefix() string {
+	return c.scope
+}
+
+// unscoped returns a copy of the client without its prefix, through which a
+// scoped operation is performed once its pathnames have been prefixed.
+func (c *Client) unscoped() *Client {
+	clone := *c
+	clone.scope = ""
+	return &clone
+}
+
+// scopePathname returns pathname prefixed with the scope of the client. Full
+// URLs are returned unchanged if they lie under the scope.
+func (c *Client) scopePathname(pathnameOrURL string) (string, error) {
+	if hasDotDotSegment(c.scope) {
+		return "", fmt.Errorf("%w: prefix %q", ErrOutsidePrefix, c.scope)
+	}
+	if u, err := url.Parse(pathnameOrURL); err == nil && u.IsAbs() {
+		if pathname := strings.TrimPrefix(u.Path, "/"); !strings.HasPrefix(pathname, c.scope) || hasDotDotSegment(pathname) {
+			return "", fmt.Errorf("%w: %q is not under %q", ErrOutsidePrefix, pathnameOrURL, c.scope)
+		}
+		return pathnameOrURL, nil
+	}
+	if hasDotDotSegment(pathnameOrURL) {
+		return "", fmt.Errorf("%w: %q escapes %q", ErrOutsidePrefix, pathnameOrURL, c.scope)
+	}
+	return c.scope + strings.TrimPrefix(pathnameOrURL, "/"), nil
+}
+
+// scopePathnames applies scopePathname to each of pathnamesOrURLs.
+func (c *Client) scopePathnames(pathnamesOrURLs []string) ([]string, error) {
+	scoped := make([]string, len(pathnamesOrURLs))
+	for i, pathnameOrURL := range pathnamesOrURLs {
+		var err error
+		if scoped[i], err = c.scopePathname(pathnameOrURL); err != nil {
+			return nil, err
+		}
+	}
+	return scoped, nil
+}
+
+func hasDotDotSegment(pathname string) bool {
+	return slices.Contains(strings.Split(pathname, "/"), "..")
+}
+
+// listInScope lists the blobs under options.Prefix within the scope of the
+// client, stripping the scope from the results if strip is set.
+func (c *Client) listInScope(ctx context.Context, options ListCommandOptions, strip bool) (*ListBlobResult, error) {
+	if c.scope == "" {
+		return c.list(ctx, options)
+	}
+	prefix, err := c.scopePathname(options.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	options.Prefix = prefix
+	result, err := c.unscoped().list(ctx, options)
+	if err != nil || !strip {
+		return result, err
+	}
+	for i := range result.Blobs {
+		result.Blobs[i].PathName = strings.TrimPrefix(strings.TrimPrefix(result.Blobs[i].PathName, "/"), c.scope)
+	}
+	for i := range result.Folders {
+		result.Folders[i] = strings.TrimPrefix(strings.TrimPrefix(result.Folders[i], "/"), c.scope)
+	}
+	return result, nil
+}
@@ -0,0 +1,169 @@
+package vercelblob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/claywarren/vercel_blob/blobtest"
+)
+
+func Test_WithPrefix_Mock(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		auth := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		auth = auth[:strings.LastIndex(auth, ":")]
+		switch {
+		case r.Method == http.MethodGet && r.URL.Query().Has("url"):
+			requests = append(requests, "head "+r.URL.Query().Get("url")+" "+auth)
+			_, _ = w.Write([]byte(`{"url":"https://store.public.blob.vercel-storage.com/tenants/42/a.txt","pathname":"tenants/42/a.txt"}`))
+		case r.Method == http.MethodGet:
+			requests = append(requests, "list "+r.URL.Query().Get("prefix")+" "+auth)
+			_, _ = w.Write([]byte(`{"blobs":[{"url":"https://store.public.blob.vercel-storage.com/tenants/42/docs/a.txt","pathname":"tenants/42/docs/a.txt"}],"folders":["tenants/42/docs/old/"]}`))
+		case r.Method == http.MethodPost:
+			requests = append(requests, "delete "+auth)
+			_, _ = w.Write([]byte(`{}`))
+		default:
+			requests = append(requests, "put "+r.URL.Path+" "+r.URL.Query().Get("fromUrl")+" "+auth)
+			_, _ = w.Write([]byte(`{"url":"https://store.public.blob.vercel-storage.com/tenants/42/b.txt","pathname":"tenants/42/b.txt"}`))
+		}
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(&countingTokenProvider{})).WithPrefix("tenants").WithPrefix("/42")
+	if client.Prefix() != "tenants/42/" {
+		t.Fatalf("Expected the prefixes to compose, got %q", client.Prefix())
+	}
+	ctx := context.Background()
+	blobURL := "https://store.public.blob.vercel-storage.com/tenants/42/a.txt"
+
+	if _, err := client.Put(ctx, "b.txt", strings.NewReader("b"), PutCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Head(ctx, "/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Head(ctx, blobURL); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Copy(ctx, blobURL, "b.txt", PutCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Delete(ctx, blobURL); err != nil {
+		t.Fatal(err)
+	}
+	list, err := client.List(ctx, ListCommandOptions{Prefix: "docs/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Blobs[0].PathName != "docs/a.txt" || list.Folders[0] != "docs/old/" {
+		t.Errorf("Expected the prefix to be stripped, got %s and %s", list.Blobs[0].PathName, list.Folders[0])
+	}
+
+	want := []string{
+		"put /tenants/42/b.txt  put:tenants/42/b.txt",
+		"head tenants/42/a.txt head:tenants/42/a.txt",
+		"head " + blobURL + " head:" + blobURL,
+		"put /tenants/42/b.txt " + blobURL + " copy:tenants/42/b.txt",
+		"delete delete:" + blobURL,
+		"list tenants/42/docs/ list:tenants/42/docs/",
+	}
+	if strings.Join(requests, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(requests, "\n"))
+	}
+
+	kept := client.WithPrefixOptions("", PrefixScopeOptions{KeepPrefixInList: true})
+	if list, err := kept.List(ctx, ListCommandOptions{}); err != nil || list.Blobs[0].PathName != "tenants/42/docs/a.txt" {
+		t.Errorf("Expected the full pathname, got %+v, %v", list, err)
+	}
+	if list, err := kept.WithPrefix("docs").List(ctx, ListCommandOptions{}); err != nil || list.Blobs[0].PathName != "tenants/42/docs/a.txt" {
+		t.Errorf("Expected nested prefixes to keep the setting, got %+v, %v", list, err)
+	}
+}
+
+func Test_WithPrefix_Escape(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token"))).WithPrefix("tenants/42/")
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"put", func() error {
+			_, err := client.Put(ctx, "../43/a.txt", strings.NewReader("a"), PutCommandOptions{})
+			return err
+		}},
+		{"nested put", func() error {
+			_, err := client.Put(ctx, "docs/../../../a.txt", strings.NewReader("a"), PutCommandOptions{})
+			return err
+		}},
+		{"head url outside", func() error {
+			_, err := client.Head(ctx, "https://store.public.blob.vercel-storage.com/tenants/43/a.txt")
+			return err
+		}},
+		{"head url escaping", func() error {
+			_, err := client.Head(ctx, "https://store.public.blob.vercel-storage.com/tenants/42/../43/a.txt")
+			return err
+		}},
+		{"list", func() error {
+			_, err := client.List(ctx, ListCommandOptions{Prefix: ".."})
+			return err
+		}},
+		{"delete", func() error {
+			return client.Delete(ctx, "a.txt", "https://store.public.blob.vercel-storage.com/b.txt")
+		}},
+		{"copy source", func() error {
+			_, err := client.Copy(ctx, "https://store.public.blob.vercel-storage.com/tenants/43/a.txt", "a.txt", PutCommandOptions{})
+			return err
+		}},
+		{"copy destination", func() error {
+			_, err := client.Copy(ctx, "https://store.public.blob.vercel-storage.com/tenants/42/a.txt", "../a.txt", PutCommandOptions{})
+			return err
+		}},
+		{"prefix", func() error {
+			_, err := client.WithPrefix("../43").Head(ctx, "a.txt")
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, ErrOutsidePrefix) {
+				t.Errorf("Expected ErrOutsidePrefix, got %v", err)
+			}
+		})
+	}
+	if requests != 0 {
+		t.Errorf("Expected no requests, got %d", requests)
+	}
+}
+
+func Test_WithPrefix_UpdateMetadata(t *testing.T) {
+	server := blobtest.NewServer()
+	defer server.Close()
+	server.Seed("a.txt", []byte("outside"), "text/plain")
+	server.Seed("tenants/42/a.txt", []byte("inside"), "text/plain")
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")), WithNoEnv()).WithPrefix("tenants/42")
+
+	// A bare pathname is within the prefix, like for the other methods.
+	contentType := "text/markdown"
+	if _, err := client.UpdateMetadata(context.Background(), "a.txt", MetadataUpdate{ContentType: &contentType}); err != nil {
+		t.Fatal(err)
+	}
+	if blob, _ := server.Blob("tenants/42/a.txt"); blob.ContentType != contentType || string(blob.Content) != "inside" {
+		t.Errorf("Expected the blob under the prefix to be updated, got %+v", blob)
+	}
+	if blob, _ := server.Blob("a.txt"); blob.ContentType != "text/plain" {
+		t.Errorf("Expected the blob outside the prefix to be left alone, got %q", blob.ContentType)
+	}
+}
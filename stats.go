@@ -0,0 +1,199 @@
+package vercelblob
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// OperationStats are the timing and traffic of one call of the client, such
+// as a Put or a CopyPrefix. They are always collected and reported on the
+// result of the call, so they can be logged only when needed, e.g. when a
+// call was slow.
+type OperationStats struct {
+	// Duration is the time the call took.
+	Duration time.Duration
+	// Attempts is the number of requests sent, including retries, hedges,
+	// the parts of a multipart upload and the requests of nested calls,
+	// such as the head of the source of a copy.
+	Attempts int
+	// Retries is the number of retries of WithRetry.
+	Retries int
+	// BytesSent is the size of the request bodies sent, and BytesReceived
+	// the size of the response bodies read.
+	BytesSent, BytesReceived int64
+	// UsedMultipart is set if a blob was uploaded in parts.
+	UsedMultipart bool
+}
+
+type operationStatsKey struct{}
+
+// operationStats collects the OperationStats of a call in progress. It is
+// updated concurrently by the parts of multipart uploads and hedges.
+type operationStats struct {
+	start     time.Time
+	attempts  atomic.Int64
+	retries   atomic.Int64
+	sent      atomic.Int64
+	received  atomic.Int64
+	multipart atomic.Bool
+}
+
+// withOperationStats returns a context collecting the stats of a call, and
+// the collector. The stats of calls made by another call of the client are
+// collected by the outer call.
+func withOperationStats(ctx context.Context) (context.Context, *operationStats) {
+	if stats := operationStatsFrom(ctx); stats != nil {
+		return ctx, stats
+	}
+	stats := &operationStats{start: time.Now()}
+	return context.WithValue(ctx, operationStatsKey{}, stats), stats
+}
+
+// operationStatsFrom returns the collector of ctx, or nil.
+func operationStatsFrom(ctx context.Context) *operationStats {
+	stats, _ := ctx.Value(operationStatsKey{}).(*operationStats)
+	return stats
+}
+
+// snapshot returns the stats collected so far.
+func (s *operationStats) snapshot() OperationStats {
+	return OperationStats{
+		Duration:      time.Since(s.start),
+		Attempts:      int(s.attempts.Load()),
+		Retries:       int(s.retries.Load()),
+		BytesSent:     s.sent.Load(),
+		BytesReceived: s.received.Load(),
+		UsedMultipart: s.multipart.Load(),
+	}
+}
+
+// ClientStats are the totals of the traffic of a client; see Client.Stats.
+type ClientStats struct {
+	// Requests is the number of requests sent, including retries, hedges
+	// and the parts of multipart uploads.
+	Requests int64
+	// BytesUploaded is the size of the request bodies sent, and
+	// BytesDownloaded the size of the response bodies read, counted as they
+	// are transferred.
+	BytesUploaded, BytesDownloaded int64
+	// Errors counts the requests that failed, by the RetryClass of their
+	// error. Only classes that occurred are present.
+	Errors map[Classification]int64
+	// Retries is the number of retries of WithRetry.
+	Retries int64
+	// OpenMultipartUploads is the number of multipart uploads created and
+	// not yet completed or abandoned. ResetStats leaves it unchanged.
+	OpenMultipartUploads int64
+}
+
+// usageCounters hold the ClientStats of a client.
+type usageCounters struct {
+	requests   atomic.Int64
+	uploaded   atomic.Int64
+	downloaded atomic.Int64
+	errors     [AuthExpired + 1]atomic.Int64
+	retries    atomic.Int64
+	uploads    atomic.Int64
+}
+
+// Stats returns the totals of the traffic of the client since it was created
+// or ResetStats was called. They are shared by the copies returned by
+// ForStore and WithPrefix, while Clone starts from zero.
+func (c *Client) Stats() ClientStats {
+	u := c.usage
+	if u == nil {
+		return ClientStats{}
+	}
+	stats := ClientStats{
+		Requests:             u.requests.Load(),
+		BytesUploaded:        u.uploaded.Load(),
+		BytesDownloaded:      u.downloaded.Load(),
+		Retries:              u.retries.Load(),
+		OpenMultipartUploads: u.uploads.Load(),
+	}
+	for class := range u.errors {
+		if n := u.errors[class].Load(); n > 0 {
+			if stats.Errors == nil {
+				stats.Errors = map[Classification]int64{}
+			}
+			stats.Errors[Classification(class)] = n
+		}
+	}
+	return stats
+}
+
+// ResetStats sets the counters of Stats back to zero.
+func (c *Client) ResetStats() {
+	u := c.usage
+	if u == nil {
+		return
+	}
+	u.requests.Store(0)
+	u.uploaded.Store(0)
+	u.downloaded.Store(0)
+	u.retries.Store(0)
+	for class := range u.errors {
+		u.errors[class].Store(0)
+	}
+}
+
+// countTraffic counts each request sent through next, and the bytes of its
+// bodies, in the stats of the client and of its call.
+func (c *Client) countTraffic(next RoundTripFunc) RoundTripFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		u := c.usage
+		countAttempt(req.Context())
+		stats := operationStatsFrom(req.Context())
+		if u == nil && stats == nil {
+			return next(req)
+		}
+		var sent, received *atomic.Int64
+		if stats != nil {
+			stats.attempts.Add(1)
+			sent, received = &stats.sent, &stats.received
+		}
+		var uploaded, downloaded *atomic.Int64
+		if u != nil {
+			u.requests.Add(1)
+			uploaded, downloaded = &u.uploaded, &u.downloaded
+		}
+		if req.Body != nil && req.Body != http.NoBody {
+			req = req.WithContext(req.Context())
+			req.Body = &countingBody{ReadCloser: req.Body, n: sent, total: uploaded}
+		}
+		resp, err := next(req)
+		if err == nil {
+			resp.Body = &countingBody{ReadCloser: resp.Body, n: received, total: downloaded}
+		}
+		if u != nil {
+			switch {
+			case err != nil:
+				u.errors[RetryClass(err)].Add(1)
+			case resp.StatusCode >= http.StatusBadRequest:
+				u.errors[RetryClass(c.peekAPIError(resp))].Add(1)
+			}
+		}
+		return resp, err
+	}
+}
+
+// countingBody adds the number of bytes read from a body to n and total,
+// which may be nil.
+type countingBody struct {
+	io.ReadCloser
+	n, total *atomic.Int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if b.n != nil {
+		b.n.Add(int64(n))
+	}
+	if b.total != nil {
+		b.total.Add(int64(n))
+	}
+	return n, err
+}
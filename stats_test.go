@@ -0,0 +1,155 @@
+package vercelblob
+
+import (
+	"context"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_OperationStats_Mock(t *testing.T) {
+	const response = `{"url":"https://blob.com/a.txt","pathname":"a.txt","uploadId":"id","key":"key","blobs":[{"url":"https://blob.com/logs/a.txt","pathname":"logs/a.txt"}]}`
+	failures := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		if r.Method == http.MethodPut && r.Header.Get("X-MPU-Action") == "" && failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.Method == http.MethodGet && r.URL.Path == "/a.txt" {
+			_, _ = w.Write([]byte("hello"))
+			return
+		}
+		w.Header().Set("ETag", `"etag"`)
+		_, _ = w.Write([]byte(response))
+	}))
+	defer server.Close()
+	client := newTestClient(t,
+		WithBaseURL(server.URL),
+		WithTokenProvider(StaticTokenProvider("token")),
+		WithRetry(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}),
+	)
+	ctx := context.Background()
+
+	put, err := client.Put(ctx, "a.txt", strings.NewReader("abc"), PutCommandOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := OperationStats{Attempts: 2, Retries: 1, BytesSent: 6, BytesReceived: int64(len(response))}
+	if got := put.Stats; got.Duration <= 0 || got.Attempts != want.Attempts || got.Retries != want.Retries || got.BytesSent != want.BytesSent || got.BytesReceived != want.BytesReceived || got.UsedMultipart {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+
+	size := MultipartThreshold + 1
+	multipart, err := client.Put(ctx, "a.bin", strings.NewReader(strings.Repeat("a", size)), PutCommandOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := multipart.Stats; !got.UsedMultipart || got.Attempts != 4 || got.BytesSent < int64(size) {
+		t.Errorf("Expected a create, two parts and a complete sending %d bytes, got %+v", size, got)
+	}
+
+	download, err := client.DownloadWithResult(ctx, server.URL+"/a.txt", DownloadCommandOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := download.Stats; got.Attempts != 1 || got.BytesReceived != 5 || got.BytesSent != 0 {
+		t.Errorf("Expected one request receiving 5 bytes, got %+v", got)
+	}
+
+	// A copy counts the head of its source.
+	copied, err := client.CopyWithOptions(ctx, "https://blob.com/a.txt", "b.txt", CopyCommandOptions{InheritMetadata: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := copied.Stats; got.Attempts != 2 || got.Retries != 0 {
+		t.Errorf("Expected a head and a copy, got %+v", got)
+	}
+
+	// A prefix operation counts every request of the run.
+	result, err := client.CopyPrefix(ctx, "logs/", "archive/", PrefixOptions{})
+	if err != nil || result.Err() != nil {
+		t.Fatal(err, result.Err())
+	}
+	if got := result.Stats; got.Attempts != 3 || got.Duration <= 0 {
+		t.Errorf("Expected a list, a head and a copy, got %+v", got)
+	}
+}
+
+func Test_Client_Stats_Mock(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		switch {
+		case r.URL.Query().Get("url") == "missing.txt":
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":{"code":"not_found","message":"not found"}}`))
+		case r.URL.Path == "/busy.txt":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case r.Method == http.MethodGet && r.URL.Path == "/a.txt":
+			_, _ = w.Write([]byte("hello"))
+		default:
+			w.Header().Set("ETag", `"etag"`)
+			_, _ = w.Write([]byte(`{"url":"https://blob.com/a.txt","pathname":"a.txt","uploadId":"id","key":"key"}`))
+		}
+	}))
+	defer server.Close()
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")))
+	ctx := context.Background()
+
+	const workers = 8
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.Put(ctx, "a.txt", strings.NewReader("abc"), PutCommandOptions{}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	size := MultipartThreshold + 1
+	if _, err := client.Put(ctx, "a.bin", strings.NewReader(strings.Repeat("a", size)), PutCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	stats := client.Stats()
+	if stats.Requests != workers+4 || stats.BytesUploaded < int64(workers*3+size) || stats.Errors != nil {
+		t.Errorf("Expected %d requests uploading at least %d bytes, got %+v", workers+4, workers*3+size, stats)
+	}
+
+	// A download is counted as far as it is read, and copies made with
+	// ForStore share the counters.
+	client.ResetStats()
+	resp, err := client.ForStore("other").download(ctx, server.URL+"/a.txt", DownloadCommandOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.CopyN(io.Discard, resp.Body, 2)
+	_ = resp.Body.Close()
+	if stats := client.Stats(); stats.Requests != 1 || stats.BytesDownloaded != 2 || stats.BytesUploaded != 0 {
+		t.Errorf("Expected one request downloading 2 bytes, got %+v", stats)
+	}
+
+	client.ResetStats()
+	_, _ = client.Head(ctx, "missing.txt")
+	_, _ = client.Download(ctx, server.URL+"/busy.txt", DownloadCommandOptions{})
+	_, _ = client.Download(ctx, closedPortURL(t), DownloadCommandOptions{})
+	want := map[Classification]int64{NonRetryable: 1, Retryable: 2}
+	if stats := client.Stats(); stats.Requests != 3 || !maps.Equal(stats.Errors, want) {
+		t.Errorf("Expected errors %v, got %+v", want, stats)
+	}
+
+	clone, err := client.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := clone.Stats(); stats.Requests != 0 {
+		t.Errorf("Expected the clone to start from zero, got %+v", stats)
+	}
+}
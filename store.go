@@ -0,0 +1,47 @@
+package vercelblob
+
+import (
+	"context"
+	"io"
+)
+
+// BlobStore is the blob access of a Client, as an interface to program
+// against, e.g. to substitute a fake in unit tests or a local implementation
+// during development. Put takes its content as a stream, and is expected to
+// upload large blobs in parts where the store supports it, as Client does.
+//
+// BlobStore is kept small and stable: capabilities added later land on
+// extension interfaces, such as OptionsBlobStore and PrefixBlobStore, which
+// callers detect with a type assertion, so that adding them does not break
+// existing implementations.
+type BlobStore interface {
+	List(ctx context.Context, options ListCommandOptions) (*ListBlobResult, error)
+	Put(ctx context.Context, pathname string, body io.Reader, options PutCommandOptions) (*PutBlobPutResult, error)
+	Head(ctx context.Context, pathnameOrURL string) (*HeadBlobResult, error)
+	Delete(ctx context.Context, urls ...string) error
+	Copy(ctx context.Context, fromURL, toPath string, options PutCommandOptions) (*PutBlobPutResult, error)
+	Download(ctx context.Context, urlPath string, options DownloadCommandOptions) ([]byte, error)
+}
+
+// OptionsBlobStore is a BlobStore supporting conditional heads, copies with
+// metadata inheritance and verification, and downloads with their metadata.
+type OptionsBlobStore interface {
+	BlobStore
+	HeadWithOptions(ctx context.Context, pathnameOrURL string, options HeadCommandOptions) (*HeadBlobResult, error)
+	CopyWithOptions(ctx context.Context, fromURL, toPath string, options CopyCommandOptions) (*CopyResult, error)
+	DownloadWithResult(ctx context.Context, urlPath string, options DownloadCommandOptions) (*DownloadResult, error)
+}
+
+// PrefixBlobStore is a BlobStore with operations on every blob under a prefix.
+type PrefixBlobStore interface {
+	BlobStore
+	CopyPrefix(ctx context.Context, fromPrefix, toPrefix string, options PrefixOptions) (*PrefixResult, error)
+	DeletePrefix(ctx context.Context, prefix string, options PrefixOptions) (*PrefixResult, error)
+	RenamePrefix(ctx context.Context, fromPrefix, toPrefix string, options PrefixOptions) (*PrefixResult, error)
+}
+
+var (
+	_ BlobStore        = (*Client)(nil)
+	_ OptionsBlobStore = (*Client)(nil)
+	_ PrefixBlobStore  = (*Client)(nil)
+)
@@ -0,0 +1,129 @@
+package vercelblob
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// StoreRegistry holds a client per named blob store, for applications that
+// address several stores, each with its own token and possibly its own base
+// URL. Operations on blob URLs are routed to the client of the store in the
+// URL's host. Create it with NewStoreRegistry.
+//
+// Store IDs are compared case-insensitively, as blob URLs carry them in
+// lowercase. A StoreRegistry must not be modified once it is in use.
+type StoreRegistry struct {
+	base   *Client
+	stores map[string]*Client
+}
+
+// NewStoreRegistry returns a registry with no stores. The clients of the
+// stores are derived from base with Client.Clone, so they share its HTTP
+// client and other settings; a nil base stands for NewClient().
+//
+//	registry := NewStoreRegistry(client)
+//	err := registry.Register("assets", WithTokenProvider(StaticTokenProvider(assetsToken)))
+func NewStoreRegistry(base *Client) *StoreRegistry {
+	if base == nil {
+		base = NewClient()
+	}
+	return &StoreRegistry{base: base, stores: map[string]*Client{}}
+}
+
+// Register adds the store storeID, whose client is the base client with opts
+// applied, e.g. WithTokenProvider and WithBaseURL. It returns the error of an
+// invalid option.
+func (r *StoreRegistry) Register(storeID string, opts ...ClientOption) error {
+	if storeID == "" {
+		return InvalidInputError("storeID")
+	}
+	client, err := r.base.Clone(opts...)
+	if err != nil {
+		return err
+	}
+	r.stores[strings.ToLower(storeID)] = client
+	return nil
+}
+
+// Store returns the client of storeID, or an error matching ErrUnknownStore
+// if the store was not registered.
+func (r *StoreRegistry) Store(storeID string) (*Client, error) {
+	client, ok := r.stores[strings.ToLower(storeID)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownStore, storeID)
+	}
+	return client, nil
+}
+
+// ForURL returns the client of the store serving blobURL, or an error matching
+// ErrUnknownStore if blobURL is not a blob URL or its store was not
+// registered.
+func (r *StoreRegistry) ForURL(blobURL string) (*Client, error) {
+	storeID := storeIDFromURL(blobURL)
+	if storeID == "" {
+		return nil, fmt.Errorf("%w: %q is not a blob URL", ErrUnknownStore, blobURL)
+	}
+	return r.Store(storeID)
+}
+
+// Head gets the metadata of the blob at blobURL from its store.
+func (r *StoreRegistry) Head(ctx context.Context, blobURL string) (*HeadBlobResult, error) {
+	client, err := r.ForURL(blobURL)
+	if err != nil {
+		return nil, err
+	}
+	return client.Head(ctx, blobURL)
+}
+
+// Download downloads the blob at blobURL with the client of its store.
+func (r *StoreRegistry) Download(ctx context.Context, blobURL string, options DownloadCommandOptions) ([]byte, error) {
+	client, err := r.ForURL(blobURL)
+	if err != nil {
+		return nil, err
+	}
+	return client.Download(ctx, blobURL, options)
+}
+
+// Delete deletes blobs from their stores, with one request per store. Nothing
+// is deleted if a URL belongs to an unknown store; otherwise the errors of
+// the stores that failed are returned as a *BatchError keyed by store ID.
+func (r *StoreRegistry) Delete(ctx context.Context, urls ...string) error {
+	var order []string
+	byStore := map[string][]string{}
+	for _, blobURL := range urls {
+		if _, err := r.ForURL(blobURL); err != nil {
+			return err
+		}
+		storeID := strings.ToLower(storeIDFromURL(blobURL))
+		if _, ok := byStore[storeID]; !ok {
+			order = append(order, storeID)
+		}
+		byStore[storeID] = append(byStore[storeID], blobURL)
+	}
+	errs := map[string]error{}
+	for _, storeID := range order {
+		if err := r.stores[storeID].Delete(ctx, byStore[storeID]...); err != nil {
+			errs[storeID] = err
+		}
+	}
+	return newBatchError(errs, len(order))
+}
+
+// Copy copies the blob at fromURL to toPath in the store toStoreID. Copies
+// within a store are made by the server; copies between stores use
+// CopyAcrossStores.
+func (r *StoreRegistry) Copy(ctx context.Context, fromURL, toStoreID, toPath string, options CopyCommandOptions) (*CopyResult, error) {
+	src, err := r.ForURL(fromURL)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := r.Store(toStoreID)
+	if err != nil {
+		return nil, err
+	}
+	if src == dst {
+		return dst.CopyWithOptions(ctx, fromURL, toPath, options)
+	}
+	return CopyAcrossStores(ctx, src, fromURL, dst, toPath, options)
+}
@@ -0,0 +1,136 @@
+package vercelblob
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// fakeStore is a blob store behind an httptest server that records the
+// requests it receives.
+type fakeStore struct {
+	*httptest.Server
+	requests []string
+}
+
+func newFakeStore(t *testing.T, storeID, token string) *fakeStore {
+	store := &fakeStore{}
+	store.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token && !strings.HasSuffix(r.Host, blobHostSuffix) {
+			t.Errorf("Expected the token of %s, got %s", storeID, r.Header.Get("Authorization"))
+		}
+		switch {
+		case r.Method == http.MethodPost:
+			var body deleteRequest
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			store.requests = append(store.requests, "delete "+strings.Join(body.URLs, " "))
+		case r.Method == http.MethodPut:
+			store.requests = append(store.requests, "copy "+r.URL.Path+" "+r.URL.Query().Get("fromUrl"))
+		case r.URL.Query().Has("url"):
+			store.requests = append(store.requests, "head "+r.URL.Query().Get("url"))
+		default:
+			store.requests = append(store.requests, "download "+r.Host+r.URL.Path)
+			_, _ = w.Write([]byte(storeID))
+			return
+		}
+		_, _ = w.Write([]byte(`{"url":"https://` + storeID + `.public.blob.vercel-storage.com/a.txt","pathname":"a.txt"}`))
+	}))
+	t.Cleanup(store.Close)
+	return store
+}
+
+// hostTransport sends requests for blob URLs to the fake store of their host.
+type hostTransport map[string]*fakeStore
+
+func (ht hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if store, ok := ht[storeIDFromURL(req.URL.String())]; ok {
+		u, _ := url.Parse(store.URL)
+		req = req.Clone(req.Context())
+		req.URL.Scheme, req.URL.Host = u.Scheme, u.Host
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func Test_StoreRegistry_Mock(t *testing.T) {
+	alpha := newFakeStore(t, "alpha", "alpha-token")
+	beta := newFakeStore(t, "beta", "beta-token")
+
+	registry := NewStoreRegistry(newTestClient(t, WithTransport(hostTransport{"alpha": alpha, "beta": beta})))
+	if err := registry.Register("Alpha", WithBaseURL(alpha.URL), WithTokenProvider(StaticTokenProvider("alpha-token"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Register("beta", WithBaseURL(beta.URL), WithTokenProvider(StaticTokenProvider("beta-token"))); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	alphaURL := "https://alpha.public.blob.vercel-storage.com/a.txt"
+	betaURL := "https://beta.public.blob.vercel-storage.com/b.txt"
+
+	content, err := registry.Download(ctx, betaURL, DownloadCommandOptions{})
+	if err != nil || string(content) != "beta" {
+		t.Errorf("Expected the content of beta, got %q, %v", content, err)
+	}
+	if _, err := registry.Head(ctx, alphaURL); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Delete(ctx, alphaURL, betaURL, alphaURL+"2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.Copy(ctx, alphaURL, "alpha", "c.txt", CopyCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.Copy(ctx, alphaURL, "beta", "c.txt", CopyCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	client, err := registry.Store("ALPHA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.BaseURL() != alpha.URL {
+		t.Errorf("Expected the base URL of alpha, got %s", client.BaseURL())
+	}
+
+	wantAlpha := []string{
+		"head " + alphaURL,
+		"delete " + alphaURL + " " + alphaURL + "2",
+		"copy /c.txt " + alphaURL,
+		"head " + alphaURL,
+	}
+	wantBeta := []string{
+		"download beta.public.blob.vercel-storage.com/b.txt",
+		"delete " + betaURL,
+		"copy /c.txt " + alphaURL,
+	}
+	if strings.Join(alpha.requests, "\n") != strings.Join(wantAlpha, "\n") {
+		t.Errorf("Expected alpha to receive\n%s\ngot\n%s", strings.Join(wantAlpha, "\n"), strings.Join(alpha.requests, "\n"))
+	}
+	if strings.Join(beta.requests, "\n") != strings.Join(wantBeta, "\n") {
+		t.Errorf("Expected beta to receive\n%s\ngot\n%s", strings.Join(wantBeta, "\n"), strings.Join(beta.requests, "\n"))
+	}
+}
+
+func Test_StoreRegistry_UnknownStore(t *testing.T) {
+	registry := NewStoreRegistry(newTestClient(t))
+	if err := registry.Register("alpha", WithTokenProvider(StaticTokenProvider("alpha-token"))); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	_, downloadErr := registry.Download(ctx, "https://gamma.public.blob.vercel-storage.com/a.txt", DownloadCommandOptions{})
+	_, storeErr := registry.Store("gamma")
+	_, copyErr := registry.Copy(ctx, "https://alpha.public.blob.vercel-storage.com/a.txt", "gamma", "a.txt", CopyCommandOptions{})
+	deleteErr := registry.Delete(ctx, "https://alpha.public.blob.vercel-storage.com/a.txt", "a.txt")
+	for _, err := range []error{downloadErr, storeErr, copyErr, deleteErr} {
+		if !errors.Is(err, ErrUnknownStore) {
+			t.Errorf("Expected ErrUnknownStore, got %v", err)
+		}
+	}
+	if err := registry.Register("beta", WithTokenProvider(nil)); err == nil {
+		t.Error("Expected the error of an invalid option")
+	}
+}
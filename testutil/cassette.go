@@ -0,0 +1,349 @@
+package testutil
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+
+	vercelblob "github.com/claywarren/vercel_blob"
+)
+
+// CassetteDir is the directory, relative to the package under test, holding
+// the cassettes of NewCassette.
+const CassetteDir = "testdata/cassettes"
+
+// ScrubbedStoreID replaces the store ID in recorded URLs and bodies, and is
+// the store ID of the token used in replay.
+const ScrubbedStoreID = "storeid"
+
+// LiveToken is the token of the live store tests run against: cassettes
+// record with it and sandboxes are created in its store. It is read from
+// BLOB_READ_WRITE_TOKEN when the test binary starts, so that tests setting
+// the variable do not switch to the live store. Cassettes replay and
+// sandboxes skip their tests while it is empty.
+var LiveToken = os.Getenv("BLOB_READ_WRITE_TOKEN")
+
+// cassetteHeaders are the request headers a replayed request must match, and
+// the only request headers recorded.
+var cassetteHeaders = []string{
+	"Range",
+	"If-None-Match",
+	"If-Range",
+	"X-Api-Version",
+	"X-Access",
+	"X-Add-Random-Suffix",
+	"X-Allow-Overwrite",
+	"X-Cache-Control-Max-Age",
+	"X-Content-Type",
+	"X-Mpu-Action",
+	"X-Mpu-Part-Number",
+}
+
+// cassetteResponseHeaders are the response headers recorded.
+var cassetteResponseHeaders = []string{
+	"Content-Type",
+	"Content-Range",
+	"Content-Disposition",
+	"Cache-Control",
+	"ETag",
+	"Retry-After",
+	"X-Vercel-Id",
+}
+
+// Interaction is a request and its response, as recorded in a cassette.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is a request of an Interaction.
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+}
+
+// RecordedResponse is a response of an Interaction. Body is base64 encoded
+// if BodyBase64 is set, e.g. for binary content.
+type RecordedResponse struct {
+	Status     int         `json:"status"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body"`
+	BodyBase64 bool        `json:"bodyBase64,omitempty"`
+}
+
+// Cassette is an http.RoundTripper that records the requests of a test and
+// their responses to a golden file, and serves them back in later runs, so
+// that tests exercise the responses of the real API without a token.
+//
+// A cassette records when LiveToken, i.e. BLOB_READ_WRITE_TOKEN, is set,
+// sending requests to the API, and replays otherwise. Recordings are
+// scrubbed: the Authorization header is dropped and the store ID of the token
+// is replaced with ScrubbedStoreID everywhere.
+//
+// In replay, each request is answered by the first unused interaction with
+// the same method, URL, query and the headers that affect the API, such as
+// X-Add-Random-Suffix and Range. A request without one fails the test, as do
+// interactions left unused when the test ends.
+type Cassette struct {
+	// Transport sends the requests when recording. Defaults to
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+
+	t         testing.TB
+	path      string
+	recording bool
+	token     string
+	storeID   *regexp.Regexp
+
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+// NewCassette returns the cassette name of the test, stored in CassetteDir
+// as name.json. Recorded interactions are written when the test ends, unless
+// it failed; in replay, a missing cassette fails the test.
+func NewCassette(t testing.TB, name string) *Cassette {
+	t.Helper()
+	c := &Cassette{
+		t:     t,
+		path:  CassettePath(name),
+		token: LiveToken,
+	}
+	c.recording = c.token != ""
+	if c.recording {
+		if storeID := storeIDOf(c.token); storeID != "" {
+			c.storeID = regexp.MustCompile(`(?i)` + regexp.QuoteMeta(storeID))
+		}
+		t.Cleanup(func() {
+			if t.Failed() {
+				t.Logf("Cassette %s not saved since the test failed", c.path)
+				return
+			}
+			if err := c.save(); err != nil {
+				t.Errorf("Save cassette %s: %v", c.path, err)
+			}
+		})
+		return c
+	}
+
+	c.token = "vercel_blob_rw_" + ScrubbedStoreID + "_replay"
+	interactions, err := LoadCassette(name)
+	if err != nil {
+		t.Fatalf("Load cassette %s, recorded by running the test with BLOB_READ_WRITE_TOKEN: %v", c.path, err)
+	}
+	c.interactions = interactions
+	c.used = make([]bool, len(interactions))
+	t.Cleanup(func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for i, used := range c.used {
+			if !used {
+				req := c.interactions[i].Request
+				t.Errorf("Cassette %s: interaction %d (%s %s) was not replayed", c.path, i, req.Method, req.URL)
+			}
+		}
+	})
+	return c
+}
+
+// CassettePath returns the path of the cassette name.
+func CassettePath(name string) string {
+	return filepath.Join(CassetteDir, name+".json")
+}
+
+// LoadCassette reads the interactions of the cassette name.
+func LoadCassette(name string) ([]Interaction, error) {
+	data, err := os.ReadFile(CassettePath(name))
+	if err != nil {
+		return nil, err
+	}
+	var interactions []Interaction
+	if err := json.Unmarshal(data, &interactions); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", CassettePath(name), err)
+	}
+	return interactions, nil
+}
+
+// Recording reports whether the cassette records, rather than replays.
+func (c *Cassette) Recording() bool {
+	return c.recording
+}
+
+// ClientOptions returns the options that route a client through the
+// cassette, with the token of the environment when recording and a token of
+// the scrubbed store in replay.
+func (c *Cassette) ClientOptions() []vercelblob.ClientOption {
+	return []vercelblob.ClientOption{
+		vercelblob.WithTransport(c),
+		vercelblob.WithTokenProvider(vercelblob.StaticTokenProvider(c.token)),
+	}
+}
+
+// Interactions returns the interactions recorded or to replay.
+func (c *Cassette) Interactions() []Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.interactions)
+}
+
+// RoundTrip records or replays req.
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorded := c.recordRequest(req)
+	if c.recording {
+		return c.record(req, recorded)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, interaction := range c.interactions {
+		if !c.used[i] && interaction.Request.matches(recorded) {
+			c.used[i] = true
+			if req.Body != nil {
+				_, _ = io.Copy(io.Discard, req.Body)
+				_ = req.Body.Close()
+			}
+			return interaction.Response.response(req)
+		}
+	}
+	c.t.Errorf("Cassette %s: no interaction for %s %s with headers %v", c.path, recorded.Method, recorded.URL, recorded.Header)
+	return nil, fmt.Errorf("testutil: cassette %s has no interaction for %s %s", c.path, recorded.Method, recorded.URL)
+}
+
+// record sends req and records it with its response.
+func (c *Cassette) record(req *http.Request, recorded RecordedRequest) (*http.Response, error) {
+	transport := c.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	response := RecordedResponse{Status: resp.StatusCode, Header: http.Header{}}
+	for _, key := range cassetteResponseHeaders {
+		for _, value := range resp.Header.Values(key) {
+			response.Header.Add(key, c.scrub(value))
+		}
+	}
+	if utf8.Valid(body) {
+		response.Body = c.scrub(string(body))
+	} else {
+		response.Body, response.BodyBase64 = base64.StdEncoding.EncodeToString(body), true
+	}
+	c.mu.Lock()
+	c.interactions = append(c.interactions, Interaction{Request: recorded, Response: response})
+	c.mu.Unlock()
+	return resp, nil
+}
+
+// recordRequest returns req as recorded, scrubbed.
+func (c *Cassette) recordRequest(req *http.Request) RecordedRequest {
+	recorded := RecordedRequest{Method: req.Method, URL: c.scrub(req.URL.String())}
+	for _, key := range cassetteHeaders {
+		if value := req.Header.Get(key); value != "" {
+			if recorded.Header == nil {
+				recorded.Header = http.Header{}
+			}
+			recorded.Header.Set(key, c.scrub(value))
+		}
+	}
+	return recorded
+}
+
+// scrub replaces the store ID in s.
+func (c *Cassette) scrub(s string) string {
+	if c.storeID == nil {
+		return s
+	}
+	return c.storeID.ReplaceAllString(s, ScrubbedStoreID)
+}
+
+// save writes the recorded interactions to the cassette.
+func (c *Cassette) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(c.interactions); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, data.Bytes(), 0o644)
+}
+
+// matches reports whether a request recorded as other is answered by the
+// interaction of r.
+func (r RecordedRequest) matches(other RecordedRequest) bool {
+	if r.Method != other.Method {
+		return false
+	}
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return false
+	}
+	v, err := url.Parse(other.URL)
+	if err != nil || u.Scheme != v.Scheme || u.Host != v.Host || u.Path != v.Path {
+		return false
+	}
+	if !maps.EqualFunc(u.Query(), v.Query(), slices.Equal) {
+		return false
+	}
+	for _, key := range cassetteHeaders {
+		if r.Header.Get(key) != other.Header.Get(key) {
+			return false
+		}
+	}
+	return true
+}
+
+// response returns the response of r to req.
+func (r RecordedResponse) response(req *http.Request) (*http.Response, error) {
+	body := []byte(r.Body)
+	if r.BodyBase64 {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(r.Body); err != nil {
+			return nil, err
+		}
+	}
+	resp := newResponse(r.Status, body)
+	maps.Copy(resp.Header, r.Header.Clone())
+	resp.Request = req
+	return resp, nil
+}
+
+// storeIDOf returns the store ID of a read-write token of the form
+// vercel_blob_rw_<storeId>_<secret>, or "".
+func storeIDOf(token string) string {
+	rest, ok := strings.CutPrefix(token, "vercel_blob_rw_")
+	if !ok {
+		return ""
+	}
+	storeID, _, _ := strings.Cut(rest, "_")
+	return storeID
+}
@@ -0,0 +1,296 @@
+package testutil
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	vercelblob "github.com/claywarren/vercel_blob"
+)
+
+// ErrConnectionReset is the error of a connection reset by the peer, as a
+// ChaosTransport reports it by default.
+var ErrConnectionReset error = &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+
+// FaultKind is the kind of failure a Fault injects.
+type FaultKind int
+
+const (
+	// FaultError fails the request with Fault.Err, ErrConnectionReset by
+	// default, without sending it.
+	FaultError FaultKind = iota
+	// FaultStatus answers the request with an error response of the API
+	// with Fault.Status, without sending it.
+	FaultStatus
+	// FaultDelay sends the request after Fault.Delay, or fails it with the
+	// error of its context if that ends first.
+	FaultDelay
+	// FaultResetRequest reads Fault.Bytes bytes of the request body, then
+	// fails the request with ErrConnectionReset without sending it.
+	FaultResetRequest
+	// FaultResetResponse sends the request and breaks its response body
+	// with ErrConnectionReset after Fault.Bytes bytes.
+	FaultResetResponse
+	// FaultTruncate sends the request and ends its response body with
+	// io.ErrUnexpectedEOF after Fault.Bytes bytes, as when the connection
+	// closes before the end of the body.
+	FaultTruncate
+)
+
+func (k FaultKind) String() string {
+	switch k {
+	case FaultError:
+		return "error"
+	case FaultStatus:
+		return "status"
+	case FaultDelay:
+		return "delay"
+	case FaultResetRequest:
+		return "reset-request"
+	case FaultResetResponse:
+		return "reset-response"
+	case FaultTruncate:
+		return "truncate"
+	}
+	return "FaultKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// Matcher selects the requests a Fault applies to. Its zero fields match any
+// request.
+type Matcher struct {
+	// Operation and Pathname match the operation of the client that sent
+	// the request and the pathname or URL it was called with, as reported
+	// by vercelblob.RequestInfoFromContext.
+	Operation vercelblob.Operation
+	Pathname  string
+	// PartNumber matches the part number of a part of a multipart upload.
+	PartNumber int
+	// Attempt matches the nth request, starting at 1, with the operation,
+	// pathname and part number of the request, e.g. 1 for the first attempt
+	// at a part and 2 for its first retry.
+	Attempt int
+}
+
+// Fault is a failure a ChaosTransport injects into the requests matching
+// Match.
+type Fault struct {
+	Match Matcher
+	Kind  FaultKind
+	// Times is the number of requests the fault is injected into. Zero
+	// injects it into every matching request.
+	Times int
+
+	// Err is the error of FaultError.
+	Err error
+	// Status is the status of FaultStatus, e.g. 503. The error code of the
+	// response is that of the status, e.g. service_unavailable.
+	Status int
+	// Delay is the delay of FaultDelay.
+	Delay time.Duration
+	// Bytes is the number of bytes that go through before the connection
+	// breaks, for FaultResetRequest, FaultResetResponse and FaultTruncate.
+	Bytes int64
+}
+
+// Injection is a fault injected by a ChaosTransport.
+type Injection struct {
+	Kind       FaultKind
+	Operation  vercelblob.Operation
+	Pathname   string
+	PartNumber int
+	Attempt    int
+}
+
+// ChaosTransport is an http.RoundTripper injecting faults, such as 503s on
+// given parts of a multipart upload, connection resets, slow responses and
+// truncated bodies, into the requests sent through it, to test how a client
+// retries, resumes and gives up. It is safe for concurrent use.
+//
+// Each request gets the first fault of Faults that matches it and has not
+// been used up; requests without one are sent as they are.
+type ChaosTransport struct {
+	// Transport sends the requests, e.g. to a blobtest server. If it is nil,
+	// requests are answered with DefaultResponse.
+	Transport http.RoundTripper
+	Faults    []Fault
+
+	mu        sync.Mutex
+	attempts  map[Matcher]int
+	used      map[int]int
+	injection []Injection
+}
+
+// RoundTrip sends req, injecting its fault.
+func (t *ChaosTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	fault, ok := t.match(req)
+	if !ok {
+		return t.send(req)
+	}
+	switch fault.Kind {
+	case FaultError:
+		closeBody(req)
+		if fault.Err != nil {
+			return nil, fault.Err
+		}
+		return nil, ErrConnectionReset
+	case FaultStatus:
+		closeBody(req)
+		resp := ErrorResponse(fault.Status, statusCode(fault.Status), http.StatusText(fault.Status))
+		resp.Request = req
+		return resp, nil
+	case FaultDelay:
+		timer := time.NewTimer(fault.Delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			closeBody(req)
+			return nil, req.Context().Err()
+		}
+		return t.send(req)
+	case FaultResetRequest:
+		if req.Body != nil {
+			_, _ = io.CopyN(io.Discard, req.Body, fault.Bytes)
+		}
+		closeBody(req)
+		return nil, ErrConnectionReset
+	case FaultResetResponse, FaultTruncate:
+		resp, err := t.send(req)
+		if err != nil {
+			return nil, err
+		}
+		failure := ErrConnectionReset
+		if fault.Kind == FaultTruncate {
+			failure = io.ErrUnexpectedEOF
+		}
+		resp.Body = &brokenBody{body: resp.Body, left: fault.Bytes, err: failure}
+		return resp, nil
+	}
+	closeBody(req)
+	return nil, fmt.Errorf("testutil: unknown fault kind %v", fault.Kind)
+}
+
+// match counts the attempt of req and returns the fault to inject into it.
+func (t *ChaosTransport) match(req *http.Request) (Fault, bool) {
+	var key Matcher
+	if info, ok := vercelblob.RequestInfoFromContext(req.Context()); ok {
+		key.Operation, key.Pathname = info.Operation, info.Pathname
+	}
+	if req.Header.Get("X-MPU-Action") == "upload" {
+		key.PartNumber, _ = strconv.Atoi(req.Header.Get("X-MPU-Part-Number"))
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.attempts == nil {
+		t.attempts, t.used = map[Matcher]int{}, map[int]int{}
+	}
+	t.attempts[key]++
+	attempt := t.attempts[key]
+	for i, fault := range t.Faults {
+		m := fault.Match
+		if m.Operation != "" && m.Operation != key.Operation ||
+			m.Pathname != "" && m.Pathname != key.Pathname ||
+			m.PartNumber != 0 && m.PartNumber != key.PartNumber ||
+			m.Attempt != 0 && m.Attempt != attempt ||
+			fault.Times > 0 && t.used[i] >= fault.Times {
+			continue
+		}
+		t.used[i]++
+		t.injection = append(t.injection, Injection{
+			Kind:       fault.Kind,
+			Operation:  key.Operation,
+			Pathname:   key.Pathname,
+			PartNumber: key.PartNumber,
+			Attempt:    attempt,
+		})
+		return fault, true
+	}
+	return Fault{}, false
+}
+
+// send sends req with the transport, or answers it with DefaultResponse.
+func (t *ChaosTransport) send(req *http.Request) (*http.Response, error) {
+	if t.Transport != nil {
+		return t.Transport.RoundTrip(req)
+	}
+	closeBody(req)
+	resp := DefaultResponse(req)
+	resp.Request = req
+	return resp, nil
+}
+
+// Injections returns the faults injected so far, in order.
+func (t *ChaosTransport) Injections() []Injection {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Injection(nil), t.injection...)
+}
+
+// Attempts returns the number of requests sent through the transport with
+// the operation, pathname and part number of m; its Attempt is ignored.
+func (t *ChaosTransport) Attempts(m Matcher) int {
+	m.Attempt = 0
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.attempts[m]
+}
+
+// Reset forgets the attempts counted and the faults used and injected.
+func (t *ChaosTransport) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.attempts, t.used, t.injection = nil, nil, nil
+}
+
+// brokenBody is a response body failing with err after left bytes.
+type brokenBody struct {
+	body io.ReadCloser
+	left int64
+	err  error
+}
+
+func (b *brokenBody) Read(p []byte) (int, error) {
+	if b.left <= 0 {
+		return 0, b.err
+	}
+	// A body shorter than Bytes ends as it is.
+	n, err := b.body.Read(p[:min(int64(len(p)), b.left)])
+	b.left -= int64(n)
+	return n, err
+}
+
+func (b *brokenBody) Close() error {
+	return b.body.Close()
+}
+
+// closeBody closes the body of a request that is not sent, as a transport
+// must.
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+}
+
+// statusCode returns the error code the API reports with status.
+func statusCode(status int) string {
+	switch status {
+	case http.StatusTooManyRequests:
+		return "rate_limited"
+	case http.StatusServiceUnavailable:
+		return "service_unavailable"
+	case http.StatusNotFound:
+		return "not_found"
+	case http.StatusForbidden:
+		return "forbidden"
+	case http.StatusBadRequest:
+		return "bad_request"
+	}
+	return "unknown_error"
+}
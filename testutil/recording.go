@@ -0,0 +1,197 @@
+// Package testutil helps test code that uses a vercelblob.Client without a
+// blob store. A RecordingTransport, passed to the client with WithTransport,
+// answers every request with a canned response and records it, so that tests
+// can assert on what was sent:
+//
+//	transport := &testutil.RecordingTransport{}
+//	client, _ := vercelblob.NewClientWithOptions(
+//		vercelblob.WithTransport(transport),
+//		vercelblob.WithTokenProvider(vercelblob.StaticTokenProvider("token")),
+//	)
+//	// ... exercise the code under test.
+//	put := transport.AssertPut(t, "reports/x.json")
+//	testutil.AssertHeader(t, put, "X-Cache-Control-Max-Age", "60")
+//
+// For tests that need a store keeping state between requests, see the
+// blobtest package.
+package testutil
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+
+	vercelblob "github.com/claywarren/vercel_blob"
+)
+
+// DefaultMaxBodySize is the number of bytes of each request body recorded by
+// a RecordingTransport without MaxBodySize, enough for a whole part of a
+// multipart upload.
+const DefaultMaxBodySize = vercelblob.MultipartThreshold
+
+// Request is a request recorded by a RecordingTransport.
+type Request struct {
+	// Operation and Pathname are the operation of the client that sent the
+	// request and the pathname or URL it was called with, as reported by
+	// vercelblob.RequestInfoFromContext. They are empty for requests sent by
+	// other means.
+	Operation vercelblob.Operation
+	Pathname  string
+
+	Method string
+	URL    *url.URL
+	Header http.Header
+	// Body holds the first MaxBodySize bytes of the request body, and
+	// BodySize its full size.
+	Body     []byte
+	BodySize int64
+	// PartNumber is the part number of a part of a multipart upload, or 0.
+	PartNumber int
+}
+
+// RecordingTransport is an http.RoundTripper recording the requests sent
+// through it. It is safe for concurrent use; the zero value answers every
+// request with DefaultResponse.
+type RecordingTransport struct {
+	// Transport, if set, sends the requests once recorded, e.g. to a
+	// blobtest server, instead of Respond.
+	Transport http.RoundTripper
+	// Respond, if set, answers the requests. It may return an error to
+	// simulate a network failure, and a nil response and error to fall back
+	// to DefaultResponse, so that it only needs to handle the requests of
+	// interest.
+	Respond func(*http.Request) (*http.Response, error)
+	// MaxBodySize caps the bytes of each request body recorded. Defaults to
+	// DefaultMaxBodySize.
+	MaxBodySize int64
+
+	mu       sync.Mutex
+	requests []Request
+}
+
+// RoundTrip records req and returns its response.
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorded := Request{
+		Method: req.Method,
+		URL:    req.URL,
+		Header: req.Header.Clone(),
+	}
+	if info, ok := vercelblob.RequestInfoFromContext(req.Context()); ok {
+		recorded.Operation, recorded.Pathname = info.Operation, info.Pathname
+	}
+	if req.Header.Get("X-MPU-Action") == "upload" {
+		recorded.PartNumber, _ = strconv.Atoi(req.Header.Get("X-MPU-Part-Number"))
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		recorded.BodySize = int64(len(body))
+		recorded.Body = bytes.Clone(body[:min(int64(len(body)), t.maxBodySize())])
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	t.mu.Lock()
+	t.requests = append(t.requests, recorded)
+	t.mu.Unlock()
+
+	if t.Transport != nil {
+		return t.Transport.RoundTrip(req)
+	}
+	var resp *http.Response
+	if t.Respond != nil {
+		var err error
+		if resp, err = t.Respond(req); err != nil {
+			return nil, err
+		}
+	}
+	if resp == nil {
+		resp = DefaultResponse(req)
+	}
+	resp.Request = req
+	return resp, nil
+}
+
+func (t *RecordingTransport) maxBodySize() int64 {
+	if t.MaxBodySize > 0 {
+		return t.MaxBodySize
+	}
+	return DefaultMaxBodySize
+}
+
+// Requests returns the recorded requests, in the order they were sent.
+func (t *RecordingTransport) Requests() []Request {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Request(nil), t.requests...)
+}
+
+// Reset forgets the recorded requests.
+func (t *RecordingTransport) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.requests = nil
+}
+
+// RequestCount returns the number of recorded requests of operation, or of
+// every request if operation is empty.
+func (t *RecordingTransport) RequestCount(operation vercelblob.Operation) int {
+	n := 0
+	for _, req := range t.Requests() {
+		if operation == "" || req.Operation == operation {
+			n++
+		}
+	}
+	return n
+}
+
+// Puts returns the recorded puts to pathname: the single requests of small
+// blobs, and the create requests of multipart uploads, which carry the same
+// headers.
+func (t *RecordingTransport) Puts(pathname string) []Request {
+	var puts []Request
+	for _, req := range t.Requests() {
+		if (req.Operation == vercelblob.OperationPut || req.Operation == vercelblob.OperationMultipartCreate) && req.Pathname == pathname {
+			puts = append(puts, req)
+		}
+	}
+	return puts
+}
+
+// Parts returns the bodies of the parts of the multipart uploads to
+// pathname, by part number. A part sent more than once, e.g. when retried,
+// keeps its last body.
+func (t *RecordingTransport) Parts(pathname string) map[int][]byte {
+	parts := map[int][]byte{}
+	for _, req := range t.Requests() {
+		if req.PartNumber > 0 && req.Pathname == pathname {
+			parts[req.PartNumber] = req.Body
+		}
+	}
+	return parts
+}
+
+// AssertPut stops the test unless exactly one put to pathname was recorded,
+// and returns it; see Puts.
+func (t *RecordingTransport) AssertPut(tb testing.TB, pathname string) Request {
+	tb.Helper()
+	puts := t.Puts(pathname)
+	if len(puts) != 1 {
+		tb.Fatalf("Expected exactly one put to %s, got %d", pathname, len(puts))
+	}
+	return puts[0]
+}
+
+// AssertHeader reports an error unless the header key of req is want.
+func AssertHeader(tb testing.TB, req Request, key, want string) {
+	tb.Helper()
+	if got := req.Header.Get(key); got != want {
+		tb.Errorf("Expected header %s of %s %s to be %q, got %q", key, req.Method, req.URL, want, got)
+	}
+}
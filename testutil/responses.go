@@ -0,0 +1,151 @@
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	vercelblob "github.com/claywarren/vercel_blob"
+)
+
+// StoreURL is the URL of the store the canned responses place blobs in.
+const StoreURL = "https://store.public.blob.vercel-storage.com/"
+
+// BlobURL returns the URL of the blob at pathname in the responses.
+func BlobURL(pathname string) string {
+	return StoreURL + strings.TrimPrefix(pathname, "/")
+}
+
+// JSONResponse returns a response with status and v encoded as JSON.
+func JSONResponse(status int, v any) *http.Response {
+	body, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("testutil: encode response: %v", err))
+	}
+	resp := newResponse(status, body)
+	resp.Header.Set("Content-Type", "application/json")
+	return resp
+}
+
+// ErrorResponse returns an error response of the API with status, code and
+// message, e.g. ErrorResponse(http.StatusNotFound, "not_found", "").
+func ErrorResponse(status int, code, message string) *http.Response {
+	return JSONResponse(status, vercelblob.BlobAPIError{Error: vercelblob.BlobAPIErrorDetail{Code: code, Message: message}})
+}
+
+// RateLimitedResponse returns a 429 response asking to retry after
+// retryAfter.
+func RateLimitedResponse(retryAfter time.Duration) *http.Response {
+	resp := ErrorResponse(http.StatusTooManyRequests, "rate_limited", "Too many requests.")
+	resp.Header.Set("Retry-After", strconv.Itoa(int(retryAfter.Round(time.Second)/time.Second)))
+	return resp
+}
+
+// PutResponse returns the response of a put or copy of the blob at
+// pathname. An empty contentType defaults to application/octet-stream.
+func PutResponse(pathname, contentType string) *http.Response {
+	return JSONResponse(http.StatusOK, vercelblob.PutBlobPutResult{
+		URL:                BlobURL(pathname),
+		Pathname:           pathname,
+		ContentType:        contentTypeOrDefault(contentType),
+		ContentDisposition: fmt.Sprintf("inline; filename=%q", path.Base(pathname)),
+	})
+}
+
+// HeadResponse returns the response of a head of the blob at pathname.
+func HeadResponse(pathname string, size uint64, contentType string) *http.Response {
+	return JSONResponse(http.StatusOK, map[string]any{
+		"url":                BlobURL(pathname),
+		"downloadUrl":        BlobURL(pathname) + "?download=1",
+		"pathname":           pathname,
+		"size":               size,
+		"uploadedAt":         time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		"contentType":        contentTypeOrDefault(contentType),
+		"contentDisposition": fmt.Sprintf("inline; filename=%q", path.Base(pathname)),
+		"cacheControl":       "public, max-age=2592000",
+	})
+}
+
+// ListResponse returns the response of a list of blobs, as the last page.
+func ListResponse(blobs ...vercelblob.ListBlobResultBlob) *http.Response {
+	return JSONResponse(http.StatusOK, vercelblob.ListBlobResult{Blobs: append([]vercelblob.ListBlobResultBlob{}, blobs...)})
+}
+
+// DownloadResponse returns the response of a download of content.
+func DownloadResponse(content []byte, contentType string) *http.Response {
+	resp := newResponse(http.StatusOK, content)
+	resp.Header.Set("Content-Type", contentTypeOrDefault(contentType))
+	return resp
+}
+
+// DefaultResponse returns a successful response fitting req, as if the API
+// had performed it: puts, copies and multipart uploads store the blob at the
+// requested pathname, heads find a blob, lists are empty and downloads
+// return no content.
+func DefaultResponse(req *http.Request) *http.Response {
+	pathname := strings.TrimPrefix(req.URL.Path, "/")
+	switch req.Header.Get("X-MPU-Action") {
+	case "create":
+		return JSONResponse(http.StatusOK, map[string]string{"uploadId": "upload-id", "key": mpuPathname(req)})
+	case "upload":
+		resp := JSONResponse(http.StatusOK, map[string]string{})
+		resp.Header.Set("ETag", `"part-`+req.Header.Get("X-MPU-Part-Number")+`"`)
+		return resp
+	case "complete":
+		return PutResponse(mpuPathname(req), req.Header.Get("X-Content-Type"))
+	case "abort":
+		return JSONResponse(http.StatusOK, map[string]string{})
+	}
+	q := req.URL.Query()
+	switch {
+	case req.Method == http.MethodPut:
+		return PutResponse(pathname, req.Header.Get("X-Content-Type"))
+	case req.Method == http.MethodPost && path.Base(req.URL.Path) == "delete":
+		return JSONResponse(http.StatusOK, map[string]string{})
+	case req.Method == http.MethodGet && q.Has("url"):
+		target := q.Get("url")
+		if u, err := url.Parse(target); err == nil && u.IsAbs() {
+			target = strings.TrimPrefix(u.Path, "/")
+		}
+		return HeadResponse(target, 0, "")
+	case req.Method == http.MethodGet && pathname == "":
+		return ListResponse()
+	default:
+		return DownloadResponse(nil, "")
+	}
+}
+
+// mpuPathname returns the pathname of a request of a multipart upload.
+func mpuPathname(req *http.Request) string {
+	if pathname := req.URL.Query().Get("pathname"); pathname != "" {
+		return pathname
+	}
+	return req.Header.Get("X-MPU-Key")
+}
+
+func newResponse(status int, body []byte) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+}
+
+func contentTypeOrDefault(contentType string) string {
+	if contentType == "" {
+		return "application/octet-stream"
+	}
+	return contentType
+}
@@ -0,0 +1,96 @@
+package testutil
+
+import (
+	"context"
+	"crypto/rand"
+	"hash/fnv"
+	randv2 "math/rand/v2"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	vercelblob "github.com/claywarren/vercel_blob"
+)
+
+// SandboxRoot is the prefix under which NewSandbox creates the prefixes of
+// live tests.
+const SandboxRoot = "vercel_blob_unittest"
+
+// RunID identifies the run of the test binary in the prefixes of its
+// sandboxes, so that concurrent runs against the same store, e.g. of
+// parallel CI jobs, do not collide.
+var RunID = time.Now().UTC().Format("20060102T150405") + "-" + strings.ToLower(rand.Text()[:8])
+
+// SandboxCleanupTimeout bounds the deletion of a sandbox when its test ends.
+const SandboxCleanupTimeout = 2 * time.Minute
+
+// Sandbox is a prefix of the live store reserved for a test, deleted with
+// everything under it when the test ends, whether it passed or not.
+type Sandbox struct {
+	// Client is scoped to Prefix with WithPrefix, so that tests address
+	// blobs by pathnames relative to the sandbox.
+	Client *vercelblob.Client
+	// Prefix is SandboxRoot/RunID/<test name>/.
+	Prefix string
+}
+
+// NewSandbox returns the sandbox of the test in the store of LiveToken, and
+// skips the test if LiveToken is empty. opts are applied to the client after
+// its token. A sandbox that cannot be deleted fails the test.
+func NewSandbox(t testing.TB, opts ...vercelblob.ClientOption) *Sandbox {
+	t.Helper()
+	if LiveToken == "" {
+		t.Skip("Skipping live test: BLOB_READ_WRITE_TOKEN not set")
+	}
+	client, err := vercelblob.NewClientWithOptions(append([]vercelblob.ClientOption{
+		vercelblob.WithTokenProvider(vercelblob.StaticTokenProvider(LiveToken)),
+	}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix := path.Join(SandboxRoot, RunID, sandboxName(t.Name())) + "/"
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), SandboxCleanupTimeout)
+		defer cancel()
+		result, err := client.DeletePrefix(ctx, prefix, vercelblob.PrefixOptions{})
+		switch {
+		case err != nil:
+			t.Errorf("Delete sandbox %s: %v", prefix, err)
+		case len(result.Failed) > 0:
+			t.Errorf("Delete sandbox %s: %d blobs left: %v", prefix, len(result.Failed), result.Failed)
+		}
+	})
+	return &Sandbox{Client: client.WithPrefix(prefix), Prefix: prefix}
+}
+
+// Pathname returns the full pathname of the blob at name in the sandbox.
+func (s *Sandbox) Pathname(name string) string {
+	return s.Prefix + strings.TrimPrefix(name, "/")
+}
+
+// Fixture returns size bytes of content derived from name, the same in every
+// run, so that tests need no fixture files and can tell apart the content of
+// different blobs and parts.
+func Fixture(name string, size int) []byte {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+	r := randv2.New(randv2.NewPCG(h.Sum64(), uint64(size)))
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(r.Uint32())
+	}
+	return content
+}
+
+// sandboxName returns the name of a test as a pathname, keeping the slashes
+// of subtests.
+func sandboxName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9', r == '/', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, name)
+}
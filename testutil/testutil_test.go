@@ -0,0 +1,290 @@
+package testutil_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	vercelblob "github.com/claywarren/vercel_blob"
+	"github.com/claywarren/vercel_blob/blobtest"
+	"github.com/claywarren/vercel_blob/testutil"
+)
+
+func newClient(t *testing.T, transport *testutil.RecordingTransport, opts ...vercelblob.ClientOption) *vercelblob.Client {
+	t.Helper()
+	client, err := vercelblob.NewClientWithOptions(append([]vercelblob.ClientOption{
+		vercelblob.WithTransport(transport),
+		vercelblob.WithTokenProvider(vercelblob.StaticTokenProvider("token")),
+		vercelblob.WithNoEnv(),
+	}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func Test_RecordingTransport_DefaultResponses(t *testing.T) {
+	transport := &testutil.RecordingTransport{}
+	client := newClient(t, transport)
+	ctx := context.Background()
+
+	put, err := client.Put(ctx, "reports/x.json", strings.NewReader(`{"a":1}`), vercelblob.PutCommandOptions{CacheControlMaxAge: 60, ContentType: "application/json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if put.URL != testutil.BlobURL("reports/x.json") || put.ContentType != "application/json" {
+		t.Errorf("Unexpected put result %+v", put)
+	}
+	if _, err := client.Head(ctx, put.URL); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.List(ctx, vercelblob.ListCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Copy(ctx, put.URL, "reports/y.json", vercelblob.PutCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Delete(ctx, put.URL); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Download(ctx, put.URL, vercelblob.DownloadCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := transport.AssertPut(t, "reports/x.json")
+	testutil.AssertHeader(t, req, "X-Cache-Control-Max-Age", "60")
+	testutil.AssertHeader(t, req, "Authorization", "Bearer token")
+	if req.Method != http.MethodPut || string(req.Body) != `{"a":1}` || req.BodySize != 7 {
+		t.Errorf("Unexpected request %+v", req)
+	}
+	if n := transport.RequestCount(""); n != 6 {
+		t.Errorf("Expected 6 requests, got %d", n)
+	}
+	for _, operation := range []vercelblob.Operation{vercelblob.OperationPut, vercelblob.OperationHead, vercelblob.OperationList, vercelblob.OperationCopy, vercelblob.OperationDelete, vercelblob.OperationDownload} {
+		if n := transport.RequestCount(operation); n != 1 {
+			t.Errorf("Expected one %s request, got %d", operation, n)
+		}
+	}
+
+	transport.Reset()
+	if n := transport.RequestCount(""); n != 0 {
+		t.Errorf("Expected no requests after Reset, got %d", n)
+	}
+}
+
+func Test_RecordingTransport_Multipart(t *testing.T) {
+	transport := &testutil.RecordingTransport{MaxBodySize: 16}
+	client := newClient(t, transport)
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), vercelblob.MultipartThreshold/16+1)
+	if _, err := client.Put(context.Background(), "big.bin", bytes.NewReader(content), vercelblob.PutCommandOptions{CacheControlMaxAge: 60}); err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertHeader(t, transport.AssertPut(t, "big.bin"), "X-Cache-Control-Max-Age", "60")
+	parts := transport.Parts("big.bin")
+	if len(parts) != 2 || string(parts[1]) != "0123456789abcdef" || string(parts[2]) != "0123456789abcdef" {
+		t.Errorf("Expected 2 parts of 16 recorded bytes, got %q", parts)
+	}
+	for _, req := range transport.Requests() {
+		if req.PartNumber == 2 && req.BodySize != 16 {
+			t.Errorf("Expected the last part to be 16 bytes, got %d", req.BodySize)
+		}
+	}
+	if n := transport.RequestCount(vercelblob.OperationMultipartPart); n != 2 {
+		t.Errorf("Expected 2 parts, got %d", n)
+	}
+}
+
+func Test_RecordingTransport_Respond(t *testing.T) {
+	transport := &testutil.RecordingTransport{
+		Respond: func(req *http.Request) (*http.Response, error) {
+			info, _ := vercelblob.RequestInfoFromContext(req.Context())
+			switch info.Operation {
+			case vercelblob.OperationHead:
+				return testutil.ErrorResponse(http.StatusNotFound, "not_found", "The requested blob does not exist"), nil
+			case vercelblob.OperationList:
+				return testutil.RateLimitedResponse(time.Second), nil
+			case vercelblob.OperationDelete:
+				return nil, errors.New("connection reset")
+			}
+			return nil, nil
+		},
+	}
+	client := newClient(t, transport)
+	ctx := context.Background()
+
+	if _, err := client.Head(ctx, "a.txt"); !vercelblob.IsNotFound(err) {
+		t.Errorf("Expected not_found, got %v", err)
+	}
+	_, err := client.List(ctx, vercelblob.ListCommandOptions{})
+	if retryAfter, ok := vercelblob.RetryAfter(err); !vercelblob.IsRateLimited(err) || !ok || retryAfter != time.Second {
+		t.Errorf("Expected rate_limited after 1s, got %v", err)
+	}
+	if err := client.Delete(ctx, "a.txt"); err == nil || !strings.Contains(err.Error(), "connection reset") {
+		t.Errorf("Expected a network failure, got %v", err)
+	}
+	if _, err := client.Put(ctx, "a.txt", strings.NewReader("a"), vercelblob.PutCommandOptions{}); err != nil {
+		t.Errorf("Expected the default response, got %v", err)
+	}
+	if n := transport.RequestCount(""); n != 4 {
+		t.Errorf("Expected 4 requests, got %d", n)
+	}
+}
+
+func Test_RecordingTransport_Transport(t *testing.T) {
+	server := blobtest.NewServer()
+	defer server.Close()
+	transport := &testutil.RecordingTransport{Transport: http.DefaultTransport}
+	client := newClient(t, transport, vercelblob.WithBaseURL(server.URL))
+	ctx := context.Background()
+
+	if _, err := client.Put(ctx, "a.txt", strings.NewReader("abc"), vercelblob.PutCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Put(ctx, "a.txt", strings.NewReader("abc"), vercelblob.PutCommandOptions{}); !errors.Is(err, vercelblob.ErrBlobAlreadyExists) {
+		t.Errorf("Expected the server to answer, got %v", err)
+	}
+	if blob, ok := server.Blob("a.txt"); !ok || string(blob.Content) != "abc" {
+		t.Errorf("Expected the body to be forwarded, got %+v", blob)
+	}
+	if puts := transport.Puts("a.txt"); len(puts) != 2 || string(puts[1].Body) != "abc" {
+		t.Errorf("Expected 2 recorded puts, got %+v", puts)
+	}
+}
+
+func Test_Cassette_RecordReplay(t *testing.T) {
+	t.Chdir(t.TempDir())
+	token := testutil.LiveToken
+	defer func() { testutil.LiveToken = token }()
+	server := blobtest.NewServer()
+	defer server.Close()
+
+	run := func(t *testing.T, wantRecording bool) {
+		cassette := testutil.NewCassette(t, "roundtrip")
+		if cassette.Recording() != wantRecording {
+			t.Fatalf("Expected recording %v", wantRecording)
+		}
+		client, err := vercelblob.NewClientWithOptions(append(cassette.ClientOptions(), vercelblob.WithBaseURL(server.URL))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		put, err := client.Put(context.Background(), "a.txt", strings.NewReader("abc"), vercelblob.PutCommandOptions{AllowOverwrite: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := client.Download(context.Background(), put.URL, vercelblob.DownloadCommandOptions{ByteRange: &vercelblob.Range{Start: 1, End: 2}})
+		if err != nil || string(data) != "bc" {
+			t.Errorf("Expected the range, got %q, %v", data, err)
+		}
+	}
+
+	t.Run("record", func(t *testing.T) {
+		testutil.LiveToken = "vercel_blob_rw_Secret42_abc"
+		server.Token = testutil.LiveToken
+		run(t, true)
+	})
+	data, err := os.ReadFile(testutil.CassettePath("roundtrip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(strings.ToLower(string(data)), "secret42") || strings.Contains(string(data), "Authorization") {
+		t.Errorf("Expected the token to be scrubbed, got %s", data)
+	}
+	if interactions, err := testutil.LoadCassette("roundtrip"); err != nil || len(interactions) != 2 || interactions[1].Request.Header.Get("Range") != "bytes=1-2" {
+		t.Errorf("Unexpected interactions %+v, %v", interactions, err)
+	}
+
+	t.Run("replay", func(t *testing.T) {
+		testutil.LiveToken = ""
+		server.Close()
+		run(t, false)
+	})
+}
+
+func Test_ChaosTransport_Matching(t *testing.T) {
+	failure := errors.New("boom")
+	chaos := &testutil.ChaosTransport{Faults: []testutil.Fault{
+		{Match: testutil.Matcher{Operation: vercelblob.OperationHead, Attempt: 2}, Kind: testutil.FaultError, Err: failure},
+		{Match: testutil.Matcher{Operation: vercelblob.OperationList}, Kind: testutil.FaultStatus, Status: http.StatusNotFound, Times: 1},
+	}}
+	client, err := vercelblob.NewClientWithOptions(
+		vercelblob.WithTransport(chaos),
+		vercelblob.WithTokenProvider(vercelblob.StaticTokenProvider("token")),
+		vercelblob.WithNoEnv(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		_, err := client.Head(ctx, "a.txt")
+		if attempt == 2 != errors.Is(err, failure) {
+			t.Errorf("Expected only attempt 2 to fail, attempt %d got %v", attempt, err)
+		}
+	}
+	if _, err := client.List(ctx, vercelblob.ListCommandOptions{}); !vercelblob.IsNotFound(err) {
+		t.Errorf("Expected the first list to get a 404, got %v", err)
+	}
+	if _, err := client.List(ctx, vercelblob.ListCommandOptions{}); err != nil {
+		t.Errorf("Expected the fault to be used up, got %v", err)
+	}
+
+	injections := chaos.Injections()
+	if len(injections) != 2 || injections[0].Kind != testutil.FaultError || injections[0].Attempt != 2 || injections[1].Kind != testutil.FaultStatus {
+		t.Errorf("Unexpected injections %+v", injections)
+	}
+	if n := chaos.Attempts(testutil.Matcher{Operation: vercelblob.OperationHead, Pathname: "a.txt"}); n != 3 {
+		t.Errorf("Expected 3 heads, got %d", n)
+	}
+	chaos.Reset()
+	if _, err := client.Head(ctx, "a.txt"); err != nil || len(chaos.Injections()) != 0 {
+		t.Errorf("Expected Reset to restart the count, got %v", err)
+	}
+}
+
+func Test_Sandbox(t *testing.T) {
+	token := testutil.LiveToken
+	defer func() { testutil.LiveToken = token }()
+	server := blobtest.NewServer()
+	defer server.Close()
+	server.Seed("vercel_blob_unittest/keep.txt", []byte("keep"), "")
+
+	testutil.LiveToken = ""
+	t.Run("skipped", func(t *testing.T) {
+		defer func() {
+			if !t.Skipped() {
+				t.Error("Expected the test to be skipped without a token")
+			}
+		}()
+		testutil.NewSandbox(t)
+	})
+
+	testutil.LiveToken = "token"
+	var prefix string
+	t.Run("live", func(t *testing.T) {
+		sandbox := testutil.NewSandbox(t, vercelblob.WithBaseURL(server.URL))
+		prefix = sandbox.Prefix
+		if !strings.HasPrefix(prefix, testutil.SandboxRoot+"/"+testutil.RunID+"/Test_Sandbox/live/") {
+			t.Errorf("Unexpected prefix %s", prefix)
+		}
+		if _, err := sandbox.Client.Put(context.Background(), "dir/a.txt", bytes.NewReader(testutil.Fixture("a", 10)), vercelblob.PutCommandOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := server.Blob(sandbox.Pathname("dir/a.txt")); !ok {
+			t.Error("Expected the blob in the sandbox")
+		}
+	})
+	if blobs := server.Blobs(); len(blobs) != 1 || blobs[0].Pathname != "vercel_blob_unittest/keep.txt" {
+		t.Errorf("Expected the sandbox %s to be deleted, and only it, got %+v", prefix, blobs)
+	}
+
+	if !bytes.Equal(testutil.Fixture("a", 10), testutil.Fixture("a", 10)) || bytes.Equal(testutil.Fixture("a", 10), testutil.Fixture("b", 10)) {
+		t.Error("Expected fixtures to depend on their name only")
+	}
+}
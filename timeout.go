@@ -0,0 +1,102 @@
+package vercelblob
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Default time limits of a single request per operation, applied when the
+// caller's context has no deadline. Metadata operations are expected to be
+// quick; transfers of blob contents are not limited.
+const (
+	defaultMetadataTimeout = 30 * time.Second
+	defaultCommandTimeout  = 2 * time.Minute
+)
+
+// defaultOperationTimeouts returns the time limit of a request for each
+// operation. Operations that are missing are not limited.
+func defaultOperationTimeouts() map[Operation]time.Duration {
+	return map[Operation]time.Duration{
+		OperationList:              defaultMetadataTimeout,
+		OperationHead:              defaultMetadataTimeout,
+		OperationDelete:            defaultMetadataTimeout,
+		OperationCopy:              defaultCommandTimeout,
+		OperationMultipartCreate:   defaultCommandTimeout,
+		OperationMultipartComplete: defaultCommandTimeout,
+	}
+}
+
+// WithOperationTimeout limits each request made for operation to d when the
+// caller's context has no deadline; a deadline set by the caller always wins.
+// A zero d removes the limit.
+//
+// By default list, head and delete requests are limited to 30 seconds, copies
+// and the first and last steps of multipart uploads to 2 minutes, and puts,
+// parts and downloads are not limited. Each part of a multipart upload is a
+// separate request.
+func WithOperationTimeout(operation Operation, d time.Duration) ClientOption {
+	return func(c *Client) error {
+		if d < 0 {
+			return NewInvalidOptionError("WithOperationTimeout", fmt.Sprintf("%v is a negative duration", d))
+		}
+		c.setOperationTimeout(operation, d)
+		return nil
+	}
+}
+
+// WithRequestTimeout limits every request to d when the caller's context has
+// no deadline, replacing the per-operation defaults of WithOperationTimeout.
+// A zero d removes every limit.
+func WithRequestTimeout(d time.Duration) ClientOption {
+	return func(c *Client) error {
+		if d < 0 {
+			return NewInvalidOptionError("WithRequestTimeout", fmt.Sprintf("%v is a negative duration", d))
+		}
+		c.operationTimeouts = map[Operation]time.Duration{}
+		for _, operation := range []Operation{
+			OperationList, OperationPut, OperationHead, OperationDownload, OperationDelete, OperationCopy,
+			OperationMultipartCreate, OperationMultipartPart, OperationMultipartComplete, OperationMultipartAbort,
+		} {
+			c.setOperationTimeout(operation, d)
+		}
+		return nil
+	}
+}
+
+func (c *Client) setOperationTimeout(operation Operation, d time.Duration) {
+	if d == 0 {
+		delete(c.operationTimeouts, operation)
+		return
+	}
+	c.operationTimeouts[operation] = d
+}
+
+// withOperationTimeout adds the time limit of operation to the context of req
+// if it has no deadline yet. The returned function releases the context.
+func (c *Client) withOperationTimeout(req *http.Request, operation Operation) (*http.Request, context.CancelFunc) {
+	d, ok := c.operationTimeouts[operation]
+	if !ok {
+		return req, func() {}
+	}
+	if _, hasDeadline := req.Context().Deadline(); hasDeadline {
+		return req, func() {}
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), d)
+	return req.WithContext(ctx), cancel
+}
+
+// cancelOnClose releases the context of a request once its response body is
+// closed, as the body is read after the request returns.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,97 @@
+package vercelblob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_WithOperationTimeout_Mock(t *testing.T) {
+	// The server answers every request after a delay.
+	const delay = 200 * time.Millisecond
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.txt","pathname":"a.txt"}`))
+	}))
+	defer server.Close()
+
+	withDeadline := func(d time.Duration) func() (context.Context, context.CancelFunc) {
+		return func() (context.Context, context.CancelFunc) { return context.WithTimeout(context.Background(), d) }
+	}
+	background := func() (context.Context, context.CancelFunc) { return context.Background(), func() {} }
+	head := func(c *Client, ctx context.Context) error { _, err := c.Head(ctx, "a.txt"); return err }
+	put := func(c *Client, ctx context.Context) error {
+		_, err := c.Put(ctx, "a.txt", strings.NewReader("a"), PutCommandOptions{})
+		return err
+	}
+
+	tests := []struct {
+		name    string
+		opts    []ClientOption
+		ctx     func() (context.Context, context.CancelFunc)
+		call    func(*Client, context.Context) error
+		timeout bool
+	}{
+		{name: "default head limit", ctx: background, call: head},
+		{name: "head limit", opts: []ClientOption{WithOperationTimeout(OperationHead, delay/4)}, ctx: background, call: head, timeout: true},
+		{name: "caller deadline beyond limit", opts: []ClientOption{WithOperationTimeout(OperationHead, delay/4)}, ctx: withDeadline(10 * delay), call: head},
+		{name: "caller deadline within limit", opts: []ClientOption{WithOperationTimeout(OperationHead, 10*delay)}, ctx: withDeadline(delay / 4), call: head, timeout: true},
+		{name: "limit removed", opts: []ClientOption{WithRequestTimeout(delay / 4), WithOperationTimeout(OperationHead, 0)}, ctx: background, call: head},
+		{name: "other operation", opts: []ClientOption{WithOperationTimeout(OperationHead, delay/4)}, ctx: background, call: put},
+		{name: "request limit", opts: []ClientOption{WithRequestTimeout(delay / 4)}, ctx: background, call: put, timeout: true},
+		{name: "request limit overridden", opts: []ClientOption{WithRequestTimeout(delay / 4), WithOperationTimeout(OperationPut, 10*delay)}, ctx: background, call: put},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, append(tt.opts, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")))...)
+			ctx, cancel := tt.ctx()
+			defer cancel()
+
+			err := tt.call(client, ctx)
+			if tt.timeout && !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+			}
+			if !tt.timeout && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func Test_WithOperationTimeout_Download_Mock(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		time.Sleep(50 * time.Millisecond)
+		_, _ = w.Write([]byte("content"))
+	}))
+	defer server.Close()
+
+	// The limit covers reading the body, which happens after the request returns.
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")), WithOperationTimeout(OperationDownload, time.Second))
+	content, err := client.Download(context.Background(), server.URL+"/a.txt", DownloadCommandOptions{})
+	if err != nil || string(content) != "content" {
+		t.Errorf("Expected content, got %q, %v", content, err)
+	}
+	client = newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")), WithOperationTimeout(OperationDownload, 10*time.Millisecond))
+	if _, err := client.Download(context.Background(), server.URL+"/a.txt", DownloadCommandOptions{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded while reading the body, got %v", err)
+	}
+}
+
+func Test_WithOperationTimeout_Invalid(t *testing.T) {
+	for _, opt := range []ClientOption{WithOperationTimeout(OperationHead, -time.Second), WithRequestTimeout(-time.Second)} {
+		if _, err := NewClientWithOptions(opt); err == nil {
+			t.Error("Expected an error for a negative timeout")
+		}
+	}
+}
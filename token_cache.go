@@ -0,0 +1,117 @@
+package vercelblob
+
+import (
+	"sync"
+	"time"
+)
+
+// cachingRefreshAhead is the fraction of the TTL after which
+// CachingTokenProvider starts refreshing a token in the background.
+const cachingRefreshAhead = 0.75
+
+// CachingTokenProvider wraps a TokenProvider and caches its tokens per
+// operation and pathname, so a provider that calls a network service is only
+// consulted once per TTL.
+//
+// Once a token is three quarters through its TTL it is refreshed in the
+// background while the cached token keeps being served. Concurrent requests
+// for a missing or expired token share a single call to the wrapped provider.
+// It is safe for concurrent use.
+type CachingTokenProvider struct {
+	inner TokenProvider
+	ttl   time.Duration
+	clock func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*cachingTokenEntry
+	flight  flightGroup[string]
+}
+
+type cachingTokenEntry struct {
+	token      string
+	fetchedAt  time.Time
+	refreshing bool
+}
+
+// CachingTokenProviderOption configures a CachingTokenProvider.
+type CachingTokenProviderOption func(*CachingTokenProvider)
+
+// WithCacheClock sets the clock the provider reads the time from to decide
+// when a token is to be refreshed. Defaults to time.Now.
+func WithCacheClock(now func() time.Time) CachingTokenProviderOption {
+	return func(p *CachingTokenProvider) {
+		p.clock = now
+	}
+}
+
+// NewCachingTokenProvider creates a new CachingTokenProvider that caches the
+// tokens of inner for ttl.
+func NewCachingTokenProvider(inner TokenProvider, ttl time.Duration, opts ...CachingTokenProviderOption) *CachingTokenProvider {
+	p := &CachingTokenProvider{
+		inner:   inner,
+		ttl:     ttl,
+		entries: map[string]*cachingTokenEntry{},
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// now returns the time of the clock of the provider.
+func (p *CachingTokenProvider) now() time.Time {
+	if p.clock != nil {
+		return p.clock()
+	}
+	return time.Now()
+}
+
+// GetToken returns the cached token for the operation and pathname, or
+// obtains one from the wrapped provider.
+func (p *CachingTokenProvider) GetToken(operation string, pathname string) (string, error) {
+	key := operation + "\x00" + pathname
+
+	p.mu.Lock()
+	entry, ok := p.entries[key]
+	if ok {
+		age := p.now().Sub(entry.fetchedAt)
+		if age < p.ttl {
+			if age > time.Duration(float64(p.ttl)*cachingRefreshAhead) && !entry.refreshing {
+				entry.refreshing = true
+				go func() { _, _ = p.refresh(key, operation, pathname) }()
+			}
+			token := entry.token
+			p.mu.Unlock()
+			return token, nil
+		}
+	}
+	p.mu.Unlock()
+
+	return p.refresh(key, operation, pathname)
+}
+
+// refresh obtains a token from the wrapped provider and caches it.
+func (p *CachingTokenProvider) refresh(key, operation, pathname string) (string, error) {
+	return p.flight.do(key, func() (string, error) {
+		token, err := p.inner.GetToken(operation, pathname)
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if err != nil {
+			if entry, ok := p.entries[key]; ok {
+				entry.refreshing = false
+			}
+			return "", err
+		}
+		p.entries[key] = &cachingTokenEntry{token: token, fetchedAt: p.now()}
+		return token, nil
+	})
+}
+
+// Invalidate removes the cached token for the operation and pathname, for
+// example after the API rejected it, so the next GetToken obtains a new one.
+func (p *CachingTokenProvider) Invalidate(operation, pathname string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.entries, operation+"\x00"+pathname)
+}
@@ -0,0 +1,117 @@
+package vercelblob
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingTokenProvider returns a new token on every call.
+type countingTokenProvider struct {
+	calls int32
+	delay time.Duration
+	err   error
+}
+
+func (p *countingTokenProvider) GetToken(operation string, pathname string) (string, error) {
+	n := atomic.AddInt32(&p.calls, 1)
+	time.Sleep(p.delay)
+	if p.err != nil {
+		return "", p.err
+	}
+	return fmt.Sprintf("%s:%s:%d", operation, pathname, n), nil
+}
+
+func Test_CachingTokenProvider(t *testing.T) {
+	inner := &countingTokenProvider{delay: 5 * time.Millisecond}
+	provider := NewCachingTokenProvider(inner, time.Hour)
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if token, _ := provider.GetToken("put", "a.txt"); token != "put:a.txt:1" {
+				t.Errorf("Expected put:a.txt:1, got %s", token)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if token, _ := provider.GetToken("list", ""); token != "list::2" {
+		t.Errorf("Expected a separate token per operation, got %s", token)
+	}
+
+	provider.Invalidate("put", "a.txt")
+	if token, _ := provider.GetToken("put", "a.txt"); token != "put:a.txt:3" {
+		t.Errorf("Expected a new token after Invalidate, got %s", token)
+	}
+}
+
+func Test_CachingTokenProvider_RefreshAhead(t *testing.T) {
+	clock := newFakeClock(time.Unix(1700000000, 0))
+	inner := &countingTokenProvider{}
+	provider := NewCachingTokenProvider(inner, 100*time.Second, WithCacheClock(clock.Now))
+
+	first, _ := provider.GetToken("put", "a.txt")
+	clock.Advance(75 * time.Second)
+	if token, _ := provider.GetToken("put", "a.txt"); token != first {
+		t.Errorf("Expected the cached token, got %s", token)
+	}
+	if calls := atomic.LoadInt32(&inner.calls); calls != 1 {
+		t.Errorf("Expected no refresh before three quarters of the TTL, got %d calls", calls)
+	}
+
+	clock.Advance(time.Second)
+	if token, _ := provider.GetToken("put", "a.txt"); token != first {
+		t.Errorf("Expected the cached token while refreshing, got %s", token)
+	}
+	waitForCachedToken(t, provider, "put\x00a.txt", "put:a.txt:2")
+
+	clock.Advance(100 * time.Second)
+	if token, _ := provider.GetToken("put", "a.txt"); token != "put:a.txt:3" {
+		t.Errorf("Expected a new token after the TTL, got %s", token)
+	}
+}
+
+// waitForCachedToken waits for a background refresh to store token.
+func waitForCachedToken(t *testing.T, provider *CachingTokenProvider, key, token string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		provider.mu.Lock()
+		entry, ok := provider.entries[key]
+		cached := ok && entry.token == token
+		provider.mu.Unlock()
+		if cached {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Expected %s to be cached", token)
+}
+
+func Test_CachingTokenProvider_Error(t *testing.T) {
+	inner := &countingTokenProvider{err: ErrForbidden}
+	provider := NewCachingTokenProvider(inner, time.Hour)
+	for range 2 {
+		if _, err := provider.GetToken("put", "a.txt"); !errors.Is(err, ErrForbidden) {
+			t.Errorf("Expected ErrForbidden, got %v", err)
+		}
+	}
+	if inner.calls != 2 {
+		t.Errorf("Expected errors not to be cached, got %d calls", inner.calls)
+	}
+}
+
+func Benchmark_CachingTokenProvider(b *testing.B) {
+	provider := NewCachingTokenProvider(&countingTokenProvider{}, time.Hour)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, _ = provider.GetToken("put", "a.txt")
+		}
+	})
+}
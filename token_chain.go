@@ -0,0 +1,54 @@
+package vercelblob
+
+import "errors"
+
+// TokenProviderChain is a TokenProvider that tries several providers in order.
+// Create it with ChainTokenProvider.
+type TokenProviderChain struct {
+	providers []TokenProvider
+
+	// OnServe, if set, is called with the index of the provider that
+	// returned the token, for debugging.
+	OnServe func(index int, provider TokenProvider)
+}
+
+// ChainTokenProvider returns a provider that asks each of providers in turn.
+// A provider failing with ErrNotAuthenticated means "try the next one"; any
+// other error is returned immediately. If no provider has a token, the chain
+// fails with ErrNotAuthenticated.
+//
+// For example, to prefer a per-request provider and fall back to the
+// BLOB_READ_WRITE_TOKEN environment variable:
+//
+//	ChainTokenProvider(requestProvider, &EnvTokenProvider{})
+func ChainTokenProvider(providers ...TokenProvider) *TokenProviderChain {
+	return &TokenProviderChain{providers: providers}
+}
+
+// GetToken returns the first token obtained from the chained providers.
+func (c *TokenProviderChain) GetToken(operation string, pathname string) (string, error) {
+	for i, provider := range c.providers {
+		token, err := provider.GetToken(operation, pathname)
+		if errors.Is(err, ErrNotAuthenticated) || err == nil && token == "" {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if c.OnServe != nil {
+			c.OnServe(i, provider)
+		}
+		return token, nil
+	}
+	return "", ErrNotAuthenticated
+}
+
+// Invalidate invalidates the token for the operation and pathname in every
+// chained provider that caches tokens.
+func (c *TokenProviderChain) Invalidate(operation, pathname string) {
+	for _, provider := range c.providers {
+		if invalidator, ok := provider.(Invalidator); ok {
+			invalidator.Invalidate(operation, pathname)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package vercelblob
+
+import (
+	"errors"
+	"testing"
+)
+
+// errTokenService is a failure of a token service other than a missing token.
+var errTokenService = errors.New("token service unavailable")
+
+func Test_ChainTokenProvider(t *testing.T) {
+	missing := &countingTokenProvider{err: ErrNotAuthenticated}
+	failing := &countingTokenProvider{err: errTokenService}
+
+	tests := []struct {
+		name      string
+		providers []TokenProvider
+		wantToken string
+		wantIndex int
+		wantErr   error
+	}{
+		{name: "empty chain", wantErr: ErrNotAuthenticated},
+		{name: "all missing", providers: []TokenProvider{missing, StaticTokenProvider("")}, wantErr: ErrNotAuthenticated},
+		{name: "first wins", providers: []TokenProvider{StaticTokenProvider("a"), StaticTokenProvider("b")}, wantToken: "a", wantIndex: 0},
+		{name: "fall back", providers: []TokenProvider{missing, StaticTokenProvider("b")}, wantToken: "b", wantIndex: 1},
+		{name: "fatal error", providers: []TokenProvider{missing, failing, StaticTokenProvider("c")}, wantErr: errTokenService},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			served := -1
+			chain := ChainTokenProvider(tt.providers...)
+			chain.OnServe = func(index int, _ TokenProvider) { served = index }
+
+			token, err := chain.GetToken("put", "a.txt")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Expected %v, got %v", tt.wantErr, err)
+				}
+				if served != -1 {
+					t.Errorf("Expected OnServe not to be called, got %d", served)
+				}
+				return
+			}
+			if err != nil || token != tt.wantToken {
+				t.Errorf("Expected %s, got %s, %v", tt.wantToken, token, err)
+			}
+			if served != tt.wantIndex {
+				t.Errorf("Expected provider %d to serve, got %d", tt.wantIndex, served)
+			}
+		})
+	}
+}
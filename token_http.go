@@ -0,0 +1,240 @@
+package vercelblob
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// defaultTokenRefreshMargin is how long before its expiry a cached token is
+// replaced by HTTPTokenProvider.
+const defaultTokenRefreshMargin = 30 * time.Second
+
+// defaultTokenEndpointTimeout is how long HTTPTokenProvider waits for the
+// endpoint by default.
+const defaultTokenEndpointTimeout = 10 * time.Second
+
+// HTTPTokenProvider is a TokenProvider that fetches short-lived tokens from a
+// route of your application, as suggested by the TokenProvider documentation.
+//
+// For every operation it POSTs {"operation": ..., "pathname": ...} to the
+// endpoint, which must answer with {"token": ..., "expiresAt": ...} where
+// expiresAt is in Unix milliseconds. Tokens are cached per operation and
+// pathname until shortly before they expire, and concurrent requests for the
+// same token share a single call to the endpoint.
+type HTTPTokenProvider struct {
+	url           string
+	httpClient    *http.Client
+	bearer        func() (string, error)
+	refreshMargin time.Duration
+	timeout       time.Duration
+	clock         func() time.Time
+
+	mu     sync.Mutex
+	cache  map[string]cachedToken
+	flight flightGroup[cachedToken]
+}
+
+// HTTPTokenProviderOption configures an HTTPTokenProvider.
+type HTTPTokenProviderOption func(*HTTPTokenProvider)
+
+// WithEndpointBearer authenticates requests to the token endpoint with the
+// bearer token returned by fn, e.g. the session of the current user.
+func WithEndpointBearer(fn func() (string, error)) HTTPTokenProviderOption {
+	return func(p *HTTPTokenProvider) {
+		p.bearer = fn
+	}
+}
+
+// WithEndpointHTTPClient sets the HTTP client used to call the token endpoint.
+// The timeout of WithEndpointTimeout still applies to each call.
+func WithEndpointHTTPClient(httpClient *http.Client) HTTPTokenProviderOption {
+	return func(p *HTTPTokenProvider) {
+		p.httpClient = httpClient
+	}
+}
+
+// WithEndpointRefreshMargin sets how long before its expiry a cached token is
+// replaced. Defaults to 30 seconds.
+func WithEndpointRefreshMargin(margin time.Duration) HTTPTokenProviderOption {
+	return func(p *HTTPTokenProvider) {
+		p.refreshMargin = margin
+	}
+}
+
+// WithEndpointTimeout sets how long a call to the token endpoint may take,
+// from sending the request to reading the response, before it fails with a
+// TokenEndpointError. Since GetToken has no context, this bounds how long a
+// hung endpoint holds up the requests waiting for a token. Zero or less waits
+// as long as the HTTP client does. Defaults to 10 seconds.
+func WithEndpointTimeout(timeout time.Duration) HTTPTokenProviderOption {
+	return func(p *HTTPTokenProvider) {
+		p.timeout = timeout
+	}
+}
+
+// WithEndpointClock sets the clock the provider reads the time from to decide
+// when a cached token expires. Defaults to time.Now.
+func WithEndpointClock(now func() time.Time) HTTPTokenProviderOption {
+	return func(p *HTTPTokenProvider) {
+		p.clock = now
+	}
+}
+
+// NewHTTPTokenProvider creates a new HTTPTokenProvider for the token endpoint
+// at url. Each call to the endpoint times out after 10 seconds unless
+// WithEndpointTimeout says otherwise.
+func NewHTTPTokenProvider(url string, opts ...HTTPTokenProviderOption) *HTTPTokenProvider {
+	p := &HTTPTokenProvider{
+		url:           url,
+		httpClient:    &http.Client{},
+		refreshMargin: defaultTokenRefreshMargin,
+		timeout:       defaultTokenEndpointTimeout,
+		cache:         map[string]cachedToken{},
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+type cachedToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+type tokenEndpointRequest struct {
+	Operation string `json:"operation"`
+	Pathname  string `json:"pathname"`
+}
+
+type tokenEndpointResponse struct {
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+// GetToken returns a cached token for the operation and pathname, or fetches
+// a new one from the endpoint.
+func (p *HTTPTokenProvider) GetToken(operation string, pathname string) (string, error) {
+	key := operation + "\x00" + pathname
+
+	p.mu.Lock()
+	cached, ok := p.cache[key]
+	p.mu.Unlock()
+	if ok && p.now().Add(p.refreshMargin).Before(cached.expiresAt) {
+		return cached.token, nil
+	}
+
+	fetched, err := p.flight.do(key, func() (cachedToken, error) {
+		return p.fetch(operation, pathname)
+	})
+	if err != nil {
+		return "", err
+	}
+	if !fetched.expiresAt.IsZero() {
+		p.mu.Lock()
+		p.cache[key] = fetched
+		p.mu.Unlock()
+	}
+	return fetched.token, nil
+}
+
+// now returns the time of the clock of the provider.
+func (p *HTTPTokenProvider) now() time.Time {
+	if p.clock != nil {
+		return p.clock()
+	}
+	return time.Now()
+}
+
+// Invalidate removes the cached token for the operation and pathname, so the
+// next GetToken fetches a new one from the endpoint.
+func (p *HTTPTokenProvider) Invalidate(operation, pathname string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.cache, operation+"\x00"+pathname)
+}
+
+func (p *HTTPTokenProvider) fetch(operation, pathname string) (cachedToken, error) {
+	ctx := context.Background()
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+	body, _ := json.Marshal(tokenEndpointRequest{Operation: operation, Pathname: pathname})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return cachedToken{}, &TokenEndpointError{URL: p.url, Err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.bearer != nil {
+		bearer, err := p.bearer()
+		if err != nil {
+			return cachedToken{}, &TokenEndpointError{URL: p.url, Err: err}
+		}
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return cachedToken{}, &TokenEndpointError{URL: p.url, Err: err}
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return cachedToken{}, &TokenEndpointError{URL: p.url, StatusCode: resp.StatusCode}
+	}
+
+	var result tokenEndpointResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return cachedToken{}, &TokenEndpointError{URL: p.url, StatusCode: resp.StatusCode, Err: err}
+	}
+	if result.Token == "" {
+		return cachedToken{}, &TokenEndpointError{URL: p.url, StatusCode: resp.StatusCode, Err: ErrNotAuthenticated}
+	}
+	fetched := cachedToken{token: result.Token}
+	if result.ExpiresAt > 0 {
+		fetched.expiresAt = time.UnixMilli(result.ExpiresAt)
+	}
+	return fetched, nil
+}
+
+// TokenEndpointError is returned by HTTPTokenProvider when a token could not
+// be obtained from the endpoint.
+//
+// StatusCode is zero for network failures, in which case Err is the transport
+// error. A 401 or 403 from the endpoint matches ErrForbidden with errors.Is.
+type TokenEndpointError struct {
+	URL        string
+	StatusCode int
+	Err        error
+}
+
+func (e *TokenEndpointError) Error() string {
+	// Credentials in the endpoint URL are masked.
+	endpoint := e.URL
+	if u, err := url.Parse(e.URL); err == nil {
+		endpoint = u.Redacted()
+	}
+	switch {
+	case e.StatusCode == 0:
+		return fmt.Sprintf("token endpoint %s: %v", endpoint, e.Err)
+	case e.Err != nil:
+		return fmt.Sprintf("token endpoint %s (%d): %v", endpoint, e.StatusCode, e.Err)
+	default:
+		return fmt.Sprintf("token endpoint %s: %d %s", endpoint, e.StatusCode, http.StatusText(e.StatusCode))
+	}
+}
+
+// Unwrap returns the underlying error, or ErrForbidden for a 401 or 403.
+func (e *TokenEndpointError) Unwrap() error {
+	if e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden {
+		return ErrForbidden
+	}
+	return e.Err
+}
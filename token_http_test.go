@@ -0,0 +1,145 @@
+package vercelblob
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_HTTPTokenProvider(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		if r.Header.Get("Authorization") != "Bearer session" {
+			t.Errorf("Expected Bearer session, got %s", r.Header.Get("Authorization"))
+		}
+		var req tokenEndpointRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		time.Sleep(10 * time.Millisecond)
+		_ = json.NewEncoder(w).Encode(tokenEndpointResponse{
+			Token:     fmt.Sprintf("%s:%s:%d", req.Operation, req.Pathname, n),
+			ExpiresAt: time.Now().Add(time.Hour).UnixMilli(),
+		})
+	}))
+	defer server.Close()
+
+	provider := NewHTTPTokenProvider(server.URL, WithEndpointBearer(func() (string, error) { return "session", nil }))
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 10)
+	for i := range tokens {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tokens[i], _ = provider.GetToken("put", "a.txt")
+		}()
+	}
+	wg.Wait()
+	for _, token := range tokens {
+		if token != "put:a.txt:1" {
+			t.Errorf("Expected a single shared token, got %v", tokens)
+			break
+		}
+	}
+
+	if token, _ := provider.GetToken("put", "a.txt"); token != "put:a.txt:1" {
+		t.Errorf("Expected the cached token, got %s", token)
+	}
+	if token, _ := provider.GetToken("list", ""); token != "list::2" {
+		t.Errorf("Expected a new token for another operation, got %s", token)
+	}
+	if calls != 2 {
+		t.Errorf("Expected 2 endpoint calls, got %d", calls)
+	}
+
+	ChainTokenProvider(provider).Invalidate("put", "a.txt")
+	if token, _ := provider.GetToken("put", "a.txt"); token != "put:a.txt:3" {
+		t.Errorf("Expected a new token after invalidation, got %s", token)
+	}
+}
+
+func Test_HTTPTokenProvider_Refresh(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		_ = json.NewEncoder(w).Encode(tokenEndpointResponse{
+			Token:     fmt.Sprintf("token-%d", n),
+			ExpiresAt: time.Now().Add(10 * time.Second).UnixMilli(),
+		})
+	}))
+	defer server.Close()
+
+	provider := NewHTTPTokenProvider(server.URL)
+	first, _ := provider.GetToken("put", "a.txt")
+	second, _ := provider.GetToken("put", "a.txt")
+	if first == second {
+		t.Errorf("Expected a token within the refresh margin to be replaced")
+	}
+
+	// The expiry is judged by the clock of the provider.
+	clock := newFakeClock(time.Now().Add(-time.Minute))
+	provider = NewHTTPTokenProvider(server.URL, WithEndpointClock(clock.Now))
+	first, _ = provider.GetToken("put", "a.txt")
+	if second, _ := provider.GetToken("put", "a.txt"); second != first {
+		t.Errorf("Expected the token to be cached a minute before it expires, got %s then %s", first, second)
+	}
+}
+
+func Test_HTTPTokenProvider_Errors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	_, err := NewHTTPTokenProvider(server.URL).GetToken("put", "a.txt")
+	var endpointErr *TokenEndpointError
+	if !errors.As(err, &endpointErr) || endpointErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected a 401 TokenEndpointError, got %v", err)
+	}
+	if !errors.Is(err, ErrForbidden) {
+		t.Errorf("Expected a 401 to match ErrForbidden")
+	}
+
+	server.Close()
+	_, err = NewHTTPTokenProvider(server.URL).GetToken("put", "a.txt")
+	var urlErr *url.Error
+	if !errors.As(err, &endpointErr) || endpointErr.StatusCode != 0 || !errors.As(err, &urlErr) {
+		t.Fatalf("Expected a network TokenEndpointError, got %v", err)
+	}
+	if errors.Is(err, ErrForbidden) {
+		t.Errorf("Expected a network failure not to match ErrForbidden")
+	}
+}
+
+func Test_HTTPTokenProvider_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	if p := NewHTTPTokenProvider(server.URL); p.timeout != defaultTokenEndpointTimeout {
+		t.Errorf("Expected a default timeout of %v, got %v", defaultTokenEndpointTimeout, p.timeout)
+	}
+
+	// The timeout applies to a client of the caller without one.
+	provider := NewHTTPTokenProvider(server.URL, WithEndpointHTTPClient(&http.Client{}), WithEndpointTimeout(20*time.Millisecond))
+	start := time.Now()
+	_, err := provider.GetToken("put", "a.txt")
+	var endpointErr *TokenEndpointError
+	if !errors.As(err, &endpointErr) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the call to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the call to end after the timeout, took %v", elapsed)
+	}
+}
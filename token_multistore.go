@@ -0,0 +1,142 @@
+package vercelblob
+
+import (
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// blobHostSuffix is the domain under which blob URLs are served, as
+// <storeId>.public.blob.vercel-storage.com.
+const blobHostSuffix = ".blob.vercel-storage.com"
+
+// StoreTokenProvider is implemented by token providers that serve several
+// blob stores. Clients returned by Client.ForStore call GetStoreToken instead
+// of GetToken so the provider knows which store is addressed.
+type StoreTokenProvider interface {
+	TokenProvider
+	GetStoreToken(storeID, operation, pathname string) (string, error)
+}
+
+// MultiStoreTokenProvider is a TokenProvider for processes that talk to
+// several blob stores, each with its own token. Create it with
+// NewMultiStoreTokenProvider.
+//
+// The store of an operation is resolved, in order, from the host of a blob
+// URL (for Download, Delete and Head of a URL), the store of a client returned
+// by Client.ForStore, the longest matching prefix registered with
+// RoutePrefix, and finally DefaultStore. Store IDs are compared
+// case-insensitively, as blob URLs carry them in lowercase.
+//
+// A MultiStoreTokenProvider must not be modified once it is in use.
+type MultiStoreTokenProvider struct {
+	stores   map[string]storeTokenSource
+	prefixes []storePrefix
+
+	// DefaultStore is the store used for pathnames that match no prefix.
+	DefaultStore string
+}
+
+// storeTokenSource is either a literal token or the environment variable
+// holding it.
+type storeTokenSource struct {
+	token  string
+	envVar string
+}
+
+type storePrefix struct {
+	prefix  string
+	storeID string
+}
+
+// NewMultiStoreTokenProvider returns a provider with no stores configured.
+//
+//	provider := NewMultiStoreTokenProvider().
+//		SetStoreEnv("assets", "BLOB_READ_WRITE_TOKEN_ASSETS").
+//		SetStoreEnv("logs", "BLOB_READ_WRITE_TOKEN_LOGS").
+//		RoutePrefix("logs/", "logs")
+func NewMultiStoreTokenProvider() *MultiStoreTokenProvider {
+	return &MultiStoreTokenProvider{stores: map[string]storeTokenSource{}}
+}
+
+// SetStoreToken configures the token of a store.
+func (p *MultiStoreTokenProvider) SetStoreToken(storeID, token string) *MultiStoreTokenProvider {
+	p.stores[strings.ToLower(storeID)] = storeTokenSource{token: token}
+	return p
+}
+
+// SetStoreEnv configures the environment variable holding the token of a
+// store. The variable is read on every request.
+func (p *MultiStoreTokenProvider) SetStoreEnv(storeID, envVar string) *MultiStoreTokenProvider {
+	p.stores[strings.ToLower(storeID)] = storeTokenSource{envVar: envVar}
+	return p
+}
+
+// RoutePrefix sends operations on pathnames starting with prefix to the given
+// store. When several prefixes match, the longest one wins.
+func (p *MultiStoreTokenProvider) RoutePrefix(prefix, storeID string) *MultiStoreTokenProvider {
+	p.prefixes = append(p.prefixes, storePrefix{prefix: prefix, storeID: storeID})
+	sort.SliceStable(p.prefixes, func(i, j int) bool {
+		return len(p.prefixes[i].prefix) > len(p.prefixes[j].prefix)
+	})
+	return p
+}
+
+// GetToken returns the token of the store the pathname belongs to.
+func (p *MultiStoreTokenProvider) GetToken(operation string, pathname string) (string, error) {
+	return p.GetStoreToken("", operation, pathname)
+}
+
+// GetStoreToken returns the token of storeID. The store of a blob URL takes
+// precedence over storeID; an empty storeID falls back to the prefix routes
+// and DefaultStore.
+func (p *MultiStoreTokenProvider) GetStoreToken(storeID, _, pathname string) (string, error) {
+	if fromURL := storeIDFromURL(pathname); fromURL != "" {
+		storeID = fromURL
+	}
+	if storeID == "" {
+		storeID = p.routeStore(pathname)
+	}
+	if storeID == "" {
+		return "", &StoreTokenError{Pathname: pathname}
+	}
+
+	source, ok := p.stores[strings.ToLower(storeID)]
+	if !ok {
+		return "", &StoreTokenError{StoreID: storeID, Pathname: pathname}
+	}
+	if source.envVar == "" {
+		return source.token, nil
+	}
+	token := os.Getenv(source.envVar)
+	if token == "" {
+		return "", &StoreTokenError{StoreID: storeID, Pathname: pathname, EnvVar: source.envVar}
+	}
+	return token, nil
+}
+
+func (p *MultiStoreTokenProvider) routeStore(pathname string) string {
+	pathname = strings.TrimPrefix(pathname, "/")
+	for _, route := range p.prefixes {
+		if strings.HasPrefix(pathname, strings.TrimPrefix(route.prefix, "/")) {
+			return route.storeID
+		}
+	}
+	return p.DefaultStore
+}
+
+// storeIDFromURL returns the store ID of a blob URL, or "" if urlOrPathname
+// is not a blob URL.
+func storeIDFromURL(urlOrPathname string) string {
+	u, err := url.Parse(urlOrPathname)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	host, ok := strings.CutSuffix(u.Hostname(), blobHostSuffix)
+	if !ok {
+		return ""
+	}
+	storeID, _, _ := strings.Cut(host, ".")
+	return storeID
+}
@@ -0,0 +1,96 @@
+package vercelblob
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_MultiStoreTokenProvider(t *testing.T) {
+	t.Setenv("BLOB_READ_WRITE_TOKEN_ASSETS", "assets-token")
+	t.Setenv("BLOB_READ_WRITE_TOKEN_LOGS", "")
+
+	provider := NewMultiStoreTokenProvider().
+		SetStoreEnv("AssetsStore", "BLOB_READ_WRITE_TOKEN_ASSETS").
+		SetStoreEnv("logs", "BLOB_READ_WRITE_TOKEN_LOGS").
+		SetStoreToken("archive", "archive-token").
+		RoutePrefix("archive/", "archive").
+		RoutePrefix("archive/logs/", "logs")
+
+	tests := []struct {
+		name      string
+		storeID   string
+		pathname  string
+		wantToken string
+		wantErr   string
+	}{
+		{name: "url", pathname: "https://assetsstore.public.blob.vercel-storage.com/a.txt", wantToken: "assets-token"},
+		{name: "url wins over store", storeID: "archive", pathname: "https://assetsstore.public.blob.vercel-storage.com/a.txt", wantToken: "assets-token"},
+		{name: "explicit store", storeID: "archive", pathname: "a.txt", wantToken: "archive-token"},
+		{name: "prefix", pathname: "/archive/a.txt", wantToken: "archive-token"},
+		{name: "longest prefix", pathname: "archive/logs/a.txt", wantErr: `environment variable BLOB_READ_WRITE_TOKEN_LOGS is not set`},
+		{name: "unknown store", pathname: "https://other.public.blob.vercel-storage.com/a.txt", wantErr: `no token configured for blob store "other"`},
+		{name: "no route", pathname: "a.txt", wantErr: `no blob store configured for "a.txt"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := provider.GetStoreToken(tt.storeID, "put", tt.pathname)
+			if tt.wantErr != "" {
+				var storeErr *StoreTokenError
+				if !errors.As(err, &storeErr) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				if !errors.Is(err, ErrNotAuthenticated) {
+					t.Errorf("Expected error to match ErrNotAuthenticated, got %v", err)
+				}
+				return
+			}
+			if err != nil || token != tt.wantToken {
+				t.Errorf("Expected %s, got %s, %v", tt.wantToken, token, err)
+			}
+		})
+	}
+
+	provider.DefaultStore = "archive"
+	if token, err := provider.GetToken("put", "a.txt"); err != nil || token != "archive-token" {
+		t.Errorf("Expected default store token, got %s, %v", token, err)
+	}
+}
+
+func Test_Client_ForStore_Mock(t *testing.T) {
+	var auth []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = append(auth, r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.txt","pathname":"a.txt"}`))
+	}))
+	defer server.Close()
+
+	provider := NewMultiStoreTokenProvider().
+		SetStoreToken("assets", "assets-token").
+		SetStoreToken("logs", "logs-token")
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(provider))
+	ctx := context.Background()
+
+	if _, err := client.ForStore("assets").Put(ctx, "a.txt", strings.NewReader("a"), PutCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ForStore("logs").Put(ctx, "a.txt", strings.NewReader("a"), PutCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Bearer assets-token", "Bearer logs-token"}
+	if strings.Join(auth, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected %v, got %v", want, auth)
+	}
+
+	_, err := client.ForStore("media").Put(ctx, "a.txt", strings.NewReader("a"), PutCommandOptions{})
+	if err == nil || !strings.Contains(err.Error(), `blob store "media"`) {
+		t.Errorf("Expected error naming the media store, got %v", err)
+	}
+	_, err = client.Put(ctx, "a.txt", strings.NewReader("a"), PutCommandOptions{})
+	if !errors.Is(err, ErrNotAuthenticated) {
+		t.Errorf("Expected ErrNotAuthenticated without a store, got %v", err)
+	}
+}
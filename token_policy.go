@@ -0,0 +1,80 @@
+package vercelblob
+
+import (
+	"path"
+	"slices"
+	"strings"
+)
+
+// PolicyRule grants the token of Provider to the operations and pathnames it
+// matches. See PolicyTokenProvider.
+type PolicyRule struct {
+	// The operations the rule allows. Empty allows every operation.
+	Operations []Operation
+	// The pathname prefix the rule allows, e.g. "uploads/user123/". Empty
+	// allows every pathname unless Pattern is set.
+	Prefix string
+	// A pattern in path.Match syntax the whole pathname must match, e.g.
+	// "public/*.png". It is checked in addition to Prefix.
+	Pattern string
+	// The source of the token for requests that match the rule.
+	Provider TokenProvider
+}
+
+// matches reports whether the rule allows operation on pathname.
+func (r PolicyRule) matches(operation Operation, pathname string) bool {
+	if len(r.Operations) > 0 && !slices.Contains(r.Operations, operation) {
+		return false
+	}
+	if !strings.HasPrefix(pathname, strings.TrimPrefix(r.Prefix, "/")) {
+		return false
+	}
+	if r.Pattern != "" {
+		matched, err := path.Match(strings.TrimPrefix(r.Pattern, "/"), pathname)
+		return err == nil && matched
+	}
+	return true
+}
+
+// PolicyTokenProvider is a TokenProvider that only hands out tokens for the
+// operations and pathnames allowed by its rules, for example list and download
+// under "public/" but put and delete only under "uploads/<userID>/".
+//
+// Rules are evaluated in order and the first match provides the token. A
+// request that matches no rule is denied with a PolicyDeniedError before any
+// token is obtained. Blob URLs are matched by their pathname; list operations
+// are matched by their prefix.
+type PolicyTokenProvider struct {
+	rules []PolicyRule
+}
+
+// NewPolicyTokenProvider returns a provider that enforces rules.
+//
+//	provider := NewPolicyTokenProvider(
+//		PolicyRule{Operations: []Operation{OperationList, OperationDownload}, Prefix: "public/", Provider: readToken},
+//		PolicyRule{Operations: []Operation{OperationPut, OperationDelete}, Prefix: "uploads/" + userID + "/", Provider: writeToken},
+//	)
+func NewPolicyTokenProvider(rules ...PolicyRule) *PolicyTokenProvider {
+	return &PolicyTokenProvider{rules: rules}
+}
+
+// Evaluate returns the index of the first rule that allows operation on
+// pathname, without obtaining a token. It is meant for testing policies.
+func (p *PolicyTokenProvider) Evaluate(operation, pathname string) (int, error) {
+	name := strings.TrimPrefix(pathnameFromURL(pathname), "/")
+	for i, rule := range p.rules {
+		if rule.matches(Operation(operation), name) {
+			return i, nil
+		}
+	}
+	return -1, &PolicyDeniedError{Operation: Operation(operation), Pathname: pathname}
+}
+
+// GetToken returns the token of the first rule that allows operation on pathname.
+func (p *PolicyTokenProvider) GetToken(operation string, pathname string) (string, error) {
+	i, err := p.Evaluate(operation, pathname)
+	if err != nil {
+		return "", err
+	}
+	return p.rules[i].Provider.GetToken(operation, pathname)
+}
@@ -0,0 +1,75 @@
+package vercelblob
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_PolicyTokenProvider(t *testing.T) {
+	provider := NewPolicyTokenProvider(
+		PolicyRule{Operations: []Operation{OperationList, OperationDownload}, Prefix: "public/", Provider: StaticTokenProvider("read")},
+		PolicyRule{Operations: []Operation{OperationPut, OperationDelete}, Prefix: "uploads/user1/", Provider: StaticTokenProvider("write")},
+		PolicyRule{Operations: []Operation{OperationHead}, Pattern: "public/*.png", Provider: StaticTokenProvider("head")},
+	)
+
+	tests := []struct {
+		operation Operation
+		pathname  string
+		wantRule  int
+		wantToken string
+	}{
+		{OperationList, "public/", 0, "read"},
+		{OperationDownload, "https://store.public.blob.vercel-storage.com/public/a.txt", 0, "read"},
+		{OperationPut, "uploads/user1/a.txt", 1, "write"},
+		{OperationDelete, "/uploads/user1/a.txt", 1, "write"},
+		{OperationHead, "public/a.png", 2, "head"},
+		{OperationPut, "public/a.txt", -1, ""},
+		{OperationPut, "uploads/user2/a.txt", -1, ""},
+		{OperationList, "", -1, ""},
+		{OperationHead, "public/nested/a.png", -1, ""},
+	}
+	for _, tt := range tests {
+		rule, _ := provider.Evaluate(string(tt.operation), tt.pathname)
+		if rule != tt.wantRule {
+			t.Errorf("%s %s: expected rule %d, got %d", tt.operation, tt.pathname, tt.wantRule, rule)
+		}
+		token, err := provider.GetToken(string(tt.operation), tt.pathname)
+		if tt.wantRule < 0 {
+			var denied *PolicyDeniedError
+			if !errors.As(err, &denied) || !errors.Is(err, ErrForbidden) {
+				t.Errorf("%s %s: expected a PolicyDeniedError, got %v", tt.operation, tt.pathname, err)
+			}
+			continue
+		}
+		if err != nil || token != tt.wantToken {
+			t.Errorf("%s %s: expected %s, got %s, %v", tt.operation, tt.pathname, tt.wantToken, token, err)
+		}
+	}
+}
+
+func Test_PolicyTokenProvider_DeniesBeforeRequest_Mock(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte(`{"blobs":[]}`))
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(NewPolicyTokenProvider(
+		PolicyRule{Operations: []Operation{OperationList}, Prefix: "public/", Provider: StaticTokenProvider("read")},
+	)))
+	ctx := context.Background()
+
+	if _, err := client.List(ctx, ListCommandOptions{Prefix: "public/"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.List(ctx, ListCommandOptions{Prefix: "private/"}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Expected ErrForbidden, got %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("Expected 1 request, got %d", requests)
+	}
+}
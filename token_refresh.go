@@ -0,0 +1,149 @@
+package vercelblob
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+)
+
+// defaultTokenRefreshCooldown is the minimum time between two retries of a
+// client after the API rejected its token.
+const defaultTokenRefreshCooldown = 10 * time.Second
+
+// Invalidator is implemented by token providers that cache tokens. When the
+// API rejects a token with 401 or 403, the client calls Invalidate before
+// asking the provider for a fresh token.
+type Invalidator interface {
+	Invalidate(operation, pathname string)
+}
+
+// tokenRefreshGuard limits how often a client retries requests with a fresh
+// token, so that a revoked token does not double the number of requests.
+type tokenRefreshGuard struct {
+	cooldown time.Duration
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+func newTokenRefreshGuard(cooldown time.Duration) *tokenRefreshGuard {
+	return &tokenRefreshGuard{cooldown: cooldown}
+}
+
+// allow reports whether a retry may happen at now, and if so starts the
+// cooldown.
+func (g *tokenRefreshGuard) allow(now time.Time) bool {
+	if g == nil {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.last.IsZero() && now.Sub(g.last) < g.cooldown {
+		return false
+	}
+	g.last = now
+	return true
+}
+
+// do sends req, which was authorized for operation on pathname.
+//
+// If the API answers 401 or 403, the cached token is invalidated and the
+// request is sent once more with a fresh token from the provider. The
+// request is not retried if its body cannot be resent, if the provider
+// returns the same token again, or within the cooldown of a previous retry;
+// the rejected response is returned then. Transient failures are retried
+// according to the retry policy of the client; see WithRetry.
+func (c *Client) do(req *http.Request, operation Operation, pathname string) (*http.Response, error) {
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	for name, values := range c.defaultHeaders {
+		if _, ok := req.Header[name]; !ok {
+			req.Header[name] = slices.Clone(values)
+		}
+	}
+	c.setIdempotencyKey(req, operation)
+	c.injectHeaders(req)
+	end, err := c.beginRequest(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	if c.dryRun && isWrite(operation) {
+		end()
+		return c.skipDryRun(req, operation, pathname), nil
+	}
+	req = withRequestInfo(req, operation, pathname)
+	req, slow := c.watchSlowRequest(req, operation, pathname)
+	req, cancel := c.withOperationTimeout(req, operation)
+	release := sync.OnceFunc(func() {
+		cancel()
+		end()
+	})
+	resp, err := c.sendWithRetries(req, operation, pathname)
+	if err != nil {
+		release()
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = newTransportError(err, operation, pathname)
+		}
+		slow.finish(nil, err)
+		return nil, err
+	}
+	resp.Body = cancelOnClose{resp.Body, func() {
+		release()
+		slow.finish(resp, nil)
+	}}
+	return resp, nil
+}
+
+type authSourceKey struct{}
+
+// contextWithAuthSource returns a copy of ctx whose requests are authorized
+// by authorize, e.g. with a token renewed during an upload, rather than by
+// the token provider of the client.
+func contextWithAuthSource(ctx context.Context, authorize func(req *http.Request, operation Operation) error) context.Context {
+	return context.WithValue(ctx, authSourceKey{}, authorize)
+}
+
+// reauthorize sets the Authorization header of req again, from the source
+// that authorized the original request.
+func (c *Client) reauthorize(req *http.Request, operation Operation, pathname string) error {
+	if authorize, ok := req.Context().Value(authSourceKey{}).(func(*http.Request, Operation) error); ok {
+		return authorize(req, operation)
+	}
+	return c.addAuthorizationHeader(req, operation, pathname)
+}
+
+// send sends req, retrying once with a fresh token as described by do.
+func (c *Client) send(req *http.Request, operation Operation, pathname string) (*http.Response, error) {
+	resp, err := c.roundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden {
+		return resp, err
+	}
+	if req.Body != nil && req.GetBody == nil || !c.tokenRefresh.allow(c.now()) {
+		return resp, nil
+	}
+
+	if invalidator, ok := c.tokenProvider.(Invalidator); ok {
+		invalidator.Invalidate(string(operation), pathname)
+	}
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retry.Body = body
+	}
+	if err := c.reauthorize(retry, operation, pathname); err != nil ||
+		retry.Header.Get("Authorization") == req.Header.Get("Authorization") {
+		return resp, nil
+	}
+
+	_ = resp.Body.Close()
+	return c.roundTrip(retry)
+}
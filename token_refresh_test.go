@@ -0,0 +1,135 @@
+package vercelblob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// expiringTokenProvider serves "expired" until it is invalidated, then "fresh".
+type expiringTokenProvider struct {
+	mu          sync.Mutex
+	invalidated int
+	calls       int
+}
+
+func (p *expiringTokenProvider) GetToken(_, _ string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	if p.invalidated == 0 {
+		return "expired", nil
+	}
+	return "fresh", nil
+}
+
+func (p *expiringTokenProvider) Invalidate(_, _ string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.invalidated++
+}
+
+// newTokenCheckingServer rejects every request not authorized with the
+// "fresh" token and records the bodies of the requests it receives.
+func newTokenCheckingServer(t *testing.T, bodies *[]string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		*bodies = append(*bodies, string(body))
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"error":{"code":"forbidden","message":"token expired"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.txt","pathname":"a.txt"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func Test_TokenRefresh_RetriesOnce_Mock(t *testing.T) {
+	var bodies []string
+	server := newTokenCheckingServer(t, &bodies)
+	provider := &expiringTokenProvider{}
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(provider))
+
+	result, err := client.Put(context.Background(), "a.txt", strings.NewReader("hello"), PutCommandOptions{})
+	if err != nil {
+		t.Fatalf("Expected the retry to succeed, got %v", err)
+	}
+	if result.Pathname != "a.txt" {
+		t.Errorf("Expected a.txt, got %s", result.Pathname)
+	}
+	if provider.invalidated != 1 {
+		t.Errorf("Expected 1 invalidation, got %d", provider.invalidated)
+	}
+	if len(bodies) != 2 || bodies[1] != "hello" {
+		t.Errorf("Expected the body to be resent, got %q", bodies)
+	}
+}
+
+func Test_TokenRefresh_NoRetry_Mock(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider TokenProvider
+		body     io.Reader
+		cooldown bool
+	}{
+		// A reader without GetBody support cannot be resent.
+		{name: "body not resendable", provider: &expiringTokenProvider{}, body: io.MultiReader(strings.NewReader("hello"))},
+		{name: "same token", provider: StaticTokenProvider("expired"), body: strings.NewReader("hello")},
+		{name: "cooldown", provider: &expiringTokenProvider{}, body: strings.NewReader("hello"), cooldown: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var bodies []string
+			server := newTokenCheckingServer(t, &bodies)
+			client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(tt.provider))
+			if tt.cooldown {
+				client.tokenRefresh = newTokenRefreshGuard(time.Hour)
+				client.tokenRefresh.allow(time.Now())
+			}
+
+			_, err := client.Put(context.Background(), "a.txt", tt.body, PutCommandOptions{})
+			if !errors.Is(err, ErrForbidden) {
+				t.Errorf("Expected ErrForbidden, got %v", err)
+			}
+			if len(bodies) != 1 {
+				t.Errorf("Expected 1 request, got %d", len(bodies))
+			}
+		})
+	}
+}
+
+// rotatingTokenProvider serves a new token on every call.
+type rotatingTokenProvider struct {
+	calls int
+}
+
+func (p *rotatingTokenProvider) GetToken(_, _ string) (string, error) {
+	p.calls++
+	return "revoked-" + strconv.Itoa(p.calls), nil
+}
+
+func Test_TokenRefresh_Cooldown_Mock(t *testing.T) {
+	var bodies []string
+	server := newTokenCheckingServer(t, &bodies)
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(&rotatingTokenProvider{}))
+
+	// Every token is rejected, so only the first failure may trigger a retry.
+	for range 3 {
+		if _, err := client.Head(context.Background(), "a.txt"); !errors.Is(err, ErrForbidden) {
+			t.Errorf("Expected ErrForbidden, got %v", err)
+		}
+	}
+	if len(bodies) != 4 {
+		t.Errorf("Expected 4 requests, got %d", len(bodies))
+	}
+}
@@ -0,0 +1,95 @@
+package vercelblob
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// defaultUploadBandwidth is the upload speed assumed by TokenRenewal when
+// none is configured, in bytes per second.
+const defaultUploadBandwidth = 1 << 20
+
+// TokenRenewal configures how a client renews a client token that would
+// expire before a multipart upload completes.
+type TokenRenewal struct {
+	// OnTokenExpiring is called with the time left on the current client
+	// token when it would expire before the rest of the upload is sent, and
+	// returns the token to continue with.
+	OnTokenExpiring func(remaining time.Duration) (string, error)
+	// Bandwidth is the expected upload speed in bytes per second, used to
+	// estimate how long the rest of an upload takes. Defaults to 1 MiB/s.
+	Bandwidth int64
+}
+
+// WithTokenRenewal makes the client renew expiring client tokens during
+// multipart uploads. Before the upload starts and between
+// parts, the expiry of the token (see TokenInfo) is compared with the time
+// the remaining bytes are expected to take, and OnTokenExpiring is consulted
+// if the token would not last. Read-write tokens never expire and are not
+// renewed.
+func WithTokenRenewal(renewal TokenRenewal) ClientOption {
+	return func(c *Client) error {
+		if renewal.Bandwidth < 0 {
+			return NewInvalidOptionError("WithTokenRenewal", fmt.Sprintf("bandwidth %d is negative", renewal.Bandwidth))
+		}
+		c.tokenRenewal = renewal
+		return nil
+	}
+}
+
+// uploadAuth authorizes the requests of one upload, keeping the token
+// returned by TokenRenewal.OnTokenExpiring for the rest of the upload.
+type uploadAuth struct {
+	c        *Client
+	pathname string
+	renewed  string
+}
+
+// apply sets the Authorization header of req to the renewed token, if any,
+// or to the token of the client. It is also the source a request rejected
+// with 401 or 403 is authorized again from.
+func (a *uploadAuth) apply(req *http.Request, operation Operation) error {
+	if a.renewed == "" {
+		return a.c.addAuthorizationHeader(req, operation, a.pathname)
+	}
+	req.Header.Set("Authorization", "Bearer "+a.renewed)
+	return nil
+}
+
+// authorize sets the Authorization header of req, renewing the token first
+// if it would expire before remaining bytes are sent.
+func (a *uploadAuth) authorize(req *http.Request, operation Operation, remaining int64) error {
+	if err := a.apply(req, operation); err != nil {
+		return err
+	}
+
+	renewal := a.c.tokenRenewal
+	if renewal.OnTokenExpiring == nil {
+		return nil
+	}
+	expiresAt, _, _, err := TokenInfo(requestToken(req))
+	if err != nil {
+		return nil
+	}
+	bandwidth := renewal.Bandwidth
+	if bandwidth <= 0 {
+		bandwidth = defaultUploadBandwidth
+	}
+	needed := time.Duration(float64(remaining) / float64(bandwidth) * float64(time.Second))
+	left := expiresAt.Sub(a.c.now())
+	if left > needed {
+		return nil
+	}
+
+	token, err := renewal.OnTokenExpiring(left)
+	if err != nil {
+		return fmt.Errorf("renew token for %s %q: %w", operation, a.pathname, err)
+	}
+	if token == "" {
+		return ErrNotAuthenticated
+	}
+	a.renewed = token
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
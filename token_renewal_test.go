@@ -0,0 +1,149 @@
+package vercelblob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_TokenInfo(t *testing.T) {
+	expiresAt := time.UnixMilli(1700000000000)
+	clientToken, _ := GenerateClientToken(testReadWriteToken, ClientTokenOptions{Pathname: "a.txt", ValidUntil: expiresAt.UnixMilli()})
+	legacyToken, _ := GenerateLegacyClientToken(testReadWriteToken, ClientTokenOptions{Pathname: "b.txt", Operation: "put", ExpiresAt: expiresAt.Unix()})
+
+	tests := []struct {
+		name          string
+		token         string
+		wantOperation string
+		wantPathname  string
+		wantErr       error
+	}{
+		{name: "client token", token: clientToken, wantPathname: "a.txt"},
+		{name: "legacy token", token: legacyToken, wantOperation: "put", wantPathname: "b.txt"},
+		{name: "read-write token", token: testReadWriteToken, wantErr: ErrMalformedClientToken},
+		{name: "garbage", token: "garbage", wantErr: ErrMalformedClientToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotExpiresAt, operation, pathname, err := TokenInfo(tt.token)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !gotExpiresAt.Equal(expiresAt) || operation != tt.wantOperation || pathname != tt.wantPathname {
+				t.Errorf("Unexpected info: %v, %q, %q", gotExpiresAt, operation, pathname)
+			}
+		})
+	}
+}
+
+func Test_TokenRenewal_Multipart_Mock(t *testing.T) {
+	clock := newFakeClock(time.Unix(1700000000, 0))
+	clientToken, _ := GenerateClientToken(testReadWriteToken, ClientTokenOptions{
+		Pathname:   "a.bin",
+		ValidUntil: clock.Now().Add(12 * time.Second).UnixMilli(),
+	})
+
+	var auth []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		auth = append(auth, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		if r.Header.Get("X-MPU-Action") == "upload" {
+			// Each part takes eight seconds.
+			clock.Advance(8 * time.Second)
+		}
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.bin","pathname":"a.bin","uploadId":"id","key":"key"}`))
+	}))
+	defer server.Close()
+
+	var remaining []time.Duration
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider(clientToken)), WithClock(clock.Now), WithTokenRenewal(TokenRenewal{
+		OnTokenExpiring: func(left time.Duration) (string, error) {
+			remaining = append(remaining, left)
+			return "renewed", nil
+		},
+		Bandwidth: 1 << 20,
+	}))
+
+	// At 1 MiB/s the 10 MiB body takes ten seconds, which the token lasts
+	// until the first part takes longer than expected.
+	body := bytes.NewReader(make([]byte, 2*MultipartThreshold+1))
+	if _, err := client.Put(context.Background(), "a.bin", body, PutCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{clientToken, clientToken, "renewed", "renewed", "renewed"}
+	if strings.Join(auth, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected tokens %v, got %v", want, auth)
+	}
+	if len(remaining) != 1 || remaining[0] != 4*time.Second {
+		t.Errorf("Expected one renewal with 4s left, got %v", remaining)
+	}
+}
+
+func Test_TokenRenewal_Rejected_Mock(t *testing.T) {
+	clock := newFakeClock(time.Unix(1700000000, 0))
+	clientToken, _ := GenerateClientToken(testReadWriteToken, ClientTokenOptions{ValidUntil: clock.Now().Add(time.Second).UnixMilli()})
+
+	var auth []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		auth = append(auth, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		if r.Header.Get("X-MPU-Action") == "complete" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"error":{"code":"forbidden","message":"denied"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.bin","pathname":"a.bin","uploadId":"id","key":"key"}`))
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider(clientToken)), WithClock(clock.Now), WithTokenRenewal(TokenRenewal{
+		OnTokenExpiring: func(time.Duration) (string, error) { return "renewed", nil },
+	}))
+
+	// The rejected complete request is not sent again with the token of the
+	// provider, which the upload no longer uses.
+	body := bytes.NewReader(make([]byte, MultipartThreshold+1))
+	if _, err := client.Put(context.Background(), "a.bin", body, PutCommandOptions{}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Expected ErrForbidden, got %v", err)
+	}
+	want := []string{"renewed", "renewed", "renewed", "renewed", "renewed"}
+	if strings.Join(auth, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected tokens %v, got %v", want, auth)
+	}
+}
+
+func Test_TokenRenewal_Error_Mock(t *testing.T) {
+	clock := newFakeClock(time.Unix(1700000000, 0))
+	clientToken, _ := GenerateClientToken(testReadWriteToken, ClientTokenOptions{ValidUntil: 1700000001000})
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider(clientToken)), WithClock(clock.Now), WithTokenRenewal(TokenRenewal{
+		OnTokenExpiring: func(time.Duration) (string, error) { return "", errTokenService },
+	}))
+
+	body := bytes.NewReader(make([]byte, MultipartThreshold+1))
+	if _, err := client.Put(context.Background(), "a.bin", body, PutCommandOptions{}); !errors.Is(err, errTokenService) {
+		t.Errorf("Expected the renewal error, got %v", err)
+	}
+	if requests != 0 {
+		t.Errorf("Expected no requests, got %d", requests)
+	}
+}
@@ -0,0 +1,43 @@
+package vercelblob
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// Connection pool settings of DefaultTransport. Every request of a client goes
+// to the same host, so the pool is sized per host rather than overall.
+const (
+	defaultMaxIdleConnsPerHost = 64
+	defaultIdleConnTimeout     = 90 * time.Second
+)
+
+// defaultTransport is shared by the clients that are not given an HTTP client
+// or transport, so that they share one connection pool.
+var defaultTransport = DefaultTransport()
+
+// DefaultTransport returns a new copy of the transport used by clients that
+// are not given an HTTP client or transport. Unlike http.DefaultTransport,
+// which keeps 2 idle connections per host, it keeps enough connections open
+// for the concurrent requests of multipart uploads and HeadMany to reuse
+// them. Start from it to change a setting:
+//
+//	transport := vercelblob.DefaultTransport()
+//	transport.MaxConnsPerHost = 16
+//	client, err := vercelblob.NewClientWithOptions(vercelblob.WithTransport(transport))
+func DefaultTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          defaultMaxIdleConnsPerHost * 2,
+		MaxIdleConnsPerHost:   defaultMaxIdleConnsPerHost,
+		IdleConnTimeout:       defaultIdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
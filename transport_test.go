@@ -0,0 +1,96 @@
+package vercelblob
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// newConnCountingServer starts a server that answers Head requests and counts
+// the connections opened to it. The first hold requests are answered together
+// once they have all arrived, so that each of them uses its own connection.
+func newConnCountingServer(tb testing.TB, hold int) (*httptest.Server, *atomic.Int64) {
+	var conns, arrived atomic.Int64
+	released := make(chan struct{})
+	if hold == 0 {
+		close(released)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n := arrived.Add(1); n == int64(hold) {
+			close(released)
+		}
+		<-released
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/a.txt","pathname":"a.txt"}`))
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	server.Start()
+	tb.Cleanup(server.Close)
+	return server, &conns
+}
+
+// headConcurrently sends n Head requests at once.
+func headConcurrently(tb testing.TB, client *Client, n int) {
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.Head(context.Background(), "a.txt"); err != nil {
+				tb.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func Test_DefaultTransport_Mock(t *testing.T) {
+	server, conns := newConnCountingServer(t, 50)
+
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")))
+	if client.httpClient.Transport != defaultTransport {
+		t.Fatal("Expected the client to use the default transport")
+	}
+	// Use a transport of its own so that other tests do not share the pool.
+	client = newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")), WithTransport(DefaultTransport()))
+
+	headConcurrently(t, client, 50)
+	if opened := conns.Load(); opened != 50 {
+		t.Fatalf("Expected 50 connections, got %d", opened)
+	}
+	headConcurrently(t, client, 50)
+	if reopened := conns.Load() - 50; reopened != 0 {
+		t.Errorf("Expected the second batch to reuse the idle connections, got %d new ones", reopened)
+	}
+
+	if transport := DefaultTransport(); transport == defaultTransport || transport.MaxIdleConnsPerHost != defaultMaxIdleConnsPerHost || !transport.ForceAttemptHTTP2 {
+		t.Errorf("Expected a new tuned transport, got %+v", transport)
+	}
+}
+
+func Benchmark_ConcurrentHeads(b *testing.B) {
+	for _, bm := range []struct {
+		name      string
+		transport http.RoundTripper
+	}{
+		{"DefaultTransport", DefaultTransport()},
+		{"http.DefaultTransport", http.DefaultTransport.(*http.Transport).Clone()},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			server, conns := newConnCountingServer(b, 0)
+			client := newTestClient(b, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider("token")), WithTransport(bm.transport))
+			b.ResetTimer()
+			for range b.N {
+				headConcurrently(b, client, 50)
+			}
+			b.ReportMetric(float64(conns.Load())/float64(b.N), "conns/op")
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package vercelblob
 
 import (
+	"encoding/json"
+	"net/http"
 	"time"
 )
 
@@ -18,6 +20,9 @@ type ListBlobResult struct {
 	Folders []string             `json:"folders,omitempty"`
 	Cursor  string               `json:"cursor"`
 	HasMore bool                 `json:"hasMore"`
+	// RequestID identifies the request to Vercel support, from the
+	// X-Vercel-Id header of the response.
+	RequestID string `json:"-"`
 }
 
 // ListCommandOptions contains options for the list operation.
@@ -36,6 +41,64 @@ type PutCommandOptions struct {
 	ContentType        string
 	// Access for the blob: "public" (default)
 	Access string
+	// Replace an existing blob at the same pathname. Without it, a Put to the
+	// pathname of an existing blob fails with ErrBlobAlreadyExists.
+	AllowOverwrite bool
+}
+
+// CopyCommandOptions contains options for the copy operation.
+type CopyCommandOptions struct {
+	// Add a random suffix to the destination pathname. When the retry policy
+	// of OperationCopy allows retries, the suffix is generated client-side so
+	// that every attempt targets the same pathname.
+	AddRandomSuffix bool
+	// Access for the blob: "public" (default)
+	Access string
+	// Replace an existing blob at the destination pathname. Without it, a copy
+	// to the pathname of an existing blob fails with ErrBlobAlreadyExists.
+	AllowOverwrite bool
+	// Content type for the destination. Nil inherits from the source when
+	// InheritMetadata is set, otherwise the API default applies.
+	ContentTypeOverride *string
+	// Cache-Control max-age in seconds for the destination. Nil inherits from
+	// the source when InheritMetadata is set, otherwise the API default applies.
+	CacheControlOverride *uint64
+	// Read the source metadata with Head and forward it to the destination.
+	// An empty Access then also inherits the access of the source.
+	InheritMetadata bool
+	// Compare the destination against the source with Head after copying, by
+	// ETag when both have one and by size otherwise.
+	Verify bool
+	// Download the source and upload it again when the server-side copy is
+	// rejected with bad_request. The source metadata is preserved.
+	StreamFallback bool
+}
+
+// MetadataUpdate contains the metadata to change with UpdateMetadata. Nil
+// fields keep their current value.
+type MetadataUpdate struct {
+	ContentType        *string
+	CacheControlMaxAge *uint64
+}
+
+// CopyMethod is the mechanism used to copy a blob.
+type CopyMethod string
+
+const (
+	// CopyMethodServer copies the blob on the server with the fromUrl mechanism.
+	CopyMethodServer CopyMethod = "server"
+	// CopyMethodStream downloads the blob and uploads it again.
+	CopyMethodStream CopyMethod = "stream"
+)
+
+// CopyResult is the response from the copy operation.
+type CopyResult struct {
+	PutBlobPutResult
+	// Method is the mechanism that performed the copy.
+	Method CopyMethod `json:"-"`
+	// BytesTransferred is the number of bytes that passed through the client;
+	// zero for server-side copies.
+	BytesTransferred int64 `json:"-"`
 }
 
 // PutBlobPutResult is the response from the put operation.
@@ -44,6 +107,14 @@ type PutBlobPutResult struct {
 	Pathname           string `json:"pathname"`
 	ContentType        string `json:"contentType"`
 	ContentDisposition string `json:"contentDisposition"`
+	// IdempotencyKey is the idempotency key the blob was written with; see
+	// WithIdempotencyHeader.
+	IdempotencyKey string `json:"-"`
+	// RequestID identifies the request to Vercel support, from the
+	// X-Vercel-Id header of the response.
+	RequestID string `json:"-"`
+	// Stats are the timing and traffic of the put or copy.
+	Stats OperationStats `json:"-"`
 }
 
 // HeadBlobResult is the response from the head operation.
@@ -55,6 +126,62 @@ type HeadBlobResult struct {
 	ContentType        string    `json:"contentType"`
 	ContentDisposition string    `json:"contentDisposition"`
 	CacheControl       string    `json:"cacheControl"`
+	// DownloadURL is the URL that serves the blob as an attachment. It is
+	// derived from URL when the API omits it.
+	DownloadURL string `json:"downloadUrl"`
+	// ContentEncoding is only reported by newer API versions.
+	ContentEncoding string `json:"contentEncoding,omitempty"`
+	// ETag identifies the current version of the blob. Pass it as
+	// HeadCommandOptions.IfNoneMatch to check whether the blob has changed.
+	ETag string `json:"-"`
+	// NotModified is set when the blob still matches
+	// HeadCommandOptions.IfNoneMatch. Only ETag, Headers and RequestID are
+	// set then.
+	NotModified bool `json:"-"`
+	// RequestID identifies the request to Vercel support, from the
+	// X-Vercel-Id header of the response. A result served from the head
+	// cache keeps the ID of the request that fetched it.
+	RequestID string `json:"-"`
+	// Headers holds the raw response headers, such as Age, X-Vercel-Cache and
+	// X-Vercel-Id. Future typed fields may duplicate entries of this map.
+	Headers http.Header `json:"-"`
+	// SizeKnown is false when the response omitted size, as opposed to
+	// reporting an empty blob.
+	SizeKnown bool `json:"-"`
+	// UploadedAtKnown is false when the response omitted uploadedAt.
+	UploadedAtKnown bool `json:"-"`
+}
+
+// UnmarshalJSON decodes a head response, recording which of the optional
+// fields were present.
+func (r *HeadBlobResult) UnmarshalJSON(data []byte) error {
+	type plain HeadBlobResult
+	aux := struct {
+		*plain
+		Size       *uint64    `json:"size"`
+		UploadedAt *time.Time `json:"uploadedAt"`
+	}{plain: (*plain)(r)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	r.SizeKnown = aux.Size != nil
+	if r.SizeKnown {
+		r.Size = *aux.Size
+	}
+	r.UploadedAtKnown = aux.UploadedAt != nil
+	if r.UploadedAtKnown {
+		r.UploadedAt = *aux.UploadedAt
+	}
+	return nil
+}
+
+// HeadCommandOptions contains options for the head operation.
+type HeadCommandOptions struct {
+	// Only return the metadata if the current ETag of the blob differs.
+	IfNoneMatch string
+	// Fail with a missing_field error when the response omits url,
+	// pathname, size or uploadedAt instead of leaving them zero.
+	Strict bool
 }
 
 // Range represents a byte range for download operations.
@@ -0,0 +1,104 @@
+package vercelblob
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strings"
+)
+
+// UploadWithClientToken uploads a blob authenticated with a client token from
+// GenerateClientToken or GenerateUploadToken instead of the read-write token,
+// the equivalent of upload() in the browser SDK. It lets programs on end-user
+// machines upload without ever seeing the read-write token of the store.
+//
+// The constraints embedded in the token are checked before anything is sent:
+// the token must not have expired, pathname must match the pathname of the
+// token, the content type must be allowed, and the body must not exceed the
+// maximum size. Violations fail with an error matching ErrUploadNotAllowed or
+// ErrClientTokenExpired. Bodies larger than MultipartThreshold are uploaded in
+// parts, as with Put.
+//
+// The signature of the token cannot be checked without the read-write token;
+// the API rejects tokens that were tampered with.
+func (c *Client) UploadWithClientToken(ctx context.Context, clientToken, pathname string, body io.Reader, options PutCommandOptions) (*PutBlobPutResult, error) {
+	if c.scope != "" {
+		scoped, err := c.scopePathname(pathname)
+		if err != nil {
+			return nil, err
+		}
+		return c.unscoped().UploadWithClientToken(ctx, clientToken, scoped, body, options)
+	}
+	tokenOptions, err := DecodeClientToken(clientToken)
+	if err != nil {
+		return nil, err
+	}
+	if c.now().Add(-clientTokenClockSkew).UnixMilli() > tokenOptions.ValidUntil {
+		return nil, ErrClientTokenExpired
+	}
+	if tokenOptions.Pathname != "" && tokenOptions.Pathname != pathname {
+		return nil, fmt.Errorf("%w: the token is for %q, not %q", ErrUploadNotAllowed, tokenOptions.Pathname, pathname)
+	}
+
+	contentType := options.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(pathname))
+	}
+	if !contentTypeAllowed(contentType, tokenOptions.AllowedContentTypes) {
+		return nil, fmt.Errorf("%w: content type %q is not allowed", ErrUploadNotAllowed, contentType)
+	}
+
+	if limit := tokenOptions.MaximumSizeInBytes; limit > 0 {
+		if size := bodySize(body); size > limit {
+			return nil, fmt.Errorf("%w: %d bytes exceed the maximum of %d", ErrUploadNotAllowed, size, limit)
+		} else if size < 0 {
+			body = &maxSizeReader{r: body, remaining: limit}
+		}
+	}
+
+	clone := *c
+	clone.tokenProvider = StaticTokenProvider(clientToken)
+	clone.storeID = ""
+	return clone.Put(ctx, pathname, body, options)
+}
+
+// contentTypeAllowed reports whether contentType matches one of the allowed
+// patterns, which may end in a wildcard subtype such as "image/*". An empty
+// list allows every content type.
+func contentTypeAllowed(contentType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "application/octet-stream"
+	}
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "*/*" || pattern == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// maxSizeReader fails once more than remaining bytes have been read, for
+// bodies whose size is not known up front.
+type maxSizeReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (m *maxSizeReader) Read(p []byte) (int, error) {
+	n, err := m.r.Read(p)
+	m.remaining -= int64(n)
+	if m.remaining < 0 {
+		return n, fmt.Errorf("%w: the body exceeds the maximum size of the token", ErrUploadNotAllowed)
+	}
+	return n, err
+}
@@ -0,0 +1,163 @@
+package vercelblob
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+)
+
+// Event types exchanged with the browser SDK and the upload-completed webhook.
+const (
+	uploadEventGenerateClientToken = "blob.generate-client-token"
+	uploadEventUploadCompleted     = "blob.upload-completed"
+)
+
+// UploadHandlerConfig configures the handler returned by NewUploadHandler.
+type UploadHandlerConfig struct {
+	// The read-write token used to sign client tokens and verify webhooks.
+	// Defaults to the BLOB_READ_WRITE_TOKEN environment variable.
+	Token string
+	// Called before a client token is generated for pathname. clientPayload
+	// is the opaque value passed by the browser to upload(). Returning an
+	// error rejects the upload. The returned options are used for the token;
+	// the pathname and the upload-completed callback are filled in.
+	OnBeforeGenerateToken func(ctx context.Context, pathname, clientPayload string) (ClientTokenOptions, error)
+	// Called once the upload has completed, with the tokenPayload set by
+	// OnBeforeGenerateToken. Optional.
+	OnUploadCompleted func(ctx context.Context, blob PutBlobPutResult, tokenPayload string) error
+}
+
+// generateClientTokenEvent is sent by the browser SDK to obtain a client token.
+type generateClientTokenEvent struct {
+	Pathname      string `json:"pathname"`
+	CallbackURL   string `json:"callbackUrl"`
+	ClientPayload string `json:"clientPayload"`
+	Multipart     bool   `json:"multipart"`
+}
+
+// uploadCompletedEvent is sent by Vercel once a client upload has completed.
+type uploadCompletedEvent struct {
+	Blob         PutBlobPutResult `json:"blob"`
+	TokenPayload string           `json:"tokenPayload"`
+}
+
+type uploadEvent struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// NewUploadHandler returns an http.Handler for browser-driven client uploads,
+// the equivalent of handleUpload in @vercel/blob. Mount it on the route passed
+// as handleUploadUrl to the browser's upload() helper.
+//
+// The handler answers the browser's request for a client token, and verifies
+// and dispatches the upload-completed webhook that Vercel sends to the same
+// route.
+func NewUploadHandler(cfg UploadHandlerConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeUploadError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		token := cfg.Token
+		if token == "" {
+			token = os.Getenv("BLOB_READ_WRITE_TOKEN")
+		}
+		if token == "" {
+			writeUploadError(w, http.StatusInternalServerError, ErrNotAuthenticated.Msg)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeUploadError(w, http.StatusBadRequest, "could not read request body")
+			return
+		}
+		var event uploadEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			writeUploadError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		switch event.Type {
+		case uploadEventGenerateClientToken:
+			handleGenerateClientToken(w, r, cfg, token, event.Payload)
+		case uploadEventUploadCompleted:
+			if err := VerifyWebhookSignatureBody(token, body, r.Header); err != nil {
+				writeUploadError(w, http.StatusUnauthorized, err.Error())
+				return
+			}
+			handleUploadCompleted(w, r, cfg, event.Payload)
+		default:
+			writeUploadError(w, http.StatusBadRequest, "unknown event type")
+		}
+	})
+}
+
+func handleGenerateClientToken(w http.ResponseWriter, r *http.Request, cfg UploadHandlerConfig, token string, raw json.RawMessage) {
+	var payload generateClientTokenEvent
+	if err := json.Unmarshal(raw, &payload); err != nil || payload.Pathname == "" {
+		writeUploadError(w, http.StatusBadRequest, "invalid generate-client-token payload")
+		return
+	}
+
+	var options ClientTokenOptions
+	if cfg.OnBeforeGenerateToken != nil {
+		var err error
+		options, err = cfg.OnBeforeGenerateToken(r.Context(), payload.Pathname, payload.ClientPayload)
+		if err != nil {
+			writeUploadError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	options.Pathname = payload.Pathname
+	if cfg.OnUploadCompleted != nil && payload.CallbackURL != "" {
+		tokenPayload := ""
+		if options.OnUploadCompleted != nil {
+			tokenPayload = options.OnUploadCompleted.TokenPayload
+		}
+		options.OnUploadCompleted = &OnUploadCompleted{CallbackURL: payload.CallbackURL, TokenPayload: tokenPayload}
+	}
+
+	clientToken, err := GenerateClientToken(token, options)
+	if err != nil {
+		writeUploadError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeUploadJSON(w, map[string]string{
+		"type":        uploadEventGenerateClientToken,
+		"clientToken": clientToken,
+	})
+}
+
+func handleUploadCompleted(w http.ResponseWriter, r *http.Request, cfg UploadHandlerConfig, raw json.RawMessage) {
+	var payload uploadCompletedEvent
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		writeUploadError(w, http.StatusBadRequest, "invalid upload-completed payload")
+		return
+	}
+	if cfg.OnUploadCompleted != nil {
+		if err := cfg.OnUploadCompleted(r.Context(), payload.Blob, payload.TokenPayload); err != nil {
+			writeUploadError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	writeUploadJSON(w, map[string]string{
+		"type":     uploadEventUploadCompleted,
+		"response": "ok",
+	})
+}
+
+func writeUploadJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeUploadError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
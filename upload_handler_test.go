@@ -0,0 +1,97 @@
+package vercelblob
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_UploadHandler(t *testing.T) {
+	var completed PutBlobPutResult
+	var completedPayload string
+	handler := NewUploadHandler(UploadHandlerConfig{
+		Token: testReadWriteToken,
+		OnBeforeGenerateToken: func(_ context.Context, pathname, clientPayload string) (ClientTokenOptions, error) {
+			if pathname == "forbidden.txt" {
+				return ClientTokenOptions{}, errors.New("not allowed")
+			}
+			return ClientTokenOptions{
+				AllowedContentTypes: []string{"image/png"},
+				OnUploadCompleted:   &OnUploadCompleted{TokenPayload: "user-" + clientPayload},
+			}, nil
+		},
+		OnUploadCompleted: func(_ context.Context, blob PutBlobPutResult, tokenPayload string) error {
+			completed = blob
+			completedPayload = tokenPayload
+			return nil
+		},
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	post := func(body []byte, signature string) (*http.Response, map[string]string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, server.URL, bytes.NewReader(body))
+		if signature != "" {
+			req.Header.Set("x-vercel-signature", signature)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		var out map[string]string
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return resp, out
+	}
+
+	// 1. The browser asks for a client token.
+	resp, out := post([]byte(`{"type":"blob.generate-client-token","payload":{"pathname":"avatar.png","callbackUrl":"https://example.com/api/upload","clientPayload":"42","multipart":false}}`), "")
+	if resp.StatusCode != http.StatusOK || out["type"] != "blob.generate-client-token" {
+		t.Fatalf("Unexpected token response %d: %v", resp.StatusCode, out)
+	}
+	options, err := VerifyClientToken(testReadWriteToken, out["clientToken"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.Pathname != "avatar.png" || options.AllowedContentTypes[0] != "image/png" {
+		t.Errorf("Unexpected token options: %+v", options)
+	}
+	if options.OnUploadCompleted == nil || options.OnUploadCompleted.CallbackURL != "https://example.com/api/upload" || options.OnUploadCompleted.TokenPayload != "user-42" {
+		t.Errorf("Unexpected upload-completed callback: %+v", options.OnUploadCompleted)
+	}
+
+	// 2. Vercel calls back once the upload has completed.
+	body := []byte(`{"type":"blob.upload-completed","payload":{"blob":{"url":"https://blob.com/avatar.png","pathname":"avatar.png"},"tokenPayload":"user-42"}}`)
+	h := hmac.New(sha256.New, []byte(testReadWriteToken))
+	h.Write(body)
+	resp, out = post(body, hex.EncodeToString(h.Sum(nil)))
+	if resp.StatusCode != http.StatusOK || out["response"] != "ok" {
+		t.Fatalf("Unexpected webhook response %d: %v", resp.StatusCode, out)
+	}
+	if completed.Pathname != "avatar.png" || completedPayload != "user-42" {
+		t.Errorf("Unexpected completion: %+v, %s", completed, completedPayload)
+	}
+
+	// Spoofed webhooks and rejected uploads fail.
+	if resp, _ = post(body, "deadbeef"); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a bad signature, got %d", resp.StatusCode)
+	}
+	if resp, _ = post(body, ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a missing signature, got %d", resp.StatusCode)
+	}
+	resp, out = post([]byte(`{"type":"blob.generate-client-token","payload":{"pathname":"forbidden.txt"}}`), "")
+	if resp.StatusCode != http.StatusBadRequest || out["error"] != "not allowed" {
+		t.Errorf("Expected 400 not allowed, got %d: %v", resp.StatusCode, out)
+	}
+	if resp, _ = post([]byte(`{"type":"unknown"}`), ""); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown event, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,121 @@
+package vercelblob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_UploadWithClientToken_Mock(t *testing.T) {
+	clientToken, _ := GenerateUploadToken(testReadWriteToken, "uploads/a.png", UploadConstraints{
+		MaximumSizeInBytes:  MultipartThreshold * 2,
+		AllowedContentTypes: []string{"image/*"},
+	})
+
+	var actions []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+clientToken {
+			t.Errorf("Expected the client token, got %s", r.Header.Get("Authorization"))
+		}
+		_, _ = io.Copy(io.Discard, r.Body)
+		actions = append(actions, r.Header.Get("X-MPU-Action"))
+		_, _ = w.Write([]byte(`{"url":"https://blob.com/uploads/a.png","pathname":"uploads/a.png","uploadId":"id","key":"key"}`))
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider(testReadWriteToken)))
+	ctx := context.Background()
+
+	result, err := client.UploadWithClientToken(ctx, clientToken, "uploads/a.png", strings.NewReader("png"), PutCommandOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Pathname != "uploads/a.png" {
+		t.Errorf("Expected uploads/a.png, got %s", result.Pathname)
+	}
+
+	actions = nil
+	large := bytes.NewReader(make([]byte, MultipartThreshold+1))
+	if _, err := client.UploadWithClientToken(ctx, clientToken, "uploads/a.png", large, PutCommandOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(actions, ",") != "create,upload,upload,complete" {
+		t.Errorf("Expected a multipart upload, got %v", actions)
+	}
+}
+
+func Test_UploadWithClientToken_Constraints(t *testing.T) {
+	clientToken, _ := GenerateUploadToken(testReadWriteToken, "uploads/a.png", UploadConstraints{
+		MaximumSizeInBytes:  4,
+		AllowedContentTypes: []string{"image/png"},
+	})
+	expired, _ := GenerateUploadToken(testReadWriteToken, "uploads/a.png", UploadConstraints{ExpiresAt: time.Now().Add(-time.Hour)})
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = io.Copy(io.Discard, r.Body)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	client := newTestClient(t, WithBaseURL(server.URL), WithTokenProvider(StaticTokenProvider(testReadWriteToken)))
+
+	tests := []struct {
+		name        string
+		token       string
+		pathname    string
+		contentType string
+		body        io.Reader
+		wantErr     error
+	}{
+		{name: "expired", token: expired, pathname: "uploads/a.png", body: strings.NewReader("png"), wantErr: ErrClientTokenExpired},
+		{name: "other pathname", token: clientToken, pathname: "uploads/b.png", body: strings.NewReader("png"), wantErr: ErrUploadNotAllowed},
+		{name: "content type", token: clientToken, pathname: "uploads/a.png", contentType: "text/plain", body: strings.NewReader("png"), wantErr: ErrUploadNotAllowed},
+		{name: "too large", token: clientToken, pathname: "uploads/a.png", body: strings.NewReader("too large"), wantErr: ErrUploadNotAllowed},
+		{name: "malformed", token: "garbage", pathname: "uploads/a.png", body: strings.NewReader("png"), wantErr: ErrMalformedClientToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.UploadWithClientToken(context.Background(), tt.token, tt.pathname, tt.body, PutCommandOptions{ContentType: tt.contentType})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+	if requests != 0 {
+		t.Errorf("Expected no requests, got %d", requests)
+	}
+
+	// A body of unknown size is cut off while it is sent.
+	_, err := client.UploadWithClientToken(context.Background(), clientToken, "uploads/a.png", io.MultiReader(strings.NewReader("too large")), PutCommandOptions{})
+	if !errors.Is(err, ErrUploadNotAllowed) {
+		t.Errorf("Expected ErrUploadNotAllowed, got %v", err)
+	}
+}
+
+func Test_contentTypeAllowed(t *testing.T) {
+	tests := []struct {
+		contentType string
+		allowed     []string
+		want        bool
+	}{
+		{"image/png", nil, true},
+		{"image/png", []string{"image/png"}, true},
+		{"image/png; charset=binary", []string{"image/*"}, true},
+		{"IMAGE/PNG", []string{"image/png"}, true},
+		{"text/plain", []string{"image/*"}, false},
+		{"", []string{"*/*"}, true},
+		{"", []string{"image/png"}, false},
+	}
+	for _, tt := range tests {
+		if got := contentTypeAllowed(tt.contentType, tt.allowed); got != tt.want {
+			t.Errorf("Expected %v for %q in %v, got %v", tt.want, tt.contentType, tt.allowed, got)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package vercelblob
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// maxListLimit is the largest page size the API accepts.
+const maxListLimit = 1000
+
+// FieldError describes a field of an options struct with an invalid value.
+// It unwraps to an invalid_input *Error.
+type FieldError struct {
+	Field string
+	// Constraint is the rule the value breaks, e.g. "must be at most 1000".
+	Constraint string
+	Value      any
+}
+
+func (e *FieldError) Error() string {
+	if value, ok := e.Value.(string); ok {
+		return fmt.Sprintf("%s %s, got %q", e.Field, e.Constraint, value)
+	}
+	return fmt.Sprintf("%s %s, got %+v", e.Field, e.Constraint, e.Value)
+}
+
+// Unwrap returns an invalid_input *Error describing the problem.
+func (e *FieldError) Unwrap() error {
+	return &Error{Msg: e.Error(), Code: "invalid_input"}
+}
+
+// ValidationError is returned by the Validate methods of the options structs
+// and by the operations taking them. It lists every invalid field, in the
+// order of the fields of the struct, and unwraps to their *FieldErrors.
+type ValidationError struct {
+	// Options is the name of the options struct, e.g. "PutCommandOptions".
+	Options  string
+	Problems []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	problems := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		problems[i] = problem.Error()
+	}
+	return fmt.Sprintf("invalid %s: %s", e.Options, strings.Join(problems, "; "))
+}
+
+// Unwrap returns the *FieldErrors of the problems.
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, len(e.Problems))
+	for i, problem := range e.Problems {
+		errs[i] = problem
+	}
+	return errs
+}
+
+// validator collects the problems of an options struct.
+type validator struct {
+	options  string
+	problems []*FieldError
+}
+
+// check records a problem with field unless ok.
+func (v *validator) check(ok bool, field, constraint string, value any) {
+	if !ok {
+		v.problems = append(v.problems, &FieldError{Field: field, Constraint: constraint, Value: value})
+	}
+}
+
+func (v *validator) checkAccess(access string) {
+	v.check(access == "" || access == "public" || access == "private", "Access", `must be "public" or "private"`, access)
+}
+
+func (v *validator) checkContentType(field, contentType string) {
+	_, _, err := mime.ParseMediaType(contentType)
+	v.check(contentType == "" || err == nil, field, "must be a media type", contentType)
+}
+
+// err returns a *ValidationError for the problems, or nil if there are none.
+func (v *validator) err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Options: v.options, Problems: v.problems}
+}
+
+// Validate reports every invalid field of the options as a *ValidationError.
+func (o ListCommandOptions) Validate() error {
+	v := validator{options: "ListCommandOptions"}
+	v.check(o.Limit <= maxListLimit, "Limit", fmt.Sprintf("must be at most %d", maxListLimit), o.Limit)
+	v.check(o.Mode == "" || o.Mode == "expanded" || o.Mode == "folded", "Mode", `must be "expanded" or "folded"`, o.Mode)
+	return v.err()
+}
+
+// Validate reports every invalid field of the options as a *ValidationError.
+func (o PutCommandOptions) Validate() error {
+	v := validator{options: "PutCommandOptions"}
+	v.checkContentType("ContentType", o.ContentType)
+	v.checkAccess(o.Access)
+	return v.err()
+}
+
+// Validate reports every invalid field of the options as a *ValidationError.
+func (o CopyCommandOptions) Validate() error {
+	v := validator{options: "CopyCommandOptions"}
+	v.checkAccess(o.Access)
+	if o.ContentTypeOverride != nil {
+		v.checkContentType("ContentTypeOverride", *o.ContentTypeOverride)
+	}
+	return v.err()
+}
+
+// Validate reports every invalid field of the options as a *ValidationError.
+func (o DownloadCommandOptions) Validate() error {
+	v := validator{options: "DownloadCommandOptions"}
+	if o.ByteRange != nil {
+		v.check(o.ByteRange.End >= o.ByteRange.Start, "ByteRange", "must not end before it starts", *o.ByteRange)
+	}
+	return v.err()
+}
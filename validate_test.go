@@ -0,0 +1,70 @@
+package vercelblob
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func Test_Options_Validate(t *testing.T) {
+	contentType := "not a type"
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"list", ListCommandOptions{Limit: 5000, Mode: "flat"}.Validate(),
+			`invalid ListCommandOptions: Limit must be at most 1000, got 5000; Mode must be "expanded" or "folded", got "flat"`},
+		{"put", PutCommandOptions{ContentType: "text/", Access: "secret"}.Validate(),
+			`invalid PutCommandOptions: ContentType must be a media type, got "text/"; Access must be "public" or "private", got "secret"`},
+		{"copy", CopyCommandOptions{Access: "secret", ContentTypeOverride: &contentType}.Validate(),
+			`invalid CopyCommandOptions: Access must be "public" or "private", got "secret"; ContentTypeOverride must be a media type, got "not a type"`},
+		{"download", DownloadCommandOptions{ByteRange: &Range{Start: 10, End: 5}}.Validate(),
+			`invalid DownloadCommandOptions: ByteRange must not end before it starts, got {Start:10 End:5}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.err == nil || tt.err.Error() != tt.want {
+				t.Fatalf("Expected %q, got %v", tt.want, tt.err)
+			}
+			var validationErr *ValidationError
+			if !errors.As(tt.err, &validationErr) || len(validationErr.Problems) != strings.Count(tt.want, ";")+1 {
+				t.Errorf("Expected every problem to be reported, got %v", tt.err)
+			}
+			var fieldErr *FieldError
+			if !errors.As(tt.err, &fieldErr) || fieldErr != validationErr.Problems[0] {
+				t.Errorf("Expected the first *FieldError, got %v", fieldErr)
+			}
+			if CodeOf(tt.err) != "invalid_input" || !errors.Is(tt.err, &Error{Code: "invalid_input"}) {
+				t.Errorf("Expected an invalid_input error, got %v", tt.err)
+			}
+		})
+	}
+
+	for _, err := range []error{
+		ListCommandOptions{Limit: 1000, Mode: "folded"}.Validate(),
+		PutCommandOptions{ContentType: "text/plain; charset=utf-8", Access: "public"}.Validate(),
+		CopyCommandOptions{}.Validate(),
+		DownloadCommandOptions{ByteRange: &Range{Start: 5, End: 5}}.Validate(),
+	} {
+		if err != nil {
+			t.Errorf("Expected valid options, got %v", err)
+		}
+	}
+}
+
+func Test_Options_Validate_BeforeRequest(t *testing.T) {
+	client := newTestClient(t, WithBaseURL("http://127.0.0.1:0"), WithTokenProvider(StaticTokenProvider("token")))
+	ctx := t.Context()
+
+	_, listErr := client.List(ctx, ListCommandOptions{Mode: "flat"})
+	_, putErr := client.Put(ctx, "a.txt", strings.NewReader("a"), PutCommandOptions{Access: "secret"})
+	_, copyErr := client.CopyWithOptions(ctx, "https://blob.com/a.txt", "b.txt", CopyCommandOptions{Access: "secret"})
+	_, downloadErr := client.Download(ctx, "https://blob.com/a.txt", DownloadCommandOptions{ByteRange: &Range{Start: 2, End: 1}})
+	for _, err := range []error{listErr, putErr, copyErr, downloadErr} {
+		var validationErr *ValidationError
+		if !errors.As(err, &validationErr) {
+			t.Errorf("Expected a *ValidationError before any request, got %v", err)
+		}
+	}
+}
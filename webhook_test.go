@@ -0,0 +1,128 @@
+package vercelblob
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testWebhookSecret = "whsec_test"
+	testWebhookBody   = `{"type":"blob.upload-completed","payload":{"blob":{"url":"https://blob.com/a.txt","pathname":"a.txt"},"tokenPayload":"x"}}`
+)
+
+func signWebhook(timestamp, body string) string {
+	h := hmac.New(sha256.New, []byte(testWebhookSecret))
+	if timestamp != "" {
+		h.Write([]byte(timestamp + "."))
+	}
+	h.Write([]byte(body))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func Test_VerifyWebhookSignatureBody_Golden(t *testing.T) {
+	header := http.Header{}
+	header.Set("x-vercel-signature", "8b5e27cfb121847e647f232df93d11c0cc5743d11243c21dd00b89d530f8184e")
+	if err := VerifyWebhookSignatureBody(testWebhookSecret, []byte(testWebhookBody), header); err != nil {
+		t.Errorf("Expected the golden signature to verify, got %v", err)
+	}
+
+	header.Set("x-vercel-signature", "12dbc5dfd77999ff57fa3a4740207a24421537a089e966efb82d2d984523688d")
+	header.Set("x-relay-timestamp", "1700000000")
+	clock := newFakeClock(time.Unix(1700000000, 0))
+	options := WebhookVerifyOptions{TimestampHeader: "x-relay-timestamp", Now: clock.Now}
+	if err := VerifyWebhookSignatureBodyWithOptions(testWebhookSecret, []byte(testWebhookBody), header, options); err != nil {
+		t.Errorf("Expected the golden timestamped signature to verify, got %v", err)
+	}
+	clock.Advance(time.Hour)
+	if err := VerifyWebhookSignatureBodyWithOptions(testWebhookSecret, []byte(testWebhookBody), header, options); !errors.Is(err, ErrWebhookTimestampStale) {
+		t.Errorf("Expected the golden timestamped signature to be stale an hour later, got %v", err)
+	}
+}
+
+func Test_VerifyWebhookSignatureBody(t *testing.T) {
+	tests := []struct {
+		name      string
+		signature string
+		wantErr   error
+	}{
+		{name: "body only", signature: signWebhook("", testWebhookBody)},
+		{name: "missing signature", wantErr: ErrWebhookSignatureMissing},
+		{name: "bad signature", signature: signWebhook("", "tampered"), wantErr: ErrWebhookSignatureInvalid},
+		{name: "timestamped signature", signature: signWebhook("1700000000", testWebhookBody), wantErr: ErrWebhookSignatureInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.signature != "" {
+				header.Set("x-vercel-signature", tt.signature)
+			}
+			err := VerifyWebhookSignatureBody(testWebhookSecret, []byte(testWebhookBody), header)
+			if tt.wantErr == nil && err != nil || !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_VerifyWebhookSignatureBodyWithOptions(t *testing.T) {
+	clock := newFakeClock(time.Unix(1700000000, 0))
+	now := strconv.FormatInt(clock.Now().Unix(), 10)
+	old := strconv.FormatInt(clock.Now().Add(-time.Hour).Unix(), 10)
+	options := WebhookVerifyOptions{TimestampHeader: "x-relay-timestamp", Now: clock.Now}
+
+	tests := []struct {
+		name      string
+		signature string
+		timestamp string
+		wantErr   error
+	}{
+		{name: "fresh timestamp", signature: signWebhook(now, testWebhookBody), timestamp: now},
+		{name: "missing timestamp", signature: signWebhook("", testWebhookBody), wantErr: ErrWebhookTimestampMissing},
+		{name: "stripped timestamp", signature: signWebhook(now, testWebhookBody), wantErr: ErrWebhookTimestampMissing},
+		{name: "missing signature", timestamp: now, wantErr: ErrWebhookSignatureMissing},
+		{name: "replayed timestamp", signature: signWebhook(old, testWebhookBody), timestamp: old, wantErr: ErrWebhookTimestampStale},
+		{name: "forged timestamp", signature: signWebhook(old, testWebhookBody), timestamp: now, wantErr: ErrWebhookSignatureInvalid},
+		{name: "malformed timestamp", signature: signWebhook("soon", testWebhookBody), timestamp: "soon", wantErr: ErrWebhookSignatureInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.signature != "" {
+				header.Set("x-vercel-signature", tt.signature)
+			}
+			if tt.timestamp != "" {
+				header.Set("x-relay-timestamp", tt.timestamp)
+			}
+			err := VerifyWebhookSignatureBodyWithOptions(testWebhookSecret, []byte(testWebhookBody), header, options)
+			if tt.wantErr == nil && err != nil || !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_VerifyWebhookSignature_Request(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/api/upload", strings.NewReader(testWebhookBody))
+	r.Header.Set("x-vercel-signature", signWebhook("", testWebhookBody))
+
+	payload, err := VerifyWebhookSignature(testWebhookSecret, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(payload) != testWebhookBody {
+		t.Errorf("Expected the request body, got %s", payload)
+	}
+	rest, _ := io.ReadAll(r.Body)
+	if string(rest) != testWebhookBody {
+		t.Errorf("Expected the body to remain readable, got %s", rest)
+	}
+}